@@ -4,6 +4,8 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -29,6 +31,10 @@ func main() {
 
 	// ─── Config ──────────────────────────────────────────────────────────
 	cfg := config.Load()
+	if err := cfg.ValidateJWT(); err != nil {
+		slog.Error("Invalid JWT configuration", "error", err)
+		os.Exit(1)
+	}
 
 	// ─── Database ────────────────────────────────────────────────────────
 	if err := database.Connect(cfg); err != nil {
@@ -43,6 +49,11 @@ func main() {
 
 	db := database.DB
 
+	if err := handlers.RegisterAuditHooks(db); err != nil {
+		slog.Error("Failed to register audit hooks", "error", err)
+		os.Exit(1)
+	}
+
 	// ─── Encryption ─────────────────────────────────────────────────────
 	var encryptor *crypto.Encryptor
 	if cfg.SSHEncryptionKey != "" {
@@ -60,41 +71,138 @@ func main() {
 	}
 
 	// ─── SSH Pool ───────────────────────────────────────────────────────
+	services.SetKeyFileDir(cfg.SSHKeyDir)
+	if err := services.SetSSHTuning(services.SSHTuning{
+		Ciphers:      services.ParseAlgorithmList(cfg.SSHCiphers),
+		KeyExchanges: services.ParseAlgorithmList(cfg.SSHKeyExchanges),
+		MACs:         services.ParseAlgorithmList(cfg.SSHMACs),
+		Compression:  cfg.SSHCompression,
+	}); err != nil {
+		slog.Error("Invalid SSH configuration", "error", err)
+		os.Exit(1)
+	}
 	sshPool := services.NewSSHPool()
+	sshPool.SetHostKeyStore(services.NewHostKeyStore(db))
+	sshPool.SetJumpHostResolver(services.NewJumpHostResolver(db, encryptor))
+
+	// ─── Event Bus ──────────────────────────────────────────────────────
+	eventBus := services.NewEventBus()
+
+	// ─── Metrics Sink ───────────────────────────────────────────────────
+	var metricsSink *services.MetricsSink
+	if cfg.MetricsSinkType != "" {
+		s, err := services.NewMetricsSink(cfg.MetricsSinkType, cfg.MetricsSinkURL, cfg.MetricsSinkToken)
+		if err != nil {
+			slog.Error("Metrics sink disabled", "error", err)
+		} else {
+			metricsSink = s
+			metricsSink.Start()
+		}
+	}
 
 	// ─── Metrics Collector ──────────────────────────────────────────────
-	metricsCollector := services.NewMetricsCollector(db, sshPool, encryptor, cfg.MetricsCollectInterval)
-	metricsCollector.Start()
+	metricsCollector := services.NewMetricsCollector(db, sshPool, encryptor, cfg.MetricsCollectInterval,
+		cfg.MetricsOfflineAfter, cfg.MetricsOnlineAfter, eventBus, metricsSink)
 
 	// ─── Monitor Checker ────────────────────────────────────────────────
-	monitorChecker := services.NewMonitorChecker(db)
+	monitorChecker := services.NewMonitorChecker(db, eventBus)
 	monitorChecker.Start()
 
+	// ─── Alert Notifications ────────────────────────────────────────────
+	alertNotifier := services.NewAlertNotifier()
+	if cfg.AlertWebhookURL != "" {
+		if n, err := services.NewWebhookNotifier(cfg.AlertWebhookURL, cfg.AlertWebhookFormat); err != nil {
+			slog.Error("Alert webhook disabled", "error", err)
+		} else {
+			alertNotifier.Register("webhook", n)
+		}
+	}
+	if cfg.SMTPHost != "" {
+		var to []string
+		for _, addr := range strings.Split(cfg.AlertEmailTo, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				to = append(to, addr)
+			}
+		}
+		n, err := services.NewEmailNotifier(services.SMTPSettings{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		}, to)
+		if err != nil {
+			slog.Error("Alert email disabled", "error", err)
+		} else {
+			alertNotifier.Register("email", n)
+		}
+	}
+
+	metricsCollector.SetNotifier(alertNotifier)
+	metricsCollector.Start()
+
+	// ─── Alert Evaluator ────────────────────────────────────────────────
+	alertEvaluator := services.NewAlertEvaluator(db, eventBus, alertNotifier, cfg.AlertEvalInterval)
+	alertEvaluator.Start()
+
+	// ─── SSL Checker ────────────────────────────────────────────────────
+	sslChecker := services.NewSSLChecker(db, eventBus, alertNotifier, cfg.SSLCheckInterval, cfg.SSLWarnDays, cfg.SSLCriticalDays)
+	sslChecker.Start()
+
+	// ─── Retention ──────────────────────────────────────────────────────
+	retentionService := services.NewRetentionService(db, cfg.MetricsRetentionDays, cfg.MonitorPingRetentionDays)
+	retentionService.Start()
+
+	// ─── Audit Forwarder ────────────────────────────────────────────────
+	var auditForwarder *services.AuditForwarder
+	if cfg.AuditForwardType != "" {
+		f, err := services.NewAuditForwarder(cfg.AuditForwardType, cfg.AuditForwardTarget, cfg.AuditForwardToken)
+		if err != nil {
+			slog.Error("Audit forwarding disabled", "error", err)
+		} else {
+			auditForwarder = f
+			auditForwarder.Start()
+			if err := handlers.RegisterAuditForwarder(db, auditForwarder); err != nil {
+				slog.Error("Failed to register audit forwarder", "error", err)
+			}
+		}
+	}
+
 	// ─── Handlers ───────────────────────────────────────────────────────
-	authHandler := handlers.NewAuthHandler(cfg)
+	authHandler := handlers.NewAuthHandler(cfg, db, auditForwarder)
 	serverHandler := handlers.NewServerHandler(db, encryptor, sshPool)
-	terminalHandler := handlers.NewTerminalHandler(serverHandler)
-	commandHandler := handlers.NewCommandHandler(serverHandler)
+	terminalHandler := handlers.NewTerminalHandler(serverHandler, cfg)
+	commandHandler := handlers.NewCommandHandler(serverHandler, cfg.ExecTimeout)
 	cronHandler := handlers.NewCronHandler(db, serverHandler)
-	coolifyHandler := handlers.NewCoolifyHandler(cfg)
+	coolifyHandler := handlers.NewCoolifyHandler(cfg, db)
 	opsHandler := handlers.NewOpsHandler(cfg)
 	aiHandler := handlers.NewAIHandler(cfg, db, serverHandler)
 	systemHandler := handlers.NewSystemHandler(db, cfg)
-	processHandler := handlers.NewProcessHandler(serverHandler)
-	dockerHandler := handlers.NewDockerHandler(serverHandler)
-	monitorHandler := handlers.NewMonitorHandler(db)
+	if err := systemHandler.RegisterCacheHooks(db); err != nil {
+		slog.Error("Failed to register dashboard cache hooks", "error", err)
+		os.Exit(1)
+	}
+	processHandler := handlers.NewProcessHandler(serverHandler, cfg.ExecTimeout)
+	dockerHandler := handlers.NewDockerHandler(serverHandler, cfg.ExecTimeout)
+	monitorHandler := handlers.NewMonitorHandler(db, monitorChecker, sslChecker)
 	alertHandler := handlers.NewAlertHandler(db)
-	databaseHandler := handlers.NewDatabaseHandler(db)
-	fileHandler := handlers.NewFileHandler(serverHandler)
+	databaseHandler := handlers.NewDatabaseHandler(db, cfg.DBQueryTimeout, cfg.DBQueryMaxRows)
+	fileHandler := handlers.NewFileHandler(serverHandler, cfg.FileUploadMaxMB)
 	auditHandler := handlers.NewAuditHandler(db)
 	configHandler := handlers.NewRemoteConfigHandler(db)
+	credentialHandler := handlers.NewCredentialHandler(db, authHandler, serverHandler)
+	streamHandler := handlers.NewStreamHandler(eventBus)
+	secretHandler := handlers.NewSecretHandler(serverHandler)
+	dbConnectionHandler := handlers.NewDBConnectionHandler(serverHandler)
+	shareHandler := handlers.NewShareHandler(serverHandler, handlers.TokenSettingsFromConfig(cfg))
+	telemetryHandler := handlers.NewTelemetryHandler(db, cfg)
 	configHandler.SeedDefaults()
 
 	// ─── Fiber App ──────────────────────────────────────────────────────
 	app := fiber.New(fiber.Config{
 		AppName:      "bastion v" + handlers.Version,
 		ServerHeader: "bastion",
-		BodyLimit:    10 * 1024 * 1024, // 10MB for log uploads
+		BodyLimit:    (max(10, cfg.FileUploadMaxMB) + 1) * 1024 * 1024, // log and file uploads, plus multipart overhead
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			message := "Internal server error"
@@ -127,10 +235,20 @@ func main() {
 		return c.Next()
 	})
 
-	// Request logger
+	// Request logger. Requests are counted by route pattern, not raw path,
+	// so IDs in URLs don't multiply the series.
+	httpRequests := services.DefaultTelemetry.Counter("bastion_http_requests_total",
+		"HTTP requests served, by method, route and status.", "method", "path", "status")
 	app.Use(func(c *fiber.Ctx) error {
 		start := time.Now()
 		err := c.Next()
+		status := c.Response().StatusCode()
+		if fe, ok := err.(*fiber.Error); ok {
+			status = fe.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		httpRequests.Inc(c.Method(), c.Route().Path, strconv.Itoa(status))
 		if c.Path() == "/api/health" {
 			return err
 		}
@@ -148,7 +266,8 @@ func main() {
 	routes.Setup(app, cfg, authHandler, serverHandler, terminalHandler, commandHandler,
 		cronHandler, coolifyHandler, opsHandler, aiHandler, systemHandler,
 		processHandler, dockerHandler, monitorHandler, alertHandler, databaseHandler,
-		fileHandler, auditHandler, configHandler)
+		fileHandler, auditHandler, configHandler, credentialHandler,
+		streamHandler, secretHandler, dbConnectionHandler, shareHandler, telemetryHandler)
 
 	// ─── Graceful Shutdown ──────────────────────────────────────────────
 	quit := make(chan os.Signal, 1)
@@ -158,9 +277,18 @@ func main() {
 		<-quit
 		slog.Info("Shutting down Bastion...")
 
+		retentionService.Stop()
+		sslChecker.Stop()
+		alertEvaluator.Stop()
 		monitorChecker.Stop()
 		metricsCollector.Stop()
+		if metricsSink != nil {
+			metricsSink.Stop()
+		}
 		sshPool.CloseAll()
+		if auditForwarder != nil {
+			auditForwarder.Stop()
+		}
 
 		if err := app.Shutdown(); err != nil {
 			slog.Error("Fiber shutdown error", "error", err)
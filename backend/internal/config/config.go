@@ -1,10 +1,21 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"time"
 )
 
+// Bounds for JWT lifetimes and the HMAC algorithms tokens may be signed with.
+const (
+	minAccessTTL  = time.Minute
+	maxAccessTTL  = 24 * time.Hour
+	maxRefreshTTL = 90 * 24 * time.Hour
+)
+
+var jwtAlgorithms = map[string]bool{"HS256": true, "HS384": true, "HS512": true}
+
 type Config struct {
 	// Server
 	Port string
@@ -17,15 +28,31 @@ type Config struct {
 	DBName     string
 	DBSSLMode  string
 
-	// Auth (single user)
+	// SQL console limits: statement timeout and rows returned per query
+	DBQueryTimeout time.Duration
+	DBQueryMaxRows int
+
+	// SSH commands run through the API are stopped after this long unless
+	// the request sets its own timeout; 0 disables
+	ExecTimeout time.Duration
+
+	// Auth: the ADMIN_* user is seeded on first boot
 	AdminUsername    string
-	AdminPassword   string // bcrypt hash stored, plaintext in env for initial setup
+	AdminPassword    string // bcrypt hash stored, plaintext in env for initial setup
 	AdminDisplayName string
-	AdminRole       string
-	JWTSecret       string
+	AdminRole        string
+	JWTSecret        string
+	JWTAlgorithm     string        // HS256, HS384 or HS512
+	JWTAccessTTL     time.Duration // access token lifetime
+	JWTRefreshTTL    time.Duration // refresh token lifetime
 
 	// SSH Encryption
 	SSHEncryptionKey string // 32-byte hex for AES-256-GCM
+	SSHKeyDir        string // directory key_file paths must live in (empty = keyfile auth disabled)
+	SSHCiphers       string // comma-separated preferred ciphers (empty = library defaults)
+	SSHKeyExchanges  string // comma-separated preferred key exchanges
+	SSHMACs          string // comma-separated preferred MACs
+	SSHCompression   bool
 
 	// Coolify
 	CoolifyAPIURL   string
@@ -40,41 +67,179 @@ type Config struct {
 	GLMAPIURL string
 	GLMModel  string
 
+	// AIDefaultServer is the server ID or name AI actions target when neither
+	// the conversation nor the request names one.
+	AIDefaultServer string
+
+	// AI tool execution limits: concurrent calls and calls allowed to queue
+	AIToolConcurrency int
+	AIToolQueue       int
+
 	// Web Search
 	TavilyAPIKey string
 	SerperAPIKey string
 
+	// Audit forwarding (optional)
+	AuditForwardType   string // syslog, http, file; empty disables
+	AuditForwardTarget string // syslog address, URL or file path
+	AuditForwardToken  string // bearer token for http
+
 	// Metrics
 	MetricsCollectInterval int // seconds
+	MetricsOfflineAfter    int // consecutive failed collections before a server is marked offline
+	MetricsOnlineAfter     int // consecutive successful collections before an offline server is marked online
+	AlertEvalInterval      int // seconds between alert rule evaluations
+
+	// Alert notifications (optional): rules pick "webhook" or "email"
+	AlertWebhookURL    string
+	AlertWebhookFormat string // json or slack
+	AlertEmailTo       string // comma-separated recipients
+	SMTPHost           string
+	SMTPPort           int
+	SMTPUsername       string
+	SMTPPassword       string
+	SMTPFrom           string
+
+	// SSL certificate expiry checks
+	SSLCheckInterval int // seconds between re-checks of tracked certificates
+	SSLWarnDays      int // days remaining below which a warning alert opens
+	SSLCriticalDays  int // days remaining below which the alert turns critical
+
+	// Metrics sink (optional)
+	MetricsSinkType  string // influxdb or prometheus; empty disables
+	MetricsSinkURL   string // write endpoint
+	MetricsSinkToken string // influxdb token or remote-write bearer token
+
+	// Bearer token required to scrape /metrics; empty leaves it open
+	MetricsToken string
+
+	// Retention: days of history kept; 0 keeps rows forever
+	MetricsRetentionDays     int
+	MonitorPingRetentionDays int
+
+	// File uploads
+	FileUploadMaxMB int // largest file accepted by the SFTP upload endpoint
+
+	// Terminal recording: record all sessions, or only servers with
+	// record_terminal set; recordings stop growing at the size cap
+	TerminalRecording      bool
+	TerminalRecordingMaxMB int
+
+	// Terminal sessions close after this long without input, or this long
+	// in total; 0 disables either
+	TerminalIdleTimeout time.Duration
+	TerminalMaxDuration time.Duration
+
+	// Dashboard
+	DashboardCacheTTL int // seconds the overview and status page are cached; 0 disables
 }
 
 func Load() *Config {
 	metricsInterval, _ := strconv.Atoi(getEnv("METRICS_COLLECT_INTERVAL", "60"))
+	offlineAfter, _ := strconv.Atoi(getEnv("METRICS_OFFLINE_AFTER", "3"))
+	onlineAfter, _ := strconv.Atoi(getEnv("METRICS_ONLINE_AFTER", "2"))
+	alertEvalInterval, _ := strconv.Atoi(getEnv("ALERT_EVAL_INTERVAL", "30"))
+	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	sslCheckInterval, _ := strconv.Atoi(getEnv("SSL_CHECK_INTERVAL", "21600"))
+	sslWarnDays, _ := strconv.Atoi(getEnv("SSL_WARN_DAYS", "14"))
+	sslCriticalDays, _ := strconv.Atoi(getEnv("SSL_CRITICAL_DAYS", "3"))
+	dashboardCacheTTL, _ := strconv.Atoi(getEnv("DASHBOARD_CACHE_TTL", "5"))
+	aiToolConcurrency, _ := strconv.Atoi(getEnv("AI_TOOL_CONCURRENCY", "4"))
+	aiToolQueue, _ := strconv.Atoi(getEnv("AI_TOOL_QUEUE", "8"))
+	metricsRetentionDays, _ := strconv.Atoi(getEnv("METRICS_RETENTION_DAYS", "30"))
+	pingRetentionDays, _ := strconv.Atoi(getEnv("MONITOR_PING_RETENTION_DAYS", "30"))
+	fileUploadMaxMB, _ := strconv.Atoi(getEnv("FILE_UPLOAD_MAX_MB", "100"))
+	recordingMaxMB, _ := strconv.Atoi(getEnv("TERMINAL_RECORDING_MAX_MB", "10"))
+	terminalIdleTimeout, _ := time.ParseDuration(getEnv("TERMINAL_IDLE_TIMEOUT", "30m"))
+	terminalMaxDuration, _ := time.ParseDuration(getEnv("TERMINAL_MAX_DURATION", "12h"))
+	accessTTL, _ := time.ParseDuration(getEnv("JWT_ACCESS_TTL", "15m"))
+	refreshTTL, _ := time.ParseDuration(getEnv("JWT_REFRESH_TTL", "168h"))
+	dbQueryTimeout, _ := time.ParseDuration(getEnv("DB_QUERY_TIMEOUT", "30s"))
+	execTimeout, _ := time.ParseDuration(getEnv("EXEC_TIMEOUT", "5m"))
+	dbQueryMaxRows, _ := strconv.Atoi(getEnv("DB_QUERY_MAX_ROWS", "1000"))
 	return &Config{
-		Port:                   getEnv("PORT", "8097"),
-		DBHost:                 getEnv("DB_HOST", "localhost"),
-		DBPort:                 getEnv("DB_PORT", "5432"),
-		DBUser:                 getEnv("DB_USER", "postgres"),
-		DBPassword:             getEnv("DB_PASSWORD", ""),
-		DBName:                 getEnv("DB_NAME", "bastion_db"),
-		DBSSLMode:              getEnv("DB_SSLMODE", "disable"),
-		AdminUsername:          getEnv("ADMIN_USERNAME", "ahmet"),
-		AdminPassword:          getEnv("ADMIN_PASSWORD", ""),
-		AdminDisplayName:       getEnv("ADMIN_DISPLAY_NAME", "Ahmet"),
-		AdminRole:              getEnv("ADMIN_ROLE", "admin"),
-		JWTSecret:              getEnv("JWT_SECRET", ""),
-		SSHEncryptionKey:       getEnv("SSH_ENCRYPTION_KEY", ""),
-		CoolifyAPIURL:         getEnv("COOLIFY_API_URL", "http://89.47.113.196:8000"),
-		CoolifyAPIToken:       getEnv("COOLIFY_API_TOKEN", ""),
-		OpsBackendURL:         getEnv("OPS_BACKEND_URL", "http://89.47.113.196:8095"),
-		OpsAdminToken:         getEnv("OPS_ADMIN_TOKEN", ""),
-		GLMAPIKey:             getEnv("GLM_API_KEY", ""),
-		GLMAPIURL:             getEnv("GLM_API_URL", "https://api.z.ai/api/paas/v4/chat/completions"),
-		GLMModel:              getEnv("GLM_MODEL", "glm-5"),
-		TavilyAPIKey:          getEnv("TAVILY_API_KEY", ""),
-		SerperAPIKey:          getEnv("SERPER_API_KEY", ""),
-		MetricsCollectInterval: metricsInterval,
+		Port:                     getEnv("PORT", "8097"),
+		DBHost:                   getEnv("DB_HOST", "localhost"),
+		DBPort:                   getEnv("DB_PORT", "5432"),
+		DBUser:                   getEnv("DB_USER", "postgres"),
+		DBPassword:               getEnv("DB_PASSWORD", ""),
+		DBName:                   getEnv("DB_NAME", "bastion_db"),
+		DBSSLMode:                getEnv("DB_SSLMODE", "disable"),
+		DBQueryTimeout:           dbQueryTimeout,
+		ExecTimeout:              execTimeout,
+		DBQueryMaxRows:           dbQueryMaxRows,
+		AdminUsername:            getEnv("ADMIN_USERNAME", "ahmet"),
+		AdminPassword:            getEnv("ADMIN_PASSWORD", ""),
+		AdminDisplayName:         getEnv("ADMIN_DISPLAY_NAME", "Ahmet"),
+		AdminRole:                getEnv("ADMIN_ROLE", "admin"),
+		JWTSecret:                getEnv("JWT_SECRET", ""),
+		JWTAlgorithm:             getEnv("JWT_ALGORITHM", "HS256"),
+		JWTAccessTTL:             accessTTL,
+		JWTRefreshTTL:            refreshTTL,
+		SSHEncryptionKey:         getEnv("SSH_ENCRYPTION_KEY", ""),
+		SSHKeyDir:                getEnv("SSH_KEY_DIR", ""),
+		SSHCiphers:               getEnv("SSH_CIPHERS", ""),
+		SSHKeyExchanges:          getEnv("SSH_KEX", ""),
+		SSHMACs:                  getEnv("SSH_MACS", ""),
+		SSHCompression:           getEnv("SSH_COMPRESSION", "false") == "true",
+		CoolifyAPIURL:            getEnv("COOLIFY_API_URL", "http://89.47.113.196:8000"),
+		CoolifyAPIToken:          getEnv("COOLIFY_API_TOKEN", ""),
+		OpsBackendURL:            getEnv("OPS_BACKEND_URL", "http://89.47.113.196:8095"),
+		OpsAdminToken:            getEnv("OPS_ADMIN_TOKEN", ""),
+		GLMAPIKey:                getEnv("GLM_API_KEY", ""),
+		GLMAPIURL:                getEnv("GLM_API_URL", "https://api.z.ai/api/paas/v4/chat/completions"),
+		GLMModel:                 getEnv("GLM_MODEL", "glm-5"),
+		AIDefaultServer:          getEnv("AI_DEFAULT_SERVER", ""),
+		AIToolConcurrency:        aiToolConcurrency,
+		AIToolQueue:              aiToolQueue,
+		TavilyAPIKey:             getEnv("TAVILY_API_KEY", ""),
+		SerperAPIKey:             getEnv("SERPER_API_KEY", ""),
+		AuditForwardType:         getEnv("AUDIT_FORWARD_TYPE", ""),
+		AuditForwardTarget:       getEnv("AUDIT_FORWARD_TARGET", ""),
+		AuditForwardToken:        getEnv("AUDIT_FORWARD_TOKEN", ""),
+		MetricsCollectInterval:   metricsInterval,
+		MetricsOfflineAfter:      offlineAfter,
+		MetricsOnlineAfter:       onlineAfter,
+		AlertEvalInterval:        alertEvalInterval,
+		AlertWebhookURL:          getEnv("ALERT_WEBHOOK_URL", ""),
+		AlertWebhookFormat:       getEnv("ALERT_WEBHOOK_FORMAT", "json"),
+		AlertEmailTo:             getEnv("ALERT_EMAIL_TO", ""),
+		SMTPHost:                 getEnv("SMTP_HOST", ""),
+		SMTPPort:                 smtpPort,
+		SMTPUsername:             getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:             getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:                 getEnv("SMTP_FROM", ""),
+		SSLCheckInterval:         sslCheckInterval,
+		SSLWarnDays:              sslWarnDays,
+		SSLCriticalDays:          sslCriticalDays,
+		MetricsSinkType:          getEnv("METRICS_SINK_TYPE", ""),
+		MetricsSinkURL:           getEnv("METRICS_SINK_URL", ""),
+		MetricsSinkToken:         getEnv("METRICS_SINK_TOKEN", ""),
+		MetricsToken:             getEnv("METRICS_TOKEN", ""),
+		MetricsRetentionDays:     metricsRetentionDays,
+		MonitorPingRetentionDays: pingRetentionDays,
+		FileUploadMaxMB:          fileUploadMaxMB,
+		TerminalRecording:        getEnv("TERMINAL_RECORDING", "false") == "true",
+		TerminalRecordingMaxMB:   recordingMaxMB,
+		TerminalIdleTimeout:      terminalIdleTimeout,
+		TerminalMaxDuration:      terminalMaxDuration,
+		DashboardCacheTTL:        dashboardCacheTTL,
+	}
+}
+
+// ValidateJWT checks the token algorithm and lifetimes are within bounds.
+// Unparseable durations load as zero and are rejected here.
+func (c *Config) ValidateJWT() error {
+	if !jwtAlgorithms[c.JWTAlgorithm] {
+		return fmt.Errorf("JWT_ALGORITHM must be HS256, HS384 or HS512, got %q", c.JWTAlgorithm)
+	}
+	if c.JWTAccessTTL < minAccessTTL || c.JWTAccessTTL > maxAccessTTL {
+		return fmt.Errorf("JWT_ACCESS_TTL must be between %s and %s", minAccessTTL, maxAccessTTL)
+	}
+	if c.JWTRefreshTTL < c.JWTAccessTTL || c.JWTRefreshTTL > maxRefreshTTL {
+		return fmt.Errorf("JWT_REFRESH_TTL must be between the access token lifetime and %s", maxRefreshTTL)
 	}
+	return nil
 }
 
 func getEnv(key, fallback string) string {
@@ -29,17 +29,29 @@ func Connect(cfg *config.Config) error {
 func Migrate() error {
 	return DB.AutoMigrate(
 		&models.Server{},
+		&models.ServerSecret{},
 		&models.SSHSession{},
+		&models.TerminalRecording{},
 		&models.CronJob{},
+		&models.CronRun{},
 		&models.CommandHistory{},
 		&models.ServerMetrics{},
+		&models.ServerNetworkMetrics{},
+		&models.ServerDiskMetrics{},
 		&models.AIConversation{},
 		&models.Monitor{},
 		&models.MonitorPing{},
+		&models.MonitorIncident{},
 		&models.SSLCert{},
 		&models.AlertRule{},
 		&models.Alert{},
 		&models.AuditLog{},
 		&models.RemoteConfig{},
+		&models.User{},
+		&models.RefreshToken{},
+		&models.DatabaseConnection{},
+		&models.ServerShare{},
+		&models.SavedQuery{},
+		&models.QueryHistory{},
 	)
 }
@@ -3,19 +3,21 @@ package handlers
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/ahmetk3436/bastion/internal/config"
 	"github.com/ahmetk3436/bastion/internal/models"
 	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/ahmetk3436/bastion/internal/tools"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/valyala/fasthttp"
@@ -23,17 +25,28 @@ import (
 	"gorm.io/gorm"
 )
 
-// ─── Coolify Apps Cache ─────────────────────────────────────────────────────
+// ─── AI Context Caches ──────────────────────────────────────────────────────
 
-type coolifyCache struct {
-	mu        sync.RWMutex
-	apps      string
-	fetchedAt time.Time
-}
+// errNoContext marks an empty context fetch, so it is retried next time
+// instead of being cached.
+var errNoContext = errors.New("no context")
 
-var appCache = &coolifyCache{}
+// cachedContext returns cache's block of AI context, calling fetch when it
+// is stale. fetch returns "" on failure.
+func cachedContext(cache *ttlCache[string], fetch func() string) string {
+	value, _, _ := cache.Get(func() (string, error) {
+		if v := fetch(); v != "" {
+			return v, nil
+		}
+		return "", errNoContext
+	})
+	return value
+}
 
-const coolifyAppCacheTTL = 5 * time.Minute
+var (
+	appCache       = &ttlCache[string]{ttl: 5 * time.Minute}
+	sreEventsCache = &ttlCache[string]{ttl: time.Minute}
+)
 
 // ─── AIHandler ──────────────────────────────────────────────────────────────
 
@@ -44,9 +57,11 @@ type AIHandler struct {
 	streamClient  *http.Client // no timeout for streaming
 	serverHandler *ServerHandler
 	webSearch     *services.WebSearchService
+	toolRegistry  *tools.ToolRegistry // tools offered by /ai/agent
 }
 
 func NewAIHandler(cfg *config.Config, db *gorm.DB, serverHandler *ServerHandler) *AIHandler {
+	webSearch := services.NewWebSearchService(cfg.TavilyAPIKey, cfg.SerperAPIKey)
 	return &AIHandler{
 		cfg: cfg,
 		db:  db,
@@ -57,25 +72,71 @@ func NewAIHandler(cfg *config.Config, db *gorm.DB, serverHandler *ServerHandler)
 			Timeout: 0, // no timeout for SSE streaming
 		},
 		serverHandler: serverHandler,
-		webSearch:     services.NewWebSearchService(cfg.TavilyAPIKey, cfg.SerperAPIKey),
+		webSearch:     webSearch,
+		toolRegistry:  tools.NewToolRegistry(cfg, db, serverHandler.GetSSHPool(), serverHandler.encryptor, webSearch),
 	}
 }
 
 // ─── Types ──────────────────────────────────────────────────────────────────
 
 type chatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []tools.ToolCall `json:"tool_calls,omitempty"`   // assistant turns of /ai/agent
+	ToolCallID string           `json:"tool_call_id,omitempty"` // role "tool" results
+}
+
+// chatHistory converts stored messages to GLM messages for plain chat.
+// Tool calls and their results from agent runs are left out, since plain
+// chat requests don't declare tools; the agent's final answers remain.
+func chatHistory(systemPrompt string, messages []chatMessage) []map[string]string {
+	glmMessages := make([]map[string]string, 0, len(messages)+1)
+	glmMessages = append(glmMessages, map[string]string{"role": "system", "content": systemPrompt})
+	for _, m := range messages {
+		if m.Role == "tool" || len(m.ToolCalls) > 0 {
+			continue
+		}
+		glmMessages = append(glmMessages, map[string]string{"role": m.Role, "content": m.Content})
+	}
+	return glmMessages
+}
+
+// glmUsage is the token usage block of a GLM response. In a stream it comes
+// with the final chunk and already covers the whole response.
+type glmUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// addConversationUsage adds usage to the conversation's running totals.
+func addConversationUsage(db *gorm.DB, convID uuid.UUID, usage *glmUsage) {
+	if usage == nil {
+		return
+	}
+	db.Model(&models.AIConversation{}).Where("id = ?", convID).Updates(map[string]interface{}{
+		"prompt_tokens":     gorm.Expr("prompt_tokens + ?", usage.PromptTokens),
+		"completion_tokens": gorm.Expr("completion_tokens + ?", usage.CompletionTokens),
+	})
 }
 
 type AIActionRequest struct {
-	Action   string `json:"action"`   // "execute_command", "restart_app", "get_logs", "get_metrics", "search_web"
-	ServerID string `json:"server_id"`
-	Command  string `json:"command"`  // for execute_command
-	AppUUID  string `json:"app_uuid"` // for restart_app, get_logs
-	Query    string `json:"query"`    // for search_web
+	Action         string   `json:"action"` // "execute_command", "restart_app", "get_logs", "get_metrics", "get_monitor_incidents", "search_web", "query_database"
+	ServerID       string   `json:"server_id"`
+	ConversationID string   `json:"conversation_id"` // its server takes precedence for execute_command
+	Command        string   `json:"command"`         // for execute_command
+	AppUUID        string   `json:"app_uuid"`        // for restart_app, get_logs
+	Query          string   `json:"query"`           // for search_web
+	Env            []string `json:"env"`             // server secret keys for execute_command
+	ConnectionID   string   `json:"connection_id"`   // for query_database
+	SQL            string   `json:"sql"`             // for query_database
+	TimeoutSeconds int      `json:"timeout_seconds"` // for execute_command; overrides EXEC_TIMEOUT
+	Confirm        bool     `json:"confirm"`         // for execute_command; required to run commands the safety checker flags
 }
 
+// aiQueryRowLimit bounds the result set returned by query_database.
+const aiQueryRowLimit = 200
+
 // ─── Chat (non-streaming) ───────────────────────────────────────────────────
 
 func (h *AIHandler) Chat(c *fiber.Ctx) error {
@@ -117,6 +178,9 @@ func (h *AIHandler) Chat(c *fiber.Ctx) error {
 			conv.ServerID = serverID
 		}
 		h.db.Create(&conv)
+	} else if serverID == nil {
+		// Fall back to the conversation's active server
+		serverID = conv.ServerID
 	}
 
 	messages = append(messages, chatMessage{Role: "user", Content: req.Message})
@@ -127,11 +191,7 @@ func (h *AIHandler) Chat(c *fiber.Ctx) error {
 	// Determine if thinking mode should be enabled
 	useThinking := isComplexQuery(req.Message)
 
-	glmMessages := make([]map[string]string, 0, len(messages)+1)
-	glmMessages = append(glmMessages, map[string]string{"role": "system", "content": systemPrompt})
-	for _, m := range messages {
-		glmMessages = append(glmMessages, map[string]string{"role": m.Role, "content": m.Content})
-	}
+	glmMessages := chatHistory(systemPrompt, messages)
 
 	glmReq := map[string]interface{}{
 		"model":    h.cfg.GLMModel,
@@ -165,6 +225,7 @@ func (h *AIHandler) Chat(c *fiber.Ctx) error {
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage *glmUsage `json:"usage"`
 	}
 	json.Unmarshal(respBody, &glmResp)
 
@@ -176,10 +237,12 @@ func (h *AIHandler) Chat(c *fiber.Ctx) error {
 	messages = append(messages, chatMessage{Role: "assistant", Content: aiResponse})
 	msgJSON, _ := json.Marshal(messages)
 	h.db.Model(&conv).Update("messages", datatypes.JSON(msgJSON))
+	addConversationUsage(h.db, conv.ID, glmResp.Usage)
 
 	return c.JSON(fiber.Map{
 		"response":        aiResponse,
 		"conversation_id": conv.ID,
+		"usage":           glmResp.Usage,
 	})
 }
 
@@ -224,6 +287,9 @@ func (h *AIHandler) ChatStream(c *fiber.Ctx) error {
 			conv.ServerID = serverID
 		}
 		h.db.Create(&conv)
+	} else if serverID == nil {
+		// Fall back to the conversation's active server
+		serverID = conv.ServerID
 	}
 
 	messages = append(messages, chatMessage{Role: "user", Content: req.Message})
@@ -234,11 +300,7 @@ func (h *AIHandler) ChatStream(c *fiber.Ctx) error {
 	// Determine if thinking mode should be enabled
 	useThinking := isComplexQuery(req.Message)
 
-	glmMessages := make([]map[string]string, 0, len(messages)+1)
-	glmMessages = append(glmMessages, map[string]string{"role": "system", "content": systemPrompt})
-	for _, m := range messages {
-		glmMessages = append(glmMessages, map[string]string{"role": m.Role, "content": m.Content})
-	}
+	glmMessages := chatHistory(systemPrompt, messages)
 
 	glmReq := map[string]interface{}{
 		"model":    h.cfg.GLMModel,
@@ -250,8 +312,12 @@ func (h *AIHandler) ChatStream(c *fiber.Ctx) error {
 	}
 
 	glmBody, _ := json.Marshal(glmReq)
-	httpReq, err := http.NewRequest("POST", h.cfg.GLMAPIURL, bytes.NewReader(glmBody))
+	// fasthttp has no per-connection context: the upstream request is
+	// cancelled when a write to the client fails or the server shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", h.cfg.GLMAPIURL, bytes.NewReader(glmBody))
 	if err != nil {
+		cancel()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to create request",
@@ -263,6 +329,7 @@ func (h *AIHandler) ChatStream(c *fiber.Ctx) error {
 
 	resp, err := h.streamClient.Do(httpReq)
 	if err != nil {
+		cancel()
 		slog.Error("GLM-5 streaming call failed", "error", err)
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":   true,
@@ -280,107 +347,149 @@ func (h *AIHandler) ChatStream(c *fiber.Ctx) error {
 	convID := conv.ID
 	dbRef := h.db
 	allMessages := messages
+	shutdown := c.Context().Done()
 
 	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-		defer resp.Body.Close()
+		assembled, usage, err := streamGLMReply(ctx, cancel, shutdown, resp, w)
+		if err != nil {
+			slog.Info("AI stream client disconnected", "conversation", convID, "error", err)
+		} else {
+			writeSSE(w, map[string]interface{}{
+				"token":           "",
+				"done":            true,
+				"conversation_id": convID.String(),
+				"usage":           usage,
+			})
+		}
 
-		scanner := bufio.NewScanner(resp.Body)
-		// Increase scanner buffer for large chunks
-		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		// Save what was assembled, even if the client left part way
+		if assembled == "" {
+			assembled = "I couldn't generate a response. Please try again."
+		}
 
-		var fullResponse strings.Builder
+		allMessages = append(allMessages, chatMessage{Role: "assistant", Content: assembled})
+		msgJSON, _ := json.Marshal(allMessages)
+		dbRef.Model(&models.AIConversation{}).Where("id = ?", convID).Update("messages", datatypes.JSON(msgJSON))
+		addConversationUsage(dbRef, convID, usage)
+	})
 
-		for scanner.Scan() {
-			line := scanner.Text()
+	return nil
+}
 
-			// Skip empty lines and comments
-			if line == "" || strings.HasPrefix(line, ":") {
-				continue
-			}
+// streamGLMReply relays the streaming GLM response resp, made with ctx, to
+// w. The upstream request is cancelled and its body closed once the stream
+// ends, a write to the client fails or shutdown is closed, so a departed
+// client does not keep GLM generating for nobody. The answer assembled up to
+// then is returned.
+func streamGLMReply(ctx context.Context, cancel context.CancelFunc, shutdown <-chan struct{}, resp *http.Response, w *bufio.Writer) (string, *glmUsage, error) {
+	defer cancel()
+	defer resp.Body.Close()
 
-			// Only process data lines
-			if !strings.HasPrefix(line, "data: ") {
-				continue
-			}
+	go func() {
+		select {
+		case <-shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-			data := strings.TrimPrefix(line, "data: ")
+	assembled, usage, err := relayGLMStream(resp.Body, w)
+	if err != nil {
+		// Stop the upstream request now instead of reading GLM's answer
+		// to the end
+		cancel()
+	}
+	return assembled, usage, err
+}
 
-			// Check for end of stream
-			if data == "[DONE]" {
-				break
-			}
+// writeSSE sends one SSE data event and flushes it to the client. The error
+// is the flush error, which is how a disconnected client shows up.
+func writeSSE(w *bufio.Writer, event map[string]interface{}) error {
+	eventJSON, _ := json.Marshal(event)
+	fmt.Fprintf(w, "data: %s\n\n", eventJSON)
+	return w.Flush()
+}
 
-			// Parse the SSE chunk from GLM
-			var chunk struct {
-				Choices []struct {
-					Delta struct {
-						Content          string `json:"content"`
-						ReasoningContent string `json:"reasoning_content"`
-					} `json:"delta"`
-					FinishReason *string `json:"finish_reason"`
-				} `json:"choices"`
-			}
+// relayGLMStream forwards GLM's SSE stream from body to the client as
+// thinking and token events, and returns the assembled answer and usage.
+// It stops with an error as soon as a write to the client fails; the
+// answer assembled up to then is still returned.
+func relayGLMStream(body io.Reader, w *bufio.Writer) (string, *glmUsage, error) {
+	scanner := bufio.NewScanner(body)
+	// Increase scanner buffer for large chunks
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 
-			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-				continue
-			}
+	var fullResponse strings.Builder
+	var usage *glmUsage
+	finished := false
 
-			if len(chunk.Choices) > 0 {
-				// Forward thinking/reasoning tokens
-				thinking := chunk.Choices[0].Delta.ReasoningContent
-				if thinking != "" {
-					event := map[string]interface{}{
-						"thinking": thinking,
-						"done":     false,
-					}
-					eventJSON, _ := json.Marshal(event)
-					fmt.Fprintf(w, "data: %s\n\n", eventJSON)
-					w.Flush()
-				}
+	for scanner.Scan() {
+		line := scanner.Text()
 
-				// Forward content tokens
-				token := chunk.Choices[0].Delta.Content
-				if token != "" {
-					fullResponse.WriteString(token)
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
 
-					event := map[string]interface{}{
-						"token": token,
-						"done":  false,
-					}
-					eventJSON, _ := json.Marshal(event)
-					fmt.Fprintf(w, "data: %s\n\n", eventJSON)
-					w.Flush()
-				}
+		// Only process data lines
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
 
-				// Check if this is the final chunk
-				if chunk.Choices[0].FinishReason != nil {
-					break
-				}
-			}
+		data := strings.TrimPrefix(line, "data: ")
+
+		// Check for end of stream
+		if data == "[DONE]" {
+			break
 		}
 
-		// Send final event
-		finalEvent := map[string]interface{}{
-			"token":           "",
-			"done":            true,
-			"conversation_id": convID.String(),
+		// Parse the SSE chunk from GLM
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content          string `json:"content"`
+					ReasoningContent string `json:"reasoning_content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *glmUsage `json:"usage"`
 		}
-		finalJSON, _ := json.Marshal(finalEvent)
-		fmt.Fprintf(w, "data: %s\n\n", finalJSON)
-		w.Flush()
 
-		// Save the full assembled response to the conversation
-		assembled := fullResponse.String()
-		if assembled == "" {
-			assembled = "I couldn't generate a response. Please try again."
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
 		}
 
-		allMessages = append(allMessages, chatMessage{Role: "assistant", Content: assembled})
-		msgJSON, _ := json.Marshal(allMessages)
-		dbRef.Model(&models.AIConversation{}).Where("id = ?", convID).Update("messages", datatypes.JSON(msgJSON))
-	})
+		if len(chunk.Choices) > 0 {
+			// Forward thinking/reasoning tokens
+			if thinking := chunk.Choices[0].Delta.ReasoningContent; thinking != "" {
+				if err := writeSSE(w, map[string]interface{}{"thinking": thinking, "done": false}); err != nil {
+					return fullResponse.String(), usage, err
+				}
+			}
 
-	return nil
+			// Forward content tokens
+			if token := chunk.Choices[0].Delta.Content; token != "" {
+				fullResponse.WriteString(token)
+				if err := writeSSE(w, map[string]interface{}{"token": token, "done": false}); err != nil {
+					return fullResponse.String(), usage, err
+				}
+			}
+
+			// Check if this is the final chunk. Usage may follow in a
+			// chunk of its own, so keep reading until it arrives.
+			if chunk.Choices[0].FinishReason != nil {
+				finished = true
+			}
+		}
+		if finished && usage != nil {
+			break
+		}
+	}
+
+	return fullResponse.String(), usage, nil
 }
 
 // ─── ExecuteAIAction ────────────────────────────────────────────────────────
@@ -403,35 +512,21 @@ func (h *AIHandler) ExecuteAIAction(c *fiber.Ctx) error {
 		return h.getLogs(c, req)
 	case "get_metrics":
 		return h.getMetrics(c, req)
+	case "get_monitor_incidents":
+		return h.getMonitorIncidents(c)
 	case "search_web":
 		return h.searchWeb(c, req)
+	case "query_database":
+		return h.queryDatabase(c, req)
 	default:
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "Unknown action: " + req.Action + ". Valid actions: execute_command, restart_app, get_logs, get_metrics, search_web",
+			"message": "Unknown action: " + req.Action + ". Valid actions: execute_command, restart_app, get_logs, get_metrics, get_monitor_incidents, search_web, query_database",
 		})
 	}
 }
 
 func (h *AIHandler) executeCommand(c *fiber.Ctx, req AIActionRequest) error {
-	// Auto-detect server if not provided (use default server)
-	if req.ServerID == "" {
-		var defaultServer models.Server
-		if err := h.db.First(&defaultServer, "is_default = ?", true).Error; err == nil {
-			req.ServerID = defaultServer.ID.String()
-		} else {
-			// Try any server
-			if err := h.db.First(&defaultServer).Error; err == nil {
-				req.ServerID = defaultServer.ID.String()
-			} else {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"error":   true,
-					"message": "No server configured. Please add a server first.",
-				})
-			}
-		}
-	}
-
 	if req.Command == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
@@ -439,23 +534,41 @@ func (h *AIHandler) executeCommand(c *fiber.Ctx, req AIActionRequest) error {
 		})
 	}
 
-	serverID, err := uuid.Parse(req.ServerID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "Invalid server_id",
+	safety := services.DefaultSafetyChecker.CheckCommandLine(req.Command)
+	if !safety.IsSafe && !req.Confirm {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error":                 true,
+			"message":               "Command '" + safety.BaseCommand + "' is classified as " + safety.Category + "; resend with confirm to run it",
+			"requires_confirmation": true,
+			"safety":                safetyVerdict(safety),
 		})
 	}
 
-	var server models.Server
-	if err := h.db.First(&server, "id = ?", serverID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+	server, source, err := h.resolveActionServer(req)
+	if err != nil {
+		status := fiber.StatusNotFound
+		if errors.Is(err, services.ErrNoServerResolved) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(fiber.Map{
 			"error":   true,
-			"message": "Server not found",
+			"message": err.Error(),
 		})
 	}
+	serverID := server.ID
+	slog.Info("AI command target", "server", server.Name, "source", source)
+
+	timeout, err := execTimeout(req.TimeoutSeconds, h.cfg.ExecTimeout)
+	if err != nil {
+		return err
+	}
+
+	env, err := resolveSecrets(c, h.serverHandler, server.ID, req.Env, "ai")
+	if err != nil {
+		return err
+	}
 
-	password, privateKey, err := h.serverHandler.GetDecryptedCredentials(&server)
+	password, privateKey, err := h.serverHandler.GetDecryptedCredentials(server)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -464,7 +577,7 @@ func (h *AIHandler) executeCommand(c *fiber.Ctx, req AIActionRequest) error {
 	}
 
 	pool := h.serverHandler.GetSSHPool()
-	client, err := pool.GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := pool.GetConnection(server, password, privateKey)
 	if err != nil {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":   true,
@@ -485,15 +598,11 @@ func (h *AIHandler) executeCommand(c *fiber.Ctx, req AIActionRequest) error {
 	var stdout, stderr bytes.Buffer
 	session.Stdout = &stdout
 	session.Stderr = &stderr
+	command, stdin := services.InjectEnv(env, req.Command, nil)
+	session.Stdin = stdin
 
-	exitCode := 0
-	if err := session.Run(req.Command); err != nil {
-		if exitErr, ok := err.(interface{ ExitStatus() int }); ok {
-			exitCode = exitErr.ExitStatus()
-		} else {
-			exitCode = -1
-		}
-	}
+	exitCode, runErr := services.RunSession(session, services.WrapCommand(server.CommandPrefix, server.Shell, command), timeout)
+	timedOut := errors.Is(runErr, services.ErrCommandTimeout)
 
 	duration := time.Since(start)
 	output := stdout.String()
@@ -503,6 +612,9 @@ func (h *AIHandler) executeCommand(c *fiber.Ctx, req AIActionRequest) error {
 		}
 		output += stderr.String()
 	}
+	if timedOut {
+		output += fmt.Sprintf("\n[Killed after %s timeout]", timeout)
+	}
 
 	// Save to command history
 	history := models.CommandHistory{
@@ -512,13 +624,18 @@ func (h *AIHandler) executeCommand(c *fiber.Ctx, req AIActionRequest) error {
 		ExitCode:   exitCode,
 		ExecutedAt: start,
 		DurationMs: int(duration.Milliseconds()),
+		TimedOut:   timedOut,
 	}
 	h.db.Create(&history)
 
-	// Check command safety for UI feedback
-	safety := services.DefaultSafetyChecker.CheckSafety(req.Command)
+	auditAction(c, h.db, "ai.command", server.ID.String(), map[string]interface{}{
+		"command":       services.RedactSecrets(req.Command),
+		"exit_code":     exitCode,
+		"history_id":    history.ID,
+		"server_source": source,
+	}, runErr)
 
-	return c.JSON(fiber.Map{
+	result := fiber.Map{
 		"action":        "execute_command",
 		"command":       req.Command,
 		"output":        output,
@@ -526,10 +643,35 @@ func (h *AIHandler) executeCommand(c *fiber.Ctx, req AIActionRequest) error {
 		"duration_ms":   duration.Milliseconds(),
 		"server":        server.Name,
 		"server_id":     server.ID.String(),
-		"safety":        safety.IsSafe,
-		"command_type":  safety.Category,
-		"base_command":  safety.BaseCommand,
-	})
+		"server_source": source,
+		"safety":        safetyVerdict(safety),
+		"timed_out":     timedOut,
+	}
+	if timedOut {
+		return timedOutResponse(c, result, timeout)
+	}
+	return c.JSON(result)
+}
+
+// resolveActionServer picks the target server for an action: the
+// conversation's server, then server_id, then AI_DEFAULT_SERVER, then the
+// is_default server. It never falls back to an arbitrary server.
+func (h *AIHandler) resolveActionServer(req AIActionRequest) (*models.Server, string, error) {
+	sel := services.ServerSelector{Request: req.ServerID, Config: h.cfg.AIDefaultServer}
+	if req.ConversationID != "" {
+		convID, err := uuid.Parse(req.ConversationID)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid conversation_id")
+		}
+		var conv models.AIConversation
+		if err := h.db.First(&conv, "id = ?", convID).Error; err != nil {
+			return nil, "", fmt.Errorf("conversation not found")
+		}
+		if conv.ServerID != nil {
+			sel.Conversation = conv.ServerID.String()
+		}
+	}
+	return services.ResolveServer(h.db, sel)
 }
 
 func (h *AIHandler) restartApp(c *fiber.Ctx, req AIActionRequest) error {
@@ -547,6 +689,7 @@ func (h *AIHandler) restartApp(c *fiber.Ctx, req AIActionRequest) error {
 
 	resp, err := h.client.Do(httpReq)
 	if err != nil {
+		auditAction(c, h.db, "coolify.restart", req.AppUUID, map[string]interface{}{"status": 0}, err)
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to restart app via Coolify: " + err.Error(),
@@ -558,6 +701,13 @@ func (h *AIHandler) restartApp(c *fiber.Ctx, req AIActionRequest) error {
 	var result interface{}
 	json.Unmarshal(body, &result)
 
+	// Coolify error statuses count as failures, as in CoolifyHandler
+	var restartErr error
+	if resp.StatusCode >= fiber.StatusBadRequest {
+		restartErr = fmt.Errorf("coolify returned HTTP %d", resp.StatusCode)
+	}
+	auditAction(c, h.db, "coolify.restart", req.AppUUID, map[string]interface{}{"status": resp.StatusCode}, restartErr)
+
 	return c.JSON(fiber.Map{
 		"action":   "restart_app",
 		"app_uuid": req.AppUUID,
@@ -629,6 +779,22 @@ func (h *AIHandler) getMetrics(c *fiber.Ctx, req AIActionRequest) error {
 	})
 }
 
+// getMonitorIncidents returns down monitors and recent incidents
+func (h *AIHandler) getMonitorIncidents(c *fiber.Ctx) error {
+	summary, err := services.GetMonitorIncidents(h.db, 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to load monitor incidents",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"action":    "get_monitor_incidents",
+		"incidents": summary,
+		"formatted": summary.Format(),
+	})
+}
 
 // searchWeb performs a web search using Tavily or Serper API
 func (h *AIHandler) searchWeb(c *fiber.Ctx, req AIActionRequest) error {
@@ -655,6 +821,83 @@ func (h *AIHandler) searchWeb(c *fiber.Ctx, req AIActionRequest) error {
 		"formatted":    h.webSearch.FormatResults(results),
 	})
 }
+
+// queryDatabase runs a read-only query against an external database that has
+// been marked AI-queryable. Every query that passes the checks is audited
+// with its SQL text and result.
+func (h *AIHandler) queryDatabase(c *fiber.Ctx, req AIActionRequest) error {
+	if req.ConnectionID == "" || req.SQL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "connection_id and sql are required for query_database",
+		})
+	}
+
+	connID, err := uuid.Parse(req.ConnectionID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid connection ID",
+		})
+	}
+
+	var conn models.DatabaseConnection
+	if err := h.db.First(&conn, "id = ?", connID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Connection not found",
+		})
+	}
+	if !conn.AIQueryable {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   true,
+			"message": "Connection is not AI-queryable",
+		})
+	}
+
+	if err := services.CheckReadOnlyQuery(req.SQL); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   true,
+			"message": "Query rejected: " + err.Error(),
+		})
+	}
+
+	details := map[string]interface{}{
+		"connection_id": conn.ID,
+		"sql":           req.SQL,
+	}
+	dsn, err := h.serverHandler.GetEncryptor().Decrypt(conn.EncryptedDSN)
+	if err != nil {
+		auditAction(c, h.db, "ai.query_database", conn.Name, details, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to decrypt connection",
+		})
+	}
+
+	result, err := services.QueryExternalDatabase(c.UserContext(), dsn, req.SQL, aiQueryRowLimit)
+	if err == nil {
+		details["row_count"] = result.RowCount
+	}
+	auditAction(c, h.db, "ai.query_database", conn.Name, details, err)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Query failed: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"action":     "query_database",
+		"connection": conn.Name,
+		"sql":        req.SQL,
+		"columns":    result.Columns,
+		"rows":       result.Rows,
+		"row_count":  result.RowCount,
+		"truncated":  result.Truncated,
+	})
+}
+
 // ─── GetConversation ────────────────────────────────────────────────────────
 
 func (h *AIHandler) GetConversation(c *fiber.Ctx) error {
@@ -678,13 +921,99 @@ func (h *AIHandler) GetConversation(c *fiber.Ctx) error {
 	var messages []chatMessage
 	json.Unmarshal([]byte(conv.Messages), &messages)
 
+	var serverName string
+	if conv.ServerID != nil {
+		var server models.Server
+		if err := h.db.Select("name").First(&server, "id = ?", *conv.ServerID).Error; err == nil {
+			serverName = server.Name
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"id":          conv.ID,
+		"title":       conv.Title,
+		"server_id":   conv.ServerID,
+		"server_name": serverName,
+		"messages":    messages,
+		"usage":       conversationUsage(conv),
+		"created_at":  conv.CreatedAt,
+		"updated_at":  conv.UpdatedAt,
+	})
+}
+
+// conversationUsage is the conversation's token totals in GLM's usage shape.
+func conversationUsage(conv models.AIConversation) glmUsage {
+	return glmUsage{
+		PromptTokens:     conv.PromptTokens,
+		CompletionTokens: conv.CompletionTokens,
+		TotalTokens:      conv.PromptTokens + conv.CompletionTokens,
+	}
+}
+
+// ─── SetConversationServer ──────────────────────────────────────────────────
+
+// SetConversationServer changes (or clears) the server a conversation is
+// focused on. The next turn builds its system prompt for that server.
+func (h *AIHandler) SetConversationServer(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid conversation ID",
+		})
+	}
+
+	var req struct {
+		ServerID string `json:"server_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+
+	var conv models.AIConversation
+	if err := h.db.First(&conv, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Conversation not found",
+		})
+	}
+
+	var serverID *uuid.UUID
+	var serverName string
+	if req.ServerID != "" {
+		sid, err := uuid.Parse(req.ServerID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid server ID",
+			})
+		}
+		var server models.Server
+		if err := h.db.First(&server, "id = ?", sid).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "Server not found",
+			})
+		}
+		serverID = &sid
+		serverName = server.Name
+	}
+
+	if err := h.db.Model(&conv).Update("server_id", serverID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update conversation",
+		})
+	}
+
 	return c.JSON(fiber.Map{
-		"id":         conv.ID,
-		"title":      conv.Title,
-		"server_id":  conv.ServerID,
-		"messages":   messages,
-		"created_at": conv.CreatedAt,
-		"updated_at": conv.UpdatedAt,
+		"message":     "Conversation server updated",
+		"id":          conv.ID,
+		"server_id":   serverID,
+		"server_name": serverName,
 	})
 }
 
@@ -844,6 +1173,7 @@ func (h *AIHandler) ListConversations(c *fiber.Ctx) error {
 		ID        uuid.UUID  `json:"id"`
 		Title     string     `json:"title"`
 		ServerID  *uuid.UUID `json:"server_id"`
+		Usage     glmUsage   `json:"usage"`
 		CreatedAt time.Time  `json:"created_at"`
 		UpdatedAt time.Time  `json:"updated_at"`
 	}
@@ -853,6 +1183,7 @@ func (h *AIHandler) ListConversations(c *fiber.Ctx) error {
 			ID:        conv.ID,
 			Title:     conv.Title,
 			ServerID:  conv.ServerID,
+			Usage:     conversationUsage(conv),
 			CreatedAt: conv.CreatedAt,
 			UpdatedAt: conv.UpdatedAt,
 		}
@@ -918,6 +1249,11 @@ func (h *AIHandler) buildSystemPrompt(serverID *uuid.UUID) string {
 			if server.LastConnectedAt != nil {
 				sb.WriteString(fmt.Sprintf("- **Last Connected**: %s\n", server.LastConnectedAt.Format(time.RFC3339)))
 			}
+			if notes := strings.TrimSpace(server.Notes); notes != "" {
+				sb.WriteString("\n### Operator Notes (respect these caveats)\n")
+				sb.WriteString(truncate(notes, 2000))
+				sb.WriteString("\n")
+			}
 
 			// Get latest metrics for this server
 			var metrics models.ServerMetrics
@@ -927,6 +1263,14 @@ func (h *AIHandler) buildSystemPrompt(serverID *uuid.UUID) string {
 				sb.WriteString(fmt.Sprintf("- Memory: %.0f MB / %.0f MB (%.1f%%)\n",
 					metrics.MemoryUsedMB, metrics.MemoryTotalMB,
 					safePercent(metrics.MemoryUsedMB, metrics.MemoryTotalMB)))
+				sb.WriteString(fmt.Sprintf("- Buffers/Cache: %.0f MB\n", metrics.MemCachedMB))
+				if metrics.SwapTotalMB > 0 {
+					sb.WriteString(fmt.Sprintf("- Swap: %.0f MB / %.0f MB (%.1f%%)\n",
+						metrics.SwapUsedMB, metrics.SwapTotalMB,
+						safePercent(metrics.SwapUsedMB, metrics.SwapTotalMB)))
+				} else {
+					sb.WriteString("- Swap: none\n")
+				}
 				sb.WriteString(fmt.Sprintf("- Disk: %.1f GB / %.1f GB (%.1f%%)\n",
 					metrics.DiskUsedGB, metrics.DiskTotalGB,
 					safePercent(metrics.DiskUsedGB, metrics.DiskTotalGB)))
@@ -936,6 +1280,18 @@ func (h *AIHandler) buildSystemPrompt(serverID *uuid.UUID) string {
 					metrics.ContainerRunning, metrics.ContainerCount))
 				sb.WriteString(fmt.Sprintf("- Uptime: %s\n", formatUptime(metrics.UptimeSeconds)))
 			}
+
+			// OOM kills from the last day, as of the latest kernel log read
+			if ooms := services.RecentOOMEvents(server.ID, 24*time.Hour, 5); len(ooms) > 0 {
+				sb.WriteString("\n### Recent OOM Kills (kernel log)\n")
+				for _, ev := range ooms {
+					sb.WriteString(fmt.Sprintf("- %s: %s (pid %d), anon-rss %d MB", ev.RawTime, ev.Process, ev.PID, ev.AnonRSSKB/1024))
+					if ev.Cgroup != "" {
+						sb.WriteString(fmt.Sprintf(", cgroup %s", ev.Cgroup))
+					}
+					sb.WriteString("\n")
+				}
+			}
 		}
 	}
 
@@ -955,6 +1311,21 @@ func (h *AIHandler) buildSystemPrompt(serverID *uuid.UUID) string {
 		}
 	}
 
+	// Add failing monitors so outages can be tied to their checks
+	if summary, err := services.GetMonitorIncidents(h.db, 5); err == nil && len(summary.Down) > 0 {
+		sb.WriteString("\n## Monitors Currently Down\n")
+		for _, d := range summary.Down {
+			sb.WriteString(fmt.Sprintf("- %s (%s): %d fails", d.Name, d.URL, d.ConsecutiveFails))
+			if d.DownSince != nil {
+				sb.WriteString(fmt.Sprintf(", down %s", formatUptime(d.DownForSeconds)))
+			}
+			if d.LastError != "" {
+				sb.WriteString(fmt.Sprintf(", error: %s", truncate(d.LastError, 120)))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
 	// Add Coolify running apps (cached)
 	if apps := h.getCoolifyAppsContext(); apps != "" {
 		sb.WriteString("\n## Running Coolify Apps\n")
@@ -969,19 +1340,38 @@ func (h *AIHandler) buildSystemPrompt(serverID *uuid.UUID) string {
 		sb.WriteString("\n")
 	}
 
-	return sb.String()
+	// Dynamic context may carry credentials from errors and events
+	return services.RedactSecrets(sb.String())
 }
 
-func (h *AIHandler) getCoolifyAppsContext() string {
-	appCache.mu.RLock()
-	if time.Since(appCache.fetchedAt) < coolifyAppCacheTTL && appCache.apps != "" {
-		cached := appCache.apps
-		appCache.mu.RUnlock()
-		return cached
+// GetSystemPrompt returns the exact system prompt a chat would send for the
+// given server, after redaction, so context can be inspected and tuned.
+func (h *AIHandler) GetSystemPrompt(c *fiber.Ctx) error {
+	var serverID *uuid.UUID
+	if raw := c.Query("server_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid server_id",
+			})
+		}
+		serverID = &id
 	}
-	appCache.mu.RUnlock()
 
-	// Fetch from Coolify
+	prompt := h.buildSystemPrompt(serverID)
+	return c.JSON(fiber.Map{
+		"server_id": serverID,
+		"prompt":    prompt,
+		"length":    len(prompt),
+	})
+}
+
+func (h *AIHandler) getCoolifyAppsContext() string {
+	return cachedContext(appCache, h.fetchCoolifyApps)
+}
+
+func (h *AIHandler) fetchCoolifyApps() string {
 	url := fmt.Sprintf("%s/api/v1/applications", h.cfg.CoolifyAPIURL)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -1017,21 +1407,17 @@ func (h *AIHandler) getCoolifyAppsContext() string {
 		sb.WriteString(fmt.Sprintf("- %s (uuid: %s, status: %s)\n", name, appUUID, status))
 	}
 
-	result := sb.String()
-
-	// Update cache
-	appCache.mu.Lock()
-	appCache.apps = result
-	appCache.fetchedAt = time.Now()
-	appCache.mu.Unlock()
-
-	return result
+	return sb.String()
 }
 
 func (h *AIHandler) getRecentSREEvents() string {
 	if h.cfg.OpsBackendURL == "" || h.cfg.OpsAdminToken == "" {
 		return ""
 	}
+	return cachedContext(sreEventsCache, h.fetchRecentSREEvents)
+}
+
+func (h *AIHandler) fetchRecentSREEvents() string {
 
 	url := fmt.Sprintf("%s/api/ops/sre/events?per_page=10", h.cfg.OpsBackendURL)
 	req, err := http.NewRequest("GET", url, nil)
@@ -1078,6 +1464,14 @@ func (h *AIHandler) getRecentSREEvents() string {
 	return sb.String()
 }
 
+// RefreshContext invalidates the cached AI context (Coolify apps and SRE
+// events) so the next chat rebuilds it from fresh data.
+func (h *AIHandler) RefreshContext(c *fiber.Ctx) error {
+	appCache.Invalidate()
+	sreEventsCache.Invalidate()
+	return c.JSON(fiber.Map{"message": "AI context cache cleared"})
+}
+
 // ─── Helpers ────────────────────────────────────────────────────────────────
 
 func truncate(s string, maxLen int) string {
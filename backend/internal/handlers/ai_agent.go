@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/ahmetk3436/bastion/internal/tools"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	defaultAgentIterations = 6
+	maxAgentIterations     = 12
+
+	// maxToolResultLen caps what one tool result adds to the model context
+	maxToolResultLen = 16 * 1024
+)
+
+// agentPrompt is appended to the system prompt for /ai/agent runs.
+const agentPrompt = `
+
+## Tools
+You can call tools to inspect and operate the infrastructure. Call them as
+needed, read their results, then answer. Commands the safety checker flags
+and app restarts are not run for you: their result says so, and you should
+tell the user the exact action so they can confirm it themselves.`
+
+// agentStep is one tool call made during an agent run.
+type agentStep struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Result    string                 `json:"result"`
+	Blocked   bool                   `json:"blocked,omitempty"` // needs user confirmation
+}
+
+// toolRunner executes one tool call requested by the model.
+type toolRunner func(call tools.ToolCall) agentStep
+
+// agentRun is the outcome of runAgent.
+type agentRun struct {
+	Answer     string
+	Messages   []chatMessage // assistant and tool messages added by the run
+	Steps      []agentStep
+	Iterations int
+	Capped     bool // maxIterations reached without a final answer
+	Usage      glmUsage
+}
+
+// Agent runs a tool-calling loop: the model may call ToolRegistry tools,
+// whose results are fed back until it answers or max_iterations model
+// calls have been made. The whole trace is saved to the conversation.
+func (h *AIHandler) Agent(c *fiber.Ctx) error {
+	var req struct {
+		Message        string `json:"message"`
+		ConversationID string `json:"conversation_id"`
+		ServerID       string `json:"server_id"`
+		MaxIterations  int    `json:"max_iterations"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Message == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Message is required",
+		})
+	}
+	if req.MaxIterations == 0 {
+		req.MaxIterations = defaultAgentIterations
+	}
+	if req.MaxIterations < 1 || req.MaxIterations > maxAgentIterations {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("max_iterations must be between 1 and %d", maxAgentIterations),
+		})
+	}
+
+	conv, messages, serverID, err := h.loadConversation(req.ConversationID, req.ServerID, req.Message)
+	if err != nil {
+		return err
+	}
+	messages = append(messages, chatMessage{Role: "user", Content: req.Message})
+
+	systemPrompt := h.buildSystemPrompt(serverID) + agentPrompt
+	run, err := h.runAgent(systemPrompt, messages, req.MaxIterations, h.agentToolRunner(c, conv.ID, serverID))
+
+	messages = append(messages, run.Messages...)
+	if err != nil {
+		slog.Error("AI agent run failed", "conversation", conv.ID, "iterations", run.Iterations, "error", err)
+		messages = append(messages, chatMessage{Role: "assistant", Content: "The AI service failed during this run: " + err.Error()})
+	}
+	msgJSON, _ := json.Marshal(messages)
+	h.db.Model(&conv).Update("messages", datatypes.JSON(msgJSON))
+	addConversationUsage(h.db, conv.ID, &run.Usage)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":           true,
+			"message":         "AI service unavailable",
+			"conversation_id": conv.ID,
+			"steps":           run.Steps,
+		})
+	}
+
+	pending := make([]fiber.Map, 0)
+	for _, step := range run.Steps {
+		if !step.Blocked {
+			continue
+		}
+		action := fiber.Map{"action": step.Tool}
+		for k, v := range step.Arguments {
+			action[k] = v
+		}
+		pending = append(pending, action)
+	}
+
+	return c.JSON(fiber.Map{
+		"response":               run.Answer,
+		"conversation_id":        conv.ID,
+		"steps":                  run.Steps,
+		"pending_actions":        pending,
+		"iterations":             run.Iterations,
+		"max_iterations_reached": run.Capped,
+		"usage":                  run.Usage,
+	})
+}
+
+// loadConversation loads the conversation with id, or creates one titled
+// after message, and resolves the server the turn is about: serverIDParam
+// when given, else the conversation's server. A malformed ID is a 400 and
+// an unknown conversation a 404.
+func (h *AIHandler) loadConversation(id, serverIDParam, message string) (models.AIConversation, []chatMessage, *uuid.UUID, error) {
+	var conv models.AIConversation
+	var messages []chatMessage
+
+	if id != "" {
+		convID, err := uuid.Parse(id)
+		if err != nil {
+			return conv, nil, nil, fiber.NewError(fiber.StatusBadRequest, "Invalid conversation ID")
+		}
+		if err := h.db.First(&conv, "id = ?", convID).Error; err != nil {
+			return conv, nil, nil, fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+		}
+		json.Unmarshal([]byte(conv.Messages), &messages)
+	}
+
+	var serverID *uuid.UUID
+	if serverIDParam != "" {
+		sid, err := uuid.Parse(serverIDParam)
+		if err != nil {
+			return conv, nil, nil, fiber.NewError(fiber.StatusBadRequest, "Invalid server ID")
+		}
+		serverID = &sid
+	}
+
+	if conv.ID == uuid.Nil {
+		conv = models.AIConversation{
+			Title:    truncate(message, 100),
+			Messages: datatypes.JSON("[]"),
+			ServerID: serverID,
+		}
+		h.db.Create(&conv)
+	} else if serverID == nil {
+		serverID = conv.ServerID
+	}
+	return conv, messages, serverID, nil
+}
+
+// runAgent calls the model with the registry's tools and runs the tool calls
+// it asks for until it answers without calling any, or maxIterations model
+// calls have been made. Every tool call gets a tool message in reply, so the
+// returned messages are a valid history for the next run. On error the run
+// so far is returned along with it.
+func (h *AIHandler) runAgent(systemPrompt string, history []chatMessage, maxIterations int, runTool toolRunner) (*agentRun, error) {
+	run := &agentRun{}
+	glmMessages := append([]chatMessage{{Role: "system", Content: systemPrompt}}, history...)
+
+	for run.Iterations < maxIterations {
+		run.Iterations++
+		reply, usage, err := h.agentCompletion(glmMessages)
+		if err != nil {
+			return run, err
+		}
+		if usage != nil {
+			run.Usage.PromptTokens += usage.PromptTokens
+			run.Usage.CompletionTokens += usage.CompletionTokens
+			run.Usage.TotalTokens += usage.TotalTokens
+		}
+
+		assistant := chatMessage{Role: "assistant", Content: reply.Content, ToolCalls: reply.ToolCalls}
+		run.Messages = append(run.Messages, assistant)
+		glmMessages = append(glmMessages, assistant)
+		if len(reply.ToolCalls) == 0 {
+			run.Answer = reply.Content
+			return run, nil
+		}
+
+		for _, call := range reply.ToolCalls {
+			step := runTool(call)
+			run.Steps = append(run.Steps, step)
+			result := chatMessage{Role: "tool", ToolCallID: call.ID, Content: step.Result}
+			run.Messages = append(run.Messages, result)
+			glmMessages = append(glmMessages, result)
+		}
+	}
+
+	run.Capped = true
+	run.Answer = fmt.Sprintf("Stopped after %d iterations without reaching an answer. "+
+		"Ask a narrower question or raise max_iterations.", maxIterations)
+	run.Messages = append(run.Messages, chatMessage{Role: "assistant", Content: run.Answer})
+	return run, nil
+}
+
+// agentReply is the assistant message of a GLM completion.
+type agentReply struct {
+	Content   string           `json:"content"`
+	ToolCalls []tools.ToolCall `json:"tool_calls"`
+}
+
+// agentCompletion makes one non-streaming GLM call offering every tool.
+func (h *AIHandler) agentCompletion(messages []chatMessage) (*agentReply, *glmUsage, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":       h.cfg.GLMModel,
+		"messages":    messages,
+		"tools":       h.toolRegistry.GetToolDefinitions(),
+		"tool_choice": "auto",
+		"stream":      false,
+	})
+	httpReq, err := http.NewRequest("POST", h.cfg.GLMAPIURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+h.cfg.GLMAPIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("GLM returned %s: %s", resp.Status, truncate(string(respBody), 200))
+	}
+
+	var glmResp struct {
+		Choices []struct {
+			Message agentReply `json:"message"`
+		} `json:"choices"`
+		Usage *glmUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(respBody, &glmResp); err != nil {
+		return nil, nil, fmt.Errorf("invalid GLM response: %w", err)
+	}
+	if len(glmResp.Choices) == 0 {
+		return nil, glmResp.Usage, fmt.Errorf("GLM returned no choices")
+	}
+	return &glmResp.Choices[0].Message, glmResp.Usage, nil
+}
+
+// agentToolRunner runs tool calls through the ToolRegistry, scoped to the
+// conversation's server. Calls agentToolBlocked rejects are not run and are
+// reported back to the model as needing confirmation. Commands, run or not,
+// and database queries are audited as the user.
+func (h *AIHandler) agentToolRunner(c *fiber.Ctx, convID uuid.UUID, serverID *uuid.UUID) toolRunner {
+	return func(call tools.ToolCall) agentStep {
+		step := agentStep{Tool: call.Function.Name, Arguments: map[string]interface{}{}}
+		var runErr error
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &step.Arguments); err != nil {
+				step.Result = "Invalid tool arguments: " + err.Error()
+				return step
+			}
+		}
+
+		args := make(map[string]interface{}, len(step.Arguments)+1)
+		for k, v := range step.Arguments {
+			args[k] = v
+		}
+		if serverID != nil {
+			args["conversation_server_id"] = serverID.String()
+		}
+
+		if reason := agentToolBlocked(step.Tool, step.Arguments); reason != "" {
+			step.Blocked = true
+			step.Result = reason
+		} else {
+			result, err := h.toolRegistry.ExecuteTool(step.Tool, args)
+			runErr = err
+			if err != nil && result == "" {
+				result = "Error: " + err.Error()
+			}
+			step.Result = truncate(result, maxToolResultLen)
+		}
+
+		switch step.Tool {
+		case "execute_command":
+			// The server the call ran on, or would have run on if blocked
+			command, _ := step.Arguments["command"].(string)
+			target := ""
+			if server, err := h.toolRegistry.ResolveServer(args); err == nil {
+				target = server.ID.String()
+			}
+			auditAction(c, h.db, "ai.command", target, map[string]interface{}{
+				"command":         services.RedactSecrets(command),
+				"blocked":         step.Blocked,
+				"conversation_id": convID,
+			}, nil)
+		case "query_database":
+			connID, _ := step.Arguments["connection_id"].(string)
+			sql, _ := step.Arguments["sql"].(string)
+			target := connID
+			var conn models.DatabaseConnection
+			if id, err := uuid.Parse(connID); err == nil && h.db.Select("name").First(&conn, "id = ?", id).Error == nil {
+				target = conn.Name
+			}
+			auditAction(c, h.db, "ai.query_database", target, map[string]interface{}{
+				"connection_id":   connID,
+				"sql":             sql,
+				"conversation_id": convID,
+			}, runErr)
+		}
+		return step
+	}
+}
+
+// agentToolBlocked returns why the agent may not run a tool call without
+// the user, or "" when it may: command lines with shell syntax, commands the
+// safety checker flags and app restarts need confirmation through
+// /ai/execute.
+func agentToolBlocked(tool string, args map[string]interface{}) string {
+	switch tool {
+	case "execute_command":
+		command, _ := args["command"].(string)
+		if services.HasShellSyntax(command) {
+			return "Not run: chained, piped, redirected or substituted commands need the user's confirmation. " +
+				"Run one simple command per call, or tell the user the exact command so they can run it."
+		}
+		safety := services.DefaultSafetyChecker.CheckCommandLine(command)
+		if !safety.IsSafe {
+			return fmt.Sprintf("Not run: '%s' is classified as %s and needs the user's confirmation. "+
+				"Tell the user the exact command so they can run it.", safety.BaseCommand, safety.Category)
+		}
+	case "restart_app":
+		return "Not run: restarting an application needs the user's confirmation. " +
+			"Tell the user which application to restart."
+	}
+	return ""
+}
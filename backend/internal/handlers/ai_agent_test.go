@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ahmetk3436/bastion/internal/config"
+	"github.com/ahmetk3436/bastion/internal/tools"
+)
+
+// mockGLM answers chat completions with replies in order and records the
+// request bodies it received.
+type mockGLM struct {
+	replies []string // JSON of each assistant message
+
+	mu       sync.Mutex
+	requests []map[string]json.RawMessage
+}
+
+func (m *mockGLM) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		m.mu.Lock()
+		n := len(m.requests)
+		m.requests = append(m.requests, body)
+		m.mu.Unlock()
+		if n >= len(m.replies) {
+			http.Error(w, "unexpected request", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":` + m.replies[n] + `}],` +
+			`"usage":{"prompt_tokens":100,"completion_tokens":10,"total_tokens":110}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newMockAgentHandler(glmURL string) *AIHandler {
+	cfg := &config.Config{GLMAPIURL: glmURL, GLMModel: "glm-test", AIToolConcurrency: 1}
+	return &AIHandler{
+		cfg:          cfg,
+		client:       http.DefaultClient,
+		toolRegistry: tools.NewToolRegistry(cfg, nil, nil, nil, nil),
+	}
+}
+
+func TestRunAgentCallsToolThenAnswers(t *testing.T) {
+	glm := &mockGLM{replies: []string{
+		`{"content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_server_list","arguments":"{}"}}]}`,
+		`{"content":"You have one server, web-1, and it is online."}`,
+	}}
+	h := newMockAgentHandler(glm.start(t).URL)
+
+	var ran []string
+	runTool := func(call tools.ToolCall) agentStep {
+		ran = append(ran, call.Function.Name)
+		return agentStep{Tool: call.Function.Name, Result: "web-1 (online)"}
+	}
+	history := []chatMessage{{Role: "user", Content: "Which servers do I have?"}}
+	run, err := h.runAgent("system prompt", history, 5, runTool)
+	if err != nil {
+		t.Fatalf("runAgent: %v", err)
+	}
+
+	if run.Answer != "You have one server, web-1, and it is online." || run.Capped || run.Iterations != 2 {
+		t.Errorf("run = %q after %d iterations (capped %v), want the final answer after 2", run.Answer, run.Iterations, run.Capped)
+	}
+	if len(ran) != 1 || ran[0] != "get_server_list" {
+		t.Errorf("tools run = %v, want get_server_list", ran)
+	}
+	if run.Usage.TotalTokens != 220 {
+		t.Errorf("usage = %+v, want both calls summed", run.Usage)
+	}
+
+	// The trace is assistant tool call, tool result, final answer
+	roles := ""
+	for _, m := range run.Messages {
+		roles += m.Role + " "
+	}
+	if roles != "assistant tool assistant " || run.Messages[1].ToolCallID != "call_1" || run.Messages[1].Content != "web-1 (online)" {
+		t.Errorf("messages = %+v", run.Messages)
+	}
+
+	// Tools were offered and the tool result was sent back to the model
+	if len(glm.requests) != 2 {
+		t.Fatalf("GLM requests = %d, want 2", len(glm.requests))
+	}
+	var offered []struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	json.Unmarshal(glm.requests[0]["tools"], &offered)
+	if len(offered) == 0 {
+		t.Error("first request offered no tools")
+	}
+	var sent []chatMessage
+	json.Unmarshal(glm.requests[1]["messages"], &sent)
+	if len(sent) != 4 || sent[0].Role != "system" || sent[3].Role != "tool" || sent[3].ToolCallID != "call_1" {
+		t.Errorf("second request messages = %+v, want system, user, tool call and its result", sent)
+	}
+}
+
+func TestRunAgentStopsAtMaxIterations(t *testing.T) {
+	call := `{"content":"","tool_calls":[{"id":"call_x","type":"function","function":{"name":"get_server_list","arguments":"{}"}}]}`
+	glm := &mockGLM{replies: []string{call, call, call}}
+	h := newMockAgentHandler(glm.start(t).URL)
+
+	runTool := func(call tools.ToolCall) agentStep {
+		return agentStep{Tool: call.Function.Name, Result: "[]"}
+	}
+	run, err := h.runAgent("system prompt", []chatMessage{{Role: "user", Content: "loop"}}, 2, runTool)
+	if err != nil {
+		t.Fatalf("runAgent: %v", err)
+	}
+	if !run.Capped || run.Iterations != 2 || len(glm.requests) != 2 {
+		t.Errorf("run capped %v after %d iterations and %d requests, want capped after 2", run.Capped, run.Iterations, len(glm.requests))
+	}
+	if last := run.Messages[len(run.Messages)-1]; last.Role != "assistant" || last.Content != run.Answer {
+		t.Errorf("last message = %+v, want the capped answer saved", last)
+	}
+}
+
+func TestRunAgentReturnsGLMError(t *testing.T) {
+	glm := &mockGLM{}
+	h := newMockAgentHandler(glm.start(t).URL)
+
+	run, err := h.runAgent("system prompt", []chatMessage{{Role: "user", Content: "hi"}}, 3, nil)
+	if err == nil {
+		t.Fatal("runAgent succeeded against a failing GLM")
+	}
+	if run == nil || run.Iterations != 1 {
+		t.Errorf("run = %+v, want the partial run returned with the error", run)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// disconnectingWriter accepts a number of writes and then fails, as a
+// client connection does once the browser goes away.
+type disconnectingWriter struct {
+	writes int
+}
+
+func (w *disconnectingWriter) Write(p []byte) (int, error) {
+	if w.writes == 0 {
+		return 0, errors.New("broken pipe")
+	}
+	w.writes--
+	return len(p), nil
+}
+
+func TestStreamGLMReplyCancelsUpstreamOnDisconnect(t *testing.T) {
+	upstreamCancelled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, token := range []string{"Disk ", "usage ", "is "} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", token)
+			flusher.Flush()
+		}
+		// Keep generating until the request is cancelled
+		select {
+		case <-r.Context().Done():
+			close(upstreamCancelled)
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "POST", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client receives two tokens and is gone by the third
+	w := bufio.NewWriterSize(&disconnectingWriter{writes: 2}, 16)
+	assembled, _, err := streamGLMReply(ctx, cancel, nil, resp, w)
+	if err == nil {
+		t.Fatal("streamGLMReply succeeded although the client disconnected")
+	}
+	if assembled != "Disk usage is " {
+		t.Errorf("assembled = %q, want the partial answer kept for saving", assembled)
+	}
+
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream GLM request was not cancelled after the client disconnected")
+	}
+}
+
+func TestStreamGLMReplyCancelsUpstreamOnShutdown(t *testing.T) {
+	upstreamCancelled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(upstreamCancelled)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "POST", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shutdown := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := streamGLMReply(ctx, cancel, shutdown, resp, bufio.NewWriter(&disconnectingWriter{writes: 100}))
+		done <- err
+	}()
+	close(shutdown)
+
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream GLM request was not cancelled on shutdown")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("streamGLMReply did not return after shutdown")
+	}
+}
@@ -1,14 +1,22 @@
 package handlers
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Simulation bounds: the replayed window and the metric rows it may load.
+const (
+	maxSimulationWindow  = 31 * 24 * time.Hour
+	maxSimulationSamples = 50000
+)
+
 type AlertHandler struct {
 	db *gorm.DB
 }
@@ -38,7 +46,12 @@ func (h *AlertHandler) CreateAlertRule(c *fiber.Ctx) error {
 		Operator            string  `json:"operator"`
 		Threshold           float64 `json:"threshold"`
 		DurationSeconds     int     `json:"duration_seconds"`
+		Severity            string  `json:"severity"`
 		NotificationChannel string  `json:"notification_channel"`
+		ServerID            string  `json:"server_id"`         // command rules
+		Command             string  `json:"command"`           // command rules
+		FailureThreshold    int     `json:"failure_threshold"` // command rules
+		WindowSeconds       int     `json:"window_seconds"`    // command rules
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -48,6 +61,34 @@ func (h *AlertHandler) CreateAlertRule(c *fiber.Ctx) error {
 		})
 	}
 
+	// Command rules watch exit codes rather than a metric
+	var commandServer *uuid.UUID
+	if req.Type == "command" {
+		serverID, err := uuid.Parse(req.ServerID)
+		if err != nil || req.Command == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Command rules require server_id and command",
+			})
+		}
+		var count int64
+		h.db.Model(&models.Server{}).Where("id = ?", serverID).Count(&count)
+		if count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "Server not found",
+			})
+		}
+		if req.FailureThreshold < 0 || req.WindowSeconds < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "failure_threshold and window_seconds must not be negative",
+			})
+		}
+		commandServer = &serverID
+		req.Metric = "exit_code"
+	}
+
 	if req.Name == "" || req.Type == "" || req.Metric == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
@@ -56,19 +97,37 @@ func (h *AlertHandler) CreateAlertRule(c *fiber.Ctx) error {
 	}
 
 	// Validate operator
-	validOps := map[string]bool{">": true, "<": true, ">=": true, "<=": true, "==": true}
-	if req.Operator != "" && !validOps[req.Operator] {
+	if req.Operator != "" && !services.ValidAlertOperators[req.Operator] {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
 			"message": "Invalid operator. Must be: >, <, >=, <=, ==",
 		})
 	}
 
+	switch req.Severity {
+	case "", "critical", "warning", "info":
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid severity. Must be: critical, warning, info",
+		})
+	}
+
+	if req.NotificationChannel != "" && !services.ValidNotificationChannels[req.NotificationChannel] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid notification_channel. Must be: dashboard, email, webhook",
+		})
+	}
+
 	rule := models.AlertRule{
-		Name:      req.Name,
-		Type:      req.Type,
-		Metric:    req.Metric,
-		Threshold: req.Threshold,
+		Name:          req.Name,
+		Type:          req.Type,
+		Metric:        req.Metric,
+		Threshold:     req.Threshold,
+		ServerID:      commandServer,
+		Command:       req.Command,
+		WindowSeconds: req.WindowSeconds,
 	}
 
 	if req.Operator != "" {
@@ -77,11 +136,17 @@ func (h *AlertHandler) CreateAlertRule(c *fiber.Ctx) error {
 	if req.DurationSeconds > 0 {
 		rule.DurationSeconds = req.DurationSeconds
 	}
+	if req.Severity != "" {
+		rule.Severity = req.Severity
+	}
+	if req.FailureThreshold > 0 {
+		rule.FailureThreshold = req.FailureThreshold
+	}
 	if req.NotificationChannel != "" {
 		rule.NotificationChannel = req.NotificationChannel
 	}
 
-	if err := h.db.Create(&rule).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Create(&rule).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to create alert rule",
@@ -91,6 +156,128 @@ func (h *AlertHandler) CreateAlertRule(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(rule)
 }
 
+// SimulateAlertRule replays a rule definition against historical metrics
+// and reports how often it would have fired.
+func (h *AlertHandler) SimulateAlertRule(c *fiber.Ctx) error {
+	var req struct {
+		Type            string  `json:"type"`
+		Metric          string  `json:"metric"`
+		Operator        string  `json:"operator"`
+		Threshold       float64 `json:"threshold"`
+		DurationSeconds int     `json:"duration_seconds"`
+		ServerID        string  `json:"server_id"`
+		From            string  `json:"from"`
+		To              string  `json:"to"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+
+	if req.Metric == "" && req.Type == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Metric or type is required",
+		})
+	}
+	if req.Type == "command" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Simulation is only available for metric rules",
+		})
+	}
+
+	if req.Operator != "" && !services.ValidAlertOperators[req.Operator] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid operator. Must be: >, <, >=, <=, ==",
+		})
+	}
+
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	if req.From != "" {
+		t, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid from timestamp (expected RFC3339)",
+			})
+		}
+		from = t
+	}
+	if req.To != "" {
+		t, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid to timestamp (expected RFC3339)",
+			})
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "from must be before to",
+		})
+	}
+	if to.Sub(from) > maxSimulationWindow {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Simulation window must be at most 31 days",
+		})
+	}
+
+	rule := models.AlertRule{
+		Type:            req.Type,
+		Metric:          req.Metric,
+		Operator:        req.Operator,
+		Threshold:       req.Threshold,
+		DurationSeconds: req.DurationSeconds,
+	}
+
+	query := h.db.WithContext(c.UserContext()).Where("collected_at BETWEEN ? AND ?", from, to)
+	if req.ServerID != "" {
+		serverID, err := uuid.Parse(req.ServerID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid server ID",
+			})
+		}
+		query = query.Where("server_id = ?", serverID)
+	}
+
+	// Fetch one extra row to detect a window with too many samples
+	var samples []models.ServerMetrics
+	if err := query.Order("collected_at ASC").Limit(maxSimulationSamples + 1).Find(&samples).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to load metrics",
+		})
+	}
+	if len(samples) > maxSimulationSamples {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("More than %d samples in range; narrow the window or pick a server", maxSimulationSamples),
+		})
+	}
+
+	triggers := services.SimulateAlertRule(&rule, samples)
+
+	return c.JSON(fiber.Map{
+		"from":          from,
+		"to":            to,
+		"samples":       len(samples),
+		"trigger_count": len(triggers),
+		"triggers":      triggers,
+	})
+}
+
 // DeleteAlertRule soft-deletes an alert rule.
 func (h *AlertHandler) DeleteAlertRule(c *fiber.Ctx) error {
 	id, err := uuid.Parse(c.Params("id"))
@@ -101,7 +288,7 @@ func (h *AlertHandler) DeleteAlertRule(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.db.Delete(&models.AlertRule{}, "id = ?", id).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Delete(&models.AlertRule{}, "id = ?", id).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to delete alert rule",
@@ -188,3 +375,147 @@ func (h *AlertHandler) ResolveAlert(c *fiber.Ctx) error {
 		"alert":   alert,
 	})
 }
+
+// maxBulkAlerts bounds how many alerts one bulk request may change.
+const maxBulkAlerts = 500
+
+// bulkAlertResult reports the outcome for one alert in a bulk request.
+type bulkAlertResult struct {
+	ID     uuid.UUID `json:"id"`
+	OK     bool      `json:"ok"`
+	Status string    `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// BulkUpdateAlerts acknowledges or resolves many alerts in one transaction.
+// Alerts are selected by explicit IDs, or with all_firing by every firing
+// alert optionally narrowed by severity and rule_id.
+func (h *AlertHandler) BulkUpdateAlerts(c *fiber.Ctx) error {
+	var req struct {
+		Action    string   `json:"action"` // acknowledge, resolve
+		IDs       []string `json:"ids"`
+		AllFiring bool     `json:"all_firing"`
+		Severity  string   `json:"severity"`
+		RuleID    string   `json:"rule_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+
+	if req.Action != "acknowledge" && req.Action != "resolve" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "action must be 'acknowledge' or 'resolve'",
+		})
+	}
+	if req.AllFiring == (len(req.IDs) > 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Provide either ids or all_firing",
+		})
+	}
+	if len(req.IDs) > maxBulkAlerts {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Too many alerts in one request",
+		})
+	}
+	if req.RuleID != "" {
+		if _, err := uuid.Parse(req.RuleID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid rule_id",
+			})
+		}
+	}
+
+	var ids []uuid.UUID
+	results := []bulkAlertResult{}
+	for _, raw := range req.IDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			results = append(results, bulkAlertResult{Error: "invalid alert ID: " + raw})
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	now := time.Now()
+	updated := 0
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.Alert{})
+		if req.AllFiring {
+			query = query.Where("status = ?", "firing")
+			if req.Severity != "" {
+				query = query.Where("severity = ?", req.Severity)
+			}
+			if req.RuleID != "" {
+				query = query.Where("rule_id = ?", req.RuleID)
+			}
+			query = query.Limit(maxBulkAlerts)
+		} else {
+			query = query.Where("id IN ?", ids)
+		}
+
+		var alerts []models.Alert
+		if err := query.Find(&alerts).Error; err != nil {
+			return err
+		}
+
+		found := make(map[uuid.UUID]bool, len(alerts))
+		for i := range alerts {
+			alert := &alerts[i]
+			found[alert.ID] = true
+
+			if alert.Status == "resolved" {
+				results = append(results, bulkAlertResult{ID: alert.ID, Status: alert.Status, Error: "already resolved"})
+				continue
+			}
+
+			switch req.Action {
+			case "acknowledge":
+				alert.Status = "acknowledged"
+				alert.AcknowledgedAt = &now
+			case "resolve":
+				alert.Status = "resolved"
+				alert.ResolvedAt = &now
+			}
+			if err := tx.Save(alert).Error; err != nil {
+				return err
+			}
+			results = append(results, bulkAlertResult{ID: alert.ID, OK: true, Status: alert.Status})
+			updated++
+		}
+
+		for _, id := range ids {
+			if !found[id] {
+				results = append(results, bulkAlertResult{ID: id, Error: "alert not found"})
+			}
+		}
+
+		actor, _ := c.Locals("username").(string)
+		return CreateAuditLog(tx, actor, "alert.bulk_"+req.Action, "alerts", map[string]interface{}{
+			"updated":    updated,
+			"requested":  len(req.IDs),
+			"all_firing": req.AllFiring,
+			"severity":   req.Severity,
+			"rule_id":    req.RuleID,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update alerts",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"action":  req.Action,
+		"updated": updated,
+		"results": results,
+	})
+}
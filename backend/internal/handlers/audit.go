@@ -2,14 +2,68 @@ package handlers
 
 import (
 	"encoding/json"
+	"log/slog"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
+// auditEvent is the JSON shape sent to the external sink.
+type auditEvent struct {
+	Event     string      `json:"event"` // audit, security
+	ID        string      `json:"id,omitempty"`
+	Actor     string      `json:"actor"`
+	Action    string      `json:"action"`
+	Target    string      `json:"target,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// RegisterAuditForwarder installs a GORM callback that sends a copy of every
+// audit row to f once it is written. The database remains the source of
+// truth.
+func RegisterAuditForwarder(db *gorm.DB, f *services.AuditForwarder) error {
+	return db.Callback().Create().After("gorm:create").Register("audit:forward", func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		log, ok := tx.Statement.Dest.(*models.AuditLog)
+		if !ok {
+			return
+		}
+		event := auditEvent{
+			Event:     "audit",
+			ID:        log.ID.String(),
+			Actor:     log.Actor,
+			Action:    log.Action,
+			Target:    log.Target,
+			Timestamp: log.CreatedAt,
+		}
+		if len(log.Details) > 0 {
+			event.Details = log.Details
+		}
+		f.Forward(event)
+	})
+}
+
+// forwardSecurityEvent forwards an event that is not stored as an audit row,
+// such as a login attempt.
+func (h *AuthHandler) forwardSecurityEvent(actor, action string, details map[string]interface{}) {
+	h.auditForwarder.Forward(auditEvent{
+		Event:     "security",
+		Actor:     actor,
+		Action:    action,
+		Details:   details,
+		Timestamp: time.Now(),
+	})
+}
+
 type AuditHandler struct {
 	db *gorm.DB
 }
@@ -18,12 +72,15 @@ func NewAuditHandler(db *gorm.DB) *AuditHandler {
 	return &AuditHandler{db: db}
 }
 
-// ListAuditLogs returns paginated audit logs, filterable by actor and action.
+// ListAuditLogs returns paginated audit logs, filterable by actor, action,
+// target substring and a created_at range (from/to, RFC3339). order is
+// "desc" (default) or "asc".
 func (h *AuditHandler) ListAuditLogs(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	perPage, _ := strconv.Atoi(c.Query("per_page", "50"))
 	actor := c.Query("actor", "")
 	action := c.Query("action", "")
+	target := strings.TrimSpace(c.Query("target", ""))
 
 	if page < 1 {
 		page = 1
@@ -32,6 +89,39 @@ func (h *AuditHandler) ListAuditLogs(c *fiber.Ctx) error {
 		perPage = 50
 	}
 
+	order := strings.ToLower(c.Query("order", "desc"))
+	if order != "asc" && order != "desc" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "order must be asc or desc",
+		})
+	}
+
+	var from, to time.Time
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": p.name + " must be an RFC3339 timestamp, e.g. 2026-01-02T15:04:05Z",
+			})
+		}
+		*p.dst = t
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "to must not be before from",
+		})
+	}
+
 	query := h.db.Model(&models.AuditLog{})
 
 	if actor != "" {
@@ -40,12 +130,21 @@ func (h *AuditHandler) ListAuditLogs(c *fiber.Ctx) error {
 	if action != "" {
 		query = query.Where("action = ?", action)
 	}
+	if target != "" {
+		query = query.Where("LOWER(target) LIKE ?", likeContains(strings.ToLower(target)))
+	}
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
 
 	var total int64
 	query.Count(&total)
 
 	var logs []models.AuditLog
-	if err := query.Order("created_at DESC").
+	if err := query.Order("created_at " + strings.ToUpper(order)).
 		Offset((page - 1) * perPage).
 		Limit(perPage).
 		Find(&logs).Error; err != nil {
@@ -63,6 +162,15 @@ func (h *AuditHandler) ListAuditLogs(c *fiber.Ctx) error {
 	})
 }
 
+// likeEscaper escapes LIKE wildcards with Postgres's default escape, a backslash.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// likeContains returns a LIKE pattern matching values that contain s
+// literally, so "%" or "_" in user input do not act as wildcards.
+func likeContains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
 // CreateAuditLog is an internal helper to record audit entries.
 func CreateAuditLog(db *gorm.DB, actor, action, target string, details map[string]interface{}) error {
 	var detailsJSON datatypes.JSON
@@ -82,3 +190,18 @@ func CreateAuditLog(db *gorm.DB, actor, action, target string, details map[strin
 
 	return db.Create(&log).Error
 }
+
+// auditAction records an action taken by the request's user along with
+// whether it succeeded. A failed insert is logged and never fails the
+// request.
+func auditAction(c *fiber.Ctx, db *gorm.DB, action, target string, details map[string]interface{}, err error) {
+	details["result"] = "ok"
+	if err != nil {
+		details["result"] = "failed"
+		details["error"] = err.Error()
+	}
+	actor, _ := c.Locals("username").(string)
+	if err := CreateAuditLog(db, actor, action, target, details); err != nil {
+		slog.Error("Failed to write audit entry", "action", action, "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+
+	"github.com/ahmetk3436/bastion/internal/middleware"
+	"gorm.io/gorm"
+)
+
+// auditedTables maps tables whose changes are audited automatically to the
+// action prefix used in the audit log. High-churn tables (metrics, pings)
+// are deliberately absent.
+var auditedTables = map[string]string{
+	"servers":              "server",
+	"monitors":             "monitor",
+	"alert_rules":          "alert_rule",
+	"cron_jobs":            "cron",
+	"server_secrets":       "secret",
+	"database_connections": "db_connection",
+	"server_shares":        "server_share",
+}
+
+// RegisterAuditHooks installs GORM callbacks that write an audit entry for
+// every create, update and delete on audited tables. Only statements whose
+// context carries an actor (see middleware.WithActor) are audited, so
+// background bookkeeping such as status updates from the collectors is not.
+func RegisterAuditHooks(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:create").Register("audit:create", auditCallback("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("audit:update", auditCallback("update")); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("audit:delete", auditCallback("delete"))
+}
+
+func auditCallback(op string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.RowsAffected == 0 || tx.Statement.Schema == nil {
+			return
+		}
+		prefix, ok := auditedTables[tx.Statement.Schema.Table]
+		if !ok {
+			return
+		}
+		actor := middleware.ActorFromContext(tx.Statement.Context)
+		if actor == "" {
+			return
+		}
+
+		target, details := auditTarget(tx, op)
+		if op == "update" {
+			if fields := updatedFields(tx.Statement.Dest); len(fields) > 0 {
+				details["fields"] = fields
+			}
+		}
+
+		// Same connection (and transaction) as the change, without its clauses
+		session := tx.Session(&gorm.Session{NewDB: true})
+		if err := CreateAuditLog(session, actor, prefix+"."+op, target, details); err != nil {
+			slog.Error("Failed to write audit entry", "action", prefix+"."+op, "error", err)
+		}
+	}
+}
+
+// auditTarget returns the primary key of the changed row. Deletes that
+// address rows by condition only (e.g. Delete(&Model{}, "id = ?", id)) are
+// described by their SQL instead.
+func auditTarget(tx *gorm.DB, op string) (string, map[string]interface{}) {
+	details := map[string]interface{}{"table": tx.Statement.Schema.Table}
+
+	rv := tx.Statement.ReflectValue
+	if pk := tx.Statement.Schema.PrioritizedPrimaryField; pk != nil && rv.Kind() == reflect.Struct {
+		if v, zero := pk.ValueOf(tx.Statement.Context, rv); !zero {
+			return fmt.Sprint(v), details
+		}
+	}
+
+	if op == "delete" {
+		details["statement"] = tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...)
+	}
+	return "", details
+}
+
+// updatedFields lists the column names of a map-based update. Values are
+// omitted so credentials never reach the audit log.
+func updatedFields(dest interface{}) []string {
+	m, ok := dest.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	fields := make([]string, 0, len(m))
+	for k := range m {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	return fields
+}
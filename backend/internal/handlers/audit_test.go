@@ -0,0 +1,20 @@
+package handlers
+
+import "testing"
+
+func TestLikeContains(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"web", "%web%"},
+		{"100%", `%100\%%`},
+		{"db_1", `%db\_1%`},
+		{`C:\logs`, `%C:\\logs%`},
+		{"", "%%"},
+	}
+	for _, tt := range tests {
+		if got := likeContains(tt.in); got != tt.want {
+			t.Errorf("likeContains(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
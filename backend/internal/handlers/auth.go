@@ -1,33 +1,136 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ahmetk3436/bastion/internal/config"
 	"github.com/ahmetk3436/bastion/internal/middleware"
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// errRefreshReuse is returned when a consumed refresh token is presented again.
+var errRefreshReuse = errors.New("refresh token reuse detected")
+
 type AuthHandler struct {
-	cfg          *config.Config
-	passwordHash string
+	cfg     *config.Config
+	db      *gorm.DB
+	tokens  middleware.TokenSettings
+	limiter *loginLimiter
+
+	// auditForwarder receives security events such as login attempts; nil
+	// when forwarding is disabled.
+	auditForwarder *services.AuditForwarder
+
+	// dummyHash is compared against for unknown usernames, so a login
+	// takes as long whether or not the user exists.
+	dummyHash []byte
+}
+
+// TokenSettingsFromConfig collects the JWT settings from cfg.
+func TokenSettingsFromConfig(cfg *config.Config) middleware.TokenSettings {
+	return middleware.TokenSettings{
+		Secret:     cfg.JWTSecret,
+		Algorithm:  cfg.JWTAlgorithm,
+		AccessTTL:  cfg.JWTAccessTTL,
+		RefreshTTL: cfg.JWTRefreshTTL,
+	}
+}
+
+func NewAuthHandler(cfg *config.Config, db *gorm.DB, auditForwarder *services.AuditForwarder) *AuthHandler {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte(uuid.NewString()), bcrypt.DefaultCost)
+	h := &AuthHandler{
+		cfg:            cfg,
+		db:             db,
+		tokens:         TokenSettingsFromConfig(cfg),
+		limiter:        newLoginLimiter(),
+		auditForwarder: auditForwarder,
+		dummyHash:      dummyHash,
+	}
+	h.seedAdmin()
+	return h
 }
 
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	// Hash the admin password on startup
-	hash, err := bcrypt.GenerateFromPassword([]byte(cfg.AdminPassword), bcrypt.DefaultCost)
+// seedAdmin creates the admin user from ADMIN_* config when there are no
+// users yet. Afterwards the database is authoritative and the config
+// password is ignored.
+func (h *AuthHandler) seedAdmin() {
+	var count int64
+	if err := h.db.Model(&models.User{}).Count(&count).Error; err != nil {
+		slog.Error("Failed to count users", "error", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	if h.cfg.AdminPassword == "" {
+		slog.Error("No users exist and ADMIN_PASSWORD is empty; nobody can log in")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(h.cfg.AdminPassword), bcrypt.DefaultCost)
 	if err != nil {
 		slog.Error("Failed to hash admin password", "error", err)
+		return
 	}
-	return &AuthHandler{
-		cfg:          cfg,
-		passwordHash: string(hash),
+	role := h.cfg.AdminRole
+	if !models.ValidRole(role) {
+		role = models.RoleAdmin
+	}
+	admin := models.User{
+		Username:     h.cfg.AdminUsername,
+		PasswordHash: string(hash),
+		DisplayName:  h.cfg.AdminDisplayName,
+		Role:         role,
 	}
+	if err := h.db.Create(&admin).Error; err != nil {
+		slog.Error("Failed to seed admin user", "username", admin.Username, "error", err)
+		return
+	}
+	slog.Info("Seeded admin user from config", "username", admin.Username)
 }
 
+// findUser loads an enabled user by username.
+func (h *AuthHandler) findUser(username string) (*models.User, error) {
+	var user models.User
+	if err := h.db.First(&user, "username = ?", username).Error; err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// CurrentRole returns the stored role of a user and whether they are still
+// enabled. JWTProtected checks it on every request, so disabling or demoting
+// a user takes effect before their access token expires.
+func (h *AuthHandler) CurrentRole(ctx context.Context, username string) (string, bool, error) {
+	var user models.User
+	err := h.db.WithContext(ctx).Select("role", "disabled").Take(&user, "username = ?", username).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return user.Role, !user.Disabled, nil
+}
+
+// Login checks a username and password and issues a token pair. Repeated
+// failures for a username or IP are refused with 429 for a while; see
+// loginLimiter.
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req struct {
 		Username string `json:"username"`
@@ -40,24 +143,52 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Username != h.cfg.AdminUsername {
+	if wait := h.limiter.lockedFor(req.Username, c.IP()); wait > 0 {
+		h.forwardSecurityEvent(req.Username, "auth.login_locked", map[string]interface{}{"ip": c.IP()})
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   true,
+			"message": "Too many failed login attempts, try again later",
+		})
+	}
+
+	var user models.User
+	if err := h.db.First(&user, "username = ?", req.Username).Error; err != nil {
+		bcrypt.CompareHashAndPassword(h.dummyHash, []byte(req.Password))
+		h.limiter.fail(req.Username, c.IP())
+		h.forwardSecurityEvent(req.Username, "auth.login_failed", map[string]interface{}{"ip": c.IP(), "reason": "unknown_user"})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error":   true,
 			"message": "Invalid credentials",
 		})
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(h.passwordHash), []byte(req.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		h.limiter.fail(req.Username, c.IP())
+		h.forwardSecurityEvent(req.Username, "auth.login_failed", map[string]interface{}{"ip": c.IP(), "reason": "bad_password"})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error":   true,
 			"message": "Invalid credentials",
 		})
 	}
+	if user.Disabled {
+		h.limiter.fail(req.Username, c.IP())
+		h.forwardSecurityEvent(req.Username, "auth.login_failed", map[string]interface{}{"ip": c.IP(), "reason": "disabled"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid credentials",
+		})
+	}
+	h.limiter.reset(req.Username, c.IP())
+	h.forwardSecurityEvent(req.Username, "auth.login", map[string]interface{}{"ip": c.IP()})
+	h.db.Model(&user).Update("last_login_at", time.Now())
 
-	displayName := h.cfg.AdminDisplayName
-	role := h.cfg.AdminRole
+	displayName := user.DisplayName
+	role := user.Role
 
-	access, refresh, err := middleware.GenerateTokens(req.Username, h.cfg.JWTSecret, displayName, role)
+	// Each login starts a new refresh token family
+	h.db.Where("expires_at < ?", time.Now()).Delete(&models.RefreshToken{})
+	access, refresh, err := h.issueTokens(h.db, uuid.New(), user.Username, displayName, role)
 	if err != nil {
 		slog.Error("Failed to generate tokens", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -92,20 +223,43 @@ func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
 		})
 	}
 
-	claims := &middleware.Claims{}
-	token, err := jwt.ParseWithClaims(req.RefreshToken, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(h.cfg.JWTSecret), nil
-	})
+	claims, ok := h.parseRefresh(req.RefreshToken)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid or expired refresh token",
+		})
+	}
 
-	if err != nil || !token.Valid {
+	// Disabled users lose their sessions; role and name changes apply now
+	user, err := h.findUser(claims.Username)
+	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error":   true,
 			"message": "Invalid or expired refresh token",
 		})
 	}
 
-	access, refresh, err := middleware.GenerateTokens(claims.Username, h.cfg.JWTSecret, claims.DisplayName, claims.Role)
+	access, refresh, err := h.rotate(claims, user)
+	if errors.Is(err, errRefreshReuse) {
+		details := map[string]interface{}{"ip": c.IP(), "jti": claims.ID}
+		if err := CreateAuditLog(h.db, claims.Username, "auth.refresh_reuse", claims.Username, details); err != nil {
+			slog.Error("Failed to write audit entry", "action", "auth.refresh_reuse", "error", err)
+		}
+		h.forwardSecurityEvent(claims.Username, "auth.refresh_reuse", details)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Refresh token was already used; all sessions from this login were revoked, please log in again",
+		})
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid or expired refresh token",
+		})
+	}
 	if err != nil {
+		slog.Error("Failed to rotate refresh token", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to generate tokens",
@@ -116,24 +270,147 @@ func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
 		"access_token":  access,
 		"refresh_token": refresh,
 		"user": fiber.Map{
-			"username":        claims.Username,
-			"display_name":    claims.DisplayName,
-			"role":            claims.Role,
-			"avatar_initials": buildInitials(claims.DisplayName),
+			"username":        user.Username,
+			"display_name":    user.DisplayName,
+			"role":            user.Role,
+			"avatar_initials": buildInitials(user.DisplayName),
 		},
 	})
 }
 
+// Logout revokes the session a refresh token belongs to: the token and
+// every other token rotated from the same login stop working. Access tokens
+// already issued remain valid until they expire.
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+
+	claims, ok := h.parseRefresh(req.RefreshToken)
+	var record models.RefreshToken
+	if ok {
+		ok = h.db.First(&record, "id = ?", claims.ID).Error == nil
+	}
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid or expired refresh token",
+		})
+	}
+
+	if err := h.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", record.FamilyID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		slog.Error("Failed to revoke refresh tokens", "username", claims.Username, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to log out",
+		})
+	}
+	if err := CreateAuditLog(h.db, claims.Username, "auth.logout", claims.Username, map[string]interface{}{"ip": c.IP()}); err != nil {
+		slog.Error("Failed to write audit entry", "action", "auth.logout", "error", err)
+	}
+
+	return c.JSON(fiber.Map{"message": "Logged out"})
+}
+
+// parseRefresh verifies a refresh token's signature, expiry and type.
+func (h *AuthHandler) parseRefresh(raw string) (*middleware.Claims, bool) {
+	claims := &middleware.Claims{}
+	token, err := h.tokens.Parse(raw, claims)
+	if err != nil || !token.Valid || !claims.IsRefresh() {
+		return nil, false
+	}
+	if _, err := uuid.Parse(claims.ID); err != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// issueTokens generates a token pair and records the refresh token as the
+// newest member of family.
+func (h *AuthHandler) issueTokens(tx *gorm.DB, family uuid.UUID, username, displayName, role string) (string, string, error) {
+	record := models.RefreshToken{
+		ID:        uuid.New(),
+		FamilyID:  family,
+		Username:  username,
+		ExpiresAt: time.Now().Add(h.tokens.RefreshTTL),
+	}
+	access, refresh, err := middleware.GenerateTokens(h.tokens, username, displayName, role, record.ID.String())
+	if err != nil {
+		return "", "", err
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", "", err
+	}
+	return access, refresh, nil
+}
+
+// rotate consumes the presented refresh token and issues the next one in its
+// family, with user's current name and role. Presenting a token that was
+// already consumed revokes the whole family, since either the client or an
+// attacker holds a stale copy. Unknown or revoked tokens return
+// gorm.ErrRecordNotFound.
+func (h *AuthHandler) rotate(claims *middleware.Claims, user *models.User) (access, refresh string, err error) {
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return "", "", gorm.ErrRecordNotFound
+	}
+
+	reused := false
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var record models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&record, "id = ?", jti).Error; err != nil {
+			return err
+		}
+		if record.RevokedAt != nil {
+			return gorm.ErrRecordNotFound
+		}
+
+		now := time.Now()
+		if record.UsedAt != nil {
+			reused = true
+			return tx.Model(&models.RefreshToken{}).
+				Where("family_id = ? AND revoked_at IS NULL", record.FamilyID).
+				Update("revoked_at", now).Error
+		}
+
+		if err := tx.Model(&record).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		access, refresh, err = h.issueTokens(tx, record.FamilyID, user.Username, user.DisplayName, user.Role)
+		return err
+	})
+	if err == nil && reused {
+		slog.Warn("Refresh token reuse detected, family revoked", "username", claims.Username, "jti", jti)
+		return "", "", errRefreshReuse
+	}
+	return access, refresh, err
+}
+
 func (h *AuthHandler) Me(c *fiber.Ctx) error {
 	username, _ := c.Locals("username").(string)
-	displayName, _ := c.Locals("display_name").(string)
-	role, _ := c.Locals("role").(string)
+	user, err := h.findUser(username)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "User not found or disabled",
+		})
+	}
 
 	return c.JSON(fiber.Map{
-		"username":        username,
-		"display_name":    displayName,
-		"role":            role,
-		"avatar_initials": buildInitials(displayName),
+		"id":              user.ID,
+		"username":        user.Username,
+		"display_name":    user.DisplayName,
+		"role":            user.Role,
+		"avatar_initials": buildInitials(user.DisplayName),
+		"last_login_at":   user.LastLoginAt,
 	})
 }
 
@@ -163,8 +440,17 @@ func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
 		})
 	}
 
+	username, _ := c.Locals("username").(string)
+	user, err := h.findUser(username)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "User not found or disabled",
+		})
+	}
+
 	// Verify old password
-	if err := bcrypt.CompareHashAndPassword([]byte(h.passwordHash), []byte(req.OldPassword)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.OldPassword)); err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error":   true,
 			"message": "Current password is incorrect",
@@ -181,14 +467,51 @@ func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
 		})
 	}
 
-	h.passwordHash = string(newHash)
-	slog.Info("Admin password changed successfully")
+	// Sessions opened with the old password end with it; the caller gets a
+	// fresh pair so only this session carries on
+	var access, refresh string
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password_hash", string(newHash)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("username = ? AND revoked_at IS NULL", user.Username).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		access, refresh, err = h.issueTokens(tx, uuid.New(), user.Username, user.DisplayName, user.Role)
+		return err
+	})
+	if err != nil {
+		slog.Error("Failed to save new password", "username", username, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update password",
+		})
+	}
+	slog.Info("Password changed", "username", username)
+	h.forwardSecurityEvent(username, "auth.password_changed", map[string]interface{}{"ip": c.IP()})
 
 	return c.JSON(fiber.Map{
-		"message": "Password changed successfully",
+		"message":       "Password changed successfully",
+		"access_token":  access,
+		"refresh_token": refresh,
 	})
 }
 
+// VerifyPassword checks a password against an enabled user's stored hash.
+// Used to re-authenticate before sensitive operations.
+func (h *AuthHandler) VerifyPassword(username, password string) bool {
+	if password == "" {
+		return false
+	}
+	user, err := h.findUser(username)
+	if err != nil {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
 // buildInitials extracts uppercase initials from a display name.
 // e.g. "Ahmet Kizilkaya" -> "AK", "Ahmet" -> "A"
 func buildInitials(name string) string {
@@ -2,21 +2,58 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"strconv"
 	"time"
 
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/ssh"
 )
 
+// maxExecTimeout bounds the timeout_seconds a request may set.
+const maxExecTimeout = 3600
+
 type CommandHandler struct {
 	serverHandler *ServerHandler
+	execTimeout   time.Duration // default for requests without timeout_seconds
+}
+
+func NewCommandHandler(serverHandler *ServerHandler, execTimeout time.Duration) *CommandHandler {
+	return &CommandHandler{serverHandler: serverHandler, execTimeout: execTimeout}
 }
 
-func NewCommandHandler(serverHandler *ServerHandler) *CommandHandler {
-	return &CommandHandler{serverHandler: serverHandler}
+// execTimeout resolves a request's timeout_seconds: 0 means the configured
+// default, anything else must be between 1 and maxExecTimeout. Errors are
+// *fiber.Error values.
+func execTimeout(seconds int, def time.Duration) (time.Duration, error) {
+	if seconds == 0 {
+		return def, nil
+	}
+	if seconds < 1 || seconds > maxExecTimeout {
+		return 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("timeout_seconds must be between 1 and %d", maxExecTimeout))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// execErrorStatus is the response status for a failed SSH command: 504
+// when it was stopped at its timeout, 502 otherwise.
+func execErrorStatus(err error) int {
+	if errors.Is(err, services.ErrCommandTimeout) {
+		return fiber.StatusGatewayTimeout
+	}
+	return fiber.StatusBadGateway
+}
+
+// timedOutResponse returns an exec response as the 504 sent when the command was
+// stopped at its timeout; result carries the partial output.
+func timedOutResponse(c *fiber.Ctx, result fiber.Map, timeout time.Duration) error {
+	result["error"] = true
+	result["message"] = fmt.Sprintf("Command timed out after %s", timeout)
+	return c.Status(fiber.StatusGatewayTimeout).JSON(result)
 }
 
 func (h *CommandHandler) ExecCommand(c *fiber.Ctx) error {
@@ -29,7 +66,89 @@ func (h *CommandHandler) ExecCommand(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Command string `json:"command"`
+		Command        string   `json:"command"`
+		Env            []string `json:"env"`             // server secret keys to inject as environment variables
+		Confirm        bool     `json:"confirm"`         // required to run commands the safety checker flags
+		TimeoutSeconds int      `json:"timeout_seconds"` // overrides EXEC_TIMEOUT
+	}
+	if err := c.BodyParser(&req); err != nil || req.Command == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Command is required",
+		})
+	}
+	timeout, err := execTimeout(req.TimeoutSeconds, h.execTimeout)
+	if err != nil {
+		return err
+	}
+
+	safety := services.DefaultSafetyChecker.CheckCommandLine(req.Command)
+	if !safety.IsSafe && !req.Confirm {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error":                 true,
+			"message":               "Command '" + safety.BaseCommand + "' is classified as " + safety.Category + "; resend with confirm to run it",
+			"requires_confirmation": true,
+			"safety":                safetyVerdict(safety),
+		})
+	}
+
+	env, err := resolveSecrets(c, h.serverHandler, serverID, req.Env, "exec")
+	if err != nil {
+		return err
+	}
+
+	history, err := h.run(serverID, req.Command, env, timeout)
+	if err != nil {
+		return err
+	}
+
+	auditAction(c, h.serverHandler.GetDB(), "command.exec", serverID.String(), map[string]interface{}{
+		"command":    services.RedactSecrets(history.Command),
+		"exit_code":  history.ExitCode,
+		"history_id": history.ID,
+		"category":   safety.Category,
+		"timed_out":  history.TimedOut,
+	}, nil)
+
+	result := fiber.Map{
+		"command":     history.Command,
+		"output":      history.Output,
+		"exit_code":   history.ExitCode,
+		"duration_ms": history.DurationMs,
+		"id":          history.ID,
+		"safety":      safetyVerdict(safety),
+		"timed_out":   history.TimedOut,
+	}
+	if history.TimedOut {
+		return timedOutResponse(c, result, timeout)
+	}
+	return c.JSON(result)
+}
+
+// safetyVerdict is the safety classification returned with exec responses.
+func safetyVerdict(s services.CommandSafety) fiber.Map {
+	return fiber.Map{
+		"safe":         s.IsSafe,
+		"category":     s.Category,
+		"base_command": s.BaseCommand,
+	}
+}
+
+// DiffCommand runs a command and diffs its output against the previous run
+// of the same command on the same server.
+func (h *CommandHandler) DiffCommand(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var req struct {
+		Command        string `json:"command"`
+		Confirm        bool   `json:"confirm"`         // required to run commands the safety checker flags
+		TimeoutSeconds int    `json:"timeout_seconds"` // overrides EXEC_TIMEOUT
 	}
 	if err := c.BodyParser(&req); err != nil || req.Command == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -37,40 +156,119 @@ func (h *CommandHandler) ExecCommand(c *fiber.Ctx) error {
 			"message": "Command is required",
 		})
 	}
+	timeout, err := execTimeout(req.TimeoutSeconds, h.execTimeout)
+	if err != nil {
+		return err
+	}
+
+	safety := services.DefaultSafetyChecker.CheckCommandLine(req.Command)
+	if !safety.IsSafe && !req.Confirm {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error":                 true,
+			"message":               "Command '" + safety.BaseCommand + "' is classified as " + safety.Category + "; resend with confirm to run it",
+			"requires_confirmation": true,
+			"safety":                safetyVerdict(safety),
+		})
+	}
+
+	db := h.serverHandler.GetDB()
+
+	var previous models.CommandHistory
+	hasPrevious := db.Where("server_id = ? AND command = ? AND container = '' AND timed_out = false", serverID, req.Command).
+		Order("executed_at DESC").
+		First(&previous).Error == nil
+
+	current, err := h.run(serverID, req.Command, nil, timeout)
+	if err != nil {
+		return err
+	}
+
+	auditAction(c, db, "command.diff", serverID.String(), map[string]interface{}{
+		"command":    services.RedactSecrets(current.Command),
+		"exit_code":  current.ExitCode,
+		"history_id": current.ID,
+		"category":   safety.Category,
+		"timed_out":  current.TimedOut,
+	}, nil)
+
+	if current.TimedOut {
+		// A partial output would only diff as a spurious change
+		return timedOutResponse(c, fiber.Map{
+			"command":     current.Command,
+			"output":      current.Output,
+			"exit_code":   current.ExitCode,
+			"duration_ms": current.DurationMs,
+			"id":          current.ID,
+			"timed_out":   true,
+		}, timeout)
+	}
+
+	result := fiber.Map{
+		"command":     current.Command,
+		"output":      current.Output,
+		"exit_code":   current.ExitCode,
+		"duration_ms": current.DurationMs,
+		"id":          current.ID,
+		"output_hash": current.OutputHash,
+		"previous_id": nil,
+		"changed":     false,
+		"diff":        "",
+	}
+	if !hasPrevious {
+		return c.JSON(result)
+	}
+
+	// Rows recorded before hashes existed are hashed on the fly
+	prevHash := previous.OutputHash
+	if prevHash == "" {
+		prevHash = services.HashOutput(previous.Output)
+	}
+
+	result["previous_id"] = previous.ID
+	result["previous_executed_at"] = previous.ExecutedAt
+	if prevHash != current.OutputHash {
+		result["changed"] = true
+		result["diff"] = services.UnifiedDiff(previous.Output, current.Output,
+			"previous "+previous.ExecutedAt.Format(time.RFC3339),
+			"current "+current.ExecutedAt.Format(time.RFC3339))
+	}
 
+	return c.JSON(result)
+}
+
+// run executes a command over SSH and records it in history. env is exported
+// before the command but not recorded. A command still running after
+// timeout (0 waits forever) is stopped, its exit code recorded as -1 and the
+// history entry marked TimedOut. Errors are *fiber.Error values suitable for
+// returning from a handler.
+func (h *CommandHandler) run(serverID uuid.UUID, command string, env map[string]string, timeout time.Duration) (*models.CommandHistory, error) {
+	return h.execute(serverID, command, command, env, nil, timeout)
+}
+
+// execute is run with the history entry's command text given separately
+// and an optional stdin.
+func (h *CommandHandler) execute(serverID uuid.UUID, command, recorded string, env map[string]string, stdin io.Reader, timeout time.Duration) (*models.CommandHistory, error) {
 	db := h.serverHandler.GetDB()
 
 	var server models.Server
 	if err := db.First(&server, "id = ?", serverID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   true,
-			"message": "Server not found",
-		})
+		return nil, fiber.NewError(fiber.StatusNotFound, "Server not found")
 	}
 
 	password, privateKey, err := h.serverHandler.GetDecryptedCredentials(&server)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to decrypt credentials",
-		})
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to decrypt credentials")
 	}
 
 	pool := h.serverHandler.GetSSHPool()
-	client, err := pool.GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := pool.GetConnection(&server, password, privateKey)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"error":   true,
-			"message": "SSH connection failed: " + err.Error(),
-		})
+		return nil, fiber.NewError(fiber.StatusBadGateway, "SSH connection failed: "+err.Error())
 	}
 
 	session, err := client.NewSession()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to create SSH session",
-		})
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to create SSH session")
 	}
 	defer session.Close()
 
@@ -79,15 +277,10 @@ func (h *CommandHandler) ExecCommand(c *fiber.Ctx) error {
 	var stdout, stderr bytes.Buffer
 	session.Stdout = &stdout
 	session.Stderr = &stderr
+	command, session.Stdin = services.InjectEnv(env, command, stdin)
 
-	exitCode := 0
-	if err := session.Run(req.Command); err != nil {
-		if exitErr, ok := err.(*ssh.ExitError); ok {
-			exitCode = exitErr.ExitStatus()
-		} else {
-			exitCode = -1
-		}
-	}
+	exitCode, err := services.RunSession(session, services.WrapCommand(server.CommandPrefix, server.Shell, command), timeout)
+	timedOut := errors.Is(err, services.ErrCommandTimeout)
 
 	duration := time.Since(start)
 	output := stdout.String()
@@ -97,25 +290,24 @@ func (h *CommandHandler) ExecCommand(c *fiber.Ctx) error {
 		}
 		output += stderr.String()
 	}
+	if timedOut {
+		output += fmt.Sprintf("\n[Killed after %s timeout]", timeout)
+	}
 
 	// Save to history
 	history := models.CommandHistory{
 		ServerID:   serverID,
-		Command:    req.Command,
+		Command:    recorded,
 		Output:     output,
+		OutputHash: services.HashOutput(output),
 		ExitCode:   exitCode,
 		ExecutedAt: start,
 		DurationMs: int(duration.Milliseconds()),
+		TimedOut:   timedOut,
 	}
 	db.Create(&history)
 
-	return c.JSON(fiber.Map{
-		"command":     req.Command,
-		"output":      output,
-		"exit_code":   exitCode,
-		"duration_ms": duration.Milliseconds(),
-		"id":          history.ID,
-	})
+	return &history, nil
 }
 
 // ExitError wraps ssh exit status
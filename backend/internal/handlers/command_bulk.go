@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// bulkExecConcurrency bounds the servers BulkExec runs on at once.
+	bulkExecConcurrency = 8
+	maxBulkExecServers  = 100
+	bulkExecTimeout     = 5 * time.Minute // per server
+)
+
+// bulkExecResult is the outcome of a bulk command on one server.
+type bulkExecResult struct {
+	ServerID   uuid.UUID  `json:"server_id"`
+	Name       string     `json:"name"`
+	Output     string     `json:"output"`
+	ExitCode   int        `json:"exit_code"` // -1 when the command did not run or was killed
+	DurationMs int        `json:"duration_ms"`
+	HistoryID  *uuid.UUID `json:"history_id"`
+	TimedOut   bool       `json:"timed_out"`
+	Error      string     `json:"error,omitempty"` // why the command did not run
+}
+
+// BulkExec runs one command on several servers concurrently, chosen by
+// server_ids or by tag. The safety check applies to the whole batch: a
+// flagged command needs confirm before it runs anywhere. Each run is
+// recorded in its server's history and audited as command.exec.
+func (h *CommandHandler) BulkExec(c *fiber.Ctx) error {
+	var req struct {
+		ServerIDs []string `json:"server_ids"`
+		Tag       string   `json:"tag"`
+		Command   string   `json:"command"`
+		Confirm   bool     `json:"confirm"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Command == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Command is required",
+		})
+	}
+	if (len(req.ServerIDs) == 0) == (req.Tag == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Give either server_ids or tag",
+		})
+	}
+
+	servers, err := h.bulkExecServers(req.ServerIDs, req.Tag)
+	if err != nil {
+		return err
+	}
+
+	safety := services.DefaultSafetyChecker.CheckCommandLine(req.Command)
+	if !safety.IsSafe && !req.Confirm {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error":                 true,
+			"message":               "Command '" + safety.BaseCommand + "' is classified as " + safety.Category + "; resend with confirm to run it on all servers",
+			"requires_confirmation": true,
+			"safety":                safetyVerdict(safety),
+			"servers":               len(servers),
+		})
+	}
+
+	start := time.Now()
+	results := make([]bulkExecResult, len(servers))
+	sem := make(chan struct{}, bulkExecConcurrency)
+	var wg sync.WaitGroup
+
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			server := &servers[i]
+			r := bulkExecResult{ServerID: server.ID, Name: server.Name, ExitCode: -1}
+			history, err := h.execute(server.ID, req.Command, req.Command, nil, nil, bulkExecTimeout)
+			if err != nil {
+				var fe *fiber.Error
+				if errors.As(err, &fe) {
+					r.Error = fe.Message
+				} else {
+					r.Error = err.Error()
+				}
+				results[i] = r
+				return
+			}
+			r.Output = history.Output
+			r.ExitCode = history.ExitCode
+			r.DurationMs = history.DurationMs
+			r.HistoryID = &history.ID
+			r.TimedOut = history.TimedOut
+			results[i] = r
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, r := range results {
+		if r.Error == "" && r.ExitCode == 0 {
+			succeeded++
+		}
+		details := map[string]interface{}{
+			"command":   services.RedactSecrets(req.Command),
+			"exit_code": r.ExitCode,
+			"category":  safety.Category,
+			"bulk":      true,
+		}
+		var runErr error
+		if r.Error != "" {
+			runErr = errors.New(r.Error)
+		} else {
+			details["history_id"] = r.HistoryID
+		}
+		auditAction(c, h.serverHandler.GetDB(), "command.exec", r.ServerID.String(), details, runErr)
+	}
+
+	return c.JSON(fiber.Map{
+		"command":     req.Command,
+		"results":     results,
+		"total":       len(results),
+		"succeeded":   succeeded,
+		"failed":      len(results) - succeeded,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"safety":      safetyVerdict(safety),
+	})
+}
+
+// bulkExecServers resolves a BulkExec target, sorted by name. Every id must
+// exist; a tag must match at least one server. Errors are *fiber.Error
+// values suitable for returning from a handler.
+func (h *CommandHandler) bulkExecServers(ids []string, tag string) ([]models.Server, error) {
+	db := h.serverHandler.GetDB()
+	var servers []models.Server
+
+	if tag != "" {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if err := whereServerTag(db.Order("name ASC"), tag).Find(&servers).Error; err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to list servers")
+		}
+		if len(servers) == 0 {
+			return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("No servers are tagged %q", tag))
+		}
+	} else {
+		unique := make([]uuid.UUID, 0, len(ids))
+		seen := make(map[uuid.UUID]bool, len(ids))
+		for _, s := range ids {
+			id, err := uuid.Parse(s)
+			if err != nil {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid server ID: "+s)
+			}
+			if !seen[id] {
+				seen[id] = true
+				unique = append(unique, id)
+			}
+		}
+		if err := db.Where("id IN ?", unique).Order("name ASC").Find(&servers).Error; err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to list servers")
+		}
+		if len(servers) != len(unique) {
+			found := make(map[uuid.UUID]bool, len(servers))
+			for _, s := range servers {
+				found[s.ID] = true
+			}
+			for _, id := range unique {
+				if !found[id] {
+					return nil, fiber.NewError(fiber.StatusNotFound, "Server not found: "+id.String())
+				}
+			}
+		}
+	}
+
+	if len(servers) > maxBulkExecServers {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("A bulk command may target at most %d servers", maxBulkExecServers))
+	}
+	return servers, nil
+}
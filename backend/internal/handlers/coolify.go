@@ -2,25 +2,75 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/ahmetk3436/bastion/internal/config"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+// coolifyAppsTTL is how long the Coolify application list is cached.
+const coolifyAppsTTL = 30 * time.Second
+
+// coolifyAppsCache holds the Coolify application list (the raw response
+// body), shared by the apps endpoint and the dashboard's app count.
+var coolifyAppsCache = &ttlCache[[]byte]{ttl: coolifyAppsTTL}
+
+// upstreamError is a non-2xx response from an upstream API.
+type upstreamError struct {
+	status int
+	body   []byte
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("upstream returned HTTP %d", e.status)
+}
+
+// fetchCoolifyApps returns a fetch function for coolifyAppsCache. Non-2xx
+// responses are returned as *upstreamError.
+func fetchCoolifyApps(client *http.Client, cfg *config.Config) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/applications", cfg.CoolifyAPIURL), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", cfg.CoolifyAPIToken)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 300 {
+			return nil, &upstreamError{status: resp.StatusCode, body: body}
+		}
+		return body, nil
+	}
+}
+
 type CoolifyHandler struct {
 	cfg    *config.Config
+	db     *gorm.DB
 	client *http.Client
 }
 
-func NewCoolifyHandler(cfg *config.Config) *CoolifyHandler {
+func NewCoolifyHandler(cfg *config.Config, db *gorm.DB) *CoolifyHandler {
 	return &CoolifyHandler{
 		cfg: cfg,
+		db:  db,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -72,8 +122,21 @@ func (h *CoolifyHandler) proxyPost(path string, jsonBody []byte) ([]byte, int, e
 	return body, resp.StatusCode, err
 }
 
+// ListApps returns Coolify's application list, cached for coolifyAppsTTL;
+// ?refresh=true fetches it again.
 func (h *CoolifyHandler) ListApps(c *fiber.Ctx) error {
-	body, status, err := h.proxyGet("applications")
+	if c.QueryBool("refresh", false) {
+		coolifyAppsCache.Invalidate()
+	}
+	body, hit, err := coolifyAppsCache.Get(fetchCoolifyApps(h.client, h.cfg))
+	setCacheHeader(c, hit)
+
+	var upstream *upstreamError
+	if errors.As(err, &upstream) {
+		var result interface{}
+		json.Unmarshal(upstream.body, &result)
+		return c.Status(upstream.status).JSON(result)
+	}
 	if err != nil {
 		slog.Error("Coolify list apps failed", "error", err)
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
@@ -84,7 +147,7 @@ func (h *CoolifyHandler) ListApps(c *fiber.Ctx) error {
 
 	var result interface{}
 	json.Unmarshal(body, &result)
-	return c.Status(status).JSON(result)
+	return c.JSON(result)
 }
 
 func (h *CoolifyHandler) GetApp(c *fiber.Ctx) error {
@@ -105,6 +168,7 @@ func (h *CoolifyHandler) GetApp(c *fiber.Ctx) error {
 func (h *CoolifyHandler) RestartApp(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
 	body, status, err := h.proxyPost(fmt.Sprintf("applications/%s/restart", uuid), nil)
+	h.auditAppAction(c, "coolify.restart", uuid, status, err)
 	if err != nil {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":   true,
@@ -124,6 +188,7 @@ func (h *CoolifyHandler) DeployApp(c *fiber.Ctx) error {
 		"force": true,
 	})
 	body, status, err := h.proxyPost("deploy", reqBody)
+	h.auditAppAction(c, "coolify.deploy", uuid, status, err)
 	if err != nil {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":   true,
@@ -136,6 +201,15 @@ func (h *CoolifyHandler) DeployApp(c *fiber.Ctx) error {
 	return c.Status(status).JSON(result)
 }
 
+// auditAppAction records a restart or deploy; Coolify error statuses count
+// as failures.
+func (h *CoolifyHandler) auditAppAction(c *fiber.Ctx, action, appUUID string, status int, err error) {
+	if err == nil && status >= fiber.StatusBadRequest {
+		err = fmt.Errorf("coolify returned HTTP %d", status)
+	}
+	auditAction(c, h.db, action, appUUID, map[string]interface{}{"status": status}, err)
+}
+
 func (h *CoolifyHandler) GetAppLogs(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
 	body, status, err := h.proxyGet(fmt.Sprintf("applications/%s/logs", uuid))
@@ -191,6 +265,108 @@ func (h *CoolifyHandler) UpdateAppEnvs(c *fiber.Ctx) error {
 	return c.Status(resp.StatusCode).JSON(result)
 }
 
+// coolifyEnv is the part of a Coolify environment variable the diff uses.
+type coolifyEnv struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	IsPreview bool   `json:"is_preview"`
+}
+
+// envChange describes one differing key. Values are always masked.
+type envChange struct {
+	Key     string `json:"key"`
+	Current string `json:"current,omitempty"`
+	Desired string `json:"desired,omitempty"`
+}
+
+// maskEnvValue hides a value while still telling empty and set apart.
+func maskEnvValue(v string) string {
+	if v == "" {
+		return "(empty)"
+	}
+	return "********"
+}
+
+// DiffAppEnvs compares an app's Coolify envs against a desired key/value map
+// and reports added, removed and changed keys. Values never leave Bastion
+// in clear; preview-deployment envs are ignored unless ?preview=true.
+func (h *CoolifyHandler) DiffAppEnvs(c *fiber.Ctx) error {
+	uuid := c.Params("uuid")
+
+	var req struct {
+		Desired map[string]string `json:"desired"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Desired == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "desired must be an object of key/value pairs",
+		})
+	}
+
+	body, status, err := h.proxyGet(fmt.Sprintf("applications/%s/envs", uuid))
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to get envs from Coolify",
+		})
+	}
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("Coolify returned status %d", status),
+		})
+	}
+
+	var envs []coolifyEnv
+	if err := json.Unmarshal(body, &envs); err != nil {
+		slog.Warn("Coolify envs parse failed", "app", uuid, "error", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Unexpected envs response from Coolify",
+		})
+	}
+
+	preview := c.QueryBool("preview", false)
+	current := make(map[string]string, len(envs))
+	for _, e := range envs {
+		if e.IsPreview == preview {
+			current[e.Key] = e.Value
+		}
+	}
+
+	added, removed, changed := []envChange{}, []envChange{}, []envChange{}
+	unchanged := 0
+	for key, want := range req.Desired {
+		have, ok := current[key]
+		switch {
+		case !ok:
+			added = append(added, envChange{Key: key, Desired: maskEnvValue(want)})
+		case have != want:
+			changed = append(changed, envChange{Key: key, Current: maskEnvValue(have), Desired: maskEnvValue(want)})
+		default:
+			unchanged++
+		}
+	}
+	for key, have := range current {
+		if _, ok := req.Desired[key]; !ok {
+			removed = append(removed, envChange{Key: key, Current: maskEnvValue(have)})
+		}
+	}
+	for _, list := range [][]envChange{added, removed, changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	}
+
+	return c.JSON(fiber.Map{
+		"app_uuid":  uuid,
+		"preview":   preview,
+		"added":     added,
+		"removed":   removed,
+		"changed":   changed,
+		"unchanged": unchanged,
+		"in_sync":   len(added)+len(removed)+len(changed) == 0,
+	})
+}
+
 func (h *CoolifyHandler) ListDatabases(c *fiber.Ctx) error {
 	body, status, err := h.proxyGet("databases")
 	if err != nil {
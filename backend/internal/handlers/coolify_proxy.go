@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxCoolifyProxyResponse caps the upstream body Proxy relays.
+const maxCoolifyProxyResponse = 10 * 1024 * 1024
+
+// coolifyProxyRules are the Coolify API resources Proxy forwards to, keyed by
+// the first segment under /api/v1, with the methods allowed on each.
+// Anything else (teams, private keys, security settings, deletes) is refused.
+var coolifyProxyRules = map[string][]string{
+	"applications": {http.MethodGet, http.MethodPost, http.MethodPatch},
+	"services":     {http.MethodGet, http.MethodPost, http.MethodPatch},
+	"databases":    {http.MethodGet, http.MethodPost, http.MethodPatch},
+	"deploy":       {http.MethodGet, http.MethodPost},
+	"deployments":  {http.MethodGet},
+	"projects":     {http.MethodGet},
+	"resources":    {http.MethodGet},
+	"servers":      {http.MethodGet},
+	"version":      {http.MethodGet},
+	"healthcheck":  {http.MethodGet},
+}
+
+// coolifyProxyActions are the Coolify API paths that act on resources even
+// though Coolify also serves them over GET: /deploy and the start, stop and
+// restart sub-paths. Proxy only forwards them as POST, so they are audited
+// and never triggered by a read.
+var coolifyProxyActions = map[string]bool{
+	"deploy":  true,
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+}
+
+// coolifyPathSegment is what each segment of a proxied path may contain.
+var coolifyPathSegment = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// checkCoolifyProxy validates a proxied path and method against
+// coolifyProxyRules and coolifyProxyActions. Errors are *fiber.Error values.
+func checkCoolifyProxy(method, path string) error {
+	segments := strings.Split(path, "/")
+	for _, seg := range segments {
+		if !coolifyPathSegment.MatchString(seg) {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid Coolify API path")
+		}
+	}
+
+	methods, ok := coolifyProxyRules[segments[0]]
+	if !ok {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("Coolify API path %q is not allowed through the proxy", segments[0]))
+	}
+	if coolifyProxyAction(segments) {
+		methods = []string{http.MethodPost}
+	}
+	for _, m := range methods {
+		if m == method {
+			return nil
+		}
+	}
+	return fiber.NewError(fiber.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed on Coolify %s", method, path))
+}
+
+// coolifyProxyAction reports whether a proxied path is one of
+// coolifyProxyActions: /deploy itself, or a start, stop or restart
+// sub-path of a resource.
+func coolifyProxyAction(segments []string) bool {
+	if len(segments) == 1 {
+		return segments[0] == "deploy"
+	}
+	return coolifyProxyActions[segments[len(segments)-1]]
+}
+
+// Proxy forwards a request under /api/coolify/proxy/ to the same path under
+// the Coolify API's /api/v1, with the query, body and Content-Type passed
+// through and the API token added. Only coolifyProxyRules paths and
+// methods are forwarded. The upstream status, content type and body are
+// returned as is. Requests other than GET, which include every action, are
+// audited.
+func (h *CoolifyHandler) Proxy(c *fiber.Ctx) error {
+	path := strings.Trim(c.Params("*"), "/")
+	method := c.Method()
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if err := checkCoolifyProxy(method, path); err != nil {
+		if fe, ok := err.(*fiber.Error); ok && fe.Code == fiber.StatusMethodNotAllowed {
+			segments := strings.Split(path, "/")
+			methods := append([]string(nil), coolifyProxyRules[segments[0]]...)
+			if coolifyProxyAction(segments) {
+				methods = []string{http.MethodPost}
+			}
+			sort.Strings(methods)
+			c.Set(fiber.HeaderAllow, strings.Join(methods, ", "))
+		}
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/v1/%s", h.cfg.CoolifyAPIURL, path)
+	if q := c.Request().URI().QueryString(); len(q) > 0 {
+		url += "?" + string(q)
+	}
+
+	var body io.Reader
+	if len(c.Body()) > 0 {
+		body = bytes.NewReader(c.Body())
+	}
+	req, err := http.NewRequestWithContext(c.UserContext(), method, url, body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid Coolify request")
+	}
+	req.Header.Set("Authorization", h.cfg.CoolifyAPIToken)
+	req.Header.Set("Accept", "application/json")
+	if ct := c.Get(fiber.HeaderContentType); ct != "" && body != nil {
+		req.Header.Set("Content-Type", ct)
+	}
+
+	resp, err := h.client.Do(req)
+	var status int
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	if method != http.MethodGet {
+		auditErr := err
+		if err == nil && status >= fiber.StatusBadRequest {
+			auditErr = fmt.Errorf("coolify returned HTTP %d", status)
+		}
+		auditAction(c, h.db, "coolify.proxy", path, map[string]interface{}{
+			"method": method,
+			"status": status,
+		}, auditErr)
+	}
+	if err != nil {
+		slog.Error("Coolify proxy request failed", "method", method, "path", path, "error", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to connect to Coolify",
+		})
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxCoolifyProxyResponse))
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to read Coolify response",
+		})
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		c.Set(fiber.HeaderContentType, ct)
+	}
+	return c.Status(resp.StatusCode).Send(respBody)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Reveal attempts (successful or not) allowed per actor within the window.
+const (
+	revealMaxAttempts = 3
+	revealWindow      = 15 * time.Minute
+)
+
+type CredentialHandler struct {
+	db            *gorm.DB
+	authHandler   *AuthHandler
+	serverHandler *ServerHandler
+
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+}
+
+func NewCredentialHandler(db *gorm.DB, authHandler *AuthHandler, serverHandler *ServerHandler) *CredentialHandler {
+	return &CredentialHandler{
+		db:            db,
+		authHandler:   authHandler,
+		serverHandler: serverHandler,
+		attempts:      make(map[string][]time.Time),
+	}
+}
+
+// allowAttempt records an attempt for actor and reports whether it is within the limit.
+func (h *CredentialHandler) allowAttempt(actor string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := time.Now().Add(-revealWindow)
+	recent := h.attempts[actor][:0]
+	for _, t := range h.attempts[actor] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= revealMaxAttempts {
+		h.attempts[actor] = recent
+		return false
+	}
+	h.attempts[actor] = append(recent, time.Now())
+	return true
+}
+
+// RevealCredential decrypts and returns a stored server credential after
+// the caller re-enters their password. Every attempt is audited.
+func (h *CredentialHandler) RevealCredential(c *fiber.Ctx) error {
+	actor, _ := c.Locals("username").(string)
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var req struct {
+		Password   string `json:"password"`
+		Credential string `json:"credential"` // password, private_key
+		Reason     string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+
+	if req.Credential != "password" && req.Credential != "private_key" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "credential must be 'password' or 'private_key'",
+		})
+	}
+
+	details := map[string]interface{}{
+		"credential": req.Credential,
+		"reason":     req.Reason,
+		"ip":         c.IP(),
+	}
+
+	if !h.allowAttempt(actor) {
+		slog.Warn("Credential reveal rate limited", "actor", actor, "server_id", id, "ip", c.IP())
+		details["result"] = "rate_limited"
+		CreateAuditLog(h.db, actor, "credential.reveal", id.String(), details)
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   true,
+			"message": "Too many reveal attempts, try again later",
+		})
+	}
+
+	if !h.authHandler.VerifyPassword(actor, req.Password) {
+		slog.Warn("Credential reveal re-authentication failed", "actor", actor, "server_id", id, "ip", c.IP())
+		details["result"] = "reauth_failed"
+		CreateAuditLog(h.db, actor, "credential.reveal", id.String(), details)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Re-authentication failed",
+		})
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	// Agent and key-file servers keep their keys outside Bastion
+	if server.AuthType == "agent" || server.AuthType == "keyfile" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Credentials for this server are not stored in Bastion",
+		})
+	}
+
+	password, privateKey, err := h.serverHandler.GetDecryptedCredentials(&server)
+	if err != nil {
+		slog.Error("Credential reveal decryption failed", "server_id", id, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to decrypt credentials",
+		})
+	}
+
+	value := password
+	if req.Credential == "private_key" {
+		value = privateKey
+	}
+	if value == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "No " + req.Credential + " stored for this server",
+		})
+	}
+
+	details["result"] = "revealed"
+	details["server_name"] = server.Name
+	if err := CreateAuditLog(h.db, actor, "credential.reveal", id.String(), details); err != nil {
+		// Never hand out a secret we could not record
+		slog.Error("Failed to audit credential reveal", "server_id", id, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to record audit log",
+		})
+	}
+	slog.Warn("Credential revealed", "actor", actor, "server_id", id, "credential", req.Credential, "ip", c.IP())
+
+	c.Set("Cache-Control", "no-store")
+	return c.JSON(fiber.Map{
+		"server_id":   id,
+		"credential":  req.Credential,
+		"value":       value,
+		"revealed_at": time.Now(),
+	})
+}
@@ -1,22 +1,35 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
 	"gorm.io/gorm"
 )
 
 type CronHandler struct {
 	db            *gorm.DB
 	serverHandler *ServerHandler
+
+	mu      sync.Mutex
+	running map[uuid.UUID]context.CancelFunc // in-flight runs by CronRun ID
 }
 
 func NewCronHandler(db *gorm.DB, serverHandler *ServerHandler) *CronHandler {
-	return &CronHandler{db: db, serverHandler: serverHandler}
+	return &CronHandler{
+		db:            db,
+		serverHandler: serverHandler,
+		running:       make(map[uuid.UUID]context.CancelFunc),
+	}
 }
 
 func (h *CronHandler) ListCrons(c *fiber.Ctx) error {
@@ -44,10 +57,12 @@ func (h *CronHandler) CreateCron(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Name                  string `json:"name"`
-		Schedule              string `json:"schedule"`
-		Command               string `json:"command"`
-		NotificationOnFailure *bool  `json:"notification_on_failure"`
+		Name                  string   `json:"name"`
+		Schedule              string   `json:"schedule"`
+		Command               string   `json:"command"`
+		EnvKeys               []string `json:"env_keys"`
+		NotificationOnFailure *bool    `json:"notification_on_failure"`
+		AllowDangerous        bool     `json:"allow_dangerous"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -63,19 +78,39 @@ func (h *CronHandler) CreateCron(c *fiber.Ctx) error {
 		})
 	}
 
+	if !validEnvKeys(req.EnvKeys) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "env_keys must be valid environment variable names",
+		})
+	}
+
+	var count int64
+	h.db.Model(&models.Server{}).Where("id = ?", serverID).Count(&count)
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
 	cron := models.CronJob{
 		ServerID:              serverID,
 		Name:                  req.Name,
 		Schedule:              req.Schedule,
 		Command:               req.Command,
+		EnvKeys:               req.EnvKeys,
 		Enabled:               true,
 		NotificationOnFailure: true,
 	}
 	if req.NotificationOnFailure != nil {
 		cron.NotificationOnFailure = *req.NotificationOnFailure
 	}
+	if safety, ok := acknowledgeCronCommand(c, &cron, req.AllowDangerous); !ok {
+		return rejectDangerousCron(c, safety)
+	}
 
-	if err := h.db.Create(&cron).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Create(&cron).Error; err != nil {
 		slog.Error("Failed to create cron job", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -104,10 +139,12 @@ func (h *CronHandler) UpdateCron(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Name                  *string `json:"name"`
-		Schedule              *string `json:"schedule"`
-		Command               *string `json:"command"`
-		NotificationOnFailure *bool   `json:"notification_on_failure"`
+		Name                  *string  `json:"name"`
+		Schedule              *string  `json:"schedule"`
+		Command               *string  `json:"command"`
+		EnvKeys               []string `json:"env_keys"`
+		NotificationOnFailure *bool    `json:"notification_on_failure"`
+		AllowDangerous        bool     `json:"allow_dangerous"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -122,14 +159,26 @@ func (h *CronHandler) UpdateCron(c *fiber.Ctx) error {
 	if req.Schedule != nil {
 		cron.Schedule = *req.Schedule
 	}
-	if req.Command != nil {
+	if req.Command != nil && *req.Command != cron.Command {
 		cron.Command = *req.Command
+		if safety, ok := acknowledgeCronCommand(c, &cron, req.AllowDangerous); !ok {
+			return rejectDangerousCron(c, safety)
+		}
+	}
+	if req.EnvKeys != nil {
+		if !validEnvKeys(req.EnvKeys) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "env_keys must be valid environment variable names",
+			})
+		}
+		cron.EnvKeys = req.EnvKeys
 	}
 	if req.NotificationOnFailure != nil {
 		cron.NotificationOnFailure = *req.NotificationOnFailure
 	}
 
-	h.db.Save(&cron)
+	h.db.WithContext(c.UserContext()).Save(&cron)
 	return c.JSON(cron)
 }
 
@@ -142,7 +191,7 @@ func (h *CronHandler) DeleteCron(c *fiber.Ctx) error {
 		})
 	}
 
-	h.db.Delete(&models.CronJob{}, "id = ?", id)
+	h.db.WithContext(c.UserContext()).Delete(&models.CronJob{}, "id = ?", id)
 	return c.JSON(fiber.Map{"message": "Cron job deleted"})
 }
 
@@ -172,6 +221,11 @@ func (h *CronHandler) RunCron(c *fiber.Ctx) error {
 		})
 	}
 
+	env, err := resolveSecrets(c, h.serverHandler, server.ID, cron.EnvKeys, "cron:"+cron.Name)
+	if err != nil {
+		return err
+	}
+
 	password, privateKey, err := h.serverHandler.GetDecryptedCredentials(&server)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -181,7 +235,7 @@ func (h *CronHandler) RunCron(c *fiber.Ctx) error {
 	}
 
 	pool := h.serverHandler.GetSSHPool()
-	client, err := pool.GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := pool.GetConnection(&server, password, privateKey)
 	if err != nil {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":   true,
@@ -198,31 +252,144 @@ func (h *CronHandler) RunCron(c *fiber.Ctx) error {
 	}
 	defer session.Close()
 
-	output, err := session.CombinedOutput(cron.Command)
+	run := models.CronRun{CronJobID: cron.ID, Status: "running", StartedAt: time.Now()}
+	if err := h.db.Create(&run).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to record cron run",
+		})
+	}
+	h.db.Model(&cron).Updates(map[string]interface{}{
+		"last_run_at": run.StartedAt,
+		"last_status": "running",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.mu.Lock()
+	h.running[run.ID] = cancel
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.running, run.ID)
+		h.mu.Unlock()
+		cancel()
+	}()
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	command, stdin := services.InjectEnv(env, cron.Command, nil)
+	session.Stdin = stdin
+	go func() {
+		output, err := session.CombinedOutput(services.WrapCommand(server.CommandPrefix, server.Shell, command))
+		done <- result{output, err}
+	}()
 
 	status := "success"
 	errMsg := ""
-	if err != nil {
-		status = "failed"
-		errMsg = err.Error()
+	var output []byte
+	select {
+	case r := <-done:
+		output = r.output
+		if r.err != nil {
+			status = "failed"
+			errMsg = r.err.Error()
+		}
+	case <-ctx.Done():
+		// Closing the session unblocks CombinedOutput; the remote process
+		// gets SIGHUP when its channel goes away.
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		r := <-done
+		output = r.output
+		status = "cancelled"
+		errMsg = "Run cancelled"
 	}
 
-	now := c.Context().Time()
+	finished := time.Now()
+	h.db.Model(&run).Updates(map[string]interface{}{
+		"status":      status,
+		"output":      string(output),
+		"error":       errMsg,
+		"finished_at": finished,
+	})
 	h.db.Model(&cron).Updates(map[string]interface{}{
-		"last_run_at": now,
 		"last_status": status,
 		"last_output": string(output),
 		"last_error":  errMsg,
 	})
 
+	var runErr error
+	if errMsg != "" {
+		runErr = errors.New(errMsg)
+	}
+	auditAction(c, h.db, "cron.run", cron.ID.String(), map[string]interface{}{
+		"cron":   cron.Name,
+		"server": server.Name,
+		"run_id": run.ID,
+		"status": status,
+	}, runErr)
+
 	return c.JSON(fiber.Map{
 		"status":  status,
 		"output":  string(output),
 		"error":   errMsg,
 		"cron_id": id,
+		"run_id":  run.ID,
 	})
 }
 
+// ListCronRuns returns recent runs of a cron job, newest first.
+func (h *CronHandler) ListCronRuns(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid cron ID",
+		})
+	}
+
+	var runs []models.CronRun
+	h.db.Where("cron_job_id = ?", id).Order("started_at DESC").Limit(50).Find(&runs)
+
+	return c.JSON(fiber.Map{"runs": runs})
+}
+
+// CancelCronRun aborts an in-flight run by closing its SSH session.
+func (h *CronHandler) CancelCronRun(c *fiber.Ctx) error {
+	runID, err := uuid.Parse(c.Params("runId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid run ID",
+		})
+	}
+
+	var run models.CronRun
+	if err := h.db.First(&run, "id = ?", runID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cron run not found",
+		})
+	}
+
+	h.mu.Lock()
+	cancel, ok := h.running[runID]
+	h.mu.Unlock()
+	if !ok {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Run is not in progress",
+			"status":  run.Status,
+		})
+	}
+
+	cancel()
+	return c.JSON(fiber.Map{"message": "Cancel requested", "run_id": runID})
+}
+
 func (h *CronHandler) ToggleCron(c *fiber.Ctx) error {
 	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
@@ -241,7 +408,7 @@ func (h *CronHandler) ToggleCron(c *fiber.Ctx) error {
 	}
 
 	cron.Enabled = !cron.Enabled
-	h.db.Save(&cron)
+	h.db.WithContext(c.UserContext()).Save(&cron)
 
 	return c.JSON(fiber.Map{
 		"message": "Cron job toggled",
@@ -276,3 +443,41 @@ func (h *CronHandler) GetCronLogs(c *fiber.Ctx) error {
 		"last_error":  cron.LastError,
 	})
 }
+
+// acknowledgeCronCommand runs a scheduled command through the safety
+// checker. Dangerous commands run unattended, so they are only accepted with
+// allow_dangerous, and the acknowledging user is recorded on the job. It
+// returns false with the verdict when the command needs acknowledgment.
+func acknowledgeCronCommand(c *fiber.Ctx, cron *models.CronJob, allowDangerous bool) (services.CommandSafety, bool) {
+	safety := services.DefaultSafetyChecker.CheckEachCommand(cron.Command)
+	if safety.Category != "dangerous" {
+		cron.DangerousAckBy, cron.DangerousAckAt = "", nil
+		return safety, true
+	}
+	if !allowDangerous {
+		return safety, false
+	}
+	now := time.Now()
+	cron.DangerousAckBy, _ = c.Locals("username").(string)
+	cron.DangerousAckAt = &now
+	return safety, true
+}
+
+func rejectDangerousCron(c *fiber.Ctx, safety services.CommandSafety) error {
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error":                 true,
+		"message":               "Scheduled command '" + safety.BaseCommand + "' is dangerous; resend with allow_dangerous to save it",
+		"requires_confirmation": true,
+		"safety":                safetyVerdict(safety),
+	})
+}
+
+// validEnvKeys reports whether every key is a valid environment variable name.
+func validEnvKeys(keys []string) bool {
+	for _, k := range keys {
+		if !services.ValidEnvKey(k) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,25 +1,222 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
+const (
+	// defaultStreamRows and maxStreamRows bound NDJSON exports and streamed queries.
+	defaultStreamRows = 10000
+	maxStreamRows     = 100000
+
+	// Defaults for the SQL console limits when unset or invalid.
+	defaultQueryTimeout = 30 * time.Second
+	defaultQueryMaxRows = 1000
+)
+
 type DatabaseHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	queryTimeout time.Duration // statement timeout for ExecuteQuery and exports
+	maxRows      int           // rows ExecuteQuery returns before truncating
 }
 
-func NewDatabaseHandler(db *gorm.DB) *DatabaseHandler {
-	return &DatabaseHandler{db: db}
+func NewDatabaseHandler(db *gorm.DB, queryTimeout time.Duration, maxRows int) *DatabaseHandler {
+	if queryTimeout <= 0 {
+		queryTimeout = defaultQueryTimeout
+	}
+	if maxRows <= 0 {
+		maxRows = defaultQueryMaxRows
+	}
+	return &DatabaseHandler{db: db, queryTimeout: queryTimeout, maxRows: maxRows}
 }
 
 // validTableName checks that a table name is safe (alphanumeric + underscore only).
 var validTableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 
+// checkTable validates a table name against the format and the whitelist of
+// actual tables. Errors are *fiber.Error values.
+func (h *DatabaseHandler) checkTable(tableName string) error {
+	if !validTableNameRegex.MatchString(tableName) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid table name")
+	}
+	validTables, err := h.getTableNames()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to validate table name")
+	}
+	if !validTables[tableName] {
+		return fiber.NewError(fiber.StatusNotFound, "Table not found")
+	}
+	return nil
+}
+
+// streamLimit reads the ?limit= bound for streamed results.
+func streamLimit(c *fiber.Ctx) int {
+	limit := c.QueryInt("limit", defaultStreamRows)
+	if limit < 1 || limit > maxStreamRows {
+		limit = defaultStreamRows
+	}
+	return limit
+}
+
+// beginReadOnly starts a read-only transaction bound to ctx. A positive
+// timeout becomes the transaction's statement_timeout. Errors are
+// *fiber.Error values.
+func (h *DatabaseHandler) beginReadOnly(ctx context.Context, timeout time.Duration) (*gorm.DB, error) {
+	tx := h.db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	if err := tx.Exec("SET TRANSACTION READ ONLY").Error; err != nil {
+		tx.Rollback()
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start read-only transaction")
+	}
+	if timeout > 0 {
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())).Error; err != nil {
+			tx.Rollback()
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to set statement timeout")
+		}
+	}
+	return tx, nil
+}
+
+// queryError converts a failed query into a *fiber.Error, reporting a
+// statement timeout or context deadline as 504.
+func queryError(err error, timeout time.Duration) error {
+	var pgErr *pgconn.PgError
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &pgErr) && pgErr.Code == "57014") {
+		return fiber.NewError(fiber.StatusGatewayTimeout, fmt.Sprintf("Query timed out after %s", timeout))
+	}
+	return fiber.NewError(fiber.StatusBadRequest, "Query failed: "+err.Error())
+}
+
+// streamQuery runs query in a read-only transaction and streams the result
+// in format, row by row, straight from the sql.Rows cursor. Errors up to
+// the first row are returned as *fiber.Error values; later errors end the
+// stream as the format's encoder decides. At most limit rows are written.
+// timeout is both the statement_timeout and a deadline on the whole stream,
+// so a client that stops reading cannot hold the transaction open, and a
+// write that fails because the client went away cancels the query at once.
+// done, if set, is called once with the rows written and the error that
+// ended the query, if any.
+func (h *DatabaseHandler) streamQuery(c *fiber.Ctx, format exportFormat, limit int, timeout time.Duration, done func(rows int, err error), query string, args ...interface{}) error {
+	if done == nil {
+		done = func(int, error) {}
+	}
+
+	// The stream outlives the handler, so the context is derived now and
+	// cancelled by the stream writer
+	ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+	tx, err := h.beginReadOnly(ctx, timeout)
+	if err != nil {
+		cancel()
+		done(0, err)
+		return err
+	}
+
+	rows, err := tx.Raw(query, args...).Rows()
+	if err != nil {
+		tx.Rollback()
+		cancel()
+		done(0, err)
+		return queryError(err, timeout)
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		tx.Rollback()
+		cancel()
+		done(0, err)
+		return queryError(err, timeout)
+	}
+
+	c.Set(fiber.HeaderContentType, format.ContentType)
+	c.Set("X-Row-Limit", strconv.Itoa(limit))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The transaction lives until the last row has been written
+		defer cancel()
+		defer tx.Rollback()
+		defer rows.Close()
+
+		enc := format.newEncoder(w, columns)
+		count, err := writeRows(enc, rows, len(columns), limit)
+		if err != nil {
+			slog.Warn("Database stream aborted", "rows", count, "error", err)
+		}
+		enc.End(err)
+		w.Flush()
+		done(count, err)
+	})
+	return nil
+}
+
+// scanValues scans the current row's n columns, with byte slices converted
+// to strings.
+func scanValues(rows *sql.Rows, n int) ([]interface{}, error) {
+	values := make([]interface{}, n)
+	ptrs := make([]interface{}, n)
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+	return values, nil
+}
+
+// writeRows passes up to limit rows of n columns to enc.
+func writeRows(enc rowEncoder, rows *sql.Rows, n, limit int) (int, error) {
+	count := 0
+	for count < limit && rows.Next() {
+		values, err := scanValues(rows, n)
+		if err != nil {
+			return count, err
+		}
+		if err := enc.Row(values); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// collectRows reads up to limit rows and reports whether any were left
+// unread, so an oversized result is cut off rather than held in memory.
+func collectRows(rows *sql.Rows, columns []string, limit int) ([]map[string]interface{}, bool, error) {
+	result := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		if len(result) >= limit {
+			return result, true, nil
+		}
+		values, err := scanValues(rows, len(columns))
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, rowMap(columns, values))
+	}
+	return result, false, rows.Err()
+}
+
 // getTableNames returns a whitelist of actual table names from information_schema.
 func (h *DatabaseHandler) getTableNames() (map[string]bool, error) {
 	var tables []struct {
@@ -76,32 +273,17 @@ func (h *DatabaseHandler) ListTables(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"tables": tableInfos})
 }
 
-// GetTableRows returns paginated rows from a specific table.
+// GetTableRows returns paginated rows from a specific table. With
+// ?format=csv, json or ndjson the rows are downloaded as ExportTable does,
+// starting at ?offset=.
 func (h *DatabaseHandler) GetTableRows(c *fiber.Ctx) error {
 	tableName := c.Params("name")
 
-	// Validate table name format
-	if !validTableNameRegex.MatchString(tableName) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "Invalid table name",
-		})
+	if err := h.checkTable(tableName); err != nil {
+		return err
 	}
-
-	// Validate against whitelist of actual tables
-	validTables, err := h.getTableNames()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to validate table name",
-		})
-	}
-
-	if !validTables[tableName] {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   true,
-			"message": "Table not found",
-		})
+	if format := c.Query("format"); format != "" {
+		return h.exportTable(c, tableName, format)
 	}
 
 	limit := c.QueryInt("limit", 50)
@@ -119,7 +301,7 @@ func (h *DatabaseHandler) GetTableRows(c *fiber.Ctx) error {
 
 	// Get rows — use quoted identifier to prevent injection
 	var rows []map[string]interface{}
-	err = h.db.Raw(fmt.Sprintf("SELECT * FROM %q LIMIT ? OFFSET ?", tableName), limit, offset).Scan(&rows).Error
+	err := h.db.Raw(fmt.Sprintf("SELECT * FROM %q LIMIT ? OFFSET ?", tableName), limit, offset).Scan(&rows).Error
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -150,10 +332,43 @@ func (h *DatabaseHandler) GetTableRows(c *fiber.Ctx) error {
 	})
 }
 
-// ExecuteQuery executes a read-only SQL query.
+// ExportTable streams the rows of a table as a download, bounded by ?limit=
+// and starting at ?offset=. ?format= is ndjson (default), csv or json.
+func (h *DatabaseHandler) ExportTable(c *fiber.Ctx) error {
+	tableName := c.Params("name")
+	if err := h.checkTable(tableName); err != nil {
+		return err
+	}
+	return h.exportTable(c, tableName, c.Query("format", "ndjson"))
+}
+
+// exportTable streams a checked table's rows in the named format.
+func (h *DatabaseHandler) exportTable(c *fiber.Ctx, tableName, formatName string) error {
+	format, err := lookupExportFormat(formatName)
+	if err != nil {
+		return err
+	}
+
+	limit := streamLimit(c)
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, tableName, format.Ext))
+	return h.streamQuery(c, format, limit, h.queryTimeout, nil, fmt.Sprintf("SELECT * FROM %q LIMIT ? OFFSET ?", tableName), limit, offset)
+}
+
+// ExecuteQuery executes a read-only SQL query under the configured statement
+// timeout. At most maxRows rows are returned, with truncated set when the
+// result had more; a request may lower either limit but not raise it. With
+// ?format=ndjson the result is streamed row by row instead of buffered,
+// bounded by ?limit= instead of the row cap; csv and json stream the same
+// way as a download.
 func (h *DatabaseHandler) ExecuteQuery(c *fiber.Ctx) error {
 	var req struct {
-		Query string `json:"query"`
+		Query          string `json:"query"`
+		TimeoutSeconds int    `json:"timeout_seconds"` // lowers the configured timeout
+		MaxRows        int    `json:"max_rows"`        // lowers the configured row cap
 	}
 	if err := c.BodyParser(&req); err != nil || req.Query == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -162,39 +377,160 @@ func (h *DatabaseHandler) ExecuteQuery(c *fiber.Ctx) error {
 		})
 	}
 
-	// Basic safety check — disallow mutation keywords
-	upper := strings.ToUpper(strings.TrimSpace(req.Query))
-	disallowed := []string{"INSERT", "UPDATE", "DELETE", "DROP", "ALTER", "CREATE", "TRUNCATE", "GRANT", "REVOKE", "COPY"}
-	for _, kw := range disallowed {
-		if strings.Contains(upper, kw) {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   true,
-				"message": fmt.Sprintf("Mutation queries are not allowed (found %s)", kw),
-			})
+	// Safety check — a single read-only statement only
+	if err := services.CheckReadOnlyQuery(req.Query); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   true,
+			"message": "Query rejected: " + err.Error(),
+		})
+	}
+
+	return h.runQuery(c, req.Query, nil, queryLimits{TimeoutSeconds: req.TimeoutSeconds, MaxRows: req.MaxRows})
+}
+
+// queryLimits are per-request query limits. Each may only lower the
+// configured one.
+type queryLimits struct {
+	TimeoutSeconds int `json:"timeout_seconds"`
+	MaxRows        int `json:"max_rows"`
+}
+
+// runQuery runs a query that passed CheckReadOnlyQuery as ExecuteQuery
+// describes and records the run in the query history. savedID is the saved
+// query being run, if any.
+func (h *DatabaseHandler) runQuery(c *fiber.Ctx, query string, savedID *uuid.UUID, limits queryLimits) error {
+	timeout := h.queryTimeout
+	if t := time.Duration(limits.TimeoutSeconds) * time.Second; t > 0 && t < timeout {
+		timeout = t
+	}
+	maxRows := h.maxRows
+	if limits.MaxRows > 0 && limits.MaxRows < maxRows {
+		maxRows = limits.MaxRows
+	}
+
+	start := time.Now()
+	entry := models.QueryHistory{SavedQueryID: savedID, SQL: query, ExecutedAt: start}
+	entry.Actor, _ = c.Locals("username").(string)
+	record := func(rows int, truncated bool, err error) {
+		entry.RowCount = rows
+		entry.Truncated = truncated
+		entry.DurationMs = time.Since(start).Milliseconds()
+		entry.Success = err == nil
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if err := h.db.Create(&entry).Error; err != nil {
+			slog.Error("Failed to record query history", "error", err)
 		}
 	}
 
-	// Execute in a read-only transaction
-	var rows []map[string]interface{}
-	err := h.db.Transaction(func(tx *gorm.DB) error {
-		// Set transaction to read-only
-		if err := tx.Exec("SET TRANSACTION READ ONLY").Error; err != nil {
+	if formatName := c.Query("format"); formatName != "" {
+		format, err := lookupExportFormat(formatName)
+		if err != nil {
 			return err
 		}
-		return tx.Raw(req.Query).Scan(&rows).Error
+		if formatName != "ndjson" {
+			c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="query.%s"`, format.Ext))
+		}
+		return h.streamQuery(c, format, streamLimit(c), timeout, func(rows int, err error) {
+			record(rows, false, err)
+		}, query)
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+	defer cancel()
+
+	result, columns, truncated, err := h.bufferQuery(ctx, timeout, query, maxRows)
+	record(len(result), truncated, err)
+	if err != nil {
+		return queryError(err, timeout)
+	}
+
+	return c.JSON(fiber.Map{
+		"query":       query,
+		"columns":     columns,
+		"rows":        result,
+		"row_count":   len(result),
+		"truncated":   truncated,
+		"max_rows":    maxRows,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"history_id":  entry.ID,
 	})
+}
+
+// bufferQuery runs query in a read-only transaction and reads up to maxRows
+// rows into memory.
+func (h *DatabaseHandler) bufferQuery(ctx context.Context, timeout time.Duration, query string, maxRows int) ([]map[string]interface{}, []string, bool, error) {
+	tx, err := h.beginReadOnly(ctx, timeout)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Raw(query).Rows()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer rows.Close()
 
+	columns, err := rows.Columns()
 	if err != nil {
+		return nil, nil, false, err
+	}
+	result, truncated, err := collectRows(rows, columns, maxRows)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return result, columns, truncated, nil
+}
+
+// ExplainQuery returns the planner's plan tree for a SELECT query, from
+// EXPLAIN (FORMAT JSON) in a read-only transaction. ANALYZE is off, so the
+// query is planned but never executed.
+func (h *DatabaseHandler) ExplainQuery(c *fiber.Ctx) error {
+	var req struct {
+		Query string `json:"query"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Query == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "Query failed: " + err.Error(),
+			"message": "Query is required",
+		})
+	}
+	if err := services.CheckExplainableQuery(req.Query); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   true,
+			"message": "Query rejected: " + err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), h.queryTimeout)
+	defer cancel()
+
+	tx, err := h.beginReadOnly(ctx, h.queryTimeout)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var raw string
+	if err := tx.Raw("EXPLAIN (FORMAT JSON, ANALYZE false) " + req.Query).Row().Scan(&raw); err != nil {
+		return queryError(err, h.queryTimeout)
+	}
+
+	var plans []struct {
+		Plan map[string]interface{} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(raw), &plans); err != nil || len(plans) == 0 {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Unexpected EXPLAIN output",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"query":     req.Query,
-		"rows":      rows,
-		"row_count": len(rows),
+		"query": req.Query,
+		"plan":  plans[0].Plan,
 	})
 }
 
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportFormat is a streamed result format.
+type exportFormat struct {
+	ContentType string
+	Ext         string
+	newEncoder  func(w *bufio.Writer, columns []string) rowEncoder
+}
+
+// exportFormats are the ?format= values streamed results accept.
+var exportFormats = map[string]exportFormat{
+	"ndjson": {"application/x-ndjson", "ndjson", newNDJSONEncoder},
+	"json":   {"application/json", "json", newJSONArrayEncoder},
+	"csv":    {"text/csv; charset=utf-8", "csv", newCSVEncoder},
+}
+
+// lookupExportFormat returns the named format, or a 400 *fiber.Error.
+func lookupExportFormat(name string) (exportFormat, error) {
+	f, ok := exportFormats[name]
+	if !ok {
+		return exportFormat{}, fiber.NewError(fiber.StatusBadRequest, "format must be csv, json or ndjson")
+	}
+	return f, nil
+}
+
+// rowEncoder writes a result set row by row. Row values are in column order.
+// End is called once with the error that stopped the rows, if any.
+type rowEncoder interface {
+	Row(values []interface{}) error
+	End(err error)
+}
+
+// ndjsonEncoder writes one JSON object per line; an error becomes a final
+// {"error": ...} line.
+type ndjsonEncoder struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func newNDJSONEncoder(w *bufio.Writer, columns []string) rowEncoder {
+	return &ndjsonEncoder{enc: json.NewEncoder(w), columns: columns}
+}
+
+func (e *ndjsonEncoder) Row(values []interface{}) error {
+	return e.enc.Encode(rowMap(e.columns, values))
+}
+
+func (e *ndjsonEncoder) End(err error) {
+	if err != nil {
+		e.enc.Encode(fiber.Map{"error": true, "message": err.Error()})
+	}
+}
+
+// jsonArrayEncoder writes a JSON array of objects. An error leaves the array
+// unterminated, so a failed export does not parse as a complete one.
+type jsonArrayEncoder struct {
+	w       *bufio.Writer
+	columns []string
+	count   int
+}
+
+func newJSONArrayEncoder(w *bufio.Writer, columns []string) rowEncoder {
+	w.WriteString("[")
+	return &jsonArrayEncoder{w: w, columns: columns}
+}
+
+func (e *jsonArrayEncoder) Row(values []interface{}) error {
+	b, err := json.Marshal(rowMap(e.columns, values))
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		e.w.WriteString(",")
+	}
+	e.w.WriteString("\n")
+	e.count++
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonArrayEncoder) End(err error) {
+	if err == nil {
+		e.w.WriteString("\n]\n")
+	}
+}
+
+// csvEncoder writes a header line and one record per row. It follows
+// Postgres' COPY CSV convention: NULL is an empty unquoted field and an
+// empty string is "", so the two stay distinct. Fields containing the
+// delimiter, quotes, line breaks or edge spaces are quoted.
+type csvEncoder struct {
+	w *bufio.Writer
+}
+
+func newCSVEncoder(w *bufio.Writer, columns []string) rowEncoder {
+	e := &csvEncoder{w: w}
+	header := make([]interface{}, len(columns))
+	for i, col := range columns {
+		header[i] = col
+	}
+	e.Row(header)
+	return e
+}
+
+func (e *csvEncoder) Row(values []interface{}) error {
+	for i, v := range values {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		if v == nil {
+			continue
+		}
+		e.w.WriteString(csvField(csvText(v)))
+	}
+	_, err := e.w.WriteString("\r\n")
+	return err
+}
+
+func (e *csvEncoder) End(err error) {}
+
+// csvText renders a non-NULL value as CSV text.
+func csvText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case fmt.Stringer:
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// csvField quotes s when needed. An empty string is always quoted.
+func csvField(s string) string {
+	if s != "" && !strings.ContainsAny(s, ",\"\r\n") && s[0] != ' ' && s[len(s)-1] != ' ' {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// rowMap keys row values by column name.
+func rowMap(columns []string, values []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		row[col] = values[i]
+	}
+	return row
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ListSavedQueries returns all saved queries by name.
+func (h *DatabaseHandler) ListSavedQueries(c *fiber.Ctx) error {
+	var queries []models.SavedQuery
+	h.db.Order("name").Find(&queries)
+
+	return c.JSON(fiber.Map{"queries": queries})
+}
+
+// CreateSavedQuery saves a named query. It must pass the same read-only
+// check as ExecuteQuery.
+func (h *DatabaseHandler) CreateSavedQuery(c *fiber.Ctx) error {
+	var req struct {
+		Name string `json:"name"`
+		SQL  string `json:"sql"`
+	}
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Name) == "" || req.SQL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Name and sql are required",
+		})
+	}
+	if err := services.CheckReadOnlyQuery(req.SQL); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   true,
+			"message": "Query rejected: " + err.Error(),
+		})
+	}
+
+	query := models.SavedQuery{Name: strings.TrimSpace(req.Name), SQL: req.SQL}
+	var count int64
+	h.db.Model(&models.SavedQuery{}).Where("name = ?", query.Name).Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "A saved query with this name already exists",
+		})
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Create(&query).Error; err != nil {
+		slog.Error("Failed to save query", "name", query.Name, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to save query",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(query)
+}
+
+// UpdateSavedQuery renames a saved query or replaces its SQL.
+func (h *DatabaseHandler) UpdateSavedQuery(c *fiber.Ctx) error {
+	query, err := h.findSavedQuery(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Name *string `json:"name"`
+		SQL  *string `json:"sql"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) != "" && strings.TrimSpace(*req.Name) != query.Name {
+		name := strings.TrimSpace(*req.Name)
+		var count int64
+		h.db.Model(&models.SavedQuery{}).Where("name = ? AND id <> ?", name, query.ID).Count(&count)
+		if count > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   true,
+				"message": "A saved query with this name already exists",
+			})
+		}
+		query.Name = name
+	}
+	if req.SQL != nil {
+		if err := services.CheckReadOnlyQuery(*req.SQL); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   true,
+				"message": "Query rejected: " + err.Error(),
+			})
+		}
+		query.SQL = *req.SQL
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Save(query).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update saved query",
+		})
+	}
+
+	return c.JSON(query)
+}
+
+// DeleteSavedQuery removes a saved query. Its history entries are kept as
+// ad hoc runs.
+func (h *DatabaseHandler) DeleteSavedQuery(c *fiber.Ctx) error {
+	query, err := h.findSavedQuery(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Delete(query).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to delete saved query",
+		})
+	}
+	h.db.Model(&models.QueryHistory{}).Where("saved_query_id = ?", query.ID).Update("saved_query_id", nil)
+
+	return c.JSON(fiber.Map{"message": "Saved query deleted"})
+}
+
+// RunSavedQuery runs a saved query as ExecuteQuery would, including
+// ?format= and the optional timeout_seconds and max_rows body fields. The
+// read-only check is applied again at run time.
+func (h *DatabaseHandler) RunSavedQuery(c *fiber.Ctx) error {
+	query, err := h.findSavedQuery(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	var limits queryLimits
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&limits); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid request body",
+			})
+		}
+	}
+
+	if err := services.CheckReadOnlyQuery(query.SQL); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   true,
+			"message": "Query rejected: " + err.Error(),
+		})
+	}
+
+	return h.runQuery(c, query.SQL, &query.ID, limits)
+}
+
+// ListQueryHistory returns SQL console runs, newest first, paginated and
+// optionally limited to one saved query.
+func (h *DatabaseHandler) ListQueryHistory(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	perPage, _ := strconv.Atoi(c.Query("per_page", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 50
+	}
+
+	query := h.db.Model(&models.QueryHistory{})
+	if s := c.Query("saved_query_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid saved_query_id",
+			})
+		}
+		query = query.Where("saved_query_id = ?", id)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var history []models.QueryHistory
+	query.Order("executed_at DESC").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&history)
+
+	return c.JSON(fiber.Map{
+		"history":  history,
+		"total":    total,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+// findSavedQuery loads a saved query by ID. Errors are *fiber.Error values.
+func (h *DatabaseHandler) findSavedQuery(id string) (*models.SavedQuery, error) {
+	queryID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid saved query ID")
+	}
+
+	var query models.SavedQuery
+	if err := h.db.First(&query, "id = ?", queryID).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Saved query not found")
+	}
+	return &query, nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DBConnectionHandler manages external database connections. DSNs are
+// encrypted on input and never returned by the API.
+type DBConnectionHandler struct {
+	db            *gorm.DB
+	serverHandler *ServerHandler
+}
+
+func NewDBConnectionHandler(serverHandler *ServerHandler) *DBConnectionHandler {
+	return &DBConnectionHandler{db: serverHandler.GetDB(), serverHandler: serverHandler}
+}
+
+// ListConnections returns all registered connections, without DSNs.
+func (h *DBConnectionHandler) ListConnections(c *fiber.Ctx) error {
+	var conns []models.DatabaseConnection
+	h.db.Order("name").Find(&conns)
+
+	return c.JSON(fiber.Map{"connections": conns})
+}
+
+// CreateConnection registers an external Postgres database after checking
+// that it is reachable.
+func (h *DBConnectionHandler) CreateConnection(c *fiber.Ctx) error {
+	var req struct {
+		Name        string `json:"name"`
+		DSN         string `json:"dsn"`
+		AIQueryable bool   `json:"ai_queryable"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Name == "" || req.DSN == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Name and dsn are required",
+		})
+	}
+
+	var count int64
+	h.db.Model(&models.DatabaseConnection{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Connection already exists",
+		})
+	}
+
+	if err := services.PingDatabase(c.UserContext(), req.DSN); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Connection failed: " + err.Error(),
+		})
+	}
+
+	encrypted, err := h.serverHandler.GetEncryptor().Encrypt(req.DSN)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to encrypt dsn",
+		})
+	}
+
+	conn := models.DatabaseConnection{
+		Name:         req.Name,
+		Host:         services.DSNHost(req.DSN),
+		EncryptedDSN: encrypted,
+		AIQueryable:  req.AIQueryable,
+	}
+	if err := h.db.WithContext(c.UserContext()).Create(&conn).Error; err != nil {
+		slog.Error("Failed to create database connection", "name", req.Name, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create connection",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(conn)
+}
+
+// UpdateConnection renames a connection or changes whether the AI may query it.
+func (h *DBConnectionHandler) UpdateConnection(c *fiber.Ctx) error {
+	conn, err := h.findConnection(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		AIQueryable *bool   `json:"ai_queryable"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+	if req.Name != nil && *req.Name != "" {
+		conn.Name = *req.Name
+	}
+	if req.AIQueryable != nil {
+		conn.AIQueryable = *req.AIQueryable
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Save(conn).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update connection",
+		})
+	}
+
+	return c.JSON(conn)
+}
+
+// DeleteConnection removes a connection.
+func (h *DBConnectionHandler) DeleteConnection(c *fiber.Ctx) error {
+	conn, err := h.findConnection(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Delete(conn).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to delete connection",
+		})
+	}
+
+	return c.JSON(fiber.Map{"message": "Connection deleted"})
+}
+
+// findConnection loads a connection by ID. Errors are *fiber.Error values.
+func (h *DBConnectionHandler) findConnection(id string) (*models.DatabaseConnection, error) {
+	connID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid connection ID")
+	}
+
+	var conn models.DatabaseConnection
+	if err := h.db.First(&conn, "id = ?", connID).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Connection not found")
+	}
+	return &conn, nil
+}
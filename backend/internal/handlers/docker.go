@@ -1,37 +1,63 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	maxLogPatternLen = 256
+	maxLogContext    = 10
 )
 
 type DockerHandler struct {
 	serverHandler *ServerHandler
+	execTimeout   time.Duration // stops docker commands that have not finished
+	// startCommand runs long-lived commands such as `docker logs -f`
+	startCommand commandProducer
 }
 
-func NewDockerHandler(serverHandler *ServerHandler) *DockerHandler {
-	return &DockerHandler{serverHandler: serverHandler}
+func NewDockerHandler(serverHandler *ServerHandler, execTimeout time.Duration) *DockerHandler {
+	h := &DockerHandler{serverHandler: serverHandler, execTimeout: execTimeout}
+	h.startCommand = h.startSSHCommand
+	return h
 }
 
-func (h *DockerHandler) execSSH(serverID uuid.UUID, command string) (string, error) {
+// sshClient returns a pooled SSH connection to the server.
+func (h *DockerHandler) sshClient(serverID uuid.UUID) (*ssh.Client, error) {
 	var server models.Server
 	if err := h.serverHandler.GetDB().First(&server, "id = ?", serverID).Error; err != nil {
-		return "", fmt.Errorf("server not found")
+		return nil, fmt.Errorf("server not found")
 	}
 
 	password, privateKey, err := h.serverHandler.GetDecryptedCredentials(&server)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt credentials: %w", err)
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
 	}
 
-	client, err := h.serverHandler.GetSSHPool().GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := h.serverHandler.GetSSHPool().GetConnection(&server, password, privateKey)
 	if err != nil {
-		return "", fmt.Errorf("SSH connection failed: %w", err)
+		return nil, fmt.Errorf("SSH connection failed: %w", err)
+	}
+	return client, nil
+}
+
+func (h *DockerHandler) execSSH(serverID uuid.UUID, command string) (string, error) {
+	client, err := h.sshClient(serverID)
+	if err != nil {
+		return "", err
 	}
 
 	session, err := client.NewSession()
@@ -40,7 +66,7 @@ func (h *DockerHandler) execSSH(serverID uuid.UUID, command string) (string, err
 	}
 	defer session.Close()
 
-	output, err := session.CombinedOutput(command)
+	output, err := services.CombinedOutputTimeout(session, command, h.execTimeout)
 	return string(output), err
 }
 
@@ -66,13 +92,17 @@ func (h *DockerHandler) ListContainers(c *fiber.Ctx) error {
 
 	output, err := h.execSSH(serverID, `docker ps -a --format '{{json .}}'`)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to list containers: " + err.Error(),
 		})
 	}
 
 	containers := parseDockerJSONLines(output)
+	for _, ct := range containers {
+		status, _ := ct["Status"].(string)
+		ct["parsed_status"] = parseDockerStatus(status)
+	}
 	return c.JSON(fiber.Map{"containers": containers})
 }
 
@@ -116,8 +146,11 @@ func (h *DockerHandler) ContainerAction(c *fiber.Ctx) error {
 
 	cmd := fmt.Sprintf("docker %s %s", req.Action, cid)
 	output, err := h.execSSH(serverID, cmd)
+	auditAction(c, h.serverHandler.GetDB(), "container."+req.Action, serverID.String(), map[string]interface{}{
+		"container": cid,
+	}, err)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Container action failed: " + err.Error(),
 			"output":  output,
@@ -130,6 +163,129 @@ func (h *DockerHandler) ContainerAction(c *fiber.Ctx) error {
 	})
 }
 
+// ContainerExec runs {"command": "..."} inside a container with
+// `docker exec <cid> sh -c <command>`. The command is shell-quoted as a
+// single argument, classified like host commands (flagged commands need
+// "confirm": true) and recorded in command history with the container set.
+func (h *DockerHandler) ContainerExec(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	cid := c.Params("cid")
+	if !sanitizeContainerID(cid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid container ID",
+		})
+	}
+
+	var req struct {
+		Command        string `json:"command"`
+		Confirm        bool   `json:"confirm"`         // required to run commands the safety checker flags
+		TimeoutSeconds int    `json:"timeout_seconds"` // overrides EXEC_TIMEOUT
+	}
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Command) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Command is required",
+		})
+	}
+	timeout, err := execTimeout(req.TimeoutSeconds, h.execTimeout)
+	if err != nil {
+		return err
+	}
+
+	safety := services.DefaultSafetyChecker.CheckCommandLine(req.Command)
+	if !safety.IsSafe && !req.Confirm {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error":                 true,
+			"message":               "Command '" + safety.BaseCommand + "' is classified as " + safety.Category + "; resend with confirm to run it",
+			"requires_confirmation": true,
+			"safety":                safetyVerdict(safety),
+		})
+	}
+
+	client, err := h.sshClient(serverID)
+	if err != nil {
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create SSH session",
+		})
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	start := time.Now()
+	cmd := fmt.Sprintf("docker exec %s sh -c %s", cid, services.ShellQuote(req.Command))
+	exitCode, err := services.RunSession(session, cmd, timeout)
+	timedOut := errors.Is(err, services.ErrCommandTimeout)
+	duration := time.Since(start)
+
+	output := stdout.String()
+	if stderr.Len() > 0 {
+		if output != "" {
+			output += "\n"
+		}
+		output += stderr.String()
+	}
+	if timedOut {
+		output += fmt.Sprintf("\n[Killed after %s timeout]", timeout)
+	}
+
+	db := h.serverHandler.GetDB()
+	history := models.CommandHistory{
+		ServerID:   serverID,
+		Command:    req.Command,
+		Container:  cid,
+		Output:     output,
+		OutputHash: services.HashOutput(output),
+		ExitCode:   exitCode,
+		ExecutedAt: start,
+		DurationMs: int(duration.Milliseconds()),
+		TimedOut:   timedOut,
+	}
+	db.Create(&history)
+
+	auditAction(c, db, "container.exec", serverID.String(), map[string]interface{}{
+		"container":  cid,
+		"command":    services.RedactSecrets(req.Command),
+		"exit_code":  exitCode,
+		"history_id": history.ID,
+		"category":   safety.Category,
+	}, nil)
+
+	result := fiber.Map{
+		"container":   cid,
+		"command":     req.Command,
+		"stdout":      stdout.String(),
+		"stderr":      stderr.String(),
+		"exit_code":   exitCode,
+		"timed_out":   timedOut,
+		"duration_ms": history.DurationMs,
+		"id":          history.ID,
+		"safety":      safetyVerdict(safety),
+	}
+	if timedOut {
+		return timedOutResponse(c, result, timeout)
+	}
+	return c.JSON(result)
+}
+
 // ContainerStats returns real-time stats for a container.
 func (h *DockerHandler) ContainerStats(c *fiber.Ctx) error {
 	serverID, err := uuid.Parse(c.Params("id"))
@@ -151,7 +307,7 @@ func (h *DockerHandler) ContainerStats(c *fiber.Ctx) error {
 	cmd := fmt.Sprintf(`docker stats %s --no-stream --format '{{json .}}'`, cid)
 	output, err := h.execSSH(serverID, cmd)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to get container stats: " + err.Error(),
 		})
@@ -184,21 +340,17 @@ func (h *DockerHandler) ContainerLogs(c *fiber.Ctx) error {
 		})
 	}
 
-	tail := c.Query("tail", "200")
-	// Validate tail is numeric
-	for _, ch := range tail {
-		if ch < '0' || ch > '9' {
-			tail = "200"
-			break
-		}
+	if c.Query("grep") != "" {
+		return h.SearchContainerLogs(c)
 	}
 
+	tail := logsTail(c)
 	cmd := fmt.Sprintf("docker logs --tail %s %s 2>&1", tail, cid)
 	output, err := h.execSSH(serverID, cmd)
 	if err != nil {
 		// Docker logs may exit non-zero but still have output
 		if output == "" {
-			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 				"error":   true,
 				"message": "Failed to get container logs: " + err.Error(),
 			})
@@ -208,6 +360,203 @@ func (h *DockerHandler) ContainerLogs(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"logs": output})
 }
 
+// SearchContainerLogs greps the recent logs of a container for an extended
+// regular expression (?pattern= or ?grep=), with optional ?context= lines
+// around each match.
+func (h *DockerHandler) SearchContainerLogs(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	cid := c.Params("cid")
+	if !sanitizeContainerID(cid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid container ID",
+		})
+	}
+
+	pattern := c.Query("pattern", c.Query("grep"))
+	if err := validateLogPattern(pattern); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	context := c.QueryInt("context", 0)
+	if context < 0 || context > maxLogContext {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("context must be between 0 and %d", maxLogContext),
+		})
+	}
+
+	tail := logsTail(c)
+	output, err := h.execSSH(serverID, logSearchCommand(cid, tail, context, pattern))
+	if err != nil {
+		// grep exits 1 when nothing matched
+		var exitErr *ssh.ExitError
+		switch {
+		case errors.As(err, &exitErr) && exitErr.ExitStatus() == 1:
+		case errors.As(err, &exitErr) && exitErr.ExitStatus() == logSearchBadPattern:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid pattern: " + strings.TrimPrefix(strings.TrimSpace(output), "grep: "),
+			})
+		case errors.As(err, &exitErr) && exitErr.ExitStatus() == logSearchDockerFailed:
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to read container logs: " + strings.TrimSpace(output),
+			})
+		default:
+			return c.Status(execErrorStatus(err)).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to search container logs: " + err.Error(),
+			})
+		}
+	}
+
+	lines := parseGrepOutput(output)
+	matches := 0
+	for _, l := range lines {
+		if l.Match {
+			matches++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"pattern": pattern,
+		"tail":    tail,
+		"context": context,
+		"matches": matches,
+		"lines":   lines,
+	})
+}
+
+// logsTail reads the numeric ?tail= parameter, defaulting to 200.
+func logsTail(c *fiber.Ctx) string {
+	tail := c.Query("tail", "200")
+	// Validate tail is numeric
+	for _, ch := range tail {
+		if ch < '0' || ch > '9' {
+			return "200"
+		}
+	}
+	if tail == "" {
+		return "200"
+	}
+	return tail
+}
+
+// Exit statuses of logSearchCommand besides grep's own 0 and 1.
+const (
+	logSearchBadPattern   = 2
+	logSearchDockerFailed = 3
+)
+
+// logSearchCommand greps the last tail lines of a container's logs for an
+// extended regular expression. The pattern is first checked by the same grep
+// that runs the search, and docker failures exit logSearchDockerFailed with
+// docker's message rather than reaching grep as an empty log.
+func logSearchCommand(cid, tail string, context int, pattern string) string {
+	p := services.ShellQuote(pattern)
+	return fmt.Sprintf("grep -E -e %[1]s </dev/null 2>&1; [ $? -eq 2 ] && exit %[2]d; "+
+		"out=$(docker logs --tail %[3]s %[4]s 2>&1) || { printf '%%s\\n' \"$out\"; exit %[5]d; }; "+
+		"printf '%%s\\n' \"$out\" | grep -n -E -C %[6]d -e %[1]s",
+		p, logSearchBadPattern, tail, cid, logSearchDockerFailed, context)
+}
+
+// validateLogPattern checks that a pattern is present and fits on one line.
+// It is shell-quoted, so this guards against malformed input rather than
+// injection; the remote grep decides whether it is a valid expression.
+func validateLogPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	if len(pattern) > maxLogPatternLen {
+		return fmt.Errorf("pattern must be at most %d characters", maxLogPatternLen)
+	}
+	if strings.ContainsAny(pattern, "\x00\r\n") {
+		return fmt.Errorf("pattern must be a single line")
+	}
+	return nil
+}
+
+// logLine is one line of grep output; Match is false for context lines.
+type logLine struct {
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
+
+var grepLineRe = regexp.MustCompile(`^(\d+)([:-])(.*)$`)
+
+// parseGrepOutput parses "grep -n -C" output, where matches are "N:text",
+// context lines "N-text" and groups are separated by "--".
+func parseGrepOutput(output string) []logLine {
+	lines := []logLine{}
+	for _, raw := range strings.Split(output, "\n") {
+		m := grepLineRe.FindStringSubmatch(strings.TrimRight(raw, "\r"))
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		lines = append(lines, logLine{Line: n, Text: m[3], Match: m[2] == ":"})
+	}
+	return lines
+}
+
+// ContainerTop returns the processes running inside a container.
+func (h *DockerHandler) ContainerTop(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	cid := c.Params("cid")
+	if !sanitizeContainerID(cid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid container ID",
+		})
+	}
+
+	output, err := h.execSSH(serverID, fmt.Sprintf("docker top %s", cid))
+	if err != nil {
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to list container processes: " + err.Error(),
+			"output":  strings.TrimSpace(output),
+		})
+	}
+
+	header, rows, ok := parseDockerTop(output)
+	if !ok {
+		// Column layout didn't match the header; hand back the raw table
+		return c.JSON(fiber.Map{
+			"container": cid,
+			"parsed":    false,
+			"header":    header,
+			"raw":       strings.TrimSpace(output),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"container": cid,
+		"parsed":    true,
+		"header":    header,
+		"processes": rows,
+	})
+}
+
 // ListImages returns all Docker images.
 func (h *DockerHandler) ListImages(c *fiber.Ctx) error {
 	serverID, err := uuid.Parse(c.Params("id"))
@@ -220,7 +569,7 @@ func (h *DockerHandler) ListImages(c *fiber.Ctx) error {
 
 	output, err := h.execSSH(serverID, `docker images --format '{{json .}}'`)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to list images: " + err.Error(),
 		})
@@ -263,7 +612,7 @@ func (h *DockerHandler) PullImage(c *fiber.Ctx) error {
 	cmd := fmt.Sprintf("docker pull %s", req.Image)
 	output, err := h.execSSH(serverID, cmd)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to pull image: " + err.Error(),
 			"output":  output,
@@ -288,7 +637,7 @@ func (h *DockerHandler) PruneImages(c *fiber.Ctx) error {
 
 	output, err := h.execSSH(serverID, "docker image prune -f")
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to prune images: " + err.Error(),
 			"output":  output,
@@ -322,7 +671,7 @@ func (h *DockerHandler) RemoveImage(c *fiber.Ctx) error {
 	cmd := fmt.Sprintf("docker rmi %s", iid)
 	output, err := h.execSSH(serverID, cmd)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to remove image: " + err.Error(),
 			"output":  output,
@@ -353,3 +702,137 @@ func parseDockerJSONLines(output string) []map[string]interface{} {
 
 	return results
 }
+
+// dockerStatus is the normalized form of a `docker ps` Status string such as
+// "Up 3 hours (healthy)" or "Exited (137) 2 minutes ago".
+type dockerStatus struct {
+	State           string `json:"state"`                      // running, paused, restarting, exited, created, dead, removing, unknown
+	Duration        string `json:"duration,omitempty"`         // "3 hours" — uptime when running, time since exit otherwise
+	DurationSeconds int64  `json:"duration_seconds,omitempty"` // approximate
+	ExitCode        *int   `json:"exit_code,omitempty"`
+	ExitReason      string `json:"exit_reason,omitempty"` // oom_or_killed (137), terminated (143), error, success
+	Health          string `json:"health,omitempty"`      // healthy, unhealthy, starting
+}
+
+var (
+	dockerUpRe     = regexp.MustCompile(`^Up (.+?)(?: \((.+)\))?$`)
+	dockerExitedRe = regexp.MustCompile(`^(Exited|Restarting) \((-?\d+)\) (.+?)(?: ago)?$`)
+	dockerHealthRe = regexp.MustCompile(`^(?:health: )?(healthy|unhealthy|starting)$`)
+	dockerCountRe  = regexp.MustCompile(`^(\d+|an?|About an?) (second|minute|hour|day|week|month|year)s?$`)
+)
+
+var dockerUnitSeconds = map[string]int64{
+	"second": 1,
+	"minute": 60,
+	"hour":   3600,
+	"day":    86400,
+	"week":   7 * 86400,
+	"month":  30 * 86400,
+	"year":   365 * 86400,
+}
+
+// parseDockerStatus extracts state, duration, exit code and health from a
+// `docker ps` Status string. Unrecognized strings yield state "unknown".
+func parseDockerStatus(status string) dockerStatus {
+	status = strings.TrimSpace(status)
+
+	if m := dockerUpRe.FindStringSubmatch(status); m != nil {
+		st := dockerStatus{State: "running", Duration: m[1]}
+		for _, note := range strings.Split(m[2], ", ") {
+			if note == "Paused" {
+				st.State = "paused"
+			} else if h := dockerHealthRe.FindStringSubmatch(note); h != nil {
+				st.Health = h[1]
+			}
+		}
+		st.DurationSeconds = dockerDurationSeconds(st.Duration)
+		return st
+	}
+
+	if m := dockerExitedRe.FindStringSubmatch(status); m != nil {
+		st := dockerStatus{State: strings.ToLower(m[1]), Duration: m[3]}
+		if code, err := strconv.Atoi(m[2]); err == nil {
+			st.ExitCode = &code
+			st.ExitReason = dockerExitReason(code)
+		}
+		st.DurationSeconds = dockerDurationSeconds(st.Duration)
+		return st
+	}
+
+	switch {
+	case status == "Created":
+		return dockerStatus{State: "created"}
+	case status == "Dead":
+		return dockerStatus{State: "dead"}
+	case strings.HasPrefix(status, "Removal In Progress"):
+		return dockerStatus{State: "removing"}
+	}
+	return dockerStatus{State: "unknown"}
+}
+
+// dockerExitReason explains an exit code; 137 (SIGKILL) usually means the
+// OOM killer, 143 (SIGTERM) a normal stop.
+func dockerExitReason(code int) string {
+	switch code {
+	case 0:
+		return "success"
+	case 137:
+		return "oom_or_killed"
+	case 143:
+		return "terminated"
+	}
+	return "error"
+}
+
+// dockerDurationSeconds converts Docker's humanized durations ("3 hours",
+// "About a minute", "Less than a second") to approximate seconds.
+func dockerDurationSeconds(d string) int64 {
+	if d == "" || d == "Less than a second" {
+		return 0
+	}
+	m := dockerCountRe.FindStringSubmatch(d)
+	if m == nil {
+		return 0
+	}
+	n := int64(1)
+	if v, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+		n = v
+	}
+	return n * dockerUnitSeconds[m[2]]
+}
+
+// parseDockerTop parses `docker top` output into rows keyed by lowercased header.
+// The last column (CMD) may contain spaces and absorbs any trailing fields.
+// ok is false when a row has fewer fields than the header.
+func parseDockerTop(output string) (header []string, rows []map[string]string, ok bool) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return nil, nil, false
+	}
+
+	header = strings.Fields(lines[0])
+	ok = true
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < len(header) {
+			ok = false
+			continue
+		}
+
+		row := make(map[string]string, len(header))
+		for i, col := range header {
+			key := strings.ToLower(col)
+			if i == len(header)-1 {
+				row[key] = strings.Join(fields[i:], " ")
+			} else {
+				row[key] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return header, rows, ok
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// composeActions maps the allowed compose actions to their subcommand.
+var composeActions = map[string]string{
+	"up":      "up -d",
+	"down":    "down",
+	"restart": "restart",
+}
+
+// composeProject is one entry of `docker compose ls --format json`.
+type composeProject struct {
+	Name        string   `json:"name"`
+	Status      string   `json:"status"` // e.g. "running(2), exited(1)"
+	ConfigFiles []string `json:"config_files"`
+	Path        string   `json:"path"` // directory of the first config file
+}
+
+// parseComposeLs parses `docker compose ls --format json`. The JSON array is
+// printed on one line; anything else (warnings mixed in from stderr) is
+// skipped.
+func parseComposeLs(output string) ([]composeProject, error) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		var raw []struct {
+			Name        string `json:"Name"`
+			Status      string `json:"Status"`
+			ConfigFiles string `json:"ConfigFiles"`
+		}
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			return nil, fmt.Errorf("unexpected docker compose ls output: %w", err)
+		}
+
+		projects := make([]composeProject, 0, len(raw))
+		for _, r := range raw {
+			p := composeProject{Name: r.Name, Status: r.Status, ConfigFiles: []string{}}
+			for _, f := range strings.Split(r.ConfigFiles, ",") {
+				if f = strings.TrimSpace(f); f != "" {
+					p.ConfigFiles = append(p.ConfigFiles, f)
+				}
+			}
+			if len(p.ConfigFiles) > 0 {
+				p.Path = path.Dir(p.ConfigFiles[0])
+			}
+			projects = append(projects, p)
+		}
+		return projects, nil
+	}
+	return nil, fmt.Errorf("unexpected docker compose ls output: no JSON found")
+}
+
+// ListComposeProjects lists compose projects on the server, including
+// stopped ones.
+func (h *DockerHandler) ListComposeProjects(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	output, err := h.execSSH(serverID, "docker compose ls --all --format json")
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to list compose projects: " + err.Error(),
+			"output":  strings.TrimSpace(output),
+		})
+	}
+
+	projects, err := parseComposeLs(output)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"projects": projects,
+		"total":    len(projects),
+	})
+}
+
+// ComposeAction runs up (detached), down or restart on the compose project
+// at path. path is the project directory or its compose file.
+func (h *DockerHandler) ComposeAction(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var req struct {
+		Path   string `json:"path"`
+		Action string `json:"action"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Path == "" || !sanitizePath(req.Path) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Valid path is required",
+		})
+	}
+
+	subcommand, ok := composeActions[req.Action]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid action. Must be: up, down, restart",
+		})
+	}
+
+	cmd := fmt.Sprintf("cd %s && docker compose %s 2>&1", services.ShellQuote(req.Path), subcommand)
+	if ext := path.Ext(req.Path); ext == ".yml" || ext == ".yaml" {
+		cmd = fmt.Sprintf("docker compose -f %s %s 2>&1", services.ShellQuote(req.Path), subcommand)
+	}
+	output, err := h.execSSH(serverID, cmd)
+	auditAction(c, h.serverHandler.GetDB(), "compose."+req.Action, serverID.String(), map[string]interface{}{
+		"path": req.Path,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Compose " + req.Action + " failed: " + err.Error(),
+			"output":  strings.TrimSpace(output),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": fmt.Sprintf("Compose project %s: %s", req.Path, req.Action),
+		"output":  strings.TrimSpace(output),
+	})
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// maxLogLineLen caps a single streamed log line; longer lines end the stream
+// with an error rather than growing the buffer without bound.
+const maxLogLineLen = 1024 * 1024
+
+// commandStream is a running remote command. Close stops the command and
+// unblocks any pending reads.
+type commandStream struct {
+	Stdout io.Reader
+	Stderr io.Reader
+	Close  func() error
+}
+
+// commandProducer starts command on a server and returns its output streams.
+type commandProducer func(serverID uuid.UUID, command string) (*commandStream, error)
+
+// startSSHCommand runs command on the server in its own SSH session.
+func (h *DockerHandler) startSSHCommand(serverID uuid.UUID, command string) (*commandStream, error) {
+	client, err := h.sshClient(serverID)
+	if err != nil {
+		return nil, err
+	}
+	return startSessionCommand(client, command)
+}
+
+// startSessionCommand runs command in a new session on client. Closing the
+// stream signals the remote process before closing the session, so
+// `docker logs -f` does not linger on the server waiting for its next write
+// to fail.
+func startSessionCommand(client *ssh.Client, command string) (*commandStream, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("SSH session failed: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("SSH session failed: %w", err)
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("SSH session failed: %w", err)
+	}
+	if err := session.Start(command); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	var once sync.Once
+	return &commandStream{
+		Stdout: stdout,
+		Stderr: stderr,
+		Close: func() error {
+			var err error
+			once.Do(func() {
+				session.Signal(ssh.SIGTERM)
+				err = session.Close()
+			})
+			return err
+		},
+	}, nil
+}
+
+// logStreamMessage is one frame sent to a container log stream client.
+type logStreamMessage struct {
+	Type   string `json:"type"`             // line, error, end
+	Stream string `json:"stream,omitempty"` // stdout, stderr (line only)
+	Data   string `json:"data,omitempty"`
+}
+
+// LogStreamCheck validates a log stream request before the WebSocket
+// upgrade, so bad IDs get a plain HTTP error instead of an opened socket.
+func (h *DockerHandler) LogStreamCheck() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := uuid.Parse(c.Params("id")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid server ID",
+			})
+		}
+		if !sanitizeContainerID(c.Params("cid")) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid container ID",
+			})
+		}
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+		c.Locals("tail", logsTail(c))
+		return c.Next()
+	}
+}
+
+// StreamContainerLogs follows a container's logs over a WebSocket. It runs
+// `docker logs -f --tail N` and sends each stdout/stderr line as it arrives.
+// The client stops following by sending {"action":"stop"} or by closing the
+// socket; either way the remote command is stopped and an "end" frame is
+// sent if the socket is still open.
+func (h *DockerHandler) StreamContainerLogs() fiber.Handler {
+	return websocket.New(func(c *websocket.Conn) {
+		serverID, _ := uuid.Parse(c.Params("id"))
+		cid := c.Params("cid")
+		tail, _ := c.Locals("tail").(string)
+
+		cmd := fmt.Sprintf("docker logs -f --tail %s %s", tail, cid)
+		stream, err := h.startCommand(serverID, cmd)
+		if err != nil {
+			c.WriteJSON(logStreamMessage{Type: "error", Data: err.Error()})
+			return
+		}
+		defer stream.Close()
+
+		slog.Info("Container log stream started", "server", serverID, "container", cid)
+		reason := pumpLogStream(c, stream)
+		slog.Info("Container log stream ended", "server", serverID, "container", cid, "reason", reason)
+	})
+}
+
+// logStreamConn is the part of *websocket.Conn that pumpLogStream uses.
+type logStreamConn interface {
+	ReadMessage() (int, []byte, error)
+	WriteJSON(v interface{}) error
+}
+
+// pumpLogStream forwards stream's output lines to conn until the command
+// exits, the client asks to stop, or the client goes away, and returns which
+// of those happened. It closes stream and waits for its reader goroutines
+// before returning, so nothing outlives the call except the client reader,
+// which exits once the socket is closed.
+func pumpLogStream(conn logStreamConn, stream *commandStream) string {
+	lines := make(chan logStreamMessage, 64)
+	quit := make(chan struct{})
+
+	var readers sync.WaitGroup
+	for name, r := range map[string]io.Reader{"stdout": stream.Stdout, "stderr": stream.Stderr} {
+		if r == nil {
+			continue
+		}
+		readers.Add(1)
+		go func(name string, r io.Reader) {
+			defer readers.Done()
+			scanner := bufio.NewScanner(r)
+			scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineLen)
+			for scanner.Scan() {
+				select {
+				case lines <- logStreamMessage{Type: "line", Stream: name, Data: scanner.Text()}:
+				case <-quit:
+					return
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				select {
+				case lines <- logStreamMessage{Type: "error", Data: name + ": " + err.Error()}:
+				case <-quit:
+				}
+			}
+		}(name, r)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		readers.Wait()
+		close(exited)
+	}()
+
+	// Client → stop requests. A read error means the socket is gone.
+	stop := make(chan struct{})
+	gone := make(chan struct{})
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				close(gone)
+				return
+			}
+			var req struct {
+				Action string `json:"action"`
+			}
+			if json.Unmarshal(msg, &req) == nil && req.Action == "stop" {
+				close(stop)
+				return
+			}
+		}
+	}()
+
+	finish := func(reason string) string {
+		close(quit)
+		stream.Close()
+		readers.Wait()
+		return reason
+	}
+
+	// Lines → client (single writer)
+	for {
+		select {
+		case msg := <-lines:
+			if conn.WriteJSON(msg) != nil {
+				return finish("client gone")
+			}
+		case <-exited:
+			// Flush what the readers queued before they finished
+			for len(lines) > 0 {
+				if conn.WriteJSON(<-lines) != nil {
+					return finish("client gone")
+				}
+			}
+			conn.WriteJSON(logStreamMessage{Type: "end", Data: "exited"})
+			return finish("exited")
+		case <-stop:
+			reason := finish("cancelled")
+			conn.WriteJSON(logStreamMessage{Type: "end", Data: reason})
+			return reason
+		case <-gone:
+			return finish("client gone")
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// fakeCommand is a commandStream fed through pipes. Close fails pending
+// reads the way closing an SSH session does.
+type fakeCommand struct {
+	stdout, stderr *io.PipeWriter
+	stream         *commandStream
+	closes         atomic.Int32
+}
+
+func newFakeCommand() *fakeCommand {
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	f := &fakeCommand{stdout: outW, stderr: errW}
+	f.stream = &commandStream{
+		Stdout: outR,
+		Stderr: errR,
+		Close: func() error {
+			f.closes.Add(1)
+			outR.CloseWithError(io.ErrClosedPipe)
+			errR.CloseWithError(io.ErrClosedPipe)
+			return nil
+		},
+	}
+	return f
+}
+
+// exit ends the command after writing its remaining output.
+func (f *fakeCommand) exit() {
+	f.stdout.Close()
+	f.stderr.Close()
+}
+
+// fakeLogConn is a logStreamConn. Messages sent on reads reach the pump as
+// client frames; closing reads makes ReadMessage fail as if the socket went
+// away.
+type fakeLogConn struct {
+	reads chan string
+
+	mu      sync.Mutex
+	written []logStreamMessage
+}
+
+func (c *fakeLogConn) ReadMessage() (int, []byte, error) {
+	msg, ok := <-c.reads
+	if !ok {
+		return 0, nil, errors.New("websocket: close 1001")
+	}
+	return 1, []byte(msg), nil
+}
+
+func (c *fakeLogConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, v.(logStreamMessage))
+	return nil
+}
+
+func (c *fakeLogConn) messages() []logStreamMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]logStreamMessage(nil), c.written...)
+}
+
+// waitForLines waits until n line frames have been written.
+func (c *fakeLogConn) waitForLines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(c.messages()) >= n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("got %v, want %d lines", c.messages(), n)
+}
+
+func runPump(conn *fakeLogConn, cmd *fakeCommand) chan string {
+	done := make(chan string, 1)
+	go func() { done <- pumpLogStream(conn, cmd.stream) }()
+	return done
+}
+
+func waitPump(t *testing.T, done chan string) string {
+	t.Helper()
+	select {
+	case reason := <-done:
+		return reason
+	case <-time.After(5 * time.Second):
+		t.Fatal("pumpLogStream did not return")
+		return ""
+	}
+}
+
+func TestPumpLogStreamForwardsUntilExit(t *testing.T) {
+	conn := &fakeLogConn{reads: make(chan string)}
+	cmd := newFakeCommand()
+	done := runPump(conn, cmd)
+
+	cmd.stdout.Write([]byte("listening on :8080\nGET /health 200\n"))
+	cmd.stderr.Write([]byte("warning: cache cold\n"))
+	conn.waitForLines(t, 3)
+	cmd.exit()
+
+	if reason := waitPump(t, done); reason != "exited" {
+		t.Errorf("reason = %q, want exited", reason)
+	}
+	msgs := conn.messages()
+	var stdout []string
+	var stderr string
+	for _, m := range msgs[:len(msgs)-1] {
+		if m.Type != "line" {
+			t.Errorf("unexpected frame %+v", m)
+		}
+		if m.Stream == "stdout" {
+			stdout = append(stdout, m.Data)
+		} else {
+			stderr = m.Data
+		}
+	}
+	if strings.Join(stdout, "|") != "listening on :8080|GET /health 200" || stderr != "warning: cache cold" {
+		t.Errorf("forwarded stdout %q and stderr %q", stdout, stderr)
+	}
+	if last := msgs[len(msgs)-1]; last != (logStreamMessage{Type: "end", Data: "exited"}) {
+		t.Errorf("last frame = %+v, want end exited", last)
+	}
+	if n := cmd.closes.Load(); n != 1 {
+		t.Errorf("stream closed %d times, want once", n)
+	}
+	close(conn.reads)
+}
+
+func TestPumpLogStreamStopsOnRequest(t *testing.T) {
+	conn := &fakeLogConn{reads: make(chan string)}
+	cmd := newFakeCommand()
+	done := runPump(conn, cmd)
+
+	cmd.stdout.Write([]byte("tick\n"))
+	conn.waitForLines(t, 1)
+	conn.reads <- `{"action":"ping"}`
+	conn.reads <- `{"action":"stop"}`
+
+	if reason := waitPump(t, done); reason != "cancelled" {
+		t.Errorf("reason = %q, want cancelled", reason)
+	}
+	msgs := conn.messages()
+	if last := msgs[len(msgs)-1]; last != (logStreamMessage{Type: "end", Data: "cancelled"}) {
+		t.Errorf("last frame = %+v, want end cancelled", last)
+	}
+	// The command was stopped: nothing more can be written to it
+	if _, err := cmd.stdout.Write([]byte("tock\n")); err == nil {
+		t.Error("command output still read after the client stopped following")
+	}
+	if n := cmd.closes.Load(); n != 1 {
+		t.Errorf("stream closed %d times, want once", n)
+	}
+}
+
+func TestPumpLogStreamStopsWhenClientGoes(t *testing.T) {
+	conn := &fakeLogConn{reads: make(chan string)}
+	cmd := newFakeCommand()
+	done := runPump(conn, cmd)
+
+	close(conn.reads)
+	if reason := waitPump(t, done); reason != "client gone" {
+		t.Errorf("reason = %q, want client gone", reason)
+	}
+	if n := cmd.closes.Load(); n != 1 {
+		t.Errorf("stream closed %d times, want once", n)
+	}
+	if msgs := conn.messages(); len(msgs) != 0 {
+		t.Errorf("frames written to a closed socket: %v", msgs)
+	}
+}
+
+func TestStreamContainerLogsRunsDockerLogs(t *testing.T) {
+	cmd := newFakeCommand()
+	started := make(chan string, 1)
+	h := &DockerHandler{startCommand: func(_ uuid.UUID, command string) (*commandStream, error) {
+		started <- command
+		return cmd.stream, nil
+	}}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/servers/:id/docker/containers/:cid/logs/stream", h.LogStreamCheck(), h.StreamContainerLogs())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	url := "ws://" + ln.Addr().String() + "/servers/" + uuid.NewString() + "/docker/containers/web_1/logs/stream?tail=50"
+	ws, _, err := fastws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if command := <-started; command != "docker logs -f --tail 50 web_1" {
+		t.Errorf("command = %q", command)
+	}
+	cmd.stdout.Write([]byte("ready\n"))
+	var msg logStreamMessage
+	if err := ws.ReadJSON(&msg); err != nil || msg != (logStreamMessage{Type: "line", Stream: "stdout", Data: "ready"}) {
+		t.Fatalf("first frame = %+v, %v; want the stdout line", msg, err)
+	}
+
+	ws.WriteJSON(map[string]string{"action": "stop"})
+	msg = logStreamMessage{}
+	if err := ws.ReadJSON(&msg); err != nil || msg != (logStreamMessage{Type: "end", Data: "cancelled"}) {
+		t.Errorf("after stop frame = %+v, %v; want end cancelled", msg, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for cmd.closes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if cmd.closes.Load() == 0 {
+		t.Error("remote command not closed after the client stopped following")
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDockerStatus(t *testing.T) {
+	tests := []struct {
+		status   string
+		state    string
+		duration string
+		seconds  int64
+		exitCode int // -1 when no exit code is expected
+		reason   string
+		health   string
+	}{
+		{"Up 3 hours", "running", "3 hours", 3 * 3600, -1, "", ""},
+		{"Up 3 hours (healthy)", "running", "3 hours", 3 * 3600, -1, "", "healthy"},
+		{"Up 12 seconds (health: starting)", "running", "12 seconds", 12, -1, "", "starting"},
+		{"Up About a minute (unhealthy)", "running", "About a minute", 60, -1, "", "unhealthy"},
+		{"Up Less than a second", "running", "Less than a second", 0, -1, "", ""},
+		{"Up 2 days (Paused)", "paused", "2 days", 2 * 86400, -1, "", ""},
+		{"Exited (0) 5 minutes ago", "exited", "5 minutes", 300, 0, "success", ""},
+		{"Exited (137) 2 minutes ago", "exited", "2 minutes", 120, 137, "oom_or_killed", ""},
+		{"Exited (143) About an hour ago", "exited", "About an hour", 3600, 143, "terminated", ""},
+		{"Exited (1) 3 weeks ago", "exited", "3 weeks", 3 * 7 * 86400, 1, "error", ""},
+		{"Restarting (1) 4 seconds ago", "restarting", "4 seconds", 4, 1, "error", ""},
+		{"Created", "created", "", 0, -1, "", ""},
+		{"Dead", "dead", "", 0, -1, "", ""},
+		{"Removal In Progress", "removing", "", 0, -1, "", ""},
+		{"something new", "unknown", "", 0, -1, "", ""},
+	}
+	for _, tt := range tests {
+		got := parseDockerStatus(tt.status)
+		if got.State != tt.state || got.Duration != tt.duration || got.DurationSeconds != tt.seconds ||
+			got.ExitReason != tt.reason || got.Health != tt.health {
+			t.Errorf("parseDockerStatus(%q) = %+v, want state %s duration %q (%ds) reason %q health %q",
+				tt.status, got, tt.state, tt.duration, tt.seconds, tt.reason, tt.health)
+		}
+		switch {
+		case tt.exitCode < 0 && got.ExitCode != nil:
+			t.Errorf("parseDockerStatus(%q) exit code = %d, want none", tt.status, *got.ExitCode)
+		case tt.exitCode >= 0 && (got.ExitCode == nil || *got.ExitCode != tt.exitCode):
+			t.Errorf("parseDockerStatus(%q) exit code = %v, want %d", tt.status, got.ExitCode, tt.exitCode)
+		}
+	}
+}
+
+func TestLogSearchCommand(t *testing.T) {
+	if _, err := exec.LookPath("grep"); err != nil {
+		t.Skip("grep not installed")
+	}
+	// A fake docker prints a short log, or fails for the container "gone"
+	bin := t.TempDir()
+	fake := "#!/bin/sh\n" +
+		"if [ \"$4\" = gone ]; then echo 'Error response from daemon: No such container: gone' >&2; exit 1; fi\n" +
+		"printf 'starting\\nerror: disk full\\nretry retry\\nerror: disk full\\n'\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(fake), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(cid, pattern string) (string, int) {
+		cmd := exec.Command("sh", "-c", logSearchCommand(cid, "200", 0, pattern))
+		cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out), 0
+	}
+
+	tests := []struct {
+		cid, pattern string
+		status       int
+		output       string
+	}{
+		{"web", "error: (disk|memory)", 0, "4:error: disk full"},
+		{"web", `(retry) \1`, 0, "3:retry retry"}, // backreference, which RE2 rejects
+		{"web", "nothing here", 1, ""},
+		{"web", "a(b", logSearchBadPattern, "grep:"},
+		{"gone", "error", logSearchDockerFailed, "No such container: gone"},
+		{"gone", "a(b", logSearchBadPattern, "grep:"},
+	}
+	for _, tt := range tests {
+		out, status := run(tt.cid, tt.pattern)
+		if status != tt.status || !strings.Contains(out, tt.output) {
+			t.Errorf("search %s for %q = %d %q, want %d containing %q", tt.cid, tt.pattern, status, out, tt.status, tt.output)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// factsTTL is how long cached server facts are served before re-gathering.
+const factsTTL = 6 * time.Hour
+
+// gatherFactsScript prints one key=value line per fact in a single session.
+const gatherFactsScript = `echo "hostname=$(hostname 2>/dev/null)"
+echo "os=$(. /etc/os-release 2>/dev/null && echo "$PRETTY_NAME")"
+echo "kernel=$(uname -r)"
+echo "arch=$(uname -m)"
+echo "cpu_model=$(grep -m1 'model name' /proc/cpuinfo 2>/dev/null | cut -d: -f2-)"
+echo "cpu_cores=$(nproc 2>/dev/null)"
+echo "mem_total_kb=$(awk '/MemTotal/{print $2}' /proc/meminfo 2>/dev/null)"
+echo "ips=$(hostname -I 2>/dev/null)"
+echo "docker=$(docker version --format '{{.Server.Version}}' 2>/dev/null)"
+echo "compose=$(docker compose version --short 2>/dev/null || docker-compose version --short 2>/dev/null)"
+echo "timezone=$(timedatectl show -p Timezone --value 2>/dev/null || cat /etc/timezone 2>/dev/null || date +%Z)"`
+
+// GetFacts returns static inventory facts for a server, served from cache
+// unless stale or ?refresh=true is passed.
+func (h *ServerHandler) GetFacts(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	refresh := c.QueryBool("refresh", false)
+	fresh := server.FactsUpdatedAt != nil && time.Since(*server.FactsUpdatedAt) < factsTTL
+	if !refresh && fresh && len(server.Facts) > 0 {
+		var facts models.ServerFacts
+		if json.Unmarshal(server.Facts, &facts) == nil {
+			return c.JSON(fiber.Map{
+				"facts":      facts,
+				"cached":     true,
+				"updated_at": server.FactsUpdatedAt,
+			})
+		}
+	}
+
+	password, privateKey, err := h.decryptCredentials(&server)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to decrypt credentials",
+		})
+	}
+
+	client, err := h.sshPool.GetConnection(&server, password, privateKey)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "SSH connection failed: " + err.Error(),
+		})
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create SSH session",
+		})
+	}
+	defer session.Close()
+
+	// Individual probes may fail; whatever was printed is still usable
+	output, _ := session.CombinedOutput(gatherFactsScript)
+	facts := parseServerFacts(string(output))
+
+	now := time.Now()
+	if b, err := json.Marshal(facts); err == nil {
+		h.db.Model(&server).Updates(map[string]interface{}{
+			"facts":            datatypes.JSON(b),
+			"facts_updated_at": now,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"facts":      facts,
+		"cached":     false,
+		"updated_at": now,
+	})
+}
+
+// parseServerFacts parses key=value lines from gatherFactsScript.
+func parseServerFacts(output string) models.ServerFacts {
+	var facts models.ServerFacts
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "hostname":
+			facts.Hostname = value
+		case "os":
+			facts.OS = value
+		case "kernel":
+			facts.Kernel = value
+		case "arch":
+			facts.Arch = value
+		case "cpu_model":
+			facts.CPUModel = value
+		case "cpu_cores":
+			facts.CPUCores, _ = strconv.Atoi(value)
+		case "mem_total_kb":
+			kb, _ := strconv.ParseInt(value, 10, 64)
+			facts.MemoryTotalMB = kb / 1024
+		case "ips":
+			facts.IPAddresses = strings.Fields(value)
+		case "docker":
+			facts.DockerVersion = value
+		case "compose":
+			facts.ComposeVersion = value
+		case "timezone":
+			facts.Timezone = value
+		}
+	}
+	if facts.IPAddresses == nil {
+		facts.IPAddresses = []string{}
+	}
+	return facts
+}
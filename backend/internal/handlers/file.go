@@ -2,19 +2,36 @@ package handlers
 
 import (
 	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/ahmetk3436/bastion/internal/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/pkg/sftp"
 )
 
+// sftpOpener opens an SFTP session to a server.
+type sftpOpener func(serverID uuid.UUID) (*sftp.Client, error)
+
 type FileHandler struct {
 	serverHandler *ServerHandler
+	maxUpload     int64 // bytes
+	// openSFTP opens the SFTP sessions behind uploads, downloads and file operations
+	openSFTP sftpOpener
 }
 
-func NewFileHandler(serverHandler *ServerHandler) *FileHandler {
-	return &FileHandler{serverHandler: serverHandler}
+func NewFileHandler(serverHandler *ServerHandler, maxUploadMB int) *FileHandler {
+	if maxUploadMB <= 0 {
+		maxUploadMB = 100
+	}
+	h := &FileHandler{serverHandler: serverHandler, maxUpload: int64(maxUploadMB) << 20}
+	h.openSFTP = h.sftpClient
+	return h
 }
 
 func (h *FileHandler) execSSH(serverID uuid.UUID, command string) (string, error) {
@@ -28,7 +45,7 @@ func (h *FileHandler) execSSH(serverID uuid.UUID, command string) (string, error
 		return "", fmt.Errorf("failed to decrypt credentials: %w", err)
 	}
 
-	client, err := h.serverHandler.GetSSHPool().GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := h.serverHandler.GetSSHPool().GetConnection(&server, password, privateKey)
 	if err != nil {
 		return "", fmt.Errorf("SSH connection failed: %w", err)
 	}
@@ -43,6 +60,44 @@ func (h *FileHandler) execSSH(serverID uuid.UUID, command string) (string, error
 	return string(output), err
 }
 
+// sftpClient opens an SFTP session over the pooled SSH connection.
+// Closing the returned client leaves the SSH connection open.
+func (h *FileHandler) sftpClient(serverID uuid.UUID) (*sftp.Client, error) {
+	var server models.Server
+	if err := h.serverHandler.GetDB().First(&server, "id = ?", serverID).Error; err != nil {
+		return nil, fmt.Errorf("server not found")
+	}
+
+	password, privateKey, err := h.serverHandler.GetDecryptedCredentials(&server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+
+	client, err := h.serverHandler.GetSSHPool().GetConnection(&server, password, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("SSH connection failed: %w", err)
+	}
+
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("SFTP session failed: %w", err)
+	}
+	return sc, nil
+}
+
+// sftpReader streams a byte range of a remote file and closes the file and
+// SFTP session once the response body has been sent.
+type sftpReader struct {
+	io.Reader
+	file   *sftp.File
+	client *sftp.Client
+}
+
+func (r *sftpReader) Close() error {
+	r.file.Close()
+	return r.client.Close()
+}
+
 // sanitizePath validates the path does not contain shell injection characters.
 func sanitizePath(path string) bool {
 	// Disallow shell metacharacters
@@ -55,7 +110,45 @@ func sanitizePath(path string) bool {
 	return path != "" && len(path) <= 4096
 }
 
-// ListFiles returns directory listing.
+// Directory listing bounds for ListFiles.
+const (
+	defaultListLimit = 1000
+	maxListLimit     = 10000
+)
+
+// validGlobRegex restricts glob filters to characters that are safe to
+// translate into an awk regex.
+var validGlobRegex = regexp.MustCompile(`^[A-Za-z0-9._*?-]+$`)
+
+// listFilesAwk strips the first 8 `ls -la` columns to get the name, then
+// applies the "after" cursor (A) and name regex (P) from the environment.
+const listFilesAwk = `!/^total / { name=$0; for (i=1; i<=8; i++) sub(/^[^ ]+ +/, "", name); ` +
+	`if (ENVIRON["A"] != "" && name <= ENVIRON["A"]) next; ` +
+	`if (ENVIRON["P"] != "" && name !~ ENVIRON["P"]) next; print }`
+
+// globToRegex converts a validated glob into an anchored ERE.
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, ch := range glob {
+		switch ch {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '.', '-':
+			sb.WriteString("[" + string(ch) + "]")
+		default:
+			sb.WriteRune(ch)
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// ListFiles returns a bounded directory listing. Entries are sorted by name;
+// pass the returned next_after as ?after= to fetch the next page, and
+// ?glob= to filter names.
 func (h *FileHandler) ListFiles(c *fiber.Ctx) error {
 	serverID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
@@ -73,7 +166,35 @@ func (h *FileHandler) ListFiles(c *fiber.Ctx) error {
 		})
 	}
 
-	cmd := fmt.Sprintf("ls -la %s", path)
+	limit, _ := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultListLimit)))
+	if limit < 1 || limit > maxListLimit {
+		limit = defaultListLimit
+	}
+
+	after := c.Query("after", "")
+	if after != "" && !sanitizePath(after) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid after cursor",
+		})
+	}
+
+	glob := c.Query("glob", "")
+	pattern := ""
+	if glob != "" {
+		if !validGlobRegex.MatchString(glob) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid glob (allowed: letters, digits, . _ - * ?)",
+			})
+		}
+		pattern = globToRegex(glob)
+	}
+
+	// Fetch one extra row to detect truncation
+	cmd := fmt.Sprintf("[ -e '%s' ] || { echo 'No such file or directory' >&2; exit 2; }; "+
+		"LC_ALL=C ls -la '%s' | A='%s' P='%s' awk '%s' | head -n %d",
+		path, path, after, pattern, listFilesAwk, limit+1)
 	output, err := h.execSSH(serverID, cmd)
 	if err != nil {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
@@ -83,9 +204,206 @@ func (h *FileHandler) ListFiles(c *fiber.Ctx) error {
 	}
 
 	files := parseFileList(output)
+	truncated := len(files) > limit
+	nextAfter := ""
+	if truncated {
+		files = files[:limit]
+		nextAfter, _ = files[limit-1]["name"].(string)
+	}
+
 	return c.JSON(fiber.Map{
-		"path":  path,
-		"files": files,
+		"path":       path,
+		"files":      files,
+		"truncated":  truncated,
+		"next_after": nextAfter,
+		"limit":      limit,
+	})
+}
+
+// DownloadFile streams a remote file over SFTP. A single HTTP Range is
+// honored so interrupted transfers can resume; other range forms are ignored
+// and the whole file is sent.
+func (h *FileHandler) DownloadFile(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	path := c.Query("path", "")
+	if path == "" || !sanitizePath(path) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Valid path is required",
+		})
+	}
+
+	sc, err := h.openSFTP(serverID)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	info, err := sc.Stat(path)
+	if err != nil {
+		sc.Close()
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "File not found: " + err.Error(),
+		})
+	}
+	if info.IsDir() {
+		sc.Close()
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Path is a directory",
+		})
+	}
+
+	size := info.Size()
+	start, length := int64(0), size
+	status := fiber.StatusOK
+
+	if c.Get(fiber.HeaderRange) != "" && size > 0 {
+		r, err := c.Range(int(size))
+		switch {
+		case err == fiber.ErrRangeUnsatisfiable:
+			sc.Close()
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return c.Status(fiber.StatusRequestedRangeNotSatisfiable).JSON(fiber.Map{
+				"error":   true,
+				"message": "Requested range not satisfiable",
+			})
+		case err == nil && r.Type == "bytes" && len(r.Ranges) == 1:
+			start = int64(r.Ranges[0].Start)
+			length = int64(r.Ranges[0].End) - start + 1
+			status = fiber.StatusPartialContent
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, r.Ranges[0].End, size))
+		}
+	}
+
+	file, err := sc.Open(path)
+	if err != nil {
+		sc.Close()
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to open file: " + err.Error(),
+		})
+	}
+	if start > 0 {
+		if _, err := file.Seek(start, io.SeekStart); err != nil {
+			file.Close()
+			sc.Close()
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to seek file: " + err.Error(),
+			})
+		}
+	}
+
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", pathpkg.Base(path)))
+	c.Status(status)
+
+	return c.SendStream(&sftpReader{
+		Reader: io.LimitReader(file, length),
+		file:   file,
+		client: sc,
+	}, int(length))
+}
+
+// UploadFile writes a multipart "file" field to a remote path over SFTP,
+// preserving its bytes. When path is a directory or ends in "/" the upload's
+// own filename is appended. Existing files are replaced.
+func (h *FileHandler) UploadFile(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Multipart field 'file' is required",
+		})
+	}
+	if fh.Size > h.maxUpload {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("File exceeds the %d MB upload limit", h.maxUpload>>20),
+		})
+	}
+
+	path := c.FormValue("path")
+	if path == "" || !sanitizePath(path) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Valid path is required",
+		})
+	}
+
+	sc, err := h.openSFTP(serverID)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+	defer sc.Close()
+
+	name := pathpkg.Base(fh.Filename)
+	if strings.HasSuffix(path, "/") {
+		path += name
+	} else if info, err := sc.Stat(path); err == nil && info.IsDir() {
+		path = pathpkg.Join(path, name)
+	}
+	if !sanitizePath(path) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid upload filename",
+		})
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to read upload: " + err.Error(),
+		})
+	}
+	defer src.Close()
+
+	dst, err := sc.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create file: " + err.Error(),
+		})
+	}
+	written, err := dst.ReadFrom(src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to write file: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "File uploaded successfully",
+		"path":    path,
+		"size":    written,
 	})
 }
 
@@ -176,7 +494,7 @@ func (h *FileHandler) WriteFile(c *fiber.Ctx) error {
 		})
 	}
 
-	client, err := h.serverHandler.GetSSHPool().GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := h.serverHandler.GetSSHPool().GetConnection(&server, password, privateKey)
 	if err != nil {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":   true,
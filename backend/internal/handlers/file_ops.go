@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"regexp"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+)
+
+// protectedPaths are never deleted, renamed or chmodded through the API.
+// Paths must be absolute and are checked once cleaned and again with
+// symlinks resolved on the server, so neither ".." nor a symlinked
+// directory reaches them.
+var protectedPaths = map[string]bool{
+	"/": true, "/bin": true, "/boot": true, "/dev": true, "/etc": true, "/home": true,
+	"/lib": true, "/lib64": true, "/opt": true, "/proc": true, "/root": true,
+	"/run": true, "/sbin": true, "/srv": true, "/sys": true, "/usr": true,
+	"/var": true,
+}
+
+// validFileMode accepts numeric octal modes such as 644, 0755 or 4755.
+var validFileMode = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+// checkMutablePath validates a path a file operation will change. Errors
+// are *fiber.Error values.
+func checkMutablePath(path string) error {
+	if !sanitizePath(path) || !pathpkg.IsAbs(path) {
+		return fiber.NewError(fiber.StatusBadRequest, "Valid absolute path is required")
+	}
+	return checkProtectedPath(pathpkg.Clean(path))
+}
+
+// checkProtectedPath refuses a cleaned absolute path in protectedPaths.
+func checkProtectedPath(path string) error {
+	if protectedPaths[path] {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("Refusing to modify protected path %s", path))
+	}
+	return nil
+}
+
+// resolveMutablePath resolves symlinks in path on the server and checks the
+// result against protectedPaths again. Unless follow is set the last
+// element is kept as is, for operations that change a symlink itself.
+func resolveMutablePath(sc *sftp.Client, path string, follow bool) error {
+	if follow {
+		real, err := sc.RealPath(path)
+		if err != nil {
+			return err
+		}
+		return checkProtectedPath(real)
+	}
+	dir, err := sc.RealPath(pathpkg.Dir(pathpkg.Clean(path)))
+	if err != nil {
+		return err
+	}
+	return checkProtectedPath(pathpkg.Join(dir, pathpkg.Base(path)))
+}
+
+// fileOpError turns a failed SFTP operation on path into a *fiber.Error,
+// telling a missing path and a permission problem on the server apart from
+// other failures. *fiber.Error values pass through.
+func fileOpError(path string, err error) error {
+	var fe *fiber.Error
+	switch {
+	case errors.As(err, &fe):
+		return fe
+	case errors.Is(err, fs.ErrNotExist):
+		return fiber.NewError(fiber.StatusNotFound, "No such file or directory: "+path)
+	case errors.Is(err, fs.ErrPermission):
+		return fiber.NewError(fiber.StatusForbidden, "Permission denied on the server: "+path)
+	}
+	return fiber.NewError(fiber.StatusBadGateway, "File operation failed: "+err.Error())
+}
+
+// fileOp opens an SFTP session to the route's server, runs op on path and
+// audits it as action with details. op returns the response body; errors
+// are answered through fileOpError.
+func (h *FileHandler) fileOp(c *fiber.Ctx, action, path string, details map[string]interface{}, op func(*sftp.Client) (fiber.Map, error)) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	sc, err := h.openSFTP(serverID)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+	defer sc.Close()
+
+	result, err := op(sc)
+	auditAction(c, h.serverHandler.GetDB(), action, serverID.String(), details, err)
+	if err != nil {
+		return fileOpError(path, err)
+	}
+	return c.JSON(result)
+}
+
+// DeleteFile removes a file, symlink or empty directory. A directory with
+// contents is only removed with ?recursive=true.
+func (h *FileHandler) DeleteFile(c *fiber.Ctx) error {
+	path := c.Query("path")
+	recursive := c.QueryBool("recursive", false)
+	if err := checkMutablePath(path); err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{"path": path, "recursive": recursive}
+	return h.fileOp(c, "file.delete", path, details, func(sc *sftp.Client) (fiber.Map, error) {
+		if err := resolveMutablePath(sc, path, false); err != nil {
+			return nil, err
+		}
+		// Lstat so a symlink is removed rather than followed
+		info, err := sc.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !info.IsDir():
+			err = sc.Remove(path)
+		case recursive:
+			err = sc.RemoveAll(path)
+		default:
+			var entries []os.FileInfo
+			if entries, err = sc.ReadDir(path); err == nil && len(entries) > 0 {
+				return nil, fiber.NewError(fiber.StatusConflict, "Directory is not empty; pass recursive=true to delete it and its contents")
+			}
+			if err == nil {
+				err = sc.RemoveDirectory(path)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return fiber.Map{
+			"message": "Deleted",
+			"path":    path,
+			"is_dir":  info.IsDir(),
+		}, nil
+	})
+}
+
+// RenameFile moves a file or directory. An existing destination is not
+// overwritten.
+func (h *FileHandler) RenameFile(c *fiber.Ctx) error {
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+	if err := checkMutablePath(req.From); err != nil {
+		return err
+	}
+	if err := checkMutablePath(req.To); err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{"from": req.From, "to": req.To}
+	return h.fileOp(c, "file.rename", req.From, details, func(sc *sftp.Client) (fiber.Map, error) {
+		for _, p := range []string{req.From, req.To} {
+			if err := resolveMutablePath(sc, p, false); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := sc.Lstat(req.To); err == nil {
+			return nil, fiber.NewError(fiber.StatusConflict, "Destination already exists: "+req.To)
+		}
+		if err := sc.Rename(req.From, req.To); err != nil {
+			return nil, err
+		}
+		return fiber.Map{
+			"message": "Renamed",
+			"from":    req.From,
+			"to":      req.To,
+		}, nil
+	})
+}
+
+// MakeDir creates a directory and any missing parents, like mkdir -p.
+func (h *FileHandler) MakeDir(c *fiber.Ctx) error {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := c.BodyParser(&req); err != nil || !sanitizePath(req.Path) || !pathpkg.IsAbs(req.Path) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Valid absolute path is required",
+		})
+	}
+
+	details := map[string]interface{}{"path": req.Path}
+	return h.fileOp(c, "file.mkdir", req.Path, details, func(sc *sftp.Client) (fiber.Map, error) {
+		if err := sc.MkdirAll(req.Path); err != nil {
+			return nil, err
+		}
+		c.Status(fiber.StatusCreated)
+		return fiber.Map{
+			"message": "Directory created",
+			"path":    req.Path,
+		}, nil
+	})
+}
+
+// ChmodFile sets a file's permission bits from a numeric octal mode.
+func (h *FileHandler) ChmodFile(c *fiber.Ctx) error {
+	var req struct {
+		Path string `json:"path"`
+		Mode string `json:"mode"` // octal, e.g. "0644"
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+	if err := checkMutablePath(req.Path); err != nil {
+		return err
+	}
+	if !validFileMode.MatchString(req.Mode) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "mode must be a numeric octal mode such as 0644",
+		})
+	}
+	mode, _ := strconv.ParseUint(req.Mode, 8, 32)
+
+	details := map[string]interface{}{"path": req.Path, "mode": req.Mode}
+	return h.fileOp(c, "file.chmod", req.Path, details, func(sc *sftp.Client) (fiber.Map, error) {
+		if err := resolveMutablePath(sc, req.Path, true); err != nil {
+			return nil, err
+		}
+		// sftp sends the setuid, setgid and sticky bits as given
+		if err := sc.Chmod(req.Path, os.FileMode(mode)); err != nil {
+			return nil, err
+		}
+		return fiber.Map{
+			"message": "Permissions changed",
+			"path":    req.Path,
+			"mode":    fmt.Sprintf("%04o", mode),
+		}, nil
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	pathpkg "path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// File search bounds for SearchFiles.
+const (
+	defaultSearchResults = 100
+	maxSearchResults     = 1000
+	fileSearchTimeout    = 30 // seconds find may run before it is stopped
+)
+
+// findPrintf prints size, mtime (epoch seconds) and path, tab separated.
+const findPrintf = `%s\t%T@\t%p\n`
+
+// SearchFiles finds regular files whose name matches ?name= (a glob) under
+// ?path=, without crossing into other filesystems. ?max= caps the results.
+// A search still running after fileSearchTimeout returns what it found.
+func (h *FileHandler) SearchFiles(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	// An explicit directory keeps searches from walking the whole filesystem
+	path := c.Query("path")
+	if !sanitizePath(path) || !pathpkg.IsAbs(path) || pathpkg.Clean(path) == "/" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "path is required and must be an absolute directory below /",
+		})
+	}
+
+	// find takes the pattern as -name's argument, but a leading dash is
+	// refused anyway so nothing resembling -exec or -delete reaches it
+	name := c.Query("name")
+	if !validGlobRegex.MatchString(name) || strings.HasPrefix(name, "-") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid name pattern (allowed: letters, digits, . _ - * ?, not starting with -)",
+		})
+	}
+
+	limit, _ := strconv.Atoi(c.Query("max", strconv.Itoa(defaultSearchResults)))
+	if limit < 1 || limit > maxSearchResults {
+		limit = defaultSearchResults
+	}
+
+	// Fetch one extra row to detect truncation
+	cmd := fmt.Sprintf("[ -d %[1]s ] || { echo 'No such directory' >&2; exit 2; }; "+
+		"timeout %[2]d find %[1]s -xdev -type f -name %[3]s -printf %[4]s 2>/dev/null | head -n %[5]d",
+		services.ShellQuote(path), fileSearchTimeout, services.ShellQuote(name), services.ShellQuote(findPrintf), limit+1)
+	output, err := h.execSSH(serverID, cmd)
+	if err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitStatus() == 2 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "No such directory: " + path,
+			})
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to search files: " + err.Error(),
+		})
+	}
+
+	files := parseFindOutput(output)
+	truncated := len(files) > limit
+	if truncated {
+		files = files[:limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"path":      path,
+		"name":      name,
+		"files":     files,
+		"count":     len(files),
+		"truncated": truncated,
+		"max":       limit,
+	})
+}
+
+// parseFindOutput parses `find -printf '%s\t%T@\t%p\n'` output. Malformed
+// lines are skipped.
+func parseFindOutput(output string) []fiber.Map {
+	files := []fiber.Map{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 || fields[2] == "" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		mtime, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, fiber.Map{
+			"path":     fields[2],
+			"name":     pathpkg.Base(fields[2]),
+			"size":     size,
+			"modified": time.Unix(0, int64(mtime*1e9)).UTC(),
+		})
+	}
+	return files
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+)
+
+// newMemoryFileHandler returns a FileHandler whose SFTP sessions all share
+// one in-memory filesystem, and the app serving its upload and download
+// routes.
+func newMemoryFileHandler(t *testing.T, maxUpload int64) *fiber.App {
+	t.Helper()
+	fs := sftp.InMemHandler()
+	h := &FileHandler{maxUpload: maxUpload}
+	h.openSFTP = func(uuid.UUID) (*sftp.Client, error) {
+		clientR, serverW := io.Pipe()
+		serverR, clientW := io.Pipe()
+		server := sftp.NewRequestServer(struct {
+			io.Reader
+			io.WriteCloser
+		}{serverR, serverW}, fs)
+		go func() {
+			server.Serve()
+			server.Close()
+		}()
+		return sftp.NewClientPipe(clientR, clientW)
+	}
+
+	app := fiber.New()
+	app.Post("/servers/:id/files/upload", h.UploadFile)
+	app.Get("/servers/:id/files/download", h.DownloadFile)
+	return app
+}
+
+func uploadRequest(t *testing.T, serverID, path, filename string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("path", path)
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	w.Close()
+
+	req := httptest.NewRequest("POST", "/servers/"+serverID+"/files/upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestFileUploadDownloadRoundTrip(t *testing.T) {
+	app := newMemoryFileHandler(t, 1<<20)
+	serverID := uuid.NewString()
+
+	// Every byte value, including NUL and invalid UTF-8
+	content := make([]byte, 4096)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	resp, err := app.Test(uploadRequest(t, serverID, "/", "blob.bin", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uploaded struct {
+		Path string `json:"path"`
+		Size int64  `json:"size"`
+	}
+	json.NewDecoder(resp.Body).Decode(&uploaded)
+	if resp.StatusCode != fiber.StatusCreated || uploaded.Path != "/blob.bin" || uploaded.Size != int64(len(content)) {
+		t.Fatalf("upload = %d %+v, want 201 with /blob.bin and %d bytes", resp.StatusCode, uploaded, len(content))
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/servers/"+serverID+"/files/download?path=/blob.bin", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusOK || !bytes.Equal(got, content) {
+		t.Fatalf("download = %d with %d bytes, want the uploaded bytes unchanged", resp.StatusCode, len(got))
+	}
+	if cl := resp.Header.Get(fiber.HeaderContentLength); cl != "4096" {
+		t.Errorf("Content-Length = %q, want 4096", cl)
+	}
+	if cd := resp.Header.Get(fiber.HeaderContentDisposition); cd != `attachment; filename="blob.bin"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	req := httptest.NewRequest("GET", "/servers/"+serverID+"/files/download?path=/blob.bin", nil)
+	req.Header.Set(fiber.HeaderRange, "bytes=1000-1999")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusPartialContent || !bytes.Equal(got, content[1000:2000]) {
+		t.Errorf("range download = %d with %d bytes, want 206 with bytes 1000-1999", resp.StatusCode, len(got))
+	}
+	if cr := resp.Header.Get(fiber.HeaderContentRange); cr != "bytes 1000-1999/4096" {
+		t.Errorf("Content-Range = %q", cr)
+	}
+}
+
+func TestFileUploadRejectsOversizeAndMissingFiles(t *testing.T) {
+	app := newMemoryFileHandler(t, 1024)
+	serverID := uuid.NewString()
+
+	resp, err := app.Test(uploadRequest(t, serverID, "/big.bin", "big.bin", make([]byte, 2048)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusRequestEntityTooLarge {
+		t.Errorf("oversize upload = %d, want 413", resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/servers/"+serverID+"/files/download?path=/big.bin", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("download of the rejected upload = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Event bounds for GetKernelLog.
+const (
+	defaultKernelEvents = 100
+	maxKernelEvents     = 1000
+)
+
+// kernelLogDeniedHint is returned when no kernel log source was readable.
+const kernelLogDeniedHint = "No kernel log source was readable. Allow dmesg (sysctl kernel.dmesg_restrict=0) " +
+	"or add the SSH user to the adm or systemd-journal group."
+
+// GetKernelLog parses recent OOM kills and hardware errors from the kernel
+// log. ?filter= is all (default), oom or hardware; ?limit= keeps the newest
+// events (default 100).
+func (h *ServerHandler) GetKernelLog(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	filter := c.Query("filter", "all")
+	var kind string
+	switch filter {
+	case "all":
+	case "oom":
+		kind = services.KernelEventOOM
+	case "hardware":
+		kind = services.KernelEventHardware
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "filter must be all, oom or hardware",
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultKernelEvents)
+	if limit <= 0 {
+		limit = defaultKernelEvents
+	}
+	limit = min(limit, maxKernelEvents)
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	password, privateKey, err := h.decryptCredentials(&server)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to decrypt credentials",
+		})
+	}
+
+	client, err := h.sshPool.GetConnection(&server, password, privateKey)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "SSH connection failed: " + err.Error(),
+		})
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create SSH session",
+		})
+	}
+	defer session.Close()
+
+	output, _ := session.CombinedOutput(services.KernelLogScript)
+	source, events := services.ParseKernelLog(string(output))
+	if source == "none" {
+		return c.JSON(fiber.Map{
+			"source":            source,
+			"permission_denied": true,
+			"hint":              kernelLogDeniedHint,
+			"events":            []services.KernelEvent{},
+			"count":             0,
+		})
+	}
+	services.RecordKernelEvents(server.ID, events)
+
+	filtered := make([]services.KernelEvent, 0, len(events))
+	for _, ev := range events {
+		if kind == "" || ev.Kind == kind {
+			filtered = append(filtered, ev)
+		}
+	}
+	filtered = filtered[max(len(filtered)-limit, 0):]
+
+	return c.JSON(fiber.Map{
+		"source":            source,
+		"permission_denied": false,
+		"filter":            filter,
+		"events":            filtered,
+		"count":             len(filtered),
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// Failed logins allowed within loginWindow before further attempts are
+// refused until the window has passed. An IP gets more room than a
+// username, since several people can share one address.
+const (
+	loginMaxUserFailures = 5
+	loginMaxIPFailures   = 20
+	loginWindow          = 15 * time.Minute
+)
+
+// loginLimiter tracks recent failed logins per username and per IP.
+type loginLimiter struct {
+	mu        sync.Mutex
+	failures  map[string][]time.Time // keyed by "user:<name>" or "ip:<addr>"
+	lastSweep time.Time
+}
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{failures: make(map[string][]time.Time)}
+}
+
+func loginUserKey(username string) string { return "user:" + username }
+func loginIPKey(ip string) string         { return "ip:" + ip }
+
+// lockedFor returns how long logins for username from ip stay blocked, or 0
+// when they are allowed.
+func (l *loginLimiter) lockedFor(username, ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	wait := l.lockedLocked(loginUserKey(username), loginMaxUserFailures, now)
+	if w := l.lockedLocked(loginIPKey(ip), loginMaxIPFailures, now); w > wait {
+		wait = w
+	}
+	return wait
+}
+
+// lockedLocked returns how long key is locked out at now. l.mu must be held.
+func (l *loginLimiter) lockedLocked(key string, max int, now time.Time) time.Duration {
+	recent := l.recentLocked(key, now)
+	if len(recent) < max {
+		return 0
+	}
+	// Locked until the oldest failure that still counts leaves the window
+	return recent[len(recent)-max].Add(loginWindow).Sub(now)
+}
+
+// recentLocked drops key's failures older than loginWindow and returns the
+// rest, oldest first. l.mu must be held.
+func (l *loginLimiter) recentLocked(key string, now time.Time) []time.Time {
+	cutoff := now.Add(-loginWindow)
+	times := l.failures[key]
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	if i == len(times) {
+		delete(l.failures, key)
+		return nil
+	}
+	l.failures[key] = times[i:]
+	return times[i:]
+}
+
+// fail records a failed login for username from ip.
+func (l *loginLimiter) fail(username, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range []string{loginUserKey(username), loginIPKey(ip)} {
+		l.failures[key] = append(l.recentLocked(key, now), now)
+	}
+
+	// Usernames that are never tried again would otherwise stay forever
+	if now.Sub(l.lastSweep) > loginWindow {
+		l.lastSweep = now
+		for key := range l.failures {
+			l.recentLocked(key, now)
+		}
+	}
+}
+
+// reset clears the failures of username and ip after a successful login.
+func (l *loginLimiter) reset(username, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, loginUserKey(username))
+	delete(l.failures, loginIPKey(ip))
+}
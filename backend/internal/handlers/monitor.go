@@ -1,25 +1,112 @@
 package handlers
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
 	"net"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Minimum time between manual checks of the same monitor.
+const manualCheckInterval = 5 * time.Second
+
+// Minimum time between CheckAllSSL runs, each of which dials every tracked
+// domain.
+const manualCheckAllInterval = 30 * time.Second
+
+// sslCheckTimeout is how long CheckAllSSL gives each domain, so one slow
+// host cannot hold up the batch.
+const sslCheckTimeout = 10 * time.Second
+
 type MonitorHandler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	checker    *services.MonitorChecker
+	sslChecker *services.SSLChecker
+
+	mu           sync.Mutex
+	lastManual   map[uuid.UUID]time.Time
+	lastCheckAll time.Time
+}
+
+func NewMonitorHandler(db *gorm.DB, checker *services.MonitorChecker, sslChecker *services.SSLChecker) *MonitorHandler {
+	return &MonitorHandler{
+		db:         db,
+		checker:    checker,
+		sslChecker: sslChecker,
+		lastManual: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// allowManualCheck reports whether a manual check of id may run now and, if
+// not, how long the caller should wait.
+func (h *MonitorHandler) allowManualCheck(id uuid.UUID) (bool, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if last, ok := h.lastManual[id]; ok {
+		if wait := manualCheckInterval - time.Since(last); wait > 0 {
+			return false, wait
+		}
+	}
+	h.lastManual[id] = time.Now()
+	return true, 0
 }
 
-func NewMonitorHandler(db *gorm.DB) *MonitorHandler {
-	return &MonitorHandler{db: db}
+// allowCheckAll is allowManualCheck for CheckAllSSL.
+func (h *MonitorHandler) allowCheckAll() (bool, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if wait := manualCheckAllInterval - time.Since(h.lastCheckAll); wait > 0 {
+		return false, wait
+	}
+	h.lastCheckAll = time.Now()
+	return true, 0
+}
+
+// CheckMonitor runs a monitor's check immediately and returns the ping.
+func (h *MonitorHandler) CheckMonitor(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid monitor ID",
+		})
+	}
+
+	var monitor models.Monitor
+	if err := h.db.First(&monitor, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Monitor not found",
+		})
+	}
+
+	if ok, wait := h.allowManualCheck(id); !ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   true,
+			"message": "Monitor was checked moments ago, try again shortly",
+		})
+	}
+
+	ping := h.checker.CheckNow(monitor)
+	h.db.First(&monitor, "id = ?", id)
+
+	return c.JSON(fiber.Map{
+		"ping":    ping,
+		"monitor": monitor,
+	})
 }
 
 // ListMonitors returns all monitors.
@@ -34,16 +121,31 @@ func (h *MonitorHandler) ListMonitors(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"monitors": monitors})
 }
 
+// ListIncidents returns currently-down monitors and recent incidents.
+func (h *MonitorHandler) ListIncidents(c *fiber.Ctx) error {
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+
+	summary, err := services.GetMonitorIncidents(h.db, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to list incidents",
+		})
+	}
+	return c.JSON(summary)
+}
+
 // CreateMonitor creates a new uptime monitor.
 func (h *MonitorHandler) CreateMonitor(c *fiber.Ctx) error {
 	var req struct {
-		Name            string `json:"name"`
-		URL             string `json:"url"`
-		Type            string `json:"type"`
-		Method          string `json:"method"`
-		IntervalSeconds int    `json:"interval_seconds"`
-		TimeoutMs       int    `json:"timeout_ms"`
-		ExpectedStatus  int    `json:"expected_status"`
+		Name             string `json:"name"`
+		URL              string `json:"url"`
+		Type             string `json:"type"`
+		Method           string `json:"method"`
+		IntervalSeconds  int    `json:"interval_seconds"`
+		TimeoutMs        int    `json:"timeout_ms"`
+		ExpectedStatus   int    `json:"expected_status"`
+		ExpectedStatuses []int  `json:"expected_statuses"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -60,22 +162,33 @@ func (h *MonitorHandler) CreateMonitor(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate URL has protocol
-	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") && !strings.HasPrefix(req.URL, "tcp://") {
+	// The scheme implies the type when none is given
+	if req.Type == "" {
+		req.Type = "http"
+		if scheme, _, ok := strings.Cut(req.URL, "://"); ok && services.ValidMonitorTypes[strings.ToLower(scheme)] {
+			req.Type = strings.ToLower(scheme)
+		}
+	}
+	if !services.ValidMonitorTypes[req.Type] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid type. Must be: http, tcp, ping, dns",
+		})
+	}
+	normalized, err := normalizeMonitorURL(req.Type, req.URL)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "URL must start with http://, https://, or tcp://",
+			"message": err.Error(),
 		})
 	}
 
 	monitor := models.Monitor{
 		Name: req.Name,
-		URL:  req.URL,
+		URL:  normalized,
+		Type: req.Type,
 	}
 
-	if req.Type != "" {
-		monitor.Type = req.Type
-	}
 	if req.Method != "" {
 		monitor.Method = req.Method
 	}
@@ -85,11 +198,23 @@ func (h *MonitorHandler) CreateMonitor(c *fiber.Ctx) error {
 	if req.TimeoutMs > 0 {
 		monitor.TimeoutMs = req.TimeoutMs
 	}
-	if req.ExpectedStatus > 0 {
-		monitor.ExpectedStatus = req.ExpectedStatus
+	statuses := req.ExpectedStatuses
+	if len(statuses) == 0 && req.ExpectedStatus > 0 {
+		statuses = []int{req.ExpectedStatus}
+	}
+	if len(statuses) == 0 {
+		statuses = []int{200}
 	}
+	if err := validateStatusCodes(statuses); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+	monitor.ExpectedStatus = statuses[0]
+	monitor.ExpectedStatuses = statuses
 
-	if err := h.db.Create(&monitor).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Create(&monitor).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to create monitor",
@@ -99,6 +224,192 @@ func (h *MonitorHandler) CreateMonitor(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(monitor)
 }
 
+// UpdateMonitor updates the provided fields of a monitor.
+func (h *MonitorHandler) UpdateMonitor(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid monitor ID",
+		})
+	}
+
+	var monitor models.Monitor
+	if err := h.db.First(&monitor, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Monitor not found",
+		})
+	}
+
+	var req struct {
+		Name             *string `json:"name"`
+		URL              *string `json:"url"`
+		Type             *string `json:"type"`
+		Method           *string `json:"method"`
+		IntervalSeconds  *int    `json:"interval_seconds"`
+		TimeoutMs        *int    `json:"timeout_ms"`
+		ExpectedStatus   *int    `json:"expected_status"`
+		ExpectedStatuses []int   `json:"expected_statuses"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+
+	if req.Name != nil && *req.Name != "" {
+		monitor.Name = *req.Name
+	}
+	if req.URL != nil || req.Type != nil {
+		monitorType, rawURL := monitor.Type, monitor.URL
+		if req.Type != nil && *req.Type != "" {
+			if !services.ValidMonitorTypes[*req.Type] {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   true,
+					"message": "Invalid type. Must be: http, tcp, ping, dns",
+				})
+			}
+			monitorType = *req.Type
+		}
+		if req.URL != nil {
+			rawURL = *req.URL
+		}
+		normalized, err := normalizeMonitorURL(monitorType, rawURL)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": err.Error(),
+			})
+		}
+		monitor.Type = monitorType
+		monitor.URL = normalized
+	}
+	if req.Method != nil && *req.Method != "" {
+		monitor.Method = *req.Method
+	}
+	if req.IntervalSeconds != nil && *req.IntervalSeconds > 0 {
+		monitor.IntervalSeconds = *req.IntervalSeconds
+	}
+	if req.TimeoutMs != nil && *req.TimeoutMs > 0 {
+		monitor.TimeoutMs = *req.TimeoutMs
+	}
+
+	statuses := req.ExpectedStatuses
+	if statuses == nil && req.ExpectedStatus != nil {
+		statuses = []int{*req.ExpectedStatus}
+	}
+	if statuses != nil {
+		if len(statuses) == 0 {
+			statuses = []int{200}
+		}
+		if err := validateStatusCodes(statuses); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": err.Error(),
+			})
+		}
+		monitor.ExpectedStatus = statuses[0]
+		monitor.ExpectedStatuses = statuses
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Save(&monitor).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update monitor",
+		})
+	}
+
+	return c.JSON(monitor)
+}
+
+// validateStatusCodes checks that every expected status is a valid HTTP code.
+func validateStatusCodes(codes []int) error {
+	for _, code := range codes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("expected status %d must be between 100 and 599", code)
+		}
+	}
+	return nil
+}
+
+// normalizeMonitorURL validates a monitor target for its type and returns
+// the stored form: a full http(s) URL, "tcp://host:port", or
+// "<type>://host" for ping and dns monitors.
+func normalizeMonitorURL(monitorType, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("URL is required")
+	}
+
+	switch monitorType {
+	case "http":
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid URL: %v", err)
+		}
+		u.Scheme = strings.ToLower(u.Scheme)
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", fmt.Errorf("http monitors need an http:// or https:// URL")
+		}
+		if u.Hostname() == "" {
+			return "", fmt.Errorf("URL %q has no host", raw)
+		}
+		if p := u.Port(); p != "" {
+			if err := validatePort(p); err != nil {
+				return "", err
+			}
+		}
+		u.Host = strings.ToLower(u.Host)
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		return u.String(), nil
+
+	case "tcp":
+		hostPort := strings.TrimPrefix(raw, "tcp://")
+		host, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			return "", fmt.Errorf("tcp monitors need host:port (e.g. tcp://db.internal:5432)")
+		}
+		if host == "" {
+			return "", fmt.Errorf("tcp monitor %q has no host", raw)
+		}
+		if err := validatePort(port); err != nil {
+			return "", err
+		}
+		return "tcp://" + net.JoinHostPort(strings.ToLower(host), port), nil
+
+	case "ping", "dns":
+		host := strings.TrimPrefix(raw, monitorType+"://")
+		if host == "" || (strings.ContainsAny(host, "/:?# ") && net.ParseIP(host) == nil) {
+			return "", fmt.Errorf("%s monitors need a bare hostname or IP address", monitorType)
+		}
+		host = strings.ToLower(host)
+		if net.ParseIP(host) == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+				return "", fmt.Errorf("host %q does not resolve", host)
+			}
+		}
+		return monitorType + "://" + host, nil
+
+	default:
+		return "", fmt.Errorf("type must be http, tcp, ping or dns")
+	}
+}
+
+// validatePort checks that p is a port number between 1 and 65535.
+func validatePort(p string) error {
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("port %q must be between 1 and 65535", p)
+	}
+	return nil
+}
+
 // GetMonitor returns a single monitor with recent pings.
 func (h *MonitorHandler) GetMonitor(c *fiber.Ctx) error {
 	id, err := uuid.Parse(c.Params("id"))
@@ -137,7 +448,7 @@ func (h *MonitorHandler) DeleteMonitor(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.db.Delete(&models.Monitor{}, "id = ?", id).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Delete(&models.Monitor{}, "id = ?", id).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to delete monitor",
@@ -166,7 +477,7 @@ func (h *MonitorHandler) ToggleMonitor(c *fiber.Ctx) error {
 	}
 
 	monitor.Enabled = !monitor.Enabled
-	h.db.Save(&monitor)
+	h.db.WithContext(c.UserContext()).Save(&monitor)
 
 	return c.JSON(fiber.Map{
 		"message": fmt.Sprintf("Monitor %s", map[bool]string{true: "enabled", false: "disabled"}[monitor.Enabled]),
@@ -211,7 +522,8 @@ func (h *MonitorHandler) GetMonitorPings(c *fiber.Ctx) error {
 	})
 }
 
-// CheckSSL connects to a domain and returns SSL certificate info.
+// CheckSSL connects to a domain and returns SSL certificate info. The
+// certificate is tracked from then on and alerted on as it nears expiry.
 func (h *MonitorHandler) CheckSSL(c *fiber.Ctx) error {
 	var req struct {
 		Domain string `json:"domain"`
@@ -223,78 +535,120 @@ func (h *MonitorHandler) CheckSSL(c *fiber.Ctx) error {
 		})
 	}
 
-	// Strip protocol if provided
-	domain := req.Domain
-	domain = strings.TrimPrefix(domain, "https://")
-	domain = strings.TrimPrefix(domain, "http://")
-	domain = strings.TrimSuffix(domain, "/")
-	// Remove port if present
-	if idx := strings.Index(domain, ":"); idx != -1 {
-		domain = domain[:idx]
+	return h.checkSSL(c, req.Domain)
+}
+
+// RecheckSSL re-runs the check for one tracked certificate on demand.
+func (h *MonitorHandler) RecheckSSL(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid certificate ID",
+		})
+	}
+
+	var cert models.SSLCert
+	if err := h.db.First(&cert, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "SSL certificate not found",
+		})
 	}
 
-	conn, err := tls.DialWithDialer(
-		&net.Dialer{Timeout: 10 * time.Second},
-		"tcp",
-		domain+":443",
-		&tls.Config{
-			InsecureSkipVerify: false,
-		},
-	)
+	return h.checkSSL(c, cert.Domain)
+}
+
+// DeleteSSLCert stops tracking a certificate and resolves its open expiry
+// alert, if any.
+func (h *MonitorHandler) DeleteSSLCert(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "TLS connection failed: " + err.Error(),
+			"message": "Invalid certificate ID",
 		})
 	}
-	defer conn.Close()
 
-	certs := conn.ConnectionState().PeerCertificates
-	if len(certs) == 0 {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+	var cert models.SSLCert
+	if err := h.db.First(&cert, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error":   true,
-			"message": "No certificates found",
+			"message": "SSL certificate not found",
 		})
 	}
 
-	cert := certs[0]
-	now := time.Now()
-	daysRemaining := int(cert.NotAfter.Sub(now).Hours() / 24)
-
-	// Save or update in DB
-	sslCert := models.SSLCert{}
-	result := h.db.Where("domain = ?", domain).First(&sslCert)
-	if result.Error != nil {
-		// Create new
-		sslCert = models.SSLCert{
-			Domain:        domain,
-			Issuer:        cert.Issuer.CommonName,
-			ValidFrom:     cert.NotBefore,
-			ValidTo:       cert.NotAfter,
-			DaysRemaining: daysRemaining,
-			LastCheckedAt: &now,
+	if cert.AlertID != nil {
+		h.db.Model(&models.Alert{}).
+			Where("id = ? AND status IN ?", *cert.AlertID, []string{"firing", "acknowledged"}).
+			Updates(map[string]interface{}{"status": "resolved", "resolved_at": time.Now()})
+	}
+	if err := h.db.WithContext(c.UserContext()).Delete(&cert).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to delete SSL certificate",
+		})
+	}
+
+	return c.JSON(fiber.Map{"message": "SSL certificate deleted"})
+}
+
+// CheckAllSSL re-checks every tracked certificate concurrently and returns
+// them sorted by soonest expiry. A domain that cannot be reached within the
+// per-domain timeout is reported with its error and last known expiry. Runs
+// closer together than manualCheckAllInterval get 429.
+func (h *MonitorHandler) CheckAllSSL(c *fiber.Ctx) error {
+	if ok, wait := h.allowCheckAll(); !ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   true,
+			"message": "Certificates were checked moments ago, try again shortly",
+		})
+	}
+
+	results, err := h.sslChecker.CheckAll(c.UserContext(), sslCheckTimeout)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to load SSL certificates",
+		})
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
 		}
-		h.db.Create(&sslCert)
-	} else {
-		// Update existing
-		h.db.Model(&sslCert).Updates(map[string]interface{}{
-			"issuer":          cert.Issuer.CommonName,
-			"valid_from":      cert.NotBefore,
-			"valid_to":        cert.NotAfter,
-			"days_remaining":  daysRemaining,
-			"last_checked_at": now,
+	}
+	return c.JSON(fiber.Map{
+		"results": results,
+		"total":   len(results),
+		"failed":  failed,
+	})
+}
+
+func (h *MonitorHandler) checkSSL(c *fiber.Ctx, domain string) error {
+	record, cert, err := h.sslChecker.Check(domain)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "TLS connection failed: " + err.Error(),
 		})
 	}
 
+	now := time.Now()
 	return c.JSON(fiber.Map{
-		"domain":         domain,
+		"id":             record.ID,
+		"domain":         record.Domain,
 		"issuer":         cert.Issuer.CommonName,
 		"subject":        cert.Subject.CommonName,
 		"valid_from":     cert.NotBefore,
 		"valid_to":       cert.NotAfter,
-		"days_remaining": daysRemaining,
+		"days_remaining": record.DaysRemaining,
 		"dns_names":      cert.DNSNames,
-		"is_valid":       now.After(cert.NotBefore) && now.Before(cert.NotAfter),
+		"is_valid":       record.VerifyError == "" && now.After(cert.NotBefore) && now.Before(cert.NotAfter),
+		"verify_error":   record.VerifyError,
+		"alert_id":       record.AlertID,
 	})
 }
 
@@ -315,7 +669,7 @@ func (h *MonitorHandler) AutoSeedMonitors(c *fiber.Ctx) error {
 
 	created := 0
 	for _, s := range seeds {
-		if err := h.db.Create(&s).Error; err == nil {
+		if err := h.db.WithContext(c.UserContext()).Create(&s).Error; err == nil {
 			created++
 		}
 	}
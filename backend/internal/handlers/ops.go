@@ -11,9 +11,14 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// opsOverviewTTL is how long the ops overview is cached.
+const opsOverviewTTL = 30 * time.Second
+
 type OpsHandler struct {
 	cfg    *config.Config
 	client *http.Client
+
+	overviewCache *ttlCache[map[string]interface{}]
 }
 
 func NewOpsHandler(cfg *config.Config) *OpsHandler {
@@ -22,6 +27,7 @@ func NewOpsHandler(cfg *config.Config) *OpsHandler {
 		client: &http.Client{
 			Timeout: 15 * time.Second,
 		},
+		overviewCache: &ttlCache[map[string]interface{}]{ttl: opsOverviewTTL},
 	}
 }
 
@@ -44,7 +50,21 @@ func (h *OpsHandler) opsGet(path string) ([]byte, int, error) {
 	return body, resp.StatusCode, err
 }
 
+// Overview returns SRE, ticket and review stats from the ops backend,
+// cached for opsOverviewTTL; ?refresh=true fetches them again. An overview
+// with a failed part is returned but not cached.
 func (h *OpsHandler) Overview(c *fiber.Ctx) error {
+	if c.QueryBool("refresh", false) {
+		h.overviewCache.Invalidate()
+	}
+	overview, hit, _ := h.overviewCache.Get(h.fetchOverview)
+	setCacheHeader(c, hit)
+	return c.JSON(overview)
+}
+
+// fetchOverview fetches the overview parts in parallel. It returns an error
+// when any part did not come back with 200.
+func (h *OpsHandler) fetchOverview() (map[string]interface{}, error) {
 	// Fetch SRE stats, ticket stats, review stats in parallel
 	type result struct {
 		key    string
@@ -76,12 +96,15 @@ func (h *OpsHandler) Overview(c *fiber.Ctx) error {
 	}()
 
 	overview := make(map[string]interface{})
+	var err error
 	for i := 0; i < 3; i++ {
 		r := <-ch
 		overview[r.key] = r.data
+		if r.status != fiber.StatusOK {
+			err = fmt.Errorf("ops %s returned HTTP %d", r.key, r.status)
+		}
 	}
-
-	return c.JSON(overview)
+	return overview, err
 }
 
 func (h *OpsHandler) SREEvents(c *fiber.Ctx) error {
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// gatherPressureScript prints host PSI, load and per-container stats in a
+// single session, one prefixed line each. Kernels without PSI (or booted
+// with psi=0) simply print no "psi" lines.
+const gatherPressureScript = `for r in cpu memory io; do
+  cat /proc/pressure/$r 2>/dev/null | sed "s/^/psi $r /"
+done
+echo "loadavg $(cut -d' ' -f1-3 /proc/loadavg 2>/dev/null)"
+echo "cores $(nproc 2>/dev/null)"
+docker stats --no-stream --format 'container {{json .}}' 2>/dev/null
+echo "docker_rc $?"`
+
+// Container list bounds for GetPressure.
+const (
+	defaultPressureTop = 5
+	maxPressureTop     = 50
+)
+
+// psiLine is one "some" or "full" line of /proc/pressure/<resource>.
+type psiLine struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  int64   `json:"total"` // microseconds stalled
+}
+
+// containerPressure is one container's entry from docker stats.
+type containerPressure struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	CPUPercent float64 `json:"cpu_percent"`
+	MemPercent float64 `json:"mem_percent"`
+	MemUsage   string  `json:"mem_usage"`
+	BlockIO    string  `json:"block_io"`
+	NetIO      string  `json:"net_io"`
+	PIDs       int     `json:"pids"`
+}
+
+// serverPressure is the parsed output of gatherPressureScript.
+type serverPressure struct {
+	PSIAvailable    bool                          `json:"psi_available"`
+	PSI             map[string]map[string]psiLine `json:"psi"` // resource -> some/full
+	LoadAvg         []float64                     `json:"load_avg"`
+	CPUCores        int                           `json:"cpu_cores"`
+	DockerAvailable bool                          `json:"docker_available"`
+	Containers      []containerPressure           `json:"-"`
+}
+
+// GetPressure returns host PSI stall figures alongside the busiest
+// containers, so one call shows whether the host or a container is the
+// bottleneck. ?top= bounds the container lists (default 5).
+func (h *ServerHandler) GetPressure(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	top := c.QueryInt("top", defaultPressureTop)
+	if top <= 0 {
+		top = defaultPressureTop
+	}
+	top = min(top, maxPressureTop)
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	password, privateKey, err := h.decryptCredentials(&server)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to decrypt credentials",
+		})
+	}
+
+	client, err := h.sshPool.GetConnection(&server, password, privateKey)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "SSH connection failed: " + err.Error(),
+		})
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create SSH session",
+		})
+	}
+	defer session.Close()
+
+	// Missing PSI or docker only drops their lines; the rest is still usable
+	output, _ := session.CombinedOutput(gatherPressureScript)
+	p := parsePressure(string(output))
+
+	byCPU := append([]containerPressure(nil), p.Containers...)
+	sort.SliceStable(byCPU, func(i, j int) bool { return byCPU[i].CPUPercent > byCPU[j].CPUPercent })
+	byMem := append([]containerPressure(nil), p.Containers...)
+	sort.SliceStable(byMem, func(i, j int) bool { return byMem[i].MemPercent > byMem[j].MemPercent })
+
+	return c.JSON(fiber.Map{
+		"host":            p,
+		"container_count": len(p.Containers),
+		"top_cpu":         byCPU[:min(top, len(byCPU))],
+		"top_memory":      byMem[:min(top, len(byMem))],
+	})
+}
+
+// parsePressure parses the prefixed lines printed by gatherPressureScript.
+func parsePressure(output string) serverPressure {
+	p := serverPressure{
+		PSI:        map[string]map[string]psiLine{},
+		LoadAvg:    []float64{},
+		Containers: []containerPressure{},
+	}
+	for _, line := range strings.Split(output, "\n") {
+		kind, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch kind {
+		case "psi":
+			// psi <resource> <some|full> avg10=.. avg60=.. avg300=.. total=..
+			fields := strings.Fields(rest)
+			if len(fields) < 2 {
+				continue
+			}
+			if p.PSI[fields[0]] == nil {
+				p.PSI[fields[0]] = map[string]psiLine{}
+			}
+			p.PSI[fields[0]][fields[1]] = parsePSIFields(fields[2:])
+			p.PSIAvailable = true
+		case "loadavg":
+			for _, f := range strings.Fields(rest) {
+				if v, err := strconv.ParseFloat(f, 64); err == nil {
+					p.LoadAvg = append(p.LoadAvg, v)
+				}
+			}
+		case "cores":
+			p.CPUCores, _ = strconv.Atoi(strings.TrimSpace(rest))
+		case "container":
+			var s struct {
+				ID, Name, CPUPerc, MemPerc, MemUsage, BlockIO, NetIO, PIDs string
+			}
+			if json.Unmarshal([]byte(rest), &s) != nil {
+				continue
+			}
+			pids, _ := strconv.Atoi(s.PIDs)
+			p.Containers = append(p.Containers, containerPressure{
+				ID:         s.ID,
+				Name:       s.Name,
+				CPUPercent: parsePercent(s.CPUPerc),
+				MemPercent: parsePercent(s.MemPerc),
+				MemUsage:   s.MemUsage,
+				BlockIO:    s.BlockIO,
+				NetIO:      s.NetIO,
+				PIDs:       pids,
+			})
+		case "docker_rc":
+			p.DockerAvailable = strings.TrimSpace(rest) == "0"
+		}
+	}
+	return p
+}
+
+func parsePSIFields(fields []string) psiLine {
+	var l psiLine
+	for _, f := range fields {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "avg10":
+			l.Avg10, _ = strconv.ParseFloat(v, 64)
+		case "avg60":
+			l.Avg60, _ = strconv.ParseFloat(v, 64)
+		case "avg300":
+			l.Avg300, _ = strconv.ParseFloat(v, 64)
+		case "total":
+			l.Total, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+	return l
+}
+
+// parsePercent parses docker's "12.34%" form; "--" and blanks are 0.
+func parsePercent(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	return v
+}
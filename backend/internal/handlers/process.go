@@ -2,35 +2,135 @@ package handlers
 
 import (
 	"fmt"
+	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
 )
 
+// Init systems understood by the service endpoints.
+const (
+	initSystemd = "systemd"
+	initOpenRC  = "openrc"
+	initRunit   = "runit"
+)
+
+// detectInitCommand prints the init system a host uses.
+const detectInitCommand = `if command -v systemctl >/dev/null 2>&1 && [ -d /run/systemd/system ]; then echo systemd; ` +
+	`elif command -v rc-service >/dev/null 2>&1; then echo openrc; ` +
+	`elif command -v sv >/dev/null 2>&1; then echo runit; ` +
+	`else echo systemd; fi`
+
+// initSystemTTL is how long a detected init system is trusted before it is
+// probed again, so a host reinstalled with another init system or a server
+// re-pointed at a different host is picked up.
+const initSystemTTL = 10 * time.Minute
+
+// detectedInit is a cached init system probe result.
+type detectedInit struct {
+	name string
+	at   time.Time
+}
+
 type ProcessHandler struct {
 	serverHandler *ServerHandler
+	execTimeout   time.Duration // stops commands that have not finished
+
+	mu          sync.Mutex
+	initSystems map[uuid.UUID]detectedInit
 }
 
-func NewProcessHandler(serverHandler *ServerHandler) *ProcessHandler {
-	return &ProcessHandler{serverHandler: serverHandler}
+func NewProcessHandler(serverHandler *ServerHandler, execTimeout time.Duration) *ProcessHandler {
+	return &ProcessHandler{
+		serverHandler: serverHandler,
+		execTimeout:   execTimeout,
+		initSystems:   make(map[uuid.UUID]detectedInit),
+	}
 }
 
-func (h *ProcessHandler) execSSH(serverID uuid.UUID, command string) (string, error) {
+// initSystem returns the cached init system for a server, probing it on
+// first use and again once the cached result is older than initSystemTTL.
+// Falls back to systemd when detection fails.
+func (h *ProcessHandler) initSystem(serverID uuid.UUID) string {
+	if cached, ok := h.cachedInitSystem(serverID); ok {
+		return cached
+	}
+
+	output, err := h.execSSH(serverID, detectInitCommand)
+	if err != nil {
+		return initSystemd
+	}
+
+	detected := parseInitSystem(output)
+	h.mu.Lock()
+	h.initSystems[serverID] = detectedInit{name: detected, at: time.Now()}
+	h.mu.Unlock()
+	return detected
+}
+
+// cachedInitSystem returns the server's init system if it was detected
+// within initSystemTTL, dropping an expired entry.
+func (h *ProcessHandler) cachedInitSystem(serverID uuid.UUID) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cached, ok := h.initSystems[serverID]
+	if !ok {
+		return "", false
+	}
+	if time.Since(cached.at) >= initSystemTTL {
+		delete(h.initSystems, serverID)
+		return "", false
+	}
+	return cached.name, true
+}
+
+// forgetInitSystem drops a server's cached init system so the next service
+// request probes it again.
+func (h *ProcessHandler) forgetInitSystem(serverID uuid.UUID) {
+	h.mu.Lock()
+	delete(h.initSystems, serverID)
+	h.mu.Unlock()
+}
+
+// parseInitSystem maps detectInitCommand output to an init system,
+// defaulting to systemd.
+func parseInitSystem(output string) string {
+	switch detected := strings.TrimSpace(output); detected {
+	case initSystemd, initOpenRC, initRunit:
+		return detected
+	}
+	return initSystemd
+}
+
+// sshClient returns a pooled SSH connection to the server.
+func (h *ProcessHandler) sshClient(serverID uuid.UUID) (*ssh.Client, error) {
 	var server models.Server
 	if err := h.serverHandler.GetDB().First(&server, "id = ?", serverID).Error; err != nil {
-		return "", fmt.Errorf("server not found")
+		return nil, fmt.Errorf("server not found")
 	}
 
 	password, privateKey, err := h.serverHandler.GetDecryptedCredentials(&server)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt credentials: %w", err)
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
 	}
 
-	client, err := h.serverHandler.GetSSHPool().GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := h.serverHandler.GetSSHPool().GetConnection(&server, password, privateKey)
 	if err != nil {
-		return "", fmt.Errorf("SSH connection failed: %w", err)
+		return nil, fmt.Errorf("SSH connection failed: %w", err)
+	}
+	return client, nil
+}
+
+func (h *ProcessHandler) execSSH(serverID uuid.UUID, command string) (string, error) {
+	client, err := h.sshClient(serverID)
+	if err != nil {
+		return "", err
 	}
 
 	session, err := client.NewSession()
@@ -39,11 +139,12 @@ func (h *ProcessHandler) execSSH(serverID uuid.UUID, command string) (string, er
 	}
 	defer session.Close()
 
-	output, err := session.CombinedOutput(command)
+	output, err := services.CombinedOutputTimeout(session, command, h.execTimeout)
 	return string(output), err
 }
 
-// ListProcesses returns the top 50 processes sorted by CPU usage.
+// ListProcesses returns the top 50 processes sorted by CPU usage, or with
+// ?format=tree every process nested under its parent.
 func (h *ProcessHandler) ListProcesses(c *fiber.Ctx) error {
 	serverID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
@@ -53,9 +154,20 @@ func (h *ProcessHandler) ListProcesses(c *fiber.Ctx) error {
 		})
 	}
 
+	switch c.Query("format", "flat") {
+	case "flat":
+	case "tree":
+		return h.listProcessTree(c, serverID)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "format must be flat or tree",
+		})
+	}
+
 	output, err := h.execSSH(serverID, "ps aux --sort=-%cpu | head -50")
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to list processes: " + err.Error(),
 		})
@@ -65,6 +177,23 @@ func (h *ProcessHandler) ListProcesses(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"processes": processes})
 }
 
+func (h *ProcessHandler) listProcessTree(c *fiber.Ctx, serverID uuid.UUID) error {
+	output, err := h.execSSH(serverID, processTreeCommand)
+	if err != nil {
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to list processes: " + err.Error(),
+		})
+	}
+
+	tree, count := buildProcessTree(output)
+	return c.JSON(fiber.Map{
+		"format":    "tree",
+		"processes": tree,
+		"count":     count,
+	})
+}
+
 // KillProcess sends a signal to a process on the server.
 func (h *ProcessHandler) KillProcess(c *fiber.Ctx) error {
 	serverID, err := uuid.Parse(c.Params("id"))
@@ -86,22 +215,16 @@ func (h *ProcessHandler) KillProcess(c *fiber.Ctx) error {
 	var req struct {
 		Signal string `json:"signal"`
 	}
-	if err := c.BodyParser(&req); err != nil {
-		req.Signal = "15" // default SIGTERM
-	}
-	if req.Signal == "" {
-		req.Signal = "15"
+	c.BodyParser(&req) // no body means SIGTERM
+	signal, ok := parseSignal(req.Signal)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": signalError,
+		})
 	}
 
-	// Validate signal and pid are numeric to prevent injection
-	for _, ch := range req.Signal {
-		if ch < '0' || ch > '9' {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   true,
-				"message": "Signal must be numeric",
-			})
-		}
-	}
+	// Validate pid is numeric to prevent injection
 	for _, ch := range pid {
 		if ch < '0' || ch > '9' {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -111,10 +234,14 @@ func (h *ProcessHandler) KillProcess(c *fiber.Ctx) error {
 		}
 	}
 
-	cmd := fmt.Sprintf("kill -%s %s", req.Signal, pid)
+	cmd := fmt.Sprintf("kill -%d %s", signal, pid)
 	output, err := h.execSSH(serverID, cmd)
+	auditAction(c, h.serverHandler.GetDB(), "process.kill", serverID.String(), map[string]interface{}{
+		"pid":    pid,
+		"signal": signal,
+	}, err)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to kill process: " + err.Error(),
 			"output":  output,
@@ -122,12 +249,12 @@ func (h *ProcessHandler) KillProcess(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"message": fmt.Sprintf("Signal %s sent to PID %s", req.Signal, pid),
+		"message": fmt.Sprintf("Signal %d sent to PID %s", signal, pid),
 		"output":  output,
 	})
 }
 
-// ListServices returns systemd service units.
+// ListServices returns service units via systemd, OpenRC or runit.
 func (h *ProcessHandler) ListServices(c *fiber.Ctx) error {
 	serverID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
@@ -137,22 +264,45 @@ func (h *ProcessHandler) ListServices(c *fiber.Ctx) error {
 		})
 	}
 
-	output, err := h.execSSH(serverID, "systemctl list-units --type=service --state=running,failed,inactive --no-pager --plain | head -100")
+	initSys := h.initSystem(serverID)
+
+	var listCmd string
+	switch initSys {
+	case initOpenRC:
+		listCmd = "rc-status --all --nocolor 2>/dev/null || rc-status --all"
+	case initRunit:
+		listCmd = `for s in /var/service/* /etc/service/*; do [ -d "$s" ] && sv status "$s"; done 2>/dev/null | head -100`
+	default:
+		listCmd = "systemctl list-units --type=service --state=running,failed,inactive --no-pager --plain | head -100"
+	}
+
+	output, err := h.execSSH(serverID, listCmd)
 	if err != nil {
 		// Some systems may still return partial output even on error
 		if output == "" {
-			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			// The host may have changed init system; probe again next time
+			h.forgetInitSystem(serverID)
+			return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 				"error":   true,
 				"message": "Failed to list services: " + err.Error(),
 			})
 		}
 	}
 
-	services := parseServices(output)
-	return c.JSON(fiber.Map{"services": services})
+	var services []fiber.Map
+	switch initSys {
+	case initOpenRC:
+		services = parseOpenRCServices(output)
+	case initRunit:
+		services = parseRunitServices(output)
+	default:
+		services = parseServices(output)
+	}
+	return c.JSON(fiber.Map{"services": services, "init_system": initSys})
 }
 
-// ServiceAction performs a systemctl action on a service.
+// ServiceAction starts, stops, restarts, enables or disables a service
+// using the server's init system.
 func (h *ProcessHandler) ServiceAction(c *fiber.Ctx) error {
 	serverID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
@@ -192,20 +342,22 @@ func (h *ProcessHandler) ServiceAction(c *fiber.Ctx) error {
 		})
 	}
 
-	// Sanitize service name (only allow alphanumeric, dash, underscore, dot, @)
-	for _, ch := range name {
-		if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' || ch == '.' || ch == '@') {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   true,
-				"message": "Invalid service name characters",
-			})
-		}
+	if !sanitizeServiceName(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid service name characters",
+		})
 	}
 
-	cmd := fmt.Sprintf("systemctl %s %s", req.Action, name)
+	initSys := h.initSystem(serverID)
+	cmd := serviceActionCommand(initSys, req.Action, name)
 	output, err := h.execSSH(serverID, cmd)
+	auditAction(c, h.serverHandler.GetDB(), "service."+req.Action, serverID.String(), map[string]interface{}{
+		"service":     name,
+		"init_system": initSys,
+	}, err)
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 			"error":   true,
 			"message": "Service action failed: " + err.Error(),
 			"output":  output,
@@ -213,8 +365,9 @@ func (h *ProcessHandler) ServiceAction(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"message": fmt.Sprintf("Service %s: %s", name, req.Action),
-		"output":  output,
+		"message":     fmt.Sprintf("Service %s: %s", name, req.Action),
+		"output":      output,
+		"init_system": initSys,
 	})
 }
 
@@ -231,7 +384,7 @@ func (h *ProcessHandler) ListNetworkConnections(c *fiber.Ctx) error {
 	output, err := h.execSSH(serverID, "ss -tunapl --no-header | head -100")
 	if err != nil {
 		if output == "" {
-			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			return c.Status(execErrorStatus(err)).JSON(fiber.Map{
 				"error":   true,
 				"message": "Failed to list connections: " + err.Error(),
 			})
@@ -314,6 +467,129 @@ func parseServices(output string) []fiber.Map {
 	return services
 }
 
+// sanitizeServiceName validates a service or unit name: alphanumerics, dash,
+// underscore, dot and @, not starting with a dash so it cannot pass as an
+// option.
+func sanitizeServiceName(name string) bool {
+	if name == "" || name[0] == '-' {
+		return false
+	}
+	for _, ch := range name {
+		if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' || ch == '.' || ch == '@') {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceActionCommand builds the shell command for a service action.
+// name must already be validated.
+func serviceActionCommand(initSys, action, name string) string {
+	switch initSys {
+	case initOpenRC:
+		switch action {
+		case "enable":
+			return fmt.Sprintf("rc-update add %s default", name)
+		case "disable":
+			return fmt.Sprintf("rc-update del %s default", name)
+		}
+		return fmt.Sprintf("rc-service %s %s", name, action)
+	case initRunit:
+		switch action {
+		case "start":
+			return fmt.Sprintf("sv up %s", name)
+		case "stop":
+			return fmt.Sprintf("sv down %s", name)
+		case "enable":
+			return fmt.Sprintf("if [ -d /var/service ]; then ln -sfn /etc/sv/%[1]s /var/service/%[1]s; else ln -sfn /etc/sv/%[1]s /etc/service/%[1]s; fi", name)
+		case "disable":
+			return fmt.Sprintf("rm -f /var/service/%[1]s /etc/service/%[1]s", name)
+		}
+		return fmt.Sprintf("sv %s %s", action, name)
+	}
+	return fmt.Sprintf("systemctl %s %s", action, name)
+}
+
+// parseOpenRCServices parses `rc-status --all` output into the systemd shape.
+// Lines look like: " sshd    [  started  ]"; runlevel headers are skipped.
+func parseOpenRCServices(output string) []fiber.Map {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	var services []fiber.Map
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		lb := strings.Index(line, "[")
+		rb := strings.LastIndex(line, "]")
+		if line == "" || lb <= 0 || rb < lb {
+			continue
+		}
+
+		name := strings.TrimSpace(line[:lb])
+		status := strings.TrimSpace(line[lb+1 : rb])
+
+		active := "inactive"
+		switch status {
+		case "started":
+			active = "active"
+		case "crashed":
+			active = "failed"
+		case "starting", "stopping":
+			active = "activating"
+		}
+
+		services = append(services, fiber.Map{
+			"name":        name,
+			"load":        "loaded",
+			"active":      active,
+			"sub":         status,
+			"description": "",
+		})
+	}
+
+	return services
+}
+
+// parseRunitServices parses `sv status` output into the systemd shape.
+// Lines look like: "run: /var/service/sshd: (pid 123) 456s; run: log: ..."
+func parseRunitServices(output string) []fiber.Map {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	var services []fiber.Map
+
+	for _, line := range lines {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 3)
+		if len(parts) < 3 {
+			continue
+		}
+
+		state := strings.TrimSpace(parts[0])
+		name := path.Base(strings.TrimSpace(parts[1]))
+		// Drop the trailing log service status
+		detail, _, _ := strings.Cut(parts[2], ";")
+		detail = strings.TrimSpace(detail)
+
+		active, sub := "inactive", "dead"
+		switch state {
+		case "run":
+			active, sub = "active", "running"
+		case "fail":
+			active, sub = "failed", "failed"
+		case "down":
+		default:
+			continue
+		}
+
+		services = append(services, fiber.Map{
+			"name":        name,
+			"load":        "loaded",
+			"active":      active,
+			"sub":         sub,
+			"description": detail,
+		})
+	}
+
+	return services
+}
+
 // parseNetworkConnections parses `ss -tunapl` output.
 func parseNetworkConnections(output string) []fiber.Map {
 	lines := strings.Split(strings.TrimSpace(output), "\n")
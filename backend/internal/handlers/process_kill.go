@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// processSignals maps the signal names the kill endpoints accept to their
+// numbers, which are the same on every Linux architecture.
+var processSignals = map[string]int{
+	"HUP":  1,
+	"INT":  2,
+	"KILL": 9,
+	"TERM": 15,
+}
+
+const signalError = "signal must be TERM, KILL, HUP, INT or a number from 0 to 64"
+
+// parseSignal accepts a signal name (TERM, sigterm, SIGKILL, ...) or number.
+// An empty signal is SIGTERM.
+func parseSignal(s string) (int, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return processSignals["TERM"], true
+	}
+	if n, ok := processSignals[strings.TrimPrefix(s, "SIG")]; ok {
+		return n, true
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n > 64 {
+		return 0, false
+	}
+	return n, true
+}
+
+// processNamePattern matches a process name as pgrep -x compares it: the
+// kernel's command name, at most 15 characters.
+var processNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.:+-]{0,14}$`)
+
+// KillProcessByName sends a signal to every process whose name is exactly
+// the given name, resolved with pgrep -x, and reports the PIDs signaled.
+func (h *ProcessHandler) KillProcessByName(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var req struct {
+		Name   string `json:"name"`
+		Signal string `json:"signal"`
+	}
+	if err := c.BodyParser(&req); err != nil || !processNamePattern.MatchString(req.Name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "name must be a process name of up to 15 characters (letters, digits, . _ : + -)",
+		})
+	}
+	signal, ok := parseSignal(req.Signal)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": signalError,
+		})
+	}
+
+	// pgrep exits 1 when nothing matches
+	output, err := h.execSSH(serverID, "pgrep -x -- "+services.ShellQuote(req.Name))
+	var exitErr *ssh.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitStatus() == 1) {
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find processes: " + err.Error(),
+			"output":  output,
+		})
+	}
+	pids := parsePgrepOutput(output)
+	if len(pids) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "No process named " + req.Name,
+		})
+	}
+
+	args := make([]string, len(pids))
+	for i, pid := range pids {
+		args[i] = strconv.Itoa(pid)
+	}
+	cmd := fmt.Sprintf("kill -%d %s", signal, strings.Join(args, " "))
+	output, err = h.execSSH(serverID, cmd)
+	auditAction(c, h.serverHandler.GetDB(), "process.kill", serverID.String(), map[string]interface{}{
+		"name":   req.Name,
+		"pids":   pids,
+		"signal": signal,
+	}, err)
+	if err != nil {
+		// A process may have exited between pgrep and kill
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to kill processes: " + err.Error(),
+			"pids":    pids,
+			"output":  output,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": fmt.Sprintf("Signal %d sent to %d process(es) named %s", signal, len(pids), req.Name),
+		"name":    req.Name,
+		"signal":  signal,
+		"pids":    pids,
+	})
+}
+
+// parsePgrepOutput parses pgrep's one-PID-per-line output. Anything that is
+// not a positive PID is skipped.
+func parsePgrepOutput(output string) []int {
+	pids := []int{}
+	for _, line := range strings.Split(output, "\n") {
+		pid, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil || pid < 1 {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestParseInitSystem(t *testing.T) {
+	tests := map[string]string{
+		"systemd\n": initSystemd,
+		"openrc\n":  initOpenRC,
+		" runit ":   initRunit,
+		"upstart\n": initSystemd,
+		"":          initSystemd,
+	}
+	for out, want := range tests {
+		if got := parseInitSystem(out); got != want {
+			t.Errorf("parseInitSystem(%q) = %q, want %q", out, got, want)
+		}
+	}
+}
+
+func TestInitSystemCacheExpires(t *testing.T) {
+	h := NewProcessHandler(nil, time.Minute)
+	fresh, stale := uuid.New(), uuid.New()
+	h.initSystems[fresh] = detectedInit{name: initOpenRC, at: time.Now()}
+	h.initSystems[stale] = detectedInit{name: initRunit, at: time.Now().Add(-initSystemTTL)}
+
+	if got, ok := h.cachedInitSystem(fresh); !ok || got != initOpenRC {
+		t.Errorf("fresh entry = %q, %v; want openrc, true", got, ok)
+	}
+	if got, ok := h.cachedInitSystem(stale); ok {
+		t.Errorf("expired entry still served as %q", got)
+	}
+	if _, ok := h.initSystems[stale]; ok {
+		t.Error("expired entry not dropped")
+	}
+
+	h.forgetInitSystem(fresh)
+	if _, ok := h.cachedInitSystem(fresh); ok {
+		t.Error("forgotten entry still served")
+	}
+}
+
+// wantServices compares parsed services on name, active and sub.
+func wantServices(t *testing.T, parser string, got []fiber.Map, want [][3]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %d services", parser, got, len(want))
+	}
+	for i, w := range want {
+		if got[i]["name"] != w[0] || got[i]["active"] != w[1] || got[i]["sub"] != w[2] {
+			t.Errorf("%s service %d = %v, want %v", parser, i, got[i], w)
+		}
+	}
+}
+
+func TestParseServices(t *testing.T) {
+	out := `UNIT                    LOAD   ACTIVE   SUB     DESCRIPTION
+nginx.service           loaded active   running A high performance web server
+postgresql@16-main.service loaded failed failed PostgreSQL Cluster 16-main
+ssh.service             loaded inactive dead    OpenBSD Secure Shell server
+
+3 loaded units listed.
+`
+	services := parseServices(out)
+	wantServices(t, "parseServices", services, [][3]string{
+		{"nginx.service", "active", "running"},
+		{"postgresql@16-main.service", "failed", "failed"},
+		{"ssh.service", "inactive", "dead"},
+	})
+	if d := services[0]["description"]; d != "A high performance web server" {
+		t.Errorf("description = %q, want the full multi-word description", d)
+	}
+}
+
+func TestParseOpenRCServices(t *testing.T) {
+	out := `Runlevel: default
+ sshd                                                              [  started  ]
+ crond                                                             [  stopped  ]
+ nginx                                                             [  crashed  ]
+Dynamic Runlevel: hotplugged
+Dynamic Runlevel: needed/wanted
+ networking                                                        [  starting ]
+`
+	wantServices(t, "parseOpenRCServices", parseOpenRCServices(out), [][3]string{
+		{"sshd", "active", "started"},
+		{"crond", "inactive", "stopped"},
+		{"nginx", "failed", "crashed"},
+		{"networking", "activating", "starting"},
+	})
+}
+
+func TestParseRunitServices(t *testing.T) {
+	out := `run: /var/service/sshd: (pid 812) 3605s; run: log: (pid 811) 3605s
+down: /var/service/nginx: 12s, normally up
+fail: /etc/service/agetty-tty1: (pid 90) 1s
+warning: /var/service/broken: unable to open supervise/ok: file does not exist
+`
+	services := parseRunitServices(out)
+	wantServices(t, "parseRunitServices", services, [][3]string{
+		{"sshd", "active", "running"},
+		{"nginx", "inactive", "dead"},
+		{"agetty-tty1", "failed", "failed"},
+	})
+	if d := services[0]["description"]; d != "(pid 812) 3605s" {
+		t.Errorf("description = %q, want the log service status dropped", d)
+	}
+}
+
+func TestServiceActionCommand(t *testing.T) {
+	tests := []struct {
+		initSys, action, want string
+	}{
+		{initSystemd, "restart", "systemctl restart nginx"},
+		{initOpenRC, "start", "rc-service nginx start"},
+		{initOpenRC, "enable", "rc-update add nginx default"},
+		{initOpenRC, "disable", "rc-update del nginx default"},
+		{initRunit, "start", "sv up nginx"},
+		{initRunit, "stop", "sv down nginx"},
+		{initRunit, "restart", "sv restart nginx"},
+		{initRunit, "disable", "rm -f /var/service/nginx /etc/service/nginx"},
+	}
+	for _, tt := range tests {
+		if got := serviceActionCommand(tt.initSys, tt.action, "nginx"); got != tt.want {
+			t.Errorf("serviceActionCommand(%q, %q) = %q, want %q", tt.initSys, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestBuildProcessTree(t *testing.T) {
+	// Columns as processTreeCommand prints them: comm padded to 16
+	output := "" +
+		"    1     0  0.0  0.1 systemd          /sbin/init splash\n" +
+		"    2     0  0.0  0.0 kthreadd         [kthreadd]\n" +
+		"  812     1  1.5  2.0 Web Content      /usr/lib/firefox/firefox -contentproc\n" +
+		"  900   812  0.2  0.3 sh               sh -c sleep 60\n" +
+		"  812     1  9.9  9.9 duplicate        listed twice while ps walked /proc\n" +
+		" 4242  4000  0.0  0.1 sleep            sleep 60\n" +
+		"\n"
+
+	roots, count := buildProcessTree(output)
+	if count != 5 {
+		t.Errorf("count = %d, want 5 with the duplicate PID dropped", count)
+	}
+	if len(roots) != 3 || roots[0].PID != 1 || roots[1].PID != 2 || roots[2].PID != 4242 {
+		t.Fatalf("roots = %+v, want pids 1, 2 and the orphaned 4242", roots)
+	}
+	if len(roots[0].Children) != 1 {
+		t.Fatalf("systemd children = %d, want 1", len(roots[0].Children))
+	}
+	web := roots[0].Children[0]
+	if web.Name != "Web Content" || web.Command != "/usr/lib/firefox/firefox -contentproc" || web.CPU != 1.5 {
+		t.Errorf("pid 812 = %+v, want the first listing with its spaced name", web)
+	}
+	if len(web.Children) != 1 || web.Children[0].PID != 900 || web.Children[0].Command != "sh -c sleep 60" {
+		t.Errorf("pid 812 children = %+v, want pid 900", web.Children)
+	}
+	if len(roots[2].Children) != 0 || roots[2].Children == nil {
+		t.Errorf("orphan children = %v, want an empty list", roots[2].Children)
+	}
+}
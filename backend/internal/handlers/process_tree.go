@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// processTreeCommand lists every process without headers. comm is padded to
+// a fixed width so names containing spaces still split from args.
+const processTreeCommand = "ps -eo pid=,ppid=,pcpu=,pmem=,comm:16=,args="
+
+// processNode is one process in the tree returned by ListProcesses with
+// ?format=tree.
+type processNode struct {
+	PID      int            `json:"pid"`
+	PPID     int            `json:"ppid"`
+	CPU      float64        `json:"cpu"`
+	Mem      float64        `json:"mem"`
+	Name     string         `json:"name"`
+	Command  string         `json:"command"`
+	Children []*processNode `json:"children"`
+}
+
+// buildProcessTree parses processTreeCommand output and nests each process
+// under its parent. Processes whose parent is not in the list (PID 1,
+// kthreadd, or a parent that exited mid-listing) become roots. It also
+// returns the number of processes parsed.
+func buildProcessTree(output string) ([]*processNode, int) {
+	var nodes []*processNode
+	byPID := make(map[int]*processNode)
+	for _, line := range strings.Split(output, "\n") {
+		node, ok := parseProcessTreeLine(line)
+		if !ok || byPID[node.PID] != nil {
+			continue
+		}
+		nodes = append(nodes, node)
+		byPID[node.PID] = node
+	}
+
+	roots := []*processNode{}
+	for _, node := range nodes {
+		parent := byPID[node.PPID]
+		if parent == nil || parent == node {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	return roots, len(nodes)
+}
+
+// parseProcessTreeLine parses one line of processTreeCommand output.
+func parseProcessTreeLine(line string) (*processNode, bool) {
+	// pid, ppid, pcpu and pmem are single words; what follows is comm in a
+	// 16-column field, a space, then args
+	var fields [4]string
+	rest := line
+	for i := range fields {
+		rest = strings.TrimLeft(rest, " ")
+		end := strings.IndexByte(rest, ' ')
+		if end < 0 {
+			return nil, false
+		}
+		fields[i], rest = rest[:end], rest[end+1:]
+	}
+
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid < 1 {
+		return nil, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, false
+	}
+	cpu, _ := strconv.ParseFloat(fields[2], 64)
+	mem, _ := strconv.ParseFloat(fields[3], 64)
+
+	name, args := rest, ""
+	if len(rest) > 16 {
+		name, args = rest[:16], rest[16:]
+	}
+	return &processNode{
+		PID:      pid,
+		PPID:     ppid,
+		CPU:      cpu,
+		Mem:      mem,
+		Name:     strings.TrimSpace(name),
+		Command:  strings.TrimSpace(args),
+		Children: []*processNode{},
+	}, true
+}
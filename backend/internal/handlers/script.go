@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	maxScriptSize        = 256 * 1024
+	defaultScriptTimeout = 300
+	maxScriptTimeout     = 3600
+)
+
+// ExecScript runs a multi-line script on a server. The script is piped to
+// the interpreter over stdin rather than embedded in the command line, and
+// scripts with dangerous lines only run with "confirm": true.
+func (h *CommandHandler) ExecScript(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var req struct {
+		Script         string   `json:"script"`
+		Interpreter    string   `json:"interpreter"` // bash (default), sh, python
+		TimeoutSeconds int      `json:"timeout_seconds"`
+		Confirm        bool     `json:"confirm"`
+		Env            []string `json:"env"` // server secret keys to inject as environment variables
+	}
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Script) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Script is required",
+		})
+	}
+	if len(req.Script) > maxScriptSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("Script exceeds %d bytes", maxScriptSize),
+		})
+	}
+
+	if req.Interpreter == "" {
+		req.Interpreter = "bash"
+	}
+	command, ok := services.ScriptInterpreters[req.Interpreter]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "interpreter must be bash, sh or python",
+		})
+	}
+
+	if req.TimeoutSeconds == 0 {
+		req.TimeoutSeconds = defaultScriptTimeout
+	}
+	if req.TimeoutSeconds < 1 || req.TimeoutSeconds > maxScriptTimeout {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("timeout_seconds must be between 1 and %d", maxScriptTimeout),
+		})
+	}
+
+	risks := services.ScriptRisks(req.Script, req.Interpreter)
+	if len(risks) > 0 && !req.Confirm {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":                 true,
+			"message":               "Script contains dangerous commands; resend with confirm: true to run it",
+			"requires_confirmation": true,
+			"risks":                 risks,
+		})
+	}
+
+	env, err := resolveSecrets(c, h.serverHandler, serverID, req.Env, "script")
+	if err != nil {
+		return err
+	}
+
+	recorded := fmt.Sprintf("# %s script\n%s", req.Interpreter, req.Script)
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	history, err := h.execute(serverID, command, recorded, env, strings.NewReader(req.Script), timeout)
+
+	// Confirmed risky runs are audited with the lines that needed confirming,
+	// whether or not the script could be started
+	details := map[string]interface{}{
+		"interpreter": req.Interpreter,
+		"risky_lines": len(risks),
+	}
+	if len(risks) > 0 {
+		details["confirmed_risks"] = risks
+	}
+	if err != nil {
+		auditAction(c, h.serverHandler.GetDB(), "command.script", serverID.String(), details, err)
+		return err
+	}
+	details["exit_code"] = history.ExitCode
+	details["history_id"] = history.ID
+	auditAction(c, h.serverHandler.GetDB(), "command.script", serverID.String(), details, nil)
+
+	return c.JSON(fiber.Map{
+		"interpreter": req.Interpreter,
+		"output":      history.Output,
+		"exit_code":   history.ExitCode,
+		"duration_ms": history.DurationMs,
+		"id":          history.ID,
+		"risks":       risks,
+		"timed_out":   history.TimedOut,
+	})
+}
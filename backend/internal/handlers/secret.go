@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SecretHandler manages per-server secrets. Values are write-only: they are
+// encrypted on input and never returned by the API.
+type SecretHandler struct {
+	db            *gorm.DB
+	serverHandler *ServerHandler
+}
+
+func NewSecretHandler(serverHandler *ServerHandler) *SecretHandler {
+	return &SecretHandler{db: serverHandler.GetDB(), serverHandler: serverHandler}
+}
+
+// ListSecrets returns the secret keys of a server, without values.
+func (h *SecretHandler) ListSecrets(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var secrets []models.ServerSecret
+	h.db.Where("server_id = ?", serverID).Order("key").Find(&secrets)
+
+	return c.JSON(fiber.Map{"secrets": secrets})
+}
+
+// CreateSecret stores a new secret for a server.
+func (h *SecretHandler) CreateSecret(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var req struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+	if !services.ValidEnvKey(req.Key) || req.Value == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "A valid environment variable name and a value are required",
+		})
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", serverID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	var count int64
+	h.db.Model(&models.ServerSecret{}).Where("server_id = ? AND key = ?", serverID, req.Key).Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Secret already exists",
+		})
+	}
+
+	encrypted, err := h.serverHandler.GetEncryptor().Encrypt(req.Value)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to encrypt secret",
+		})
+	}
+
+	secret := models.ServerSecret{ServerID: serverID, Key: req.Key, EncryptedValue: encrypted}
+	if err := h.db.WithContext(c.UserContext()).Create(&secret).Error; err != nil {
+		slog.Error("Failed to create secret", "server_id", serverID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create secret",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(secret)
+}
+
+// UpdateSecret replaces the value of an existing secret.
+func (h *SecretHandler) UpdateSecret(c *fiber.Ctx) error {
+	secret, err := h.findSecret(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Value == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Value is required",
+		})
+	}
+
+	encrypted, err := h.serverHandler.GetEncryptor().Encrypt(req.Value)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to encrypt secret",
+		})
+	}
+
+	secret.EncryptedValue = encrypted
+	if err := h.db.WithContext(c.UserContext()).Save(secret).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update secret",
+		})
+	}
+
+	return c.JSON(secret)
+}
+
+// DeleteSecret removes a secret.
+func (h *SecretHandler) DeleteSecret(c *fiber.Ctx) error {
+	secret, err := h.findSecret(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Delete(secret).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to delete secret",
+		})
+	}
+
+	return c.JSON(fiber.Map{"message": "Secret deleted"})
+}
+
+// findSecret loads the secret addressed by :id and :key.
+func (h *SecretHandler) findSecret(c *fiber.Ctx) (*models.ServerSecret, error) {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid server ID")
+	}
+
+	var secret models.ServerSecret
+	if err := h.db.First(&secret, "server_id = ? AND key = ?", serverID, c.Params("key")).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Secret not found")
+	}
+	return &secret, nil
+}
+
+// resolveSecrets decrypts the requested secrets for injection into a command
+// and records the access in the audit log. Errors are *fiber.Error values.
+func resolveSecrets(c *fiber.Ctx, sh *ServerHandler, serverID uuid.UUID, keys []string, purpose string) (map[string]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	env, err := services.ResolveServerSecrets(sh.GetDB(), sh.GetEncryptor(), serverID, keys)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	actor, _ := c.Locals("username").(string)
+	if err := CreateAuditLog(sh.GetDB(), actor, "secret.inject", serverID.String(), map[string]interface{}{
+		"keys":    keys,
+		"purpose": purpose,
+	}); err != nil {
+		// Secrets are only handed out when the access is on record
+		slog.Error("Failed to audit secret access", "server_id", serverID, "error", err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to audit secret access")
+	}
+	return env, nil
+}
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ahmetk3436/bastion/internal/crypto"
@@ -12,6 +16,35 @@ import (
 	"gorm.io/gorm"
 )
 
+// maxMetricsPoints caps how many rows GetMetrics returns in one page.
+const maxMetricsPoints = 5000
+
+// metricsBucketSelect averages ServerMetrics into fixed-size time buckets.
+// Both placeholders are the bucket size in seconds.
+const metricsBucketSelect = `server_id,
+	AVG(cpu_percent) AS cpu_percent,
+	AVG(memory_used_mb) AS memory_used_mb,
+	AVG(memory_total_mb) AS memory_total_mb,
+	AVG(mem_cached_mb) AS mem_cached_mb,
+	AVG(swap_used_mb) AS swap_used_mb,
+	AVG(swap_total_mb) AS swap_total_mb,
+	AVG(disk_used_gb) AS disk_used_gb,
+	AVG(disk_total_gb) AS disk_total_gb,
+	MAX(disk_max_percent) AS disk_max_percent,
+	MAX(network_rx_bytes) AS network_rx_bytes,
+	MAX(network_tx_bytes) AS network_tx_bytes,
+	ROUND(AVG(container_count)) AS container_count,
+	ROUND(AVG(container_running)) AS container_running,
+	AVG(load_avg1m) AS load_avg1m,
+	AVG(load_avg5m) AS load_avg5m,
+	AVG(load_avg15m) AS load_avg15m,
+	MAX(uptime_seconds) AS uptime_seconds,
+	AVG(gpu_util_percent) AS gpu_util_percent,
+	AVG(gpu_mem_used_mb) AS gpu_mem_used_mb,
+	AVG(gpu_mem_total_mb) AS gpu_mem_total_mb,
+	to_timestamp(floor(extract(epoch from collected_at) / ?) * ?) AS bucket,
+	MIN(collected_at) AS collected_at`
+
 type ServerHandler struct {
 	db        *gorm.DB
 	encryptor *crypto.Encryptor
@@ -22,9 +55,49 @@ func NewServerHandler(db *gorm.DB, encryptor *crypto.Encryptor, sshPool *service
 	return &ServerHandler{db: db, encryptor: encryptor, sshPool: sshPool}
 }
 
+// ListServers lists servers, optionally filtered by status, tag and
+// environment and searched by name, host or notes (q). sort picks the
+// column; order defaults to asc, or desc for created_at (the default sort).
 func (h *ServerHandler) ListServers(c *fiber.Ctx) error {
+	column, ok := serverSortColumns[c.Query("sort", "created_at")]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "sort must be name, host, status, environment or created_at",
+		})
+	}
+	defaultOrder := "asc"
+	if column == "created_at" {
+		defaultOrder = "desc"
+	}
+	order := strings.ToLower(c.Query("order", defaultOrder))
+	if order != "asc" && order != "desc" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "order must be asc or desc",
+		})
+	}
+
+	query := h.db.Order(column + " " + order)
+	if column != "name" {
+		query = query.Order("name")
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if tag := c.Query("tag"); tag != "" {
+		query = whereServerTag(query, strings.ToLower(strings.TrimSpace(tag)))
+	}
+	if env := c.Query("environment"); env != "" {
+		query = query.Where("environment = ?", strings.ToLower(strings.TrimSpace(env)))
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := likeContains(strings.ToLower(q))
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(host) LIKE ? OR LOWER(notes) LIKE ?", like, like, like)
+	}
+
 	var servers []models.Server
-	if err := h.db.Order("created_at DESC").Find(&servers).Error; err != nil {
+	if err := query.Find(&servers).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to list servers",
@@ -33,16 +106,30 @@ func (h *ServerHandler) ListServers(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"servers": servers})
 }
 
+// collectIntervalMessage explains the accepted collect_interval_seconds values.
+const collectIntervalMessage = "collect_interval_seconds must be 0 (global interval) or between 10 and 86400"
+
 func (h *ServerHandler) CreateServer(c *fiber.Ctx) error {
 	var req struct {
-		Name       string `json:"name"`
-		Host       string `json:"host"`
-		Port       int    `json:"port"`
-		Username   string `json:"username"`
-		AuthType   string `json:"auth_type"`
-		Password   string `json:"password"`
-		PrivateKey string `json:"private_key"`
-		IsDefault  bool   `json:"is_default"`
+		Name           string   `json:"name"`
+		Host           string   `json:"host"`
+		Port           int      `json:"port"`
+		Username       string   `json:"username"`
+		AuthType       string   `json:"auth_type"`
+		Password       string   `json:"password"`
+		PrivateKey     string   `json:"private_key"`
+		Passphrase     string   `json:"passphrase"`     // for passphrase-protected keys
+		JumpServerID   string   `json:"jump_server_id"` // server to connect through
+		KeyFile        string   `json:"key_file"`
+		IsDefault      bool     `json:"is_default"`
+		CommandPrefix  string   `json:"command_prefix"`
+		Shell          string   `json:"shell"`
+		HostKeyPolicy  string   `json:"host_key_policy"`
+		Tags           []string `json:"tags"`
+		Environment    string   `json:"environment"`
+		RecordTerminal bool     `json:"record_terminal"`
+
+		CollectIntervalSeconds int `json:"collect_interval_seconds"` // 0 uses the global interval
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -64,9 +151,86 @@ func (h *ServerHandler) CreateServer(c *fiber.Ctx) error {
 	if req.AuthType == "" {
 		req.AuthType = "password"
 	}
+	if !services.ValidAuthType(req.AuthType) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "auth_type must be password, key, keyfile or agent",
+		})
+	}
+	if req.HostKeyPolicy == "" {
+		req.HostKeyPolicy = services.HostKeyPolicyStrict
+	}
+	if !services.ValidHostKeyPolicy(req.HostKeyPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "host_key_policy must be strict or warn",
+		})
+	}
+	if !services.ValidCollectInterval(req.CollectIntervalSeconds) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": collectIntervalMessage,
+		})
+	}
+	tags, err := normalizeServerTags(req.Tags)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid tags: " + err.Error(),
+		})
+	}
+	environment, err := normalizeServerLabel(req.Environment)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid environment: " + err.Error(),
+		})
+	}
 
-	// Test connection first
-	fingerprint, err := services.TestSSHConnection(req.Host, req.Port, req.Username, req.Password, req.PrivateKey, req.AuthType)
+	// Key files are read from the Bastion host, never stored
+	privateKey := req.PrivateKey
+	if req.AuthType == "keyfile" {
+		key, err := services.ReadKeyFile(req.KeyFile)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": err.Error(),
+			})
+		}
+		privateKey = key
+	}
+	if req.AuthType == "key" || req.AuthType == "keyfile" {
+		unlocked, err := services.UnlockPrivateKey(privateKey, req.Passphrase)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": keyErrorMessage(err),
+			})
+		}
+		privateKey = unlocked
+	}
+
+	var jumpServerID *uuid.UUID
+	if req.JumpServerID != "" {
+		id, err := uuid.Parse(req.JumpServerID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid jump_server_id",
+			})
+		}
+		jumpServerID = &id
+	}
+	jump, err := h.jumpHost(jumpServerID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	// Test connection first; the host key seen here is trusted from now on
+	fingerprint, err := services.TestSSHConnection(req.Host, req.Port, req.Username, req.Password, privateKey, req.AuthType, "", req.HostKeyPolicy, jump)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
@@ -76,14 +240,35 @@ func (h *ServerHandler) CreateServer(c *fiber.Ctx) error {
 
 	// Encrypt credentials
 	server := models.Server{
-		Name:        req.Name,
-		Host:        req.Host,
-		Port:        req.Port,
-		Username:    req.Username,
-		AuthType:    req.AuthType,
-		Fingerprint: fingerprint,
-		IsDefault:   req.IsDefault,
-		Status:      "online",
+		Name:          req.Name,
+		Host:          req.Host,
+		Port:          req.Port,
+		Username:      req.Username,
+		AuthType:      req.AuthType,
+		Fingerprint:   fingerprint,
+		HostKeyPolicy: req.HostKeyPolicy,
+		JumpServerID:  jumpServerID,
+		IsDefault:     req.IsDefault,
+		Status:        "online",
+		CommandPrefix: req.CommandPrefix,
+		Shell:         req.Shell,
+		Tags:          tags,
+		Environment:   environment,
+	}
+	server.RecordTerminal = req.RecordTerminal
+	server.CollectIntervalSeconds = req.CollectIntervalSeconds
+	if req.AuthType == "keyfile" {
+		server.KeyFile = req.KeyFile
+	}
+	if (req.AuthType == "key" || req.AuthType == "keyfile") && req.Passphrase != "" {
+		encrypted, err := h.encryptor.Encrypt(req.Passphrase)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to encrypt passphrase",
+			})
+		}
+		server.EncryptedPassphrase = encrypted
 	}
 
 	now := time.Now()
@@ -98,7 +283,7 @@ func (h *ServerHandler) CreateServer(c *fiber.Ctx) error {
 			})
 		}
 		server.EncryptedPrivateKey = encrypted
-	} else if req.Password != "" {
+	} else if req.AuthType == "password" && req.Password != "" {
 		encrypted, err := h.encryptor.Encrypt(req.Password)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -114,7 +299,7 @@ func (h *ServerHandler) CreateServer(c *fiber.Ctx) error {
 		h.db.Model(&models.Server{}).Where("is_default = ?", true).Update("is_default", false)
 	}
 
-	if err := h.db.Create(&server).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Create(&server).Error; err != nil {
 		slog.Error("Failed to create server", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -170,14 +355,27 @@ func (h *ServerHandler) UpdateServer(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Name       *string `json:"name"`
-		Host       *string `json:"host"`
-		Port       *int    `json:"port"`
-		Username   *string `json:"username"`
-		AuthType   *string `json:"auth_type"`
-		Password   *string `json:"password"`
-		PrivateKey *string `json:"private_key"`
-		IsDefault  *bool   `json:"is_default"`
+		Name          *string   `json:"name"`
+		Host          *string   `json:"host"`
+		Port          *int      `json:"port"`
+		Username      *string   `json:"username"`
+		AuthType      *string   `json:"auth_type"`
+		Password      *string   `json:"password"`
+		PrivateKey    *string   `json:"private_key"`
+		Passphrase    *string   `json:"passphrase"`     // "" removes a stored passphrase
+		JumpServerID  *string   `json:"jump_server_id"` // "" connects directly
+		KeyFile       *string   `json:"key_file"`
+		IsDefault     *bool     `json:"is_default"`
+		CommandPrefix *string   `json:"command_prefix"`
+		Shell         *string   `json:"shell"`
+		HostKeyPolicy *string   `json:"host_key_policy"`
+		ResetHostKey  bool      `json:"reset_host_key"` // trust the next host key seen
+		Tags          *[]string `json:"tags"`           // replaces all tags
+		Environment   *string   `json:"environment"`    // "" clears it
+
+		RecordTerminal *bool `json:"record_terminal"`
+
+		CollectIntervalSeconds *int `json:"collect_interval_seconds"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -189,36 +387,147 @@ func (h *ServerHandler) UpdateServer(c *fiber.Ctx) error {
 	if req.Name != nil {
 		server.Name = *req.Name
 	}
-	if req.Host != nil {
+	if req.Host != nil && *req.Host != server.Host {
 		server.Host = *req.Host
+		server.Fingerprint = ""
 	}
-	if req.Port != nil {
+	if req.Port != nil && *req.Port != server.Port {
 		server.Port = *req.Port
+		server.Fingerprint = ""
+	}
+	if req.ResetHostKey {
+		server.Fingerprint = ""
+	}
+	if req.HostKeyPolicy != nil {
+		if !services.ValidHostKeyPolicy(*req.HostKeyPolicy) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "host_key_policy must be strict or warn",
+			})
+		}
+		server.HostKeyPolicy = *req.HostKeyPolicy
 	}
 	if req.Username != nil {
 		server.Username = *req.Username
 	}
+	if req.JumpServerID != nil {
+		server.JumpServerID = nil
+		if *req.JumpServerID != "" {
+			id, err := uuid.Parse(*req.JumpServerID)
+			if err != nil || id == server.ID {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   true,
+					"message": "Invalid jump_server_id",
+				})
+			}
+			if _, err := h.jumpHost(&id); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   true,
+					"message": err.Error(),
+				})
+			}
+			server.JumpServerID = &id
+		}
+	}
 	if req.AuthType != nil {
+		if !services.ValidAuthType(*req.AuthType) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "auth_type must be password, key, keyfile or agent",
+			})
+		}
 		server.AuthType = *req.AuthType
 	}
+	if req.KeyFile != nil {
+		server.KeyFile = *req.KeyFile
+	}
 	if req.Password != nil && *req.Password != "" {
 		encrypted, err := h.encryptor.Encrypt(*req.Password)
-		if err == nil {
-			server.EncryptedPassword = encrypted
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to encrypt password",
+			})
 		}
+		server.EncryptedPassword = encrypted
 	}
 	if req.PrivateKey != nil && *req.PrivateKey != "" {
 		encrypted, err := h.encryptor.Encrypt(*req.PrivateKey)
-		if err == nil {
-			server.EncryptedPrivateKey = encrypted
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to encrypt private key",
+			})
+		}
+		server.EncryptedPrivateKey = encrypted
+	}
+	if req.Passphrase != nil {
+		server.EncryptedPassphrase = ""
+		if *req.Passphrase != "" {
+			encrypted, err := h.encryptor.Encrypt(*req.Passphrase)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":   true,
+					"message": "Failed to encrypt passphrase",
+				})
+			}
+			server.EncryptedPassphrase = encrypted
+		}
+	}
+	// A new key, key file or passphrase must still unlock before it is saved
+	keyChanged := req.PrivateKey != nil || req.KeyFile != nil || req.Passphrase != nil || req.AuthType != nil
+	if keyChanged && (server.AuthType == "key" || server.AuthType == "keyfile") {
+		if _, _, err := h.decryptCredentials(&server); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": keyErrorMessage(err),
+			})
 		}
 	}
+	if req.CommandPrefix != nil {
+		server.CommandPrefix = *req.CommandPrefix
+	}
+	if req.Shell != nil {
+		server.Shell = *req.Shell
+	}
+	if req.CollectIntervalSeconds != nil {
+		if !services.ValidCollectInterval(*req.CollectIntervalSeconds) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": collectIntervalMessage,
+			})
+		}
+		server.CollectIntervalSeconds = *req.CollectIntervalSeconds
+	}
+	if req.Tags != nil {
+		tags, err := normalizeServerTags(*req.Tags)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid tags: " + err.Error(),
+			})
+		}
+		server.Tags = tags
+	}
+	if req.Environment != nil {
+		environment, err := normalizeServerLabel(*req.Environment)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid environment: " + err.Error(),
+			})
+		}
+		server.Environment = environment
+	}
+	if req.RecordTerminal != nil {
+		server.RecordTerminal = *req.RecordTerminal
+	}
 	if req.IsDefault != nil && *req.IsDefault {
 		h.db.Model(&models.Server{}).Where("is_default = ?", true).Update("is_default", false)
 		server.IsDefault = true
 	}
 
-	if err := h.db.Save(&server).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Save(&server).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to update server",
@@ -237,7 +546,16 @@ func (h *ServerHandler) DeleteServer(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.db.Delete(&models.Server{}, "id = ?", id).Error; err != nil {
+	var proxied int64
+	h.db.Model(&models.Server{}).Where("jump_server_id = ?", id).Count(&proxied)
+	if proxied > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("Server is the jump host for %d other server(s)", proxied),
+		})
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Delete(&models.Server{}, "id = ?", id).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to delete server",
@@ -265,6 +583,12 @@ func (h *ServerHandler) TestConnection(c *fiber.Ctx) error {
 	}
 
 	password, privateKey, err := h.decryptCredentials(&server)
+	if errors.Is(err, services.ErrMissingCredential) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server has no stored credential for auth type " + server.AuthType,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -272,29 +596,204 @@ func (h *ServerHandler) TestConnection(c *fiber.Ctx) error {
 		})
 	}
 
-	fingerprint, err := services.TestSSHConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	jump, err := h.jumpHost(server.JumpServerID)
 	if err != nil {
-		h.db.Model(&server).Updates(map[string]interface{}{"status": "offline"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	fingerprint, err := services.TestSSHConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType, server.Fingerprint, server.HostKeyPolicy, jump)
+	if err != nil {
+		status := services.StatusForSSHError(err)
+		h.db.Model(&server).Updates(map[string]interface{}{
+			"status":     status,
+			"last_error": err.Error(),
+		})
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":       true,
 			"message":     "Connection failed: " + err.Error(),
+			"error_class": services.ClassifySSHError(err),
+			"status":      status,
 			"fingerprint": fingerprint,
 		})
 	}
 
-	now := time.Now()
-	h.db.Model(&server).Updates(map[string]interface{}{
-		"status":            "online",
-		"fingerprint":       fingerprint,
-		"last_connected_at": now,
+	h.db.Model(&server).Updates(connectedUpdates(&server, fingerprint))
+
+	return c.JSON(fiber.Map{
+		"message":             "Connection successful",
+		"fingerprint":         fingerprint,
+		"fingerprint_changed": server.Fingerprint != "" && fingerprint != server.Fingerprint,
 	})
+}
+
+// connectedUpdates are the columns set after a successful connection test.
+// The fingerprint is only recorded when none is stored: under the warn
+// policy a changed host key still connects, but it is not trusted until
+// reset_host_key clears the old one.
+func connectedUpdates(server *models.Server, fingerprint string) map[string]interface{} {
+	updates := map[string]interface{}{
+		"status":            "online",
+		"last_error":        "",
+		"last_connected_at": time.Now(),
+	}
+	if server.Fingerprint == "" {
+		updates["fingerprint"] = fingerprint
+	}
+	return updates
+}
+
+// testAllConcurrency bounds parallel SSH dials in TestAllConnections.
+const testAllConcurrency = 8
+
+// TestAllConnections re-verifies every server concurrently and reports
+// per-server results, flagging fingerprint changes.
+func (h *ServerHandler) TestAllConnections(c *fiber.Ctx) error {
+	var servers []models.Server
+	if err := h.db.Order("name ASC").Find(&servers).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to list servers",
+		})
+	}
+
+	type result struct {
+		ServerID            uuid.UUID `json:"server_id"`
+		Name                string    `json:"name"`
+		Status              string    `json:"status"`
+		Error               string    `json:"error,omitempty"`
+		ErrorClass          string    `json:"error_class,omitempty"`
+		Fingerprint         string    `json:"fingerprint"`
+		PreviousFingerprint string    `json:"previous_fingerprint,omitempty"`
+		FingerprintChanged  bool      `json:"fingerprint_changed"`
+	}
+
+	results := make([]result, len(servers))
+	sem := make(chan struct{}, testAllConcurrency)
+	var wg sync.WaitGroup
+
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			server := &servers[i]
+			r := result{ServerID: server.ID, Name: server.Name}
+
+			password, privateKey, err := h.decryptCredentials(server)
+			if err != nil {
+				r.Status = server.Status
+				r.Error = "failed to decrypt credentials"
+				results[i] = r
+				return
+			}
+
+			jump, err := h.jumpHost(server.JumpServerID)
+			if err != nil {
+				r.Status = server.Status
+				r.Error = err.Error()
+				results[i] = r
+				return
+			}
+
+			fingerprint, err := services.TestSSHConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType, server.Fingerprint, server.HostKeyPolicy, jump)
+			r.Fingerprint = fingerprint
+			if fingerprint != "" && server.Fingerprint != "" && fingerprint != server.Fingerprint {
+				r.FingerprintChanged = true
+				r.PreviousFingerprint = server.Fingerprint
+				slog.Warn("Server host key fingerprint changed", "server", server.Name, "old", server.Fingerprint, "new", fingerprint)
+			}
+
+			if err != nil {
+				r.Status = services.StatusForSSHError(err)
+				r.Error = err.Error()
+				r.ErrorClass = services.ClassifySSHError(err)
+				h.db.Model(server).Updates(map[string]interface{}{
+					"status":     r.Status,
+					"last_error": r.Error,
+				})
+				results[i] = r
+				return
+			}
+
+			r.Status = "online"
+			h.db.Model(server).Updates(connectedUpdates(server, fingerprint))
+			results[i] = r
+		}(i)
+	}
+	wg.Wait()
+
+	online, failed := 0, 0
+	changed := make([]string, 0)
+	for _, r := range results {
+		if r.Status == "online" {
+			online++
+		} else {
+			failed++
+		}
+		if r.FingerprintChanged {
+			changed = append(changed, r.Name)
+		}
+	}
+
+	auditAction(c, h.db, "server.test_all", "servers", map[string]interface{}{
+		"total":                len(results),
+		"online":               online,
+		"failed":               failed,
+		"fingerprints_changed": changed,
+	}, nil)
 
 	return c.JSON(fiber.Map{
-		"message":     "Connection successful",
-		"fingerprint": fingerprint,
+		"results":              results,
+		"total":                len(results),
+		"online":               online,
+		"failed":               failed,
+		"fingerprints_changed": changed,
 	})
 }
 
+// metricsRange reads the time range of a metrics query: ?period= (1h, 24h
+// or 7d, default 1h) ending now, or explicit RFC3339 ?from= and ?to=. Errors
+// are *fiber.Error values.
+func metricsRange(c *fiber.Ctx) (since, until time.Time, period string, err error) {
+	period = c.Query("period", "1h")
+	until = time.Now()
+	switch period {
+	case "24h":
+		since = until.Add(-24 * time.Hour)
+	case "7d":
+		since = until.Add(-7 * 24 * time.Hour)
+	default:
+		since = until.Add(-1 * time.Hour)
+	}
+
+	// Explicit from/to override the preset period
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return since, until, period, fiber.NewError(fiber.StatusBadRequest, "Invalid from (expected RFC3339)")
+		}
+		since = t
+		period = "custom"
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return since, until, period, fiber.NewError(fiber.StatusBadRequest, "Invalid to (expected RFC3339)")
+		}
+		until = t
+		period = "custom"
+	}
+	if !since.Before(until) {
+		return since, until, period, fiber.NewError(fiber.StatusBadRequest, "from must be before to")
+	}
+	return since, until, period, nil
+}
+
 func (h *ServerHandler) GetMetrics(c *fiber.Ctx) error {
 	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
@@ -304,23 +803,64 @@ func (h *ServerHandler) GetMetrics(c *fiber.Ctx) error {
 		})
 	}
 
-	period := c.Query("period", "1h")
-	var since time.Time
-	switch period {
-	case "24h":
-		since = time.Now().Add(-24 * time.Hour)
-	case "7d":
-		since = time.Now().Add(-7 * 24 * time.Hour)
-	default:
-		since = time.Now().Add(-1 * time.Hour)
+	since, until, period, err := metricsRange(c)
+	if err != nil {
+		return err
+	}
+
+	limit := min(c.QueryInt("limit", 1000), maxMetricsPoints)
+	if limit < 1 {
+		limit = 1000
+	}
+	offset := max(c.QueryInt("offset", 0), 0)
+
+	// Optional downsampling: bucket size in seconds, averaged in SQL
+	resolution := c.QueryInt("resolution", 0)
+	if resolution < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "resolution must be a positive number of seconds",
+		})
 	}
 
 	var metrics []models.ServerMetrics
-	h.db.Where("server_id = ? AND collected_at >= ?", id, since).
-		Order("collected_at ASC").
-		Find(&metrics)
+	var total int64
 
-	return c.JSON(fiber.Map{"metrics": metrics, "period": period})
+	if resolution > 0 {
+		bucketed := h.db.Model(&models.ServerMetrics{}).
+			Select(metricsBucketSelect, resolution, resolution).
+			Where("server_id = ? AND collected_at >= ? AND collected_at <= ?", id, since, until).
+			Group("server_id, bucket")
+
+		h.db.Table("(?) AS b", bucketed).Count(&total)
+		if err := bucketed.Order("bucket ASC").Offset(offset).Limit(limit).Scan(&metrics).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to query metrics",
+			})
+		}
+	} else {
+		query := h.db.Model(&models.ServerMetrics{}).
+			Where("server_id = ? AND collected_at >= ? AND collected_at <= ?", id, since, until)
+		query.Count(&total)
+		if err := query.Order("collected_at ASC").Offset(offset).Limit(limit).Find(&metrics).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to query metrics",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"metrics":    metrics,
+		"period":     period,
+		"from":       since,
+		"to":         until,
+		"resolution": resolution,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
 }
 
 func (h *ServerHandler) GetLiveMetrics(c *fiber.Ctx) error {
@@ -343,20 +883,229 @@ func (h *ServerHandler) GetLiveMetrics(c *fiber.Ctx) error {
 	return c.JSON(metrics)
 }
 
-func (h *ServerHandler) decryptCredentials(server *models.Server) (password, privateKey string, err error) {
-	if server.EncryptedPassword != "" {
-		password, err = h.encryptor.Decrypt(server.EncryptedPassword)
-		if err != nil {
-			return "", "", err
-		}
+// GetNetworkMetrics returns per-interface network samples in the range
+// GetMetrics takes, grouped by interface, oldest first. ?interface= limits
+// it to one interface; ?limit= and ?offset= page through the rows, and
+// truncated reports that rows remain after this page.
+func (h *ServerHandler) GetNetworkMetrics(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
 	}
-	if server.EncryptedPrivateKey != "" {
-		privateKey, err = h.encryptor.Decrypt(server.EncryptedPrivateKey)
-		if err != nil {
-			return "", "", err
+
+	since, until, period, err := metricsRange(c)
+	if err != nil {
+		return err
+	}
+	limit := min(c.QueryInt("limit", 1000), maxMetricsPoints)
+	if limit < 1 {
+		limit = 1000
+	}
+	offset := max(c.QueryInt("offset", 0), 0)
+
+	query := h.db.Model(&models.ServerNetworkMetrics{}).
+		Where("server_id = ? AND collected_at >= ? AND collected_at <= ?", id, since, until)
+	if iface := c.Query("interface"); iface != "" {
+		query = query.Where("interface = ?", iface)
+	}
+	var total int64
+	query.Count(&total)
+	var rows []models.ServerNetworkMetrics
+	if err := query.Order("collected_at ASC, interface ASC").Offset(offset).Limit(limit).Find(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to query network metrics",
+		})
+	}
+
+	interfaces := map[string][]models.ServerNetworkMetrics{}
+	for _, row := range rows {
+		interfaces[row.Interface] = append(interfaces[row.Interface], row)
+	}
+
+	return c.JSON(fiber.Map{
+		"interfaces": interfaces,
+		"period":     period,
+		"from":       since,
+		"to":         until,
+		"count":      len(rows),
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+		"truncated":  int64(offset+len(rows)) < total,
+	})
+}
+
+// GetDisks returns every mount from the server's latest disk sample, fullest
+// first.
+func (h *ServerHandler) GetDisks(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	latest := h.db.Model(&models.ServerDiskMetrics{}).Select("metrics_id").
+		Where("server_id = ?", id).Order("collected_at DESC").Limit(1)
+	var disks []models.ServerDiskMetrics
+	if err := h.db.Where("metrics_id = (?)", latest).Order("used_percent DESC, mount ASC").Find(&disks).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to query disk metrics",
+		})
+	}
+	if len(disks) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "No disk metrics available",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"disks":        disks,
+		"count":        len(disks),
+		"collected_at": disks[0].CollectedAt,
+	})
+}
+
+// DiagnoseMetrics runs the metrics collection commands once against a server
+// and returns each command's raw output and parse result without storing a
+// sample. Admin only, since it exposes command output.
+func (h *ServerHandler) DiagnoseMetrics(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	password, privateKey, err := h.decryptCredentials(&server)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to decrypt credentials",
+		})
+	}
+
+	client, err := h.sshPool.GetConnection(&server, password, privateKey)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   true,
+			"message": "SSH connection failed: " + err.Error(),
+		})
+	}
+
+	probes := services.DiagnoseMetrics(client)
+	failed := 0
+	for _, p := range probes {
+		if p.CommandErr != "" || p.ParseErr != "" {
+			failed++
 		}
 	}
-	return password, privateKey, nil
+
+	return c.JSON(fiber.Map{
+		"server":     server.Name,
+		"probes":     probes,
+		"failed":     failed,
+		"checked_at": time.Now(),
+	})
+}
+
+// GetPool returns the pooled SSH connections to a server's host:port and
+// when each was last used.
+func (h *ServerHandler) GetPool(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	conns := h.sshPool.Stats(server.Host, server.Port)
+	return c.JSON(fiber.Map{
+		"server":      server.Name,
+		"count":       len(conns),
+		"connections": conns,
+	})
+}
+
+// ResetPool drops every pooled SSH connection to a server's host:port so the
+// next request dials fresh. Admin only.
+func (h *ServerHandler) ResetPool(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	dropped := h.sshPool.Evict(server.Host, server.Port)
+
+	auditAction(c, h.db, "server.pool_reset", server.ID.String(), map[string]interface{}{
+		"server":  server.Name,
+		"dropped": dropped,
+	}, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "SSH pool reset",
+		"server":  server.Name,
+		"dropped": dropped,
+	})
+}
+
+// jumpHost loads the jump server with the given ID for a connection test.
+func (h *ServerHandler) jumpHost(id *uuid.UUID) (*services.JumpHost, error) {
+	return services.LoadJumpHost(h.db, h.encryptor, id)
+}
+
+// keyErrorMessage explains why a private key could not be used, telling a
+// wrong or missing passphrase apart from a malformed key.
+func keyErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrWrongPassphrase):
+		return "Wrong passphrase for private key"
+	case errors.Is(err, services.ErrPassphraseRequired):
+		return "Private key is passphrase-protected; provide passphrase"
+	case errors.Is(err, services.ErrMalformedKey):
+		return "Malformed private key: " + err.Error()
+	}
+	return err.Error()
+}
+
+func (h *ServerHandler) decryptCredentials(server *models.Server) (password, privateKey string, err error) {
+	return services.DecryptServerCredentials(h.encryptor, server)
 }
 
 // GetDecryptedCredentials is used by other handlers that need SSH access
@@ -364,6 +1113,11 @@ func (h *ServerHandler) GetDecryptedCredentials(server *models.Server) (password
 	return h.decryptCredentials(server)
 }
 
+// GetEncryptor returns the credential encryptor
+func (h *ServerHandler) GetEncryptor() *crypto.Encryptor {
+	return h.encryptor
+}
+
 // GetSSHPool returns the SSH connection pool
 func (h *ServerHandler) GetSSHPool() *services.SSHPool {
 	return h.sshPool
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Caps on operator-supplied server notes and metadata.
+const (
+	maxServerNotes    = 64 << 10
+	maxServerMetadata = 16 << 10
+)
+
+// UpdateNotes replaces a server's notes and/or metadata. Metadata must be a
+// JSON object; either field may be omitted to leave it unchanged.
+func (h *ServerHandler) UpdateNotes(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	var req struct {
+		Notes    *string         `json:"notes"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+
+	if req.Notes != nil {
+		if len(*req.Notes) > maxServerNotes {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Notes exceed 64KB",
+			})
+		}
+		server.Notes = *req.Notes
+	}
+	if len(req.Metadata) > 0 {
+		if len(req.Metadata) > maxServerMetadata {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Metadata exceeds 16KB",
+			})
+		}
+		var obj map[string]interface{}
+		if string(req.Metadata) != "null" && json.Unmarshal(req.Metadata, &obj) != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Metadata must be a JSON object",
+			})
+		}
+		if obj == nil {
+			server.Metadata = nil
+		} else {
+			server.Metadata = datatypes.JSON(req.Metadata)
+		}
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Save(&server).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update notes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":       server.ID,
+		"notes":    server.Notes,
+		"metadata": server.Metadata,
+	})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxServerTags  = 32
+	maxServerLabel = 64 // tag and environment length
+)
+
+// serverLabelPattern is what tags and environments may contain once
+// lowercased.
+var serverLabelPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]*$`)
+
+// serverSortColumns maps the ?sort= values ListServers accepts to columns.
+var serverSortColumns = map[string]string{
+	"name":        "name",
+	"host":        "host",
+	"status":      "status",
+	"environment": "environment",
+	"created_at":  "created_at",
+}
+
+// normalizeServerLabel lowercases and trims a tag or environment and checks
+// it against serverLabelPattern. "" is returned as is.
+func normalizeServerLabel(label string) (string, error) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if label == "" {
+		return "", nil
+	}
+	if len(label) > maxServerLabel || !serverLabelPattern.MatchString(label) {
+		return "", fmt.Errorf("%q is not a valid label: use up to %d letters, digits, '_', '.', ':' or '-'", label, maxServerLabel)
+	}
+	return label, nil
+}
+
+// normalizeServerTags normalizes each tag, dropping empty ones and
+// duplicates. The result is never nil so it is stored as [] rather than null.
+func normalizeServerTags(tags []string) ([]string, error) {
+	if len(tags) > maxServerTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxServerTags)
+	}
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeServerLabel(tag)
+		if err != nil {
+			return nil, err
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out, nil
+}
+
+// whereServerTag narrows a servers query to those carrying tag.
+func whereServerTag(query *gorm.DB, tag string) *gorm.DB {
+	contains, _ := json.Marshal([]string{tag})
+	return query.Where("tags @> ?::jsonb", string(contains))
+}
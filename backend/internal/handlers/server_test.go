@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+)
+
+func TestConnectedUpdatesKeepsStoredFingerprint(t *testing.T) {
+	pinned := &models.Server{Fingerprint: "SHA256:old"}
+	if fp, ok := connectedUpdates(pinned, "SHA256:new")["fingerprint"]; ok {
+		t.Errorf("stored fingerprint overwritten with %v", fp)
+	}
+
+	unpinned := &models.Server{}
+	if fp := connectedUpdates(unpinned, "SHA256:new")["fingerprint"]; fp != "SHA256:new" {
+		t.Errorf("fingerprint = %v, want SHA256:new recorded on first use", fp)
+	}
+}
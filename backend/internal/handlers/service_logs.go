@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Bounds for ?lines= on the service log endpoints.
+const (
+	defaultJournalLines = 200
+	maxJournalLines     = 10000
+)
+
+var (
+	// journalRelativeSince matches "30m", "2h", "7d" and similar, meaning
+	// that long ago
+	journalRelativeSince = regexp.MustCompile(`^[0-9]{1,6}(s|m|min|h|d|w)$`)
+	// journalEntryPrefix matches short-iso output: timestamp, host, then the
+	// identifier with an optional [pid] before ": "
+	journalEntryPrefix = regexp.MustCompile(`^(\d\S*) (\S+) ([^\s:\[]+)(?:\[(\d+)\])?: `)
+)
+
+// journalSince turns ?since= into a journalctl --since value. It accepts a
+// Unix timestamp in seconds, a relative age such as 30m, 2h or 7d, or a
+// local date as 2006-01-02 with an optional 15:04 or 15:04:05 time. An empty
+// since is returned unchanged.
+func journalSince(since string) (string, bool) {
+	switch {
+	case since == "":
+		return "", true
+	case strings.Trim(since, "0123456789") == "" && len(since) <= 12:
+		return "@" + since, true
+	case journalRelativeSince.MatchString(since):
+		return "-" + since, true
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if _, err := time.Parse(layout, since); err == nil {
+			return since, true
+		}
+	}
+	return "", false
+}
+
+// journalctlCommand builds the journalctl command for a unit's log. unit
+// must already be validated.
+func journalctlCommand(unit string, lines int, since string, follow bool) string {
+	cmd := fmt.Sprintf("journalctl --no-pager --quiet --output=short-iso -u %s -n %d", unit, lines)
+	if since != "" {
+		cmd += " --since " + services.ShellQuote(since)
+	}
+	if follow {
+		cmd += " --follow"
+	}
+	return cmd
+}
+
+// ServiceLogs returns the last ?lines= journal lines of a systemd unit,
+// optionally only those after ?since=. With ?follow=true the request must be
+// a WebSocket upgrade and is passed on to StreamServiceLogs.
+func (h *ProcessHandler) ServiceLogs(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	name := c.Params("name")
+	if !sanitizeServiceName(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid service name characters",
+		})
+	}
+
+	lines, err := strconv.Atoi(c.Query("lines", strconv.Itoa(defaultJournalLines)))
+	if err != nil || lines < 1 || lines > maxJournalLines {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("lines must be a number from 1 to %d", maxJournalLines),
+		})
+	}
+
+	since, ok := journalSince(c.Query("since"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "since must be a Unix timestamp, an age such as 30m, 2h or 7d, or a date as YYYY-MM-DD [HH:MM[:SS]]",
+		})
+	}
+
+	follow := c.QueryBool("follow", false)
+	if follow && !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	if initSys := h.initSystem(serverID); initSys != initSystemd {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("Service logs need systemd's journal; this server uses %s", initSys),
+		})
+	}
+
+	cmd := journalctlCommand(name, lines, since, follow)
+	if follow {
+		c.Locals("journal_cmd", cmd)
+		return c.Next()
+	}
+
+	output, err := h.execSSH(serverID, cmd)
+	if err != nil {
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to read service logs: " + err.Error(),
+			"output":  output,
+		})
+	}
+
+	entries := parseJournalOutput(output)
+	return c.JSON(fiber.Map{
+		"name":    name,
+		"logs":    output,
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// StreamServiceLogs follows a unit's journal over a WebSocket, after
+// ServiceLogs has validated the request. Frames and stopping work as for
+// StreamContainerLogs.
+func (h *ProcessHandler) StreamServiceLogs() fiber.Handler {
+	return websocket.New(func(c *websocket.Conn) {
+		serverID, _ := uuid.Parse(c.Params("id"))
+		name := c.Params("name")
+		cmd, _ := c.Locals("journal_cmd").(string)
+
+		client, err := h.sshClient(serverID)
+		if err != nil {
+			c.WriteJSON(logStreamMessage{Type: "error", Data: err.Error()})
+			return
+		}
+		stream, err := startSessionCommand(client, cmd)
+		if err != nil {
+			c.WriteJSON(logStreamMessage{Type: "error", Data: err.Error()})
+			return
+		}
+		defer stream.Close()
+
+		slog.Info("Service log stream started", "server", serverID, "service", name)
+		reason := pumpLogStream(c, stream)
+		slog.Info("Service log stream ended", "server", serverID, "service", name, "reason", reason)
+	})
+}
+
+// parseJournalOutput parses `journalctl --output=short-iso` lines into
+// entries. Indented lines continue the previous entry's message; lines that
+// do not look like entries, such as "-- Boot ... --" markers and permission
+// hints, are kept as entries with only a message.
+func parseJournalOutput(output string) []fiber.Map {
+	entries := []fiber.Map{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(entries) > 0 {
+			last := entries[len(entries)-1]
+			last["message"] = last["message"].(string) + "\n" + strings.TrimSpace(line)
+			continue
+		}
+
+		m := journalEntryPrefix.FindStringSubmatch(line)
+		if m == nil {
+			entries = append(entries, fiber.Map{"message": line})
+			continue
+		}
+		entry := fiber.Map{
+			"timestamp":  m[1],
+			"host":       m[2],
+			"identifier": m[3],
+			"message":    line[len(m[0]):],
+		}
+		if pid, err := strconv.Atoi(m[4]); err == nil {
+			entry["pid"] = pid
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// serviceStatusSeparator splits `systemctl show` from `systemctl status`
+// output in the combined command GetServiceStatus runs.
+const serviceStatusSeparator = "--- bastion systemctl status ---"
+
+// serviceLogLines is how many journal lines systemctl status includes.
+const serviceLogLines = 20
+
+// GetServiceStatus returns the properties of one systemd unit from
+// `systemctl show`, with its state, main PID, memory and restart count
+// picked out, and the recent log lines from `systemctl status`. Only admins
+// see the properties that can carry credentials (see
+// sensitiveUnitProperty).
+func (h *ProcessHandler) GetServiceStatus(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	name := c.Params("name")
+	if !sanitizeServiceName(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid service name characters",
+		})
+	}
+
+	if initSys := h.initSystem(serverID); initSys != initSystemd {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("Service status detail needs systemd; this server uses %s", initSys),
+		})
+	}
+
+	// systemctl status exits non-zero for any unit that is not running
+	cmd := fmt.Sprintf("systemctl show --no-pager %[1]s && echo '%[2]s' && { systemctl status --no-pager --lines=%[3]d %[1]s 2>&1; true; }",
+		name, serviceStatusSeparator, serviceLogLines)
+	output, err := h.execSSH(serverID, cmd)
+	if err != nil {
+		return c.Status(execErrorStatus(err)).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to read service status: " + err.Error(),
+			"output":  output,
+		})
+	}
+
+	show, status, _ := strings.Cut(output, serviceStatusSeparator+"\n")
+	props := parseSystemctlShow(show)
+	if props["LoadState"] == "not-found" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "No such service: " + name,
+		})
+	}
+
+	resp := systemdUnitSummary(props)
+	resp["name"] = name
+	resp["logs"] = parseServiceStatusLogs(status)
+	if role, _ := c.Locals("role").(string); role != "admin" {
+		for key := range props {
+			if sensitiveUnitProperty(key) {
+				delete(props, key)
+			}
+		}
+	}
+	resp["properties"] = props
+	return c.JSON(resp)
+}
+
+// sensitiveUnitProperty reports whether a `systemctl show` property can
+// carry credentials: the environment, credentials and every Exec* command
+// line.
+func sensitiveUnitProperty(key string) bool {
+	switch key {
+	case "Environment", "EnvironmentFiles", "UnsetEnvironment",
+		"SetCredential", "SetCredentialEncrypted", "LoadCredential", "LoadCredentialEncrypted", "ImportCredential":
+		return true
+	}
+	return strings.HasPrefix(key, "Exec")
+}
+
+// parseSystemctlShow parses `systemctl show` KEY=VALUE lines. Values keep
+// any further '=' characters.
+func parseSystemctlShow(output string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), "=")
+		if !ok || key == "" {
+			continue
+		}
+		props[key] = value
+	}
+	return props
+}
+
+// systemdUnitSummary picks the commonly needed fields out of a unit's
+// properties. main_pid, memory and restarts are null when systemd does not
+// report them.
+func systemdUnitSummary(props map[string]string) fiber.Map {
+	summary := fiber.Map{
+		"description":     props["Description"],
+		"load_state":      props["LoadState"],
+		"active_state":    props["ActiveState"],
+		"sub_state":       props["SubState"],
+		"unit_file_state": props["UnitFileState"],
+		"active_since":    props["ActiveEnterTimestamp"],
+		"main_pid":        nil,
+		"memory":          nil,
+		"restarts":        nil,
+	}
+	// MainPID is 0 when the unit has no running main process
+	if pid, err := strconv.Atoi(props["MainPID"]); err == nil && pid > 0 {
+		summary["main_pid"] = pid
+	}
+	// MemoryCurrent is "[not set]" or the max uint64 without memory accounting
+	if mem, err := strconv.ParseUint(props["MemoryCurrent"], 10, 64); err == nil && mem != ^uint64(0) {
+		summary["memory"] = mem
+	}
+	if n, err := strconv.Atoi(props["NRestarts"]); err == nil {
+		summary["restarts"] = n
+	}
+	return summary
+}
+
+// parseServiceStatusLogs returns the journal lines systemctl status prints
+// after the blank line that ends its status block.
+func parseServiceStatusLogs(output string) []string {
+	logs := []string{}
+	_, tail, ok := strings.Cut(output, "\n\n")
+	if !ok {
+		return logs
+	}
+	for _, line := range strings.Split(tail, "\n") {
+		if line = strings.TrimRight(line, " \r"); line != "" {
+			logs = append(logs, line)
+		}
+	}
+	return logs
+}
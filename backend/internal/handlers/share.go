@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/middleware"
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Share link lifetimes.
+const (
+	defaultShareTTL = 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+// shareHistoryPoints is how many recent metrics samples a share link shows.
+const shareHistoryPoints = 60
+
+// ShareHandler mints and serves signed, read-only status links for a single
+// server. Shared views never include host, credentials or command output.
+type ShareHandler struct {
+	db     *gorm.DB
+	tokens middleware.TokenSettings
+}
+
+func NewShareHandler(serverHandler *ServerHandler, tokens middleware.TokenSettings) *ShareHandler {
+	return &ShareHandler{db: serverHandler.GetDB(), tokens: tokens}
+}
+
+// CreateShare mints a share token for a server. expires_in is a Go
+// duration (default 24h, max 720h).
+func (h *ShareHandler) CreateShare(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var req struct {
+		Label     string `json:"label"`
+		ExpiresIn string `json:"expires_in"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid request body",
+			})
+		}
+	}
+
+	ttl := defaultShareTTL
+	if req.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 || ttl > maxShareTTL {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "expires_in must be a positive duration up to 720h",
+			})
+		}
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", serverID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Server not found",
+		})
+	}
+
+	username, _ := c.Locals("username").(string)
+	share := models.ServerShare{
+		ID:        uuid.New(),
+		ServerID:  server.ID,
+		Label:     req.Label,
+		CreatedBy: username,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	token, err := middleware.GenerateShareToken(h.tokens, share.ID.String(), server.ID.String(), share.ExpiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to sign share token",
+		})
+	}
+	if err := h.db.WithContext(c.UserContext()).Create(&share).Error; err != nil {
+		slog.Error("Failed to create server share", "server", server.Name, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create share",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"share": share,
+		"token": token,
+		"path":  "/api/share/" + token,
+	})
+}
+
+// ListShares returns the share links minted for a server, newest first.
+func (h *ShareHandler) ListShares(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var shares []models.ServerShare
+	h.db.Where("server_id = ?", serverID).Order("created_at DESC").Find(&shares)
+
+	return c.JSON(fiber.Map{"shares": shares})
+}
+
+// RevokeShare invalidates a share link before it expires.
+func (h *ShareHandler) RevokeShare(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	var share models.ServerShare
+	if err := h.db.First(&share, "id = ? AND server_id = ?", c.Params("shareId"), serverID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Share not found",
+		})
+	}
+
+	if share.RevokedAt == nil {
+		now := time.Now()
+		if err := h.db.WithContext(c.UserContext()).Model(&share).Update("revoked_at", now).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to revoke share",
+			})
+		}
+		share.RevokedAt = &now
+	}
+
+	return c.JSON(fiber.Map{"message": "Share revoked", "share": share})
+}
+
+// PublicStatus serves the shared view of a server to anyone holding a
+// valid, unrevoked share token.
+func (h *ShareHandler) PublicStatus(c *fiber.Ctx) error {
+	invalid := func() error {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Share link is invalid, expired or revoked",
+		})
+	}
+
+	shareID, serverID, err := middleware.ParseShareToken(h.tokens, c.Params("token"))
+	if err != nil {
+		return invalid()
+	}
+
+	var share models.ServerShare
+	if err := h.db.First(&share, "id = ? AND server_id = ?", shareID, serverID).Error; err != nil {
+		return invalid()
+	}
+	if share.RevokedAt != nil || time.Now().After(share.ExpiresAt) {
+		return invalid()
+	}
+
+	var server models.Server
+	if err := h.db.First(&server, "id = ?", share.ServerID).Error; err != nil {
+		return invalid()
+	}
+
+	type sample struct {
+		CPUPercent       float64   `json:"cpu_percent"`
+		MemoryPercent    float64   `json:"memory_percent"`
+		DiskPercent      float64   `json:"disk_percent"`
+		LoadAvg1m        float64   `json:"load_avg_1m"`
+		ContainerCount   int       `json:"container_count"`
+		ContainerRunning int       `json:"container_running"`
+		UptimeSeconds    int64     `json:"uptime_seconds"`
+		CollectedAt      time.Time `json:"collected_at"`
+	}
+	var rows []models.ServerMetrics
+	h.db.Where("server_id = ?", server.ID).Order("collected_at DESC").Limit(shareHistoryPoints).Find(&rows)
+
+	history := make([]sample, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		m := rows[i]
+		history = append(history, sample{
+			CPUPercent:       m.CPUPercent,
+			MemoryPercent:    safePercent(m.MemoryUsedMB, m.MemoryTotalMB),
+			DiskPercent:      safePercent(m.DiskUsedGB, m.DiskTotalGB),
+			LoadAvg1m:        m.LoadAvg1m,
+			ContainerCount:   m.ContainerCount,
+			ContainerRunning: m.ContainerRunning,
+			UptimeSeconds:    m.UptimeSeconds,
+			CollectedAt:      m.CollectedAt,
+		})
+	}
+
+	var latest *sample
+	if len(history) > 0 {
+		latest = &history[len(history)-1]
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{
+		"server": fiber.Map{
+			"name":              server.Name,
+			"status":            server.Status,
+			"last_connected_at": server.LastConnectedAt,
+		},
+		"latest":     latest,
+		"history":    history,
+		"label":      share.Label,
+		"expires_at": share.ExpiresAt,
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// streamableEvents are the event types a dashboard client may subscribe to.
+var streamableEvents = map[string]bool{
+	services.EventMetrics:      true,
+	services.EventServerStatus: true,
+	services.EventMonitorState: true,
+	services.EventAlert:        true,
+}
+
+type StreamHandler struct {
+	events *services.EventBus
+}
+
+func NewStreamHandler(events *services.EventBus) *StreamHandler {
+	return &StreamHandler{events: events}
+}
+
+// UpgradeCheck is middleware that checks if the request is a websocket upgrade
+func (h *StreamHandler) UpgradeCheck() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if websocket.IsWebSocketUpgrade(c) {
+			return c.Next()
+		}
+		return fiber.ErrUpgradeRequired
+	}
+}
+
+// HandleDashboard multiplexes live events over a single WebSocket.
+// Clients send {"action":"subscribe"|"unsubscribe","types":[...]} to choose
+// which event types they receive; nothing is sent until they subscribe.
+func (h *StreamHandler) HandleDashboard() fiber.Handler {
+	return websocket.New(func(c *websocket.Conn) {
+		events, unsubscribe := h.events.Subscribe(64)
+		defer unsubscribe()
+
+		var mu sync.Mutex
+		subscribed := make(map[string]bool)
+		replies := make(chan fiber.Map, 8)
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		defer close(stopped)
+
+		reply := func(m fiber.Map) bool {
+			select {
+			case replies <- m:
+				return true
+			case <-stopped:
+				return false
+			}
+		}
+
+		// Client → subscription changes
+		go func() {
+			defer close(done)
+			for {
+				_, msg, err := c.ReadMessage()
+				if err != nil {
+					return
+				}
+
+				var req struct {
+					Action string   `json:"action"`
+					Types  []string `json:"types"`
+				}
+				if json.Unmarshal(msg, &req) != nil {
+					if !reply(fiber.Map{"type": "error", "data": "Invalid message"}) {
+						return
+					}
+					continue
+				}
+
+				mu.Lock()
+				for _, t := range req.Types {
+					if !streamableEvents[t] {
+						continue
+					}
+					switch req.Action {
+					case "subscribe":
+						subscribed[t] = true
+					case "unsubscribe":
+						delete(subscribed, t)
+					}
+				}
+				current := make([]string, 0, len(subscribed))
+				for t := range subscribed {
+					current = append(current, t)
+				}
+				mu.Unlock()
+
+				if !reply(fiber.Map{"type": "subscriptions", "data": current}) {
+					return
+				}
+			}
+		}()
+
+		// Events → client (single writer)
+		for {
+			select {
+			case <-done:
+				return
+			case msg := <-replies:
+				if c.WriteJSON(msg) != nil {
+					return
+				}
+			case evt, ok := <-events:
+				if !ok {
+					return
+				}
+				mu.Lock()
+				wanted := subscribed[evt.Type]
+				mu.Unlock()
+				if !wanted {
+					continue
+				}
+				if c.WriteJSON(evt) != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// HandleServerMetrics streams one server's metrics over a WebSocket: each
+// ServerMetrics row is sent as a "metrics" event as soon as the collector
+// stores it, so charts update without polling /metrics/live. Any number of
+// clients may watch the same server; each is unsubscribed on disconnect.
+func (h *StreamHandler) HandleServerMetrics() fiber.Handler {
+	return websocket.New(func(c *websocket.Conn) {
+		serverID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			c.WriteJSON(fiber.Map{"type": "error", "data": "Invalid server ID"})
+			return
+		}
+
+		events, unsubscribe := h.events.Subscribe(16)
+		defer unsubscribe()
+
+		// The client sends nothing but control frames; reading is how a
+		// disconnect is noticed while no metrics arrive
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				if _, _, err := c.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case <-done:
+				return
+			case evt, ok := <-events:
+				if !ok {
+					return
+				}
+				if evt.Type != services.EventMetrics {
+					continue
+				}
+				if m, ok := evt.Data.(models.ServerMetrics); !ok || m.ServerID != serverID {
+					continue
+				}
+				if c.WriteJSON(evt) != nil {
+					return
+				}
+			}
+		}
+	})
+}
@@ -2,8 +2,6 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"time"
@@ -20,15 +18,21 @@ type SystemHandler struct {
 	db     *gorm.DB
 	cfg    *config.Config
 	client *http.Client
+
+	overviewCache *ttlCache[fiber.Map]
+	statusCache   *ttlCache[fiber.Map]
 }
 
 func NewSystemHandler(db *gorm.DB, cfg *config.Config) *SystemHandler {
+	ttl := time.Duration(cfg.DashboardCacheTTL) * time.Second
 	return &SystemHandler{
 		db:  db,
 		cfg: cfg,
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		overviewCache: &ttlCache[fiber.Map]{ttl: ttl},
+		statusCache:   &ttlCache[fiber.Map]{ttl: ttl},
 	}
 }
 
@@ -77,7 +81,19 @@ func (h *SystemHandler) Info(c *fiber.Ctx) error {
 	})
 }
 
+// DashboardOverview returns the dashboard counts. ?refresh=true rebuilds
+// them, re-fetching the Coolify app list too.
 func (h *SystemHandler) DashboardOverview(c *fiber.Ctx) error {
+	if c.QueryBool("refresh", false) {
+		coolifyAppsCache.Invalidate()
+		h.overviewCache.Invalidate()
+	}
+	overview, hit, _ := h.overviewCache.Get(dashboardPayload(h.buildOverview))
+	setCacheHeader(c, hit)
+	return c.JSON(overview)
+}
+
+func (h *SystemHandler) buildOverview() fiber.Map {
 	// ─── Server counts ──────────────────────────────────────────────────
 	var serverTotal, serverOnline, serverOffline int64
 	h.db.Table("servers").Where("deleted_at IS NULL").Count(&serverTotal)
@@ -106,7 +122,7 @@ func (h *SystemHandler) DashboardOverview(c *fiber.Ctx) error {
 	}
 
 	// ─── Build response ─────────────────────────────────────────────────
-	return c.JSON(fiber.Map{
+	return fiber.Map{
 		"servers": fiber.Map{
 			"total":   serverTotal,
 			"online":  serverOnline,
@@ -126,11 +142,17 @@ func (h *SystemHandler) DashboardOverview(c *fiber.Ctx) error {
 			"apps": coolifyApps,
 		},
 		"uptime_seconds": int64(time.Since(startTime).Seconds()),
-	})
+	}
 }
 
 // StatusPage returns an aggregated status overview of servers and monitors.
 func (h *SystemHandler) StatusPage(c *fiber.Ctx) error {
+	status, hit, _ := h.statusCache.Get(dashboardPayload(h.buildStatusPage))
+	setCacheHeader(c, hit)
+	return c.JSON(status)
+}
+
+func (h *SystemHandler) buildStatusPage() fiber.Map {
 	// Server statuses
 	type ServerStatus struct {
 		ID     string `json:"id"`
@@ -180,36 +202,22 @@ func (h *SystemHandler) StatusPage(c *fiber.Ctx) error {
 	var activeAlerts int64
 	h.db.Table("alerts").Where("status = ?", "firing").Count(&activeAlerts)
 
-	return c.JSON(fiber.Map{
+	return fiber.Map{
 		"status":        overall,
 		"servers":       servers,
 		"monitors":      monitors,
 		"active_alerts": activeAlerts,
-	})
+	}
 }
 
-// fetchCoolifyAppCount calls the Coolify API to count deployed applications.
+// fetchCoolifyAppCount counts deployed Coolify applications from the shared
+// application list cache.
 func (h *SystemHandler) fetchCoolifyAppCount() int {
-	url := fmt.Sprintf("%s/api/v1/applications", h.cfg.CoolifyAPIURL)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		slog.Warn("Coolify request build failed", "error", err)
-		return 0
-	}
-	req.Header.Set("Authorization", h.cfg.CoolifyAPIToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := h.client.Do(req)
+	body, _, err := coolifyAppsCache.Get(fetchCoolifyApps(h.client, h.cfg))
 	if err != nil {
 		slog.Warn("Coolify API unreachable for dashboard", "error", err)
 		return 0
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0
-	}
 
 	var apps []json.RawMessage
 	if err := json.Unmarshal(body, &apps); err != nil {
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// dashboardTables are the tables the overview and status page are built
+// from; any write to them drops both cached payloads.
+var dashboardTables = map[string]bool{
+	"servers":           true,
+	"cron_jobs":         true,
+	"command_histories": true,
+	"ai_conversations":  true,
+	"monitors":          true,
+	"alerts":            true,
+}
+
+// dashboardPayload adapts a dashboard payload builder, which cannot fail,
+// to a ttlCache fetch. The overview and status page are cached for
+// DASHBOARD_CACHE_TTL so rapid polling does not re-run every count query.
+func dashboardPayload(build func() fiber.Map) func() (fiber.Map, error) {
+	return func() (fiber.Map, error) {
+		return build(), nil
+	}
+}
+
+// RegisterCacheHooks installs GORM callbacks that invalidate the dashboard
+// caches whenever a dashboard table is written.
+func (h *SystemHandler) RegisterCacheHooks(db *gorm.DB) error {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.RowsAffected == 0 || !dashboardTables[tx.Statement.Table] {
+			return
+		}
+		h.overviewCache.Invalidate()
+		h.statusCache.Invalidate()
+	}
+
+	if err := db.Callback().Create().After("gorm:create").Register("dashboard_cache:create", invalidate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("dashboard_cache:update", invalidate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("dashboard_cache:delete", invalidate)
+}
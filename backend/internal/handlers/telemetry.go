@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"log/slog"
+	"strings"
+
+	"github.com/ahmetk3436/bastion/internal/config"
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type TelemetryHandler struct {
+	db    *gorm.DB
+	token string
+}
+
+// NewTelemetryHandler serves services.DefaultTelemetry and registers the
+// gauges read from the database at scrape time.
+func NewTelemetryHandler(db *gorm.DB, cfg *config.Config) *TelemetryHandler {
+	h := &TelemetryHandler{db: db, token: cfg.MetricsToken}
+	services.DefaultTelemetry.GaugeFunc("bastion_monitors",
+		"Enabled monitors by last status.", []string{"status"}, h.monitorSamples)
+	services.DefaultTelemetry.GaugeFunc("bastion_alerts_firing",
+		"Firing alerts by severity.", []string{"severity"}, h.alertSamples)
+	return h
+}
+
+// Metrics renders Bastion's own metrics in the Prometheus text format. When
+// METRICS_TOKEN is set the scraper must send it as a bearer token.
+func (h *TelemetryHandler) Metrics(c *fiber.Ctx) error {
+	if h.token != "" {
+		token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid metrics token",
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := services.DefaultTelemetry.Write(&buf); err != nil {
+		slog.Error("Failed to render metrics", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to render metrics",
+		})
+	}
+	c.Set(fiber.HeaderContentType, services.TelemetryContentType)
+	return c.Send(buf.Bytes())
+}
+
+// monitorSamples counts enabled monitors by last status (up, down, unknown).
+func (h *TelemetryHandler) monitorSamples() []services.TelemetrySample {
+	return h.countBy(&models.Monitor{}, "last_status", "enabled = ?", true)
+}
+
+// alertSamples counts firing alerts by severity.
+func (h *TelemetryHandler) alertSamples() []services.TelemetrySample {
+	return h.countBy(&models.Alert{}, "severity", "status = ?", "firing")
+}
+
+func (h *TelemetryHandler) countBy(model interface{}, column string, where string, args ...interface{}) []services.TelemetrySample {
+	var rows []struct {
+		Label string
+		Count int64
+	}
+	if err := h.db.Model(model).
+		Select(column+" AS label, COUNT(*) AS count").
+		Where(where, args...).
+		Group(column).
+		Scan(&rows).Error; err != nil {
+		slog.Warn("Failed to read metrics gauge", "column", column, "error", err)
+		return nil
+	}
+
+	samples := make([]services.TelemetrySample, 0, len(rows))
+	for _, r := range rows {
+		samples = append(samples, services.TelemetrySample{Labels: []string{r.Label}, Value: float64(r.Count)})
+	}
+	return samples
+}
@@ -2,22 +2,61 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/ahmetk3436/bastion/internal/config"
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/ssh"
 )
 
+// Why a terminal session ended, stored as SSHSession.EndReason.
+const (
+	sessionEndClosed      = "closed" // the shell exited or the client left
+	sessionEndIdleTimeout = "idle_timeout"
+	sessionEndMaxDuration = "max_duration"
+)
+
 type TerminalHandler struct {
 	serverHandler *ServerHandler
+
+	recordAll      bool // record every session, not only record_terminal servers
+	recordMaxBytes int
+
+	// Sessions close after idleTimeout without input or maxDuration in
+	// total; 0 disables either.
+	idleTimeout time.Duration
+	maxDuration time.Duration
 }
 
-func NewTerminalHandler(serverHandler *ServerHandler) *TerminalHandler {
-	return &TerminalHandler{serverHandler: serverHandler}
+func NewTerminalHandler(serverHandler *ServerHandler, cfg *config.Config) *TerminalHandler {
+	return &TerminalHandler{
+		serverHandler:  serverHandler,
+		recordAll:      cfg.TerminalRecording,
+		recordMaxBytes: cfg.TerminalRecordingMaxMB * 1024 * 1024,
+		idleTimeout:    cfg.TerminalIdleTimeout,
+		maxDuration:    cfg.TerminalMaxDuration,
+	}
+}
+
+// lowerLimit returns limit, or the ?key= value in seconds when the client
+// asks for a shorter one. A client cannot raise or disable a limit.
+func lowerLimit(c *websocket.Conn, key string, limit time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(c.Query(key))
+	if err != nil || seconds <= 0 {
+		return limit
+	}
+	if d := time.Duration(seconds) * time.Second; limit == 0 || d < limit {
+		return d
+	}
+	return limit
 }
 
 // UpgradeCheck is middleware that checks if the request is a websocket upgrade
@@ -30,7 +69,10 @@ func (h *TerminalHandler) UpgradeCheck() fiber.Handler {
 	}
 }
 
-// HandleTerminal handles WebSocket terminal sessions
+// HandleTerminal handles WebSocket terminal sessions. The session is closed,
+// with a notice to the client, after the idle timeout passes without any
+// inbound message or the max duration is reached; ?idle_timeout= and
+// ?max_duration= (seconds) may shorten either.
 func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 	return websocket.New(func(c *websocket.Conn) {
 		serverID, err := uuid.Parse(c.Params("id"))
@@ -54,7 +96,7 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 		}
 
 		pool := h.serverHandler.GetSSHPool()
-		client, err := pool.GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+		client, err := pool.GetConnection(&server, password, privateKey)
 		if err != nil {
 			c.WriteMessage(websocket.TextMessage, []byte("Error: SSH connection failed: "+err.Error()))
 			return
@@ -68,9 +110,11 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 		defer session.Close()
 
 		// Record session
+		actor, _ := c.Locals("username").(string)
 		sshSession := models.SSHSession{
 			ServerID:  serverID,
 			StartedAt: time.Now(),
+			Actor:     actor,
 		}
 		db.Create(&sshSession)
 
@@ -89,6 +133,11 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 			return
 		}
 
+		var recorder *services.CastRecorder
+		if h.recordAll || server.RecordTerminal {
+			recorder = services.NewCastRecorder(cols, rows, "xterm-256color", h.recordMaxBytes)
+		}
+
 		// Get stdin/stdout pipes
 		stdin, err := session.StdinPipe()
 		if err != nil {
@@ -119,6 +168,15 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 		var commandsExecuted int
 
 		done := make(chan struct{})
+		activity := make(chan struct{}, 1)
+
+		// The websocket allows one writer at a time
+		var writeMu sync.Mutex
+		send := func(b []byte) {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			c.WriteMessage(websocket.TextMessage, b)
+		}
 
 		// stdout → WebSocket
 		go func() {
@@ -131,7 +189,10 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 				}
 				if n > 0 {
 					bytesTransferred += int64(n)
-					c.WriteMessage(websocket.TextMessage, buf[:n])
+					send(buf[:n])
+					if recorder != nil {
+						recorder.Output(buf[:n])
+					}
 				}
 			}
 		}()
@@ -146,7 +207,10 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 				}
 				if n > 0 {
 					bytesTransferred += int64(n)
-					c.WriteMessage(websocket.TextMessage, buf[:n])
+					send(buf[:n])
+					if recorder != nil {
+						recorder.Output(buf[:n])
+					}
 				}
 			}
 		}()
@@ -159,6 +223,10 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 					session.Close()
 					return
 				}
+				select {
+				case activity <- struct{}{}:
+				default:
+				}
 
 				switch msgType {
 				case websocket.TextMessage:
@@ -170,6 +238,9 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 					}
 					if json.Unmarshal(msg, &ctrl) == nil && ctrl.Type == "resize" {
 						session.WindowChange(ctrl.Rows, ctrl.Cols)
+						if recorder != nil {
+							recorder.Resize(ctrl.Cols, ctrl.Rows)
+						}
 						continue
 					}
 					// Regular text input
@@ -185,8 +256,47 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 		}()
 
 		// Wait for session to end
-		select {
-		case <-done:
+		idleTimeout := lowerLimit(c, "idle_timeout", h.idleTimeout)
+		maxDuration := lowerLimit(c, "max_duration", h.maxDuration)
+		var idle, deadline <-chan time.Time
+		var idleTimer *time.Timer
+		if idleTimeout > 0 {
+			idleTimer = time.NewTimer(idleTimeout)
+			defer idleTimer.Stop()
+			idle = idleTimer.C
+		}
+		if maxDuration > 0 {
+			deadlineTimer := time.NewTimer(maxDuration)
+			defer deadlineTimer.Stop()
+			deadline = deadlineTimer.C
+		}
+
+		endReason := sessionEndClosed
+	wait:
+		for {
+			select {
+			case <-done:
+				break wait
+			case <-activity:
+				if idleTimer != nil {
+					idleTimer.Reset(idleTimeout)
+				}
+			case <-idle:
+				endReason = sessionEndIdleTimeout
+				send([]byte(fmt.Sprintf("\r\n[bastion] Session closed after %s without input.\r\n", idleTimeout)))
+				break wait
+			case <-deadline:
+				endReason = sessionEndMaxDuration
+				send([]byte(fmt.Sprintf("\r\n[bastion] Session closed after reaching the %s limit.\r\n", maxDuration)))
+				break wait
+			}
+		}
+		if endReason != sessionEndClosed {
+			session.Close()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+			}
 		}
 
 		// Update session record
@@ -197,11 +307,16 @@ func (h *TerminalHandler) HandleTerminal() fiber.Handler {
 			"duration_seconds":  duration,
 			"commands_executed": commandsExecuted,
 			"bytes_transferred": bytesTransferred,
+			"end_reason":        endReason,
 		})
 
+		if recorder != nil {
+			h.saveRecording(&sshSession, cols, rows, recorder)
+		}
+
 		// Update server last connected
 		db.Model(&server).Update("last_connected_at", now)
 
-		slog.Info("Terminal session ended", "server", server.Name, "duration", duration)
+		slog.Info("Terminal session ended", "server", server.Name, "duration", duration, "reason", endReason)
 	})
 }
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/ahmetk3436/bastion/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// saveRecording stores a finished session's cast and marks the session as
+// recorded. Failures are logged; the session itself is already over.
+func (h *TerminalHandler) saveRecording(session *models.SSHSession, cols, rows int, recorder *services.CastRecorder) {
+	cast := recorder.Bytes()
+	recording := models.TerminalRecording{
+		SessionID: session.ID,
+		Width:     cols,
+		Height:    rows,
+		Events:    recorder.Events(),
+		Size:      len(cast),
+		Truncated: recorder.Truncated(),
+		Cast:      cast,
+	}
+
+	db := h.serverHandler.GetDB()
+	if err := db.Create(&recording).Error; err != nil {
+		slog.Error("Failed to save terminal recording", "session", session.ID, "error", err)
+		return
+	}
+	db.Model(session).Update("recorded", true)
+}
+
+// ListSessions returns a server's terminal sessions, newest first.
+func (h *TerminalHandler) ListSessions(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid server ID",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	perPage, _ := strconv.Atoi(c.Query("per_page", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 50
+	}
+
+	db := h.serverHandler.GetDB()
+	var total int64
+	db.Model(&models.SSHSession{}).Where("server_id = ?", serverID).Count(&total)
+
+	var sessions []models.SSHSession
+	db.Where("server_id = ?", serverID).
+		Order("started_at DESC").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&sessions)
+
+	return c.JSON(fiber.Map{
+		"sessions": sessions,
+		"total":    total,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+// GetRecording downloads a session's asciicast v2 recording, playable with
+// `asciinema play` or asciinema-player.
+func (h *TerminalHandler) GetRecording(c *fiber.Ctx) error {
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid session ID",
+		})
+	}
+
+	var recording models.TerminalRecording
+	if err := h.serverHandler.GetDB().First(&recording, "session_id = ?", sessionID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "No recording for this session",
+		})
+	}
+
+	auditAction(c, h.serverHandler.GetDB(), "terminal.recording.view", sessionID.String(), map[string]interface{}{
+		"size": recording.Size,
+	}, nil)
+
+	c.Set(fiber.HeaderContentType, services.CastContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="session-%s.cast"`, sessionID))
+	return c.Send(recording.Cast)
+}
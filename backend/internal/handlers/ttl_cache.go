@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ttlCache holds one fetched value for a fixed TTL, typically an upstream
+// API response. A zero TTL disables it. Concurrent callers that find it
+// stale share a single fetch instead of each calling upstream.
+type ttlCache[T any] struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	value     T
+	valid     bool
+	fetchedAt time.Time
+	gen       int          // bumped by Invalidate so in-flight fetches are not stored
+	inflight  *ttlFetch[T] // the fetch callers are waiting on, if any
+}
+
+// errTTLFetchPanicked is returned to callers that waited on a fetch that
+// panicked.
+var errTTLFetchPanicked = errors.New("cache fetch panicked")
+
+// ttlFetch is one in-progress fetch and, once done is closed, its result.
+type ttlFetch[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Get returns the cached value while it is fresh (hit is true), and
+// otherwise calls fetch. A failed fetch is not cached: its callers get its
+// error along with whatever value it returned.
+func (c *ttlCache[T]) Get(fetch func() (T, error)) (value T, hit bool, err error) {
+	c.mu.Lock()
+	if c.valid && time.Since(c.fetchedAt) < c.ttl {
+		value = c.value
+		c.mu.Unlock()
+		return value, true, nil
+	}
+	if call := c.inflight; call != nil {
+		c.mu.Unlock()
+		<-call.done
+		return call.value, false, call.err
+	}
+	call := &ttlFetch[T]{done: make(chan struct{})}
+	c.inflight = call
+	gen := c.gen
+	c.mu.Unlock()
+
+	// Deferred so a panicking fetch still releases its waiters and the
+	// next Get starts a new fetch instead of waiting forever
+	completed := false
+	defer func() {
+		if !completed {
+			call.err = errTTLFetchPanicked
+		}
+		c.mu.Lock()
+		if call.err == nil && gen == c.gen && c.ttl > 0 {
+			c.value, c.valid, c.fetchedAt = call.value, true, time.Now()
+		}
+		if c.inflight == call {
+			c.inflight = nil
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = fetch()
+	completed = true
+	return call.value, false, call.err
+}
+
+// Invalidate drops the cached value so the next Get fetches fresh data.
+func (c *ttlCache[T]) Invalidate() {
+	c.mu.Lock()
+	var zero T
+	c.value, c.valid = zero, false
+	c.gen++
+	c.mu.Unlock()
+}
+
+// setCacheHeader reports on a response whether it was served from a cache.
+func setCacheHeader(c *fiber.Ctx, hit bool) {
+	if hit {
+		c.Set("X-Cache", "HIT")
+	} else {
+		c.Set("X-Cache", "MISS")
+	}
+}
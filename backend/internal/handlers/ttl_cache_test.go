@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// countingUpstream serves body on every path and counts requests per path.
+func countingUpstream(t *testing.T, status int, body string) (*httptest.Server, func(path string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[path]
+	}
+}
+
+func getCached(t *testing.T, app *fiber.App, url string) (int, string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header.Get("X-Cache")
+}
+
+func TestCoolifyAppsCachedWithinTTL(t *testing.T) {
+	coolifyAppsCache.Invalidate()
+	t.Cleanup(coolifyAppsCache.Invalidate)
+
+	srv, hits := countingUpstream(t, http.StatusOK, `[{"uuid":"a"},{"uuid":"b"}]`)
+	cfg := &config.Config{CoolifyAPIURL: srv.URL, CoolifyAPIToken: "token"}
+	h := &CoolifyHandler{cfg: cfg, client: srv.Client()}
+	app := fiber.New()
+	app.Get("/coolify/apps", h.ListApps)
+
+	const path = "/api/v1/applications"
+	if status, cache := getCached(t, app, "/coolify/apps"); status != 200 || cache != "MISS" || hits(path) != 1 {
+		t.Fatalf("first call = %d %s with %d upstream hits, want a MISS that hits Coolify", status, cache, hits(path))
+	}
+	if status, cache := getCached(t, app, "/coolify/apps"); status != 200 || cache != "HIT" || hits(path) != 1 {
+		t.Errorf("second call = %d %s with %d upstream hits, want a HIT within the TTL", status, cache, hits(path))
+	}
+
+	// The dashboard count shares the cached list
+	system := &SystemHandler{cfg: cfg, client: srv.Client()}
+	if n := system.fetchCoolifyAppCount(); n != 2 || hits(path) != 1 {
+		t.Errorf("dashboard app count = %d with %d upstream hits, want 2 from the cache", n, hits(path))
+	}
+
+	if _, cache := getCached(t, app, "/coolify/apps?refresh=true"); cache != "MISS" || hits(path) != 2 {
+		t.Errorf("refresh = %s with %d upstream hits, want Coolify fetched again", cache, hits(path))
+	}
+}
+
+func TestCoolifyAppsErrorsNotCached(t *testing.T) {
+	coolifyAppsCache.Invalidate()
+	t.Cleanup(coolifyAppsCache.Invalidate)
+
+	srv, hits := countingUpstream(t, http.StatusUnauthorized, `{"message":"Unauthenticated."}`)
+	h := &CoolifyHandler{cfg: &config.Config{CoolifyAPIURL: srv.URL}, client: srv.Client()}
+	app := fiber.New()
+	app.Get("/coolify/apps", h.ListApps)
+
+	for i := 1; i <= 2; i++ {
+		if status, _ := getCached(t, app, "/coolify/apps"); status != http.StatusUnauthorized {
+			t.Errorf("call %d = %d, want Coolify's 401 passed through", i, status)
+		}
+	}
+	if n := hits("/api/v1/applications"); n != 2 {
+		t.Errorf("upstream hits = %d, want the failed response not cached", n)
+	}
+}
+
+func TestOpsOverviewCachedWithinTTL(t *testing.T) {
+	srv, hits := countingUpstream(t, http.StatusOK, `{"total":3}`)
+	h := NewOpsHandler(&config.Config{OpsBackendURL: srv.URL})
+	app := fiber.New()
+	app.Get("/ops/overview", h.Overview)
+
+	const path = "/api/ops/sre/stats"
+	getCached(t, app, "/ops/overview")
+	if _, cache := getCached(t, app, "/ops/overview"); cache != "HIT" || hits(path) != 1 || hits("/api/ops/reviews/stats") != 1 {
+		t.Errorf("second call = %s with %d upstream hits, want a HIT within the TTL", cache, hits(path))
+	}
+	if _, cache := getCached(t, app, "/ops/overview?refresh=true"); cache != "MISS" || hits(path) != 2 {
+		t.Errorf("refresh = %s with %d upstream hits, want the ops backend fetched again", cache, hits(path))
+	}
+}
+
+func TestTTLCacheSharesConcurrentFetch(t *testing.T) {
+	cache := &ttlCache[string]{ttl: time.Minute}
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (string, error) {
+		fetches.Add(1)
+		<-release
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, _, err := cache.Get(fetch); v != "value" || err != nil {
+				t.Errorf("Get = %q, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want concurrent callers to share one", n)
+	}
+
+	// Disabled with a zero TTL
+	disabled := &ttlCache[string]{}
+	disabled.Get(func() (string, error) { return "a", nil })
+	if _, hit, _ := disabled.Get(func() (string, error) { return "b", nil }); hit {
+		t.Error("zero-TTL cache served a cached value")
+	}
+
+	failing := &ttlCache[string]{ttl: time.Minute}
+	failing.Get(func() (string, error) { return "", errors.New("upstream down") })
+	if v, hit, _ := failing.Get(func() (string, error) { return "ok", nil }); hit || v != "ok" {
+		t.Errorf("after a failed fetch Get = %q (hit %v), want a fresh fetch", v, hit)
+	}
+}
+
+func TestTTLCacheRecoversFromPanickingFetch(t *testing.T) {
+	cache := &ttlCache[string]{ttl: time.Minute}
+	started := make(chan struct{})
+	waiting := make(chan struct{})
+	waiterErr := make(chan error, 1)
+
+	go func() {
+		defer func() { recover() }()
+		cache.Get(func() (string, error) {
+			close(started)
+			<-waiting
+			time.Sleep(50 * time.Millisecond) // let the waiter block on this fetch
+			panic("upstream client bug")
+		})
+	}()
+	<-started
+	go func() {
+		close(waiting)
+		_, _, err := cache.Get(func() (string, error) { return "unused", nil })
+		waiterErr <- err
+	}()
+
+	select {
+	case err := <-waiterErr:
+		if !errors.Is(err, errTTLFetchPanicked) {
+			t.Errorf("waiter error = %v, want errTTLFetchPanicked", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter still blocked on a fetch that panicked")
+	}
+
+	v, hit, err := cache.Get(func() (string, error) { return "fresh", nil })
+	if v != "fresh" || hit || err != nil {
+		t.Errorf("Get after the panic = %q (hit %v), %v; want a new fetch", v, hit, err)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLen = 8
+
+// usernamePattern is what usernames may contain.
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.@-]{0,63}$`)
+
+// ListUsers returns every user by username.
+func (h *AuthHandler) ListUsers(c *fiber.Ctx) error {
+	var users []models.User
+	h.db.Order("username").Find(&users)
+
+	return c.JSON(fiber.Map{"users": users})
+}
+
+// CreateUser adds a user with a password and role. Role defaults to viewer.
+func (h *AuthHandler) CreateUser(c *fiber.Ctx) error {
+	var req struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		DisplayName string `json:"display_name"`
+		Role        string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if !usernamePattern.MatchString(req.Username) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Username must be 1-64 letters, digits, '_', '.', '@' or '-'",
+		})
+	}
+	if len(req.Password) < minPasswordLen {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Password must be at least 8 characters",
+		})
+	}
+	if req.Role == "" {
+		req.Role = models.RoleViewer
+	}
+	if !models.ValidRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "role must be admin, operator or viewer",
+		})
+	}
+
+	var count int64
+	h.db.Model(&models.User{}).Where("username = ?", req.Username).Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "A user with this username already exists",
+		})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to hash password",
+		})
+	}
+	displayName := strings.TrimSpace(req.DisplayName)
+	if displayName == "" {
+		displayName = req.Username
+	}
+	user := models.User{
+		Username:     req.Username,
+		PasswordHash: string(hash),
+		DisplayName:  displayName,
+		Role:         req.Role,
+	}
+
+	err = h.db.Create(&user).Error
+	auditAction(c, h.db, "user.create", user.Username, map[string]interface{}{"role": user.Role}, err)
+	if err != nil {
+		slog.Error("Failed to create user", "username", user.Username, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create user",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(user)
+}
+
+// UpdateUser changes a user's display name or role, or disables and
+// re-enables them. Disabling revokes their refresh tokens. Admins cannot
+// disable or demote themselves, so there is always someone to undo it.
+func (h *AuthHandler) UpdateUser(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid user ID",
+		})
+	}
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "User not found",
+		})
+	}
+
+	var req struct {
+		DisplayName *string `json:"display_name"`
+		Role        *string `json:"role"`
+		Disabled    *bool   `json:"disabled"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid request body",
+		})
+	}
+
+	actor, _ := c.Locals("username").(string)
+	self := actor == user.Username
+	details := map[string]interface{}{}
+
+	if req.DisplayName != nil && strings.TrimSpace(*req.DisplayName) != "" {
+		user.DisplayName = strings.TrimSpace(*req.DisplayName)
+		details["display_name"] = user.DisplayName
+	}
+	if req.Role != nil && *req.Role != user.Role {
+		if !models.ValidRole(*req.Role) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "role must be admin, operator or viewer",
+			})
+		}
+		if self {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "You cannot change your own role",
+			})
+		}
+		user.Role = *req.Role
+		details["role"] = user.Role
+	}
+	if req.Disabled != nil && *req.Disabled != user.Disabled {
+		if self && *req.Disabled {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "You cannot disable yourself",
+			})
+		}
+		user.Disabled = *req.Disabled
+		details["disabled"] = user.Disabled
+	}
+
+	err = h.db.Save(&user).Error
+	if err == nil && user.Disabled {
+		err = h.db.Model(&models.RefreshToken{}).
+			Where("username = ? AND revoked_at IS NULL", user.Username).
+			Update("revoked_at", time.Now()).Error
+	}
+	auditAction(c, h.db, "user.update", user.Username, details, err)
+	if err != nil {
+		slog.Error("Failed to update user", "username", user.Username, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update user",
+		})
+	}
+
+	return c.JSON(user)
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the authenticated username so code
+// below the handler (e.g. GORM callbacks) can attribute changes.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the username set by WithActor, or "".
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
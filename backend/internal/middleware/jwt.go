@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"strings"
 	"time"
 
@@ -8,42 +9,84 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token types other than access tokens. Tokens carrying any type are never
+// accepted as access tokens.
+const (
+	tokenTypeRefresh = "refresh"
+	tokenTypeShare   = "share"
+)
+
 type Claims struct {
 	Username    string `json:"username"`
 	DisplayName string `json:"display_name,omitempty"`
 	Role        string `json:"role,omitempty"`
+	TokenType   string `json:"typ,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateTokens(username, secret, displayName, role string) (string, string, error) {
-	// Access token (15 min)
+// IsRefresh reports whether the claims belong to a refresh token.
+func (c *Claims) IsRefresh() bool {
+	return c.TokenType == tokenTypeRefresh
+}
+
+// TokenSettings controls how tokens are signed and how long they live.
+type TokenSettings struct {
+	Secret     string
+	Algorithm  string // HS256, HS384 or HS512
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+func (s TokenSettings) method() jwt.SigningMethod {
+	if m := jwt.GetSigningMethod(s.Algorithm); m != nil {
+		return m
+	}
+	return jwt.SigningMethodHS256
+}
+
+// Parse verifies a token signed with these settings. Tokens signed with any
+// other algorithm are rejected.
+func (s TokenSettings) Parse(tokenStr string, claims *Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(s.Secret), nil
+	}, jwt.WithValidMethods([]string{s.method().Alg()}))
+}
+
+// GenerateTokens issues an access token and a refresh token whose jti is
+// refreshID, so the caller can track it for rotation.
+func GenerateTokens(s TokenSettings, username, displayName, role, refreshID string) (string, string, error) {
+	now := time.Now()
+
+	// Access token
 	accessClaims := &Claims{
 		Username:    username,
 		DisplayName: displayName,
 		Role:        role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.AccessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	access, err := accessToken.SignedString([]byte(secret))
+	accessToken := jwt.NewWithClaims(s.method(), accessClaims)
+	access, err := accessToken.SignedString([]byte(s.Secret))
 	if err != nil {
 		return "", "", err
 	}
 
-	// Refresh token (7 days)
+	// Refresh token
 	refreshClaims := &Claims{
 		Username:    username,
 		DisplayName: displayName,
 		Role:        role,
+		TokenType:   tokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        refreshID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.RefreshTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refresh, err := refreshToken.SignedString([]byte(secret))
+	refreshToken := jwt.NewWithClaims(s.method(), refreshClaims)
+	refresh, err := refreshToken.SignedString([]byte(s.Secret))
 	if err != nil {
 		return "", "", err
 	}
@@ -51,7 +94,43 @@ func GenerateTokens(username, secret, displayName, role string) (string, string,
 	return access, refresh, nil
 }
 
-func JWTProtected(secret string) fiber.Handler {
+// GenerateShareToken issues a read-only share token for serverID whose jti
+// is the share record ID.
+func GenerateShareToken(s TokenSettings, shareID, serverID string, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		TokenType: tokenTypeShare,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        shareID,
+			Subject:   serverID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return jwt.NewWithClaims(s.method(), claims).SignedString([]byte(s.Secret))
+}
+
+// ParseShareToken verifies a share token and returns its share and server
+// IDs. Access and refresh tokens are rejected.
+func ParseShareToken(s TokenSettings, tokenStr string) (shareID, serverID string, err error) {
+	claims := &Claims{}
+	token, err := s.Parse(tokenStr, claims)
+	if err != nil {
+		return "", "", err
+	}
+	if !token.Valid || claims.TokenType != tokenTypeShare {
+		return "", "", jwt.ErrTokenInvalidClaims
+	}
+	return claims.ID, claims.Subject, nil
+}
+
+// RoleLookup returns a user's current role and whether their account is
+// still active, so a token outliving a disable or demotion is not honored.
+type RoleLookup func(ctx context.Context, username string) (role string, active bool, err error)
+
+// JWTProtected accepts requests carrying a valid access token. When lookup is
+// non-nil it is consulted on every request: tokens of disabled or deleted
+// users are refused and the stored role replaces the one in the token.
+func JWTProtected(settings TokenSettings, lookup RoleLookup) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var tokenStr string
 
@@ -75,20 +154,56 @@ func JWTProtected(secret string) fiber.Handler {
 		}
 
 		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
+		token, err := settings.Parse(tokenStr, claims)
 
-		if err != nil || !token.Valid {
+		if err != nil || !token.Valid || claims.TokenType != "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error":   true,
 				"message": "Invalid or expired token",
 			})
 		}
 
+		role := claims.Role
+		if lookup != nil {
+			current, active, err := lookup(c.UserContext(), claims.Username)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":   true,
+					"message": "Failed to verify account",
+				})
+			}
+			if !active {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error":   true,
+					"message": "User not found or disabled",
+				})
+			}
+			role = current
+		}
+
 		c.Locals("username", claims.Username)
 		c.Locals("display_name", claims.DisplayName)
-		c.Locals("role", claims.Role)
+		c.Locals("role", role)
+		c.SetUserContext(WithActor(c.UserContext(), claims.Username))
+		return c.Next()
+	}
+}
+
+// RequireRole rejects requests whose token role is not one of roles.
+// Must run after JWTProtected.
+func RequireRole(roles ...string) fiber.Handler {
+	allowed := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		allowed[r] = true
+	}
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if !allowed[role] {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   true,
+				"message": "Insufficient permissions",
+			})
+		}
 		return c.Next()
 	}
 }
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestJWTProtectedChecksCurrentAccount(t *testing.T) {
+	settings := TokenSettings{Secret: "test-secret", Algorithm: "HS256", AccessTTL: time.Hour, RefreshTTL: time.Hour}
+
+	// Tokens were issued as admins; the store has moved on since
+	accounts := map[string]struct {
+		role   string
+		active bool
+	}{
+		"alice": {"admin", true},
+		"bob":   {"viewer", true}, // demoted
+		"carol": {"admin", false}, // disabled
+	}
+	lookup := func(ctx context.Context, username string) (string, bool, error) {
+		if username == "broken" {
+			return "", false, errors.New("database unavailable")
+		}
+		a, ok := accounts[username]
+		return a.role, ok && a.active, nil
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(JWTProtected(settings, lookup))
+	app.Get("/admin", RequireRole("admin"), func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	tests := []struct {
+		username string
+		status   int
+	}{
+		{"alice", fiber.StatusOK},
+		{"bob", fiber.StatusForbidden},
+		{"carol", fiber.StatusUnauthorized},
+		{"deleted", fiber.StatusUnauthorized},
+		{"broken", fiber.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		access, _, err := GenerateTokens(settings, tt.username, tt.username, "admin", "refresh-id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+access)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET /admin as %s = %d, want %d", tt.username, resp.StatusCode, tt.status)
+		}
+	}
+}
@@ -10,12 +10,17 @@ import (
 type AlertRule struct {
 	ID                  uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	Name                string         `gorm:"not null" json:"name"`
-	Type                string         `gorm:"not null" json:"type"` // cpu, memory, disk, response_time, uptime
+	Type                string         `gorm:"not null" json:"type"` // cpu, memory, disk, response_time, uptime, command
 	Metric              string         `gorm:"not null" json:"metric"`
 	Operator            string         `gorm:"not null;default:'>'" json:"operator"` // >, <, >=, <=, ==
 	Threshold           float64        `gorm:"not null" json:"threshold"`
 	DurationSeconds     int            `gorm:"default:60" json:"duration_seconds"`
-	NotificationChannel string         `gorm:"default:'dashboard'" json:"notification_channel"` // dashboard, email
+	Severity            string         `gorm:"not null;default:'warning'" json:"severity"`      // critical, warning, info
+	NotificationChannel string         `gorm:"default:'dashboard'" json:"notification_channel"` // dashboard, email, webhook
+	ServerID            *uuid.UUID     `gorm:"type:uuid" json:"server_id"`                      // command rules: server whose history is watched
+	Command             string         `gorm:"type:text" json:"command"`                        // command rules: exact command text
+	FailureThreshold    int            `gorm:"default:3" json:"failure_threshold"`              // command rules: failures that fire
+	WindowSeconds       int            `gorm:"default:0" json:"window_seconds"`                 // command rules: 0 = consecutive failures
 	Enabled             bool           `gorm:"default:true" json:"enabled"`
 	LastTriggeredAt     *time.Time     `json:"last_triggered_at"`
 	CreatedAt           time.Time      `json:"created_at"`
@@ -26,8 +31,10 @@ type AlertRule struct {
 type Alert struct {
 	ID             uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	RuleID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"rule_id"`
+	ServerID       *uuid.UUID `gorm:"type:uuid;index" json:"server_id"`
 	Severity       string     `gorm:"not null;default:'warning'" json:"severity"` // critical, warning, info
 	Message        string     `gorm:"not null" json:"message"`
+	Details        string     `gorm:"type:text" json:"details"`                // e.g. last failing output, redacted
 	Status         string     `gorm:"not null;default:'firing'" json:"status"` // firing, acknowledged, resolved
 	AcknowledgedAt *time.Time `json:"acknowledged_at"`
 	ResolvedAt     *time.Time `json:"resolved_at"`
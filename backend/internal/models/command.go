@@ -11,9 +11,12 @@ type CommandHistory struct {
 	ServerID   uuid.UUID `gorm:"type:uuid;not null;index" json:"server_id"`
 	Server     Server    `gorm:"foreignKey:ServerID" json:"-"`
 	Command    string    `gorm:"not null" json:"command"`
+	Container  string    `gorm:"size:128;not null;default:''" json:"container,omitempty"` // set when run via docker exec
 	Output     string    `gorm:"type:text" json:"output"`
+	OutputHash string    `gorm:"size:64" json:"output_hash"`
 	ExitCode   int       `json:"exit_code"`
 	ExecutedAt time.Time `gorm:"not null" json:"executed_at"`
 	DurationMs int       `json:"duration_ms"`
+	TimedOut   bool      `gorm:"default:false" json:"timed_out"` // killed at the exec timeout; output is partial
 	IsFavorite bool      `gorm:"default:false" json:"is_favorite"`
 }
@@ -4,24 +4,39 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type CronJob struct {
-	ID                    uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	ServerID              uuid.UUID      `gorm:"type:uuid;not null;index" json:"server_id"`
-	Server                Server         `gorm:"foreignKey:ServerID" json:"-"`
-	Name                  string         `gorm:"not null" json:"name"`
-	Schedule              string         `gorm:"not null" json:"schedule"` // cron expression
-	Command               string         `gorm:"not null" json:"command"`
-	Enabled               bool           `gorm:"default:true" json:"enabled"`
-	LastRunAt             *time.Time     `json:"last_run_at"`
-	LastStatus            string         `gorm:"default:''" json:"last_status"` // success, failed, running
-	LastOutput            string         `gorm:"type:text" json:"last_output"`
-	LastError             string         `gorm:"type:text" json:"last_error"`
-	NextRunAt             *time.Time     `json:"next_run_at"`
-	NotificationOnFailure bool           `gorm:"default:true" json:"notification_on_failure"`
-	CreatedAt             time.Time      `json:"created_at"`
-	UpdatedAt             time.Time      `json:"updated_at"`
-	DeletedAt             gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                    uuid.UUID                   `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServerID              uuid.UUID                   `gorm:"type:uuid;not null;index" json:"server_id"`
+	Server                Server                      `gorm:"foreignKey:ServerID" json:"-"`
+	Name                  string                      `gorm:"not null" json:"name"`
+	Schedule              string                      `gorm:"not null" json:"schedule"` // cron expression
+	Command               string                      `gorm:"not null" json:"command"`
+	EnvKeys               datatypes.JSONSlice[string] `gorm:"type:jsonb" json:"env_keys"` // server secrets injected at run time
+	Enabled               bool                        `gorm:"default:true" json:"enabled"`
+	LastRunAt             *time.Time                  `json:"last_run_at"`
+	LastStatus            string                      `gorm:"default:''" json:"last_status"` // success, failed, running, cancelled
+	LastOutput            string                      `gorm:"type:text" json:"last_output"`
+	LastError             string                      `gorm:"type:text" json:"last_error"`
+	NextRunAt             *time.Time                  `json:"next_run_at"`
+	NotificationOnFailure bool                        `gorm:"default:true" json:"notification_on_failure"`
+	DangerousAckBy        string                      `gorm:"default:''" json:"dangerous_ack_by"` // who allowed a dangerous command to be scheduled
+	DangerousAckAt        *time.Time                  `json:"dangerous_ack_at"`
+	CreatedAt             time.Time                   `json:"created_at"`
+	UpdatedAt             time.Time                   `json:"updated_at"`
+	DeletedAt             gorm.DeletedAt              `gorm:"index" json:"-"`
+}
+
+// CronRun is one execution of a cron job.
+type CronRun struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CronJobID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"cron_job_id"`
+	Status     string     `gorm:"not null;index" json:"status"` // running, success, failed, cancelled
+	Output     string     `gorm:"type:text" json:"output"`
+	Error      string     `gorm:"type:text" json:"error"`
+	StartedAt  time.Time  `gorm:"not null" json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DatabaseConnection is an external Postgres database registered for
+// read-only querying. The DSN is stored encrypted; AIQueryable must be set
+// explicitly before the AI may query it.
+type DatabaseConnection struct {
+	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name         string    `gorm:"uniqueIndex;not null" json:"name"`
+	Host         string    `json:"host"` // host/dbname for display, without credentials
+	EncryptedDSN string    `gorm:"type:text;not null" json:"-"`
+	AIQueryable  bool      `gorm:"default:false" json:"ai_queryable"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
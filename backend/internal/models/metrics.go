@@ -13,8 +13,13 @@ type ServerMetrics struct {
 	CPUPercent       float64   `json:"cpu_percent"`
 	MemoryUsedMB     float64   `json:"memory_used_mb"`
 	MemoryTotalMB    float64   `json:"memory_total_mb"`
+	MemCachedMB      float64   `json:"mem_cached_mb"` // buffers and page cache
+	SwapUsedMB       float64   `json:"swap_used_mb"`
+	SwapTotalMB      float64   `json:"swap_total_mb"`
 	DiskUsedGB       float64   `json:"disk_used_gb"`
 	DiskTotalGB      float64   `json:"disk_total_gb"`
+	DiskMaxPercent   float64   `json:"disk_max_percent"` // fullest mount in Disks
+	DiskMaxMount     string    `json:"disk_max_mount"`
 	NetworkRxBytes   int64     `json:"network_rx_bytes"`
 	NetworkTxBytes   int64     `json:"network_tx_bytes"`
 	ContainerCount   int       `json:"container_count"`
@@ -23,5 +28,49 @@ type ServerMetrics struct {
 	LoadAvg5m        float64   `json:"load_avg_5m"`
 	LoadAvg15m       float64   `json:"load_avg_15m"`
 	UptimeSeconds    int64     `json:"uptime_seconds"`
+	GPUUtilPercent   *float64  `json:"gpu_util_percent"` // mean across GPUs; nil without nvidia-smi
+	GPUMemUsedMB     *float64  `json:"gpu_mem_used_mb"`  // summed across GPUs
+	GPUMemTotalMB    *float64  `json:"gpu_mem_total_mb"`
 	CollectedAt      time.Time `gorm:"not null;index" json:"collected_at"`
+	// Interfaces and Disks are filled by collection and stored in their own
+	// tables
+	Interfaces []ServerNetworkMetrics `gorm:"-" json:"interfaces,omitempty"`
+	Disks      []ServerDiskMetrics    `gorm:"-" json:"disks,omitempty"`
+}
+
+// ServerDiskMetrics is one mounted filesystem's usage from a metrics
+// collection.
+type ServerDiskMetrics struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServerID    uuid.UUID `gorm:"type:uuid;not null;index" json:"server_id"`
+	MetricsID   uuid.UUID `gorm:"type:uuid;not null;index" json:"metrics_id"`
+	Mount       string    `gorm:"not null" json:"mount"`
+	SizeGB      float64   `json:"size_gb"`
+	UsedGB      float64   `json:"used_gb"`
+	UsedPercent float64   `json:"used_percent"`
+	CollectedAt time.Time `gorm:"not null;index" json:"collected_at"`
+}
+
+// ServerNetworkMetrics is one network interface's /proc/net/dev counters
+// from a metrics collection. The deltas and rates are against the server's
+// previous sample of the interface; they are nil for its first sample and
+// after the counters reset.
+type ServerNetworkMetrics struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServerID    uuid.UUID `gorm:"type:uuid;not null;index:idx_server_net_metrics_iface" json:"server_id"`
+	MetricsID   uuid.UUID `gorm:"type:uuid;not null;index" json:"metrics_id"`
+	Interface   string    `gorm:"size:64;not null;index:idx_server_net_metrics_iface" json:"interface"`
+	RxBytes     int64     `json:"rx_bytes"`
+	RxPackets   int64     `json:"rx_packets"`
+	RxErrors    int64     `json:"rx_errors"`
+	RxDropped   int64     `json:"rx_dropped"`
+	TxBytes     int64     `json:"tx_bytes"`
+	TxPackets   int64     `json:"tx_packets"`
+	TxErrors    int64     `json:"tx_errors"`
+	TxDropped   int64     `json:"tx_dropped"`
+	RxDelta     *int64    `json:"rx_bytes_delta"`
+	TxDelta     *int64    `json:"tx_bytes_delta"`
+	RxRate      *float64  `json:"rx_bytes_per_sec"`
+	TxRate      *float64  `json:"tx_bytes_per_sec"`
+	CollectedAt time.Time `gorm:"not null;index" json:"collected_at"`
 }
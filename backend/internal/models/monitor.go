@@ -4,27 +4,29 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type Monitor struct {
-	ID               uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Name             string         `gorm:"not null" json:"name"`
-	URL              string         `gorm:"not null" json:"url"`
-	Type             string         `gorm:"default:'http'" json:"type"` // http, tcp, ping
-	Method           string         `gorm:"default:'GET'" json:"method"`
-	IntervalSeconds  int            `gorm:"default:60" json:"interval_seconds"`
-	TimeoutMs        int            `gorm:"default:5000" json:"timeout_ms"`
-	ExpectedStatus   int            `gorm:"default:200" json:"expected_status"`
-	Enabled          bool           `gorm:"default:true" json:"enabled"`
-	LastCheckedAt    *time.Time     `json:"last_checked_at"`
-	LastStatus       string         `gorm:"default:'unknown'" json:"last_status"` // up, down, unknown
-	LastResponseMs   int            `json:"last_response_ms"`
-	ConsecutiveFails int            `gorm:"default:0" json:"consecutive_fails"`
-	UptimePercent    float64        `gorm:"default:100" json:"uptime_percent"`
-	CreatedAt        time.Time      `json:"created_at"`
-	UpdatedAt        time.Time      `json:"updated_at"`
-	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	ID               uuid.UUID                `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name             string                   `gorm:"not null" json:"name"`
+	URL              string                   `gorm:"not null" json:"url"`
+	Type             string                   `gorm:"default:'http'" json:"type"` // http, tcp, ping, dns
+	Method           string                   `gorm:"default:'GET'" json:"method"`
+	IntervalSeconds  int                      `gorm:"default:60" json:"interval_seconds"`
+	TimeoutMs        int                      `gorm:"default:5000" json:"timeout_ms"`
+	ExpectedStatus   int                      `gorm:"default:200" json:"expected_status"`
+	ExpectedStatuses datatypes.JSONSlice[int] `gorm:"type:jsonb" json:"expected_statuses"` // any of these is "up"; empty falls back to ExpectedStatus
+	Enabled          bool                     `gorm:"default:true" json:"enabled"`
+	LastCheckedAt    *time.Time               `json:"last_checked_at"`
+	LastStatus       string                   `gorm:"default:'unknown'" json:"last_status"` // up, down, unknown
+	LastResponseMs   int                      `json:"last_response_ms"`
+	ConsecutiveFails int                      `gorm:"default:0" json:"consecutive_fails"`
+	UptimePercent    float64                  `gorm:"default:100" json:"uptime_percent"`
+	CreatedAt        time.Time                `json:"created_at"`
+	UpdatedAt        time.Time                `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt           `gorm:"index" json:"-"`
 }
 
 type MonitorPing struct {
@@ -34,7 +36,21 @@ type MonitorPing struct {
 	ResponseMs int       `json:"response_ms"`
 	StatusCode int       `json:"status_code"`
 	Error      string    `json:"error"`
-	CheckedAt  time.Time `gorm:"not null" json:"checked_at"`
+	CheckedAt  time.Time `gorm:"not null;index" json:"checked_at"`
+}
+
+// MonitorIncident is a contiguous period during which a monitor was down.
+// ResolvedAt is nil while the incident is open.
+type MonitorIncident struct {
+	ID              uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	MonitorID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"monitor_id"`
+	StartedAt       time.Time  `gorm:"not null;index" json:"started_at"`
+	ResolvedAt      *time.Time `json:"resolved_at"`
+	DurationSeconds int64      `json:"duration_seconds"`
+	FailCount       int        `gorm:"default:1" json:"fail_count"`
+	LastError       string     `gorm:"type:text" json:"last_error"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type SSLCert struct {
@@ -44,6 +60,8 @@ type SSLCert struct {
 	ValidFrom     time.Time  `json:"valid_from"`
 	ValidTo       time.Time  `json:"valid_to"`
 	DaysRemaining int        `json:"days_remaining"`
+	VerifyError   string     `json:"verify_error"`              // why the chain is untrusted; empty when valid
+	AlertID       *uuid.UUID `gorm:"type:uuid" json:"alert_id"` // open expiry alert, if any
 	LastCheckedAt *time.Time `json:"last_checked_at"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SavedQuery is a named read-only query for the SQL console.
+type SavedQuery struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;not null" json:"name"`
+	SQL       string    `gorm:"column:sql;type:text;not null" json:"sql"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QueryHistory records one SQL console query run, ad hoc or saved.
+type QueryHistory struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	SavedQueryID *uuid.UUID `gorm:"type:uuid;index" json:"saved_query_id"` // nil for ad hoc queries
+	SQL          string     `gorm:"column:sql;type:text;not null" json:"sql"`
+	Actor        string     `gorm:"size:64" json:"actor"`
+	RowCount     int        `json:"row_count"`
+	Truncated    bool       `gorm:"default:false" json:"truncated"`
+	DurationMs   int64      `json:"duration_ms"`
+	Success      bool       `gorm:"not null" json:"success"`
+	Error        string     `gorm:"type:text" json:"error,omitempty"`
+	ExecutedAt   time.Time  `gorm:"not null;index" json:"executed_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServerSecret is an encrypted environment value scoped to one server. The
+// value is only ever decrypted to inject it into a command.
+type ServerSecret struct {
+	ID             uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServerID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_server_secret_key" json:"server_id"`
+	Key            string    `gorm:"not null;uniqueIndex:idx_server_secret_key" json:"key"`
+	EncryptedValue string    `gorm:"type:text;not null" json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -4,23 +4,54 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type Server struct {
-	ID                  uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Name                string         `gorm:"not null" json:"name"`
-	Host                string         `gorm:"not null" json:"host"`
-	Port                int            `gorm:"default:22" json:"port"`
-	Username            string         `gorm:"not null" json:"username"`
-	AuthType            string         `gorm:"not null;default:'password'" json:"auth_type"` // password or key
-	EncryptedPassword   string         `gorm:"" json:"-"`
-	EncryptedPrivateKey string         `gorm:"type:text" json:"-"`
-	Fingerprint         string         `gorm:"" json:"fingerprint"`
-	IsDefault           bool           `gorm:"default:false" json:"is_default"`
-	Status              string         `gorm:"default:'unknown'" json:"status"` // online, offline, unknown
-	LastConnectedAt     *time.Time     `json:"last_connected_at"`
-	CreatedAt           time.Time      `json:"created_at"`
-	UpdatedAt           time.Time      `json:"updated_at"`
-	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                     uuid.UUID                   `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name                   string                      `gorm:"not null" json:"name"`
+	Host                   string                      `gorm:"not null" json:"host"`
+	Port                   int                         `gorm:"default:22" json:"port"`
+	Username               string                      `gorm:"not null" json:"username"`
+	AuthType               string                      `gorm:"not null;default:'password'" json:"auth_type"` // password, key, keyfile or agent
+	KeyFile                string                      `gorm:"" json:"key_file"`                             // private key path on the Bastion host, for keyfile
+	EncryptedPassword      string                      `gorm:"" json:"-"`
+	EncryptedPrivateKey    string                      `gorm:"type:text" json:"-"`
+	EncryptedPassphrase    string                      `gorm:"" json:"-"` // private key passphrase, for key and keyfile
+	Fingerprint            string                      `gorm:"" json:"fingerprint"`
+	HostKeyPolicy          string                      `gorm:"not null;default:'strict'" json:"host_key_policy"` // strict or warn
+	JumpServerID           *uuid.UUID                  `gorm:"type:uuid" json:"jump_server_id"`                  // server to ProxyJump through; nil connects directly
+	IsDefault              bool                        `gorm:"default:false" json:"is_default"`
+	Status                 string                      `gorm:"default:'unknown'" json:"status"` // online, offline, auth_error, unknown
+	LastError              string                      `gorm:"type:text" json:"last_error"`
+	LastConnectedAt        *time.Time                  `json:"last_connected_at"`
+	CommandPrefix          string                      `gorm:"" json:"command_prefix"` // e.g. "toolbox run", prepended to user commands
+	Shell                  string                      `gorm:"" json:"shell"`          // e.g. "bash -lc", wraps user commands
+	Facts                  datatypes.JSON              `gorm:"type:jsonb" json:"-"`    // cached ServerFacts
+	FactsUpdatedAt         *time.Time                  `json:"facts_updated_at"`
+	Notes                  string                      `gorm:"type:text" json:"notes"`                               // operator notes, markdown
+	Metadata               datatypes.JSON              `gorm:"type:jsonb" json:"metadata"`                           // free-form key/value object
+	CollectIntervalSeconds int                         `gorm:"default:0" json:"collect_interval_seconds"`            // 0 uses METRICS_COLLECT_INTERVAL
+	Tags                   datatypes.JSONSlice[string] `gorm:"type:jsonb;not null;default:'[]'" json:"tags"`         // lowercase labels for grouping, e.g. "web"
+	Environment            string                      `gorm:"size:64;not null;default:'';index" json:"environment"` // e.g. production, staging; "" when unset
+	RecordTerminal         bool                        `gorm:"default:false" json:"record_terminal"`                 // record terminal sessions even when TERMINAL_RECORDING is off
+	CreatedAt              time.Time                   `json:"created_at"`
+	UpdatedAt              time.Time                   `json:"updated_at"`
+	DeletedAt              gorm.DeletedAt              `gorm:"index" json:"-"`
+}
+
+// ServerFacts is static inventory gathered from a server.
+type ServerFacts struct {
+	Hostname       string   `json:"hostname"`
+	OS             string   `json:"os"`
+	Kernel         string   `json:"kernel"`
+	Arch           string   `json:"arch"`
+	CPUModel       string   `json:"cpu_model"`
+	CPUCores       int      `json:"cpu_cores"`
+	MemoryTotalMB  int64    `json:"memory_total_mb"`
+	IPAddresses    []string `json:"ip_addresses"`
+	DockerVersion  string   `json:"docker_version"`
+	ComposeVersion string   `json:"compose_version"`
+	Timezone       string   `json:"timezone"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServerShare records a read-only status link minted for one server. The
+// signed token carries the share ID, so revoking the row invalidates the
+// link before it expires.
+type ServerShare struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServerID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"server_id"`
+	Label     string     `json:"label"`
+	CreatedBy string     `json:"created_by"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -15,4 +15,7 @@ type SSHSession struct {
 	DurationSeconds  int        `json:"duration_seconds"`
 	CommandsExecuted int        `gorm:"default:0" json:"commands_executed"`
 	BytesTransferred int64      `gorm:"default:0" json:"bytes_transferred"`
+	Actor            string     `gorm:"index" json:"actor"`
+	Recorded         bool       `gorm:"default:false" json:"recorded"` // a TerminalRecording exists
+	EndReason        string     `json:"end_reason"`                    // closed, idle_timeout or max_duration
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TerminalRecording is the asciicast v2 recording of one SSHSession's
+// output. Input is not recorded.
+type TerminalRecording struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	SessionID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"session_id"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Events    int       `json:"events"`
+	Size      int       `json:"size"`      // bytes
+	Truncated bool      `json:"truncated"` // output past TERMINAL_RECORDING_MAX_MB was dropped
+	Cast      []byte    `gorm:"type:bytea" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User roles.
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// ValidRole reports whether role is one of the user roles.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleOperator || role == RoleViewer
+}
+
+// User is a Bastion login. The first admin is seeded from ADMIN_* config on
+// first boot; disabled users cannot log in, refresh tokens or use the API.
+type User struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Username     string     `gorm:"size:64;uniqueIndex;not null" json:"username"`
+	PasswordHash string     `gorm:"not null" json:"-"` // bcrypt
+	DisplayName  string     `json:"display_name"`
+	Role         string     `gorm:"size:32;not null;default:'viewer'" json:"role"`
+	Disabled     bool       `gorm:"default:false" json:"disabled"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -27,108 +27,197 @@ func Setup(
 	fileHandler *handlers.FileHandler,
 	auditHandler *handlers.AuditHandler,
 	configHandler *handlers.RemoteConfigHandler,
+	credentialHandler *handlers.CredentialHandler,
+	streamHandler *handlers.StreamHandler,
+	secretHandler *handlers.SecretHandler,
+	dbConnectionHandler *handlers.DBConnectionHandler,
+	shareHandler *handlers.ShareHandler,
+	telemetryHandler *handlers.TelemetryHandler,
 ) {
 	// ─── Public ──────────────────────────────────────────────────────────
 	app.Get("/api/health", systemHandler.Health)
 	app.Get("/api/config", configHandler.GetConfig)
+	app.Get("/api/share/:token", shareHandler.PublicStatus)
+	app.Get("/metrics", telemetryHandler.Metrics) // METRICS_TOKEN-guarded when set
 
 	// ─── Auth ────────────────────────────────────────────────────────────
 	app.Post("/api/auth/login", authHandler.Login)
 	app.Post("/api/auth/refresh", authHandler.Refresh)
+	app.Post("/api/auth/logout", authHandler.Logout)
 
 	// ─── Protected routes ────────────────────────────────────────────────
-	api := app.Group("/api", middleware.JWTProtected(cfg.JWTSecret))
+	api := app.Group("/api", middleware.JWTProtected(handlers.TokenSettingsFromConfig(cfg), authHandler.CurrentRole))
+
+	// Viewers are read-only: routes that change servers or run anything on
+	// them need operate.
+	operate := middleware.RequireRole("admin", "operator")
 
 	// Auth (protected)
 	api.Get("/auth/me", authHandler.Me)
 	api.Put("/auth/password", authHandler.ChangePassword)
 
+	// Users (admin only)
+	users := api.Group("/users", middleware.RequireRole("admin"))
+	users.Get("/", authHandler.ListUsers)
+	users.Post("/", authHandler.CreateUser)
+	users.Put("/:id", authHandler.UpdateUser)
+
 	// Dashboard
 	api.Get("/dashboard/overview", systemHandler.DashboardOverview)
 
+	// Dashboard live stream (WebSocket)
+	api.Use("/ws/dashboard", streamHandler.UpgradeCheck())
+	api.Get("/ws/dashboard", streamHandler.HandleDashboard())
+
 	// System
 	api.Get("/system/info", systemHandler.Info)
 
 	// Servers
 	api.Get("/servers", serverHandler.ListServers)
-	api.Post("/servers", serverHandler.CreateServer)
+	api.Post("/servers", operate, serverHandler.CreateServer)
+	api.Post("/servers/test-all", middleware.RequireRole("admin"), serverHandler.TestAllConnections)
 	api.Get("/servers/:id", serverHandler.GetServer)
-	api.Put("/servers/:id", serverHandler.UpdateServer)
-	api.Delete("/servers/:id", serverHandler.DeleteServer)
-	api.Post("/servers/:id/test", serverHandler.TestConnection)
+	api.Put("/servers/:id", operate, serverHandler.UpdateServer)
+	api.Delete("/servers/:id", operate, serverHandler.DeleteServer)
+	api.Post("/servers/:id/test", operate, serverHandler.TestConnection)
+	api.Get("/servers/:id/pool", serverHandler.GetPool)
+	api.Post("/servers/:id/pool/reset", middleware.RequireRole("admin"), serverHandler.ResetPool)
+	api.Post("/servers/:id/reveal-credential", middleware.RequireRole("admin"), credentialHandler.RevealCredential)
+
+	// Server Secrets (values are write-only)
+	api.Get("/servers/:id/secrets", secretHandler.ListSecrets)
+	api.Post("/servers/:id/secrets", operate, secretHandler.CreateSecret)
+	api.Put("/servers/:id/secrets/:key", operate, secretHandler.UpdateSecret)
+	api.Delete("/servers/:id/secrets/:key", operate, secretHandler.DeleteSecret)
 	api.Get("/servers/:id/metrics", serverHandler.GetMetrics)
 	api.Get("/servers/:id/metrics/live", serverHandler.GetLiveMetrics)
+	api.Get("/servers/:id/metrics/network", serverHandler.GetNetworkMetrics)
+	api.Get("/servers/:id/disks", serverHandler.GetDisks)
+	api.Use("/servers/:id/metrics/stream", streamHandler.UpgradeCheck())
+	api.Get("/servers/:id/metrics/stream", streamHandler.HandleServerMetrics())
+	api.Get("/servers/:id/metrics/diagnose", middleware.RequireRole("admin"), serverHandler.DiagnoseMetrics)
+	api.Get("/servers/:id/facts", serverHandler.GetFacts)
+	api.Get("/servers/:id/pressure", serverHandler.GetPressure)
+	api.Get("/servers/:id/kernel-log", serverHandler.GetKernelLog)
+	api.Put("/servers/:id/notes", operate, serverHandler.UpdateNotes)
+	api.Get("/servers/:id/shares", shareHandler.ListShares)
+	api.Post("/servers/:id/shares", middleware.RequireRole("admin"), shareHandler.CreateShare)
+	api.Delete("/servers/:id/shares/:shareId", middleware.RequireRole("admin"), shareHandler.RevokeShare)
 
 	// Terminal (WebSocket)
-	api.Use("/servers/:id/terminal", terminalHandler.UpgradeCheck())
+	api.Use("/servers/:id/terminal", operate, terminalHandler.UpgradeCheck())
 	api.Get("/servers/:id/terminal", terminalHandler.HandleTerminal())
+	api.Get("/servers/:id/sessions", terminalHandler.ListSessions)
+	api.Get("/sessions/:id/recording", middleware.RequireRole("admin"), terminalHandler.GetRecording)
 
 	// Commands
-	api.Post("/servers/:id/exec", commandHandler.ExecCommand)
+	api.Post("/servers/:id/exec", operate, commandHandler.ExecCommand)
+	api.Post("/servers/:id/exec/diff", operate, commandHandler.DiffCommand)
+	api.Post("/servers/:id/script", operate, commandHandler.ExecScript)
 	api.Get("/servers/:id/history", commandHandler.GetHistory)
+	api.Post("/commands/bulk-exec", operate, commandHandler.BulkExec)
 	api.Get("/commands/favorites", commandHandler.ListFavorites)
-	api.Post("/commands/favorites/:id", commandHandler.ToggleFavorite)
-	api.Delete("/commands/favorites/:id", commandHandler.DeleteFavorite)
+	api.Post("/commands/favorites/:id", operate, commandHandler.ToggleFavorite)
+	api.Delete("/commands/favorites/:id", operate, commandHandler.DeleteFavorite)
 
 	// Cron Jobs
 	api.Get("/servers/:id/crons", cronHandler.ListCrons)
-	api.Post("/servers/:id/crons", cronHandler.CreateCron)
-	api.Put("/crons/:id", cronHandler.UpdateCron)
-	api.Delete("/crons/:id", cronHandler.DeleteCron)
-	api.Post("/crons/:id/run", cronHandler.RunCron)
-	api.Post("/crons/:id/toggle", cronHandler.ToggleCron)
+	api.Post("/servers/:id/crons", operate, cronHandler.CreateCron)
+	api.Put("/crons/:id", operate, cronHandler.UpdateCron)
+	api.Delete("/crons/:id", operate, cronHandler.DeleteCron)
+	api.Post("/crons/:id/run", operate, cronHandler.RunCron)
+	api.Post("/crons/:id/toggle", operate, cronHandler.ToggleCron)
 	api.Get("/crons/:id/logs", cronHandler.GetCronLogs)
+	api.Get("/crons/:id/runs", cronHandler.ListCronRuns)
+	api.Post("/crons/runs/:runId/cancel", operate, cronHandler.CancelCronRun)
 
 	// Process + Services + Network (params: :id = server ID)
 	api.Get("/servers/:id/processes", processHandler.ListProcesses)
-	api.Post("/servers/:id/processes/:pid/kill", processHandler.KillProcess)
+	api.Post("/servers/:id/processes/kill-by-name", operate, processHandler.KillProcessByName)
+	api.Post("/servers/:id/processes/:pid/kill", operate, processHandler.KillProcess)
 	api.Get("/servers/:id/services", processHandler.ListServices)
-	api.Post("/servers/:id/services/:name/action", processHandler.ServiceAction)
+	api.Get("/servers/:id/services/:name/status", processHandler.GetServiceStatus)
+	api.Get("/servers/:id/services/:name/logs", processHandler.ServiceLogs, processHandler.StreamServiceLogs())
+	api.Post("/servers/:id/services/:name/action", operate, processHandler.ServiceAction)
 	api.Get("/servers/:id/network/connections", processHandler.ListNetworkConnections)
 
 	// Docker (params: :id = server ID)
 	docker := api.Group("/servers/:id/docker")
 	docker.Get("/containers", dockerHandler.ListContainers)
-	docker.Post("/containers/:cid/action", dockerHandler.ContainerAction)
+	docker.Post("/containers/:cid/action", operate, dockerHandler.ContainerAction)
+	docker.Post("/containers/:cid/exec", operate, dockerHandler.ContainerExec)
 	docker.Get("/containers/:cid/stats", dockerHandler.ContainerStats)
 	docker.Get("/containers/:cid/logs", dockerHandler.ContainerLogs)
+	docker.Get("/containers/:cid/logs/search", dockerHandler.SearchContainerLogs)
+	docker.Get("/containers/:cid/logs/stream", dockerHandler.LogStreamCheck(), dockerHandler.StreamContainerLogs())
+	docker.Get("/containers/:cid/top", dockerHandler.ContainerTop)
 	docker.Get("/images", dockerHandler.ListImages)
-	docker.Post("/images/pull", dockerHandler.PullImage)
-	docker.Post("/images/prune", dockerHandler.PruneImages)
-	docker.Delete("/images/:iid", dockerHandler.RemoveImage)
+	docker.Post("/images/pull", operate, dockerHandler.PullImage)
+	docker.Post("/images/prune", operate, dockerHandler.PruneImages)
+	docker.Delete("/images/:iid", operate, dockerHandler.RemoveImage)
+	docker.Get("/compose", dockerHandler.ListComposeProjects)
+	docker.Post("/compose/action", operate, dockerHandler.ComposeAction)
 
 	// Monitors
 	monitors := api.Group("/monitors")
 	monitors.Get("/", monitorHandler.ListMonitors)
-	monitors.Post("/", monitorHandler.CreateMonitor)
-	monitors.Post("/auto-seed", monitorHandler.AutoSeedMonitors)
+	monitors.Post("/", operate, monitorHandler.CreateMonitor)
+	monitors.Post("/auto-seed", operate, monitorHandler.AutoSeedMonitors)
 	monitors.Get("/ssl", monitorHandler.ListSSLCerts)
-	monitors.Post("/ssl/check", monitorHandler.CheckSSL)
+	monitors.Get("/incidents", monitorHandler.ListIncidents)
+	monitors.Post("/ssl/check", operate, monitorHandler.CheckSSL)
+	monitors.Post("/ssl/check-all", operate, monitorHandler.CheckAllSSL)
+	monitors.Post("/ssl/:id/check", operate, monitorHandler.RecheckSSL)
+	monitors.Delete("/ssl/:id", operate, monitorHandler.DeleteSSLCert)
 	monitors.Get("/:id", monitorHandler.GetMonitor)
-	monitors.Delete("/:id", monitorHandler.DeleteMonitor)
-	monitors.Post("/:id/toggle", monitorHandler.ToggleMonitor)
+	monitors.Put("/:id", operate, monitorHandler.UpdateMonitor)
+	monitors.Delete("/:id", operate, monitorHandler.DeleteMonitor)
+	monitors.Post("/:id/toggle", operate, monitorHandler.ToggleMonitor)
+	monitors.Post("/:id/check", operate, monitorHandler.CheckMonitor)
 	monitors.Get("/:id/pings", monitorHandler.GetMonitorPings)
 
 	// Alerts
 	alerts := api.Group("/alerts")
 	alerts.Get("/rules", alertHandler.ListAlertRules)
-	alerts.Post("/rules", alertHandler.CreateAlertRule)
-	alerts.Delete("/rules/:id", alertHandler.DeleteAlertRule)
+	alerts.Post("/rules", operate, alertHandler.CreateAlertRule)
+	alerts.Post("/rules/simulate", alertHandler.SimulateAlertRule)
+	alerts.Delete("/rules/:id", operate, alertHandler.DeleteAlertRule)
 	alerts.Get("/", alertHandler.ListAlerts)
-	alerts.Put("/:id/acknowledge", alertHandler.AcknowledgeAlert)
-	alerts.Put("/:id/resolve", alertHandler.ResolveAlert)
+	alerts.Post("/bulk", operate, alertHandler.BulkUpdateAlerts)
+	alerts.Put("/:id/acknowledge", operate, alertHandler.AcknowledgeAlert)
+	alerts.Put("/:id/resolve", operate, alertHandler.ResolveAlert)
 
-	// Database
-	database := api.Group("/database")
+	// Database (admin only: the console reads Bastion's own tables,
+	// credentials and tokens included)
+	database := api.Group("/database", middleware.RequireRole("admin"))
 	database.Get("/tables", databaseHandler.ListTables)
 	database.Get("/tables/:name/rows", databaseHandler.GetTableRows)
+	database.Get("/tables/:name/export", databaseHandler.ExportTable)
 	database.Post("/query", databaseHandler.ExecuteQuery)
+	database.Post("/explain", databaseHandler.ExplainQuery)
+	database.Get("/history", databaseHandler.ListQueryHistory)
+	database.Get("/saved-queries", databaseHandler.ListSavedQueries)
+	database.Post("/saved-queries", databaseHandler.CreateSavedQuery)
+	database.Put("/saved-queries/:id", databaseHandler.UpdateSavedQuery)
+	database.Delete("/saved-queries/:id", databaseHandler.DeleteSavedQuery)
+	database.Post("/saved-queries/:id/run", databaseHandler.RunSavedQuery)
 	database.Get("/stats", databaseHandler.GetDatabaseStats)
+	database.Get("/connections", dbConnectionHandler.ListConnections)
+	database.Post("/connections", dbConnectionHandler.CreateConnection)
+	database.Put("/connections/:id", dbConnectionHandler.UpdateConnection)
+	database.Delete("/connections/:id", dbConnectionHandler.DeleteConnection)
 
 	// Files
 	api.Get("/servers/:id/files", fileHandler.ListFiles)
+	api.Get("/servers/:id/files/search", fileHandler.SearchFiles)
 	api.Get("/servers/:id/files/content", fileHandler.ReadFile)
-	api.Put("/servers/:id/files/content", fileHandler.WriteFile)
+	api.Put("/servers/:id/files/content", operate, fileHandler.WriteFile)
+	api.Get("/servers/:id/files/download", fileHandler.DownloadFile)
+	api.Post("/servers/:id/files/upload", operate, fileHandler.UploadFile)
+	api.Delete("/servers/:id/files", operate, fileHandler.DeleteFile)
+	api.Post("/servers/:id/files/rename", operate, fileHandler.RenameFile)
+	api.Post("/servers/:id/files/mkdir", operate, fileHandler.MakeDir)
+	api.Post("/servers/:id/files/chmod", operate, fileHandler.ChmodFile)
 	api.Get("/servers/:id/disk", fileHandler.DiskUsage)
 
 	// Audit
@@ -136,8 +225,8 @@ func Setup(
 
 	// Remote Config (admin)
 	api.Get("/config/:key", configHandler.GetConfigKey)
-	api.Put("/config/:key", configHandler.SetConfigKey)
-	api.Delete("/config/:key", configHandler.DeleteConfigKey)
+	api.Put("/config/:key", middleware.RequireRole("admin"), configHandler.SetConfigKey)
+	api.Delete("/config/:key", middleware.RequireRole("admin"), configHandler.DeleteConfigKey)
 
 	// Status Page
 	api.Get("/status", systemHandler.StatusPage)
@@ -146,14 +235,16 @@ func Setup(
 	coolify := api.Group("/coolify")
 	coolify.Get("/apps", coolifyHandler.ListApps)
 	coolify.Get("/apps/:uuid", coolifyHandler.GetApp)
-	coolify.Post("/apps/:uuid/restart", coolifyHandler.RestartApp)
-	coolify.Post("/apps/:uuid/deploy", coolifyHandler.DeployApp)
+	coolify.Post("/apps/:uuid/restart", operate, coolifyHandler.RestartApp)
+	coolify.Post("/apps/:uuid/deploy", operate, coolifyHandler.DeployApp)
 	coolify.Get("/apps/:uuid/logs", coolifyHandler.GetAppLogs)
 	coolify.Get("/apps/:uuid/envs", coolifyHandler.GetAppEnvs)
-	coolify.Put("/apps/:uuid/envs", coolifyHandler.UpdateAppEnvs)
+	coolify.Put("/apps/:uuid/envs", operate, coolifyHandler.UpdateAppEnvs)
+	coolify.Post("/apps/:uuid/envs/diff", coolifyHandler.DiffAppEnvs)
 	coolify.Get("/databases", coolifyHandler.ListDatabases)
 	coolify.Get("/services", coolifyHandler.ListServices)
 	coolify.Get("/deployments", coolifyHandler.ListDeployments)
+	coolify.All("/proxy/*", operate, coolifyHandler.Proxy)
 
 	// Ops Integration
 	ops := api.Group("/ops")
@@ -166,10 +257,14 @@ func Setup(
 	ai := api.Group("/ai")
 	ai.Post("/chat", aiHandler.Chat)
 	ai.Post("/stream", aiHandler.ChatStream)
-	ai.Post("/execute", aiHandler.ExecuteAIAction)
+	ai.Post("/agent", operate, aiHandler.Agent)
+	ai.Post("/execute", operate, aiHandler.ExecuteAIAction)
 	ai.Post("/analyze-logs", aiHandler.AnalyzeLogs)
 	ai.Post("/suggest-fix", aiHandler.SuggestFix)
+	ai.Post("/context/refresh", middleware.RequireRole("admin"), aiHandler.RefreshContext)
+	ai.Get("/system-prompt", middleware.RequireRole("admin"), aiHandler.GetSystemPrompt)
 	ai.Get("/conversations", aiHandler.ListConversations)
 	ai.Get("/conversations/:id", aiHandler.GetConversation)
-	ai.Delete("/conversations/:id", aiHandler.DeleteConversation)
+	ai.Put("/conversations/:id/server", operate, aiHandler.SetConversationServer)
+	ai.Delete("/conversations/:id", operate, aiHandler.DeleteConversation)
 }
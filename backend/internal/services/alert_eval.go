@@ -0,0 +1,139 @@
+package services
+
+import (
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+)
+
+// ValidAlertOperators lists the comparison operators an alert rule may use.
+var ValidAlertOperators = map[string]bool{">": true, "<": true, ">=": true, "<=": true, "==": true}
+
+// CompareThreshold reports whether value satisfies "value <op> threshold".
+// An empty operator defaults to ">".
+func CompareThreshold(value float64, op string, threshold float64) bool {
+	switch op {
+	case "", ">":
+		return value > threshold
+	case "<":
+		return value < threshold
+	case ">=":
+		return value >= threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	}
+	return false
+}
+
+// MetricValue extracts the named metric from a ServerMetrics sample.
+// Memory and disk percentages are derived from used/total.
+func MetricValue(m *models.ServerMetrics, metric string) (float64, bool) {
+	switch metric {
+	case "cpu", "cpu_percent":
+		return m.CPUPercent, true
+	case "memory", "memory_percent":
+		if m.MemoryTotalMB <= 0 {
+			return 0, false
+		}
+		return m.MemoryUsedMB / m.MemoryTotalMB * 100, true
+	case "memory_used_mb":
+		return m.MemoryUsedMB, true
+	case "disk", "disk_percent":
+		if m.DiskTotalGB <= 0 {
+			return 0, false
+		}
+		return m.DiskUsedGB / m.DiskTotalGB * 100, true
+	case "disk_used_gb":
+		return m.DiskUsedGB, true
+	case "disk_max_percent":
+		// The fullest mount rather than /; absent without df --output
+		if m.DiskMaxMount == "" {
+			return 0, false
+		}
+		return m.DiskMaxPercent, true
+	case "load", "load_avg_1m":
+		return m.LoadAvg1m, true
+	case "load_avg_5m":
+		return m.LoadAvg5m, true
+	case "load_avg_15m":
+		return m.LoadAvg15m, true
+	case "container_count":
+		return float64(m.ContainerCount), true
+	case "container_running":
+		return float64(m.ContainerRunning), true
+	case "network_rx_bytes":
+		return float64(m.NetworkRxBytes), true
+	case "network_tx_bytes":
+		return float64(m.NetworkTxBytes), true
+	case "gpu", "gpu_util_percent":
+		if m.GPUUtilPercent == nil {
+			return 0, false
+		}
+		return *m.GPUUtilPercent, true
+	case "gpu_memory_percent":
+		if m.GPUMemTotalMB == nil || *m.GPUMemTotalMB <= 0 {
+			return 0, false
+		}
+		return *m.GPUMemUsedMB / *m.GPUMemTotalMB * 100, true
+	}
+	return 0, false
+}
+
+// RuleMetricValue resolves a rule's metric against a sample, falling back to
+// the rule type (cpu, memory, disk) when the metric name is not recognized.
+func RuleMetricValue(rule *models.AlertRule, m *models.ServerMetrics) (float64, bool) {
+	if v, ok := MetricValue(m, rule.Metric); ok {
+		return v, true
+	}
+	return MetricValue(m, rule.Type)
+}
+
+// AlertTrigger is one point at which a rule would have fired.
+type AlertTrigger struct {
+	ServerID  string    `json:"server_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// SimulateAlertRule replays a rule against samples ordered by collected_at.
+// A rule fires once its condition has held for DurationSeconds and re-arms
+// only after the condition clears.
+func SimulateAlertRule(rule *models.AlertRule, samples []models.ServerMetrics) []AlertTrigger {
+	type breach struct {
+		since time.Time
+		fired bool
+	}
+
+	duration := time.Duration(rule.DurationSeconds) * time.Second
+	active := make(map[string]*breach)
+	triggers := make([]AlertTrigger, 0)
+
+	for i := range samples {
+		m := &samples[i]
+		key := m.ServerID.String()
+
+		value, ok := RuleMetricValue(rule, m)
+		if !ok || !CompareThreshold(value, rule.Operator, rule.Threshold) {
+			delete(active, key)
+			continue
+		}
+
+		b, exists := active[key]
+		if !exists {
+			b = &breach{since: m.CollectedAt}
+			active[key] = b
+		}
+		if !b.fired && m.CollectedAt.Sub(b.since) >= duration {
+			b.fired = true
+			triggers = append(triggers, AlertTrigger{
+				ServerID:  key,
+				Timestamp: m.CollectedAt,
+				Value:     value,
+			})
+		}
+	}
+
+	return triggers
+}
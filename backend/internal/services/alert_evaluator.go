@@ -0,0 +1,307 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// alertStaleAfter is how many evaluation intervals a metrics sample stays
+// current. Servers without a recent sample are neither fired nor resolved.
+const alertStaleAfter = 5
+
+// AlertEvaluator periodically checks enabled alert rules against the latest
+// metrics of every server, fires an Alert once a condition has held for the
+// rule's duration and resolves it when the condition clears.
+type AlertEvaluator struct {
+	db       *gorm.DB
+	events   *EventBus
+	notifier *AlertNotifier
+	interval time.Duration
+	stop     chan struct{}
+
+	mu       sync.Mutex
+	breaches map[string]time.Time // "rule:server" -> first sample that breached
+}
+
+// NewAlertEvaluator creates an evaluator. notifier may be nil, in which case
+// alerts are only shown on the dashboard.
+func NewAlertEvaluator(db *gorm.DB, events *EventBus, notifier *AlertNotifier, intervalSec int) *AlertEvaluator {
+	if intervalSec <= 0 {
+		intervalSec = 30
+	}
+	return &AlertEvaluator{
+		db:       db,
+		events:   events,
+		notifier: notifier,
+		interval: time.Duration(intervalSec) * time.Second,
+		stop:     make(chan struct{}),
+		breaches: make(map[string]time.Time),
+	}
+}
+
+func (ae *AlertEvaluator) Start() {
+	go ae.loop()
+	slog.Info("Alert evaluator started", "interval", ae.interval)
+}
+
+func (ae *AlertEvaluator) Stop() {
+	ae.stop <- struct{}{}
+	slog.Info("Alert evaluator stopped")
+}
+
+func (ae *AlertEvaluator) loop() {
+	ticker := time.NewTicker(ae.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ae.evaluateAll()
+		case <-ae.stop:
+			return
+		}
+	}
+}
+
+func (ae *AlertEvaluator) evaluateAll() {
+	var rules []models.AlertRule
+	if err := ae.db.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		slog.Error("Failed to load alert rules", "error", err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	// Latest sample per server, ignoring servers that stopped reporting
+	var samples []models.ServerMetrics
+	since := time.Now().Add(-alertStaleAfter * ae.interval)
+	if err := ae.db.Raw(`SELECT DISTINCT ON (server_id) * FROM server_metrics
+		WHERE collected_at > ? ORDER BY server_id, collected_at DESC`, since).Scan(&samples).Error; err != nil {
+		slog.Error("Failed to load latest metrics for alerting", "error", err)
+		return
+	}
+
+	var servers []models.Server
+	ae.db.Select("id", "name").Find(&servers)
+	names := make(map[uuid.UUID]string, len(servers))
+	for _, s := range servers {
+		names[s.ID] = s.Name
+	}
+
+	for i := range rules {
+		if rules[i].Type == SSLRuleType || rules[i].Type == CredentialsRuleType {
+			continue // evaluated by SSLChecker and MetricsCollector
+		}
+		if rules[i].Type == "command" {
+			if rules[i].ServerID != nil {
+				ae.evaluateCommand(&rules[i], names[*rules[i].ServerID])
+			}
+			continue
+		}
+		for j := range samples {
+			ae.evaluate(&rules[i], &samples[j], names[samples[j].ServerID])
+		}
+	}
+}
+
+// AlertTransition is the outcome of checking one rule against one sample.
+type AlertTransition int
+
+const (
+	AlertUnchanged AlertTransition = iota
+	AlertFire
+	AlertClear
+)
+
+// StepAlertRule advances the breach state of a rule for one sample. since is
+// the time the current breach started (zero when not breaching); the new
+// value is returned along with whether the rule should fire or clear. A rule
+// fires on every sample once the breach has lasted DurationSeconds and clears
+// on every sample below threshold; callers debounce against open alerts.
+// Samples lacking the metric leave the state unchanged.
+func StepAlertRule(rule *models.AlertRule, m *models.ServerMetrics, since time.Time) (time.Time, float64, AlertTransition) {
+	value, ok := RuleMetricValue(rule, m)
+	if !ok {
+		return since, 0, AlertUnchanged
+	}
+	if !CompareThreshold(value, rule.Operator, rule.Threshold) {
+		return time.Time{}, value, AlertClear
+	}
+
+	if since.IsZero() {
+		since = m.CollectedAt
+	}
+	if m.CollectedAt.Sub(since) >= time.Duration(rule.DurationSeconds)*time.Second {
+		return since, value, AlertFire
+	}
+	return since, value, AlertUnchanged
+}
+
+func (ae *AlertEvaluator) evaluate(rule *models.AlertRule, m *models.ServerMetrics, serverName string) {
+	key := rule.ID.String() + ":" + m.ServerID.String()
+
+	ae.mu.Lock()
+	since, value, transition := StepAlertRule(rule, m, ae.breaches[key])
+	if since.IsZero() {
+		delete(ae.breaches, key)
+	} else {
+		ae.breaches[key] = since
+	}
+	ae.mu.Unlock()
+
+	switch transition {
+	case AlertFire:
+		operator := rule.Operator
+		if operator == "" {
+			operator = ">"
+		}
+		subject := serverName
+		if rule.Metric == "disk_max_percent" && m.DiskMaxMount != "" {
+			subject += " (mount " + m.DiskMaxMount + ")"
+		}
+		ae.fire(rule, m.ServerID, serverName, fmt.Sprintf("%s: %s on %s is %.2f (%s %.2f for %ds)",
+			rule.Name, rule.Metric, subject, value, operator, rule.Threshold, rule.DurationSeconds), "")
+	case AlertClear:
+		ae.resolve(rule, m.ServerID, serverName)
+	}
+}
+
+// maxAlertDetails caps the command output stored on an alert.
+const maxAlertDetails = 4000
+
+// CommandFailureTransition decides whether a command rule fires or clears
+// from recent runs ordered newest first. Without a window the newest
+// FailureThreshold runs must all have failed; with one, that many failures
+// must fall inside it. A rule clears once the newest run succeeds.
+func CommandFailureTransition(rule *models.AlertRule, runs []models.CommandHistory, now time.Time) AlertTransition {
+	if len(runs) == 0 {
+		return AlertUnchanged
+	}
+	threshold := max(rule.FailureThreshold, 1)
+
+	failures := 0
+	for _, r := range runs {
+		if rule.WindowSeconds > 0 {
+			if now.Sub(r.ExecutedAt) > time.Duration(rule.WindowSeconds)*time.Second {
+				break
+			}
+		} else if r.ExitCode == 0 {
+			break
+		}
+		if r.ExitCode != 0 {
+			failures++
+		}
+	}
+
+	if failures >= threshold {
+		return AlertFire
+	}
+	if runs[0].ExitCode == 0 {
+		return AlertClear
+	}
+	return AlertUnchanged
+}
+
+// evaluateCommand checks a command rule against the server's command history.
+func (ae *AlertEvaluator) evaluateCommand(rule *models.AlertRule, serverName string) {
+	query := ae.db.Where("server_id = ? AND command = ? AND container = ''", *rule.ServerID, rule.Command).Order("executed_at DESC")
+	if rule.WindowSeconds > 0 {
+		query = query.Where("executed_at > ?", time.Now().Add(-time.Duration(rule.WindowSeconds)*time.Second))
+	} else {
+		query = query.Limit(max(rule.FailureThreshold, 1))
+	}
+
+	var runs []models.CommandHistory
+	if err := query.Find(&runs).Error; err != nil {
+		slog.Error("Failed to load command history for alerting", "rule", rule.Name, "error", err)
+		return
+	}
+
+	switch CommandFailureTransition(rule, runs, time.Now()) {
+	case AlertFire:
+		last := runs[0]
+		mode := "in a row"
+		if rule.WindowSeconds > 0 {
+			mode = fmt.Sprintf("within %ds", rule.WindowSeconds)
+		}
+		message := fmt.Sprintf("%s: %q on %s failed %d+ times %s (last exit code %d)",
+			rule.Name, truncateContent(rule.Command, 80), serverName, max(rule.FailureThreshold, 1), mode, last.ExitCode)
+		ae.fire(rule, *rule.ServerID, serverName, message, truncateContent(RedactSecrets(last.Output), maxAlertDetails))
+	case AlertClear:
+		ae.resolve(rule, *rule.ServerID, serverName)
+	}
+}
+
+// fire creates a firing alert unless one is already open for the rule and
+// server.
+func (ae *AlertEvaluator) fire(rule *models.AlertRule, serverID uuid.UUID, serverName, message, details string) {
+	var open int64
+	ae.db.Model(&models.Alert{}).
+		Where("rule_id = ? AND server_id = ? AND status IN ?", rule.ID, serverID, []string{"firing", "acknowledged"}).
+		Count(&open)
+	if open > 0 {
+		return
+	}
+
+	alert := models.Alert{
+		RuleID:   rule.ID,
+		ServerID: &serverID,
+		Severity: rule.Severity,
+		Message:  message,
+		Details:  details,
+		Status:   "firing",
+	}
+	if alert.Severity == "" {
+		alert.Severity = "warning"
+	}
+	if err := ae.db.Create(&alert).Error; err != nil {
+		slog.Error("Failed to create alert", "rule", rule.Name, "server", serverName, "error", err)
+		return
+	}
+
+	now := time.Now()
+	ae.db.Model(rule).Update("last_triggered_at", now)
+	ae.events.Publish(EventAlert, alert)
+	ae.notify(rule, alert, serverName, NotifyFiring)
+	slog.Warn("Alert firing", "rule", rule.Name, "server", serverName, "message", message)
+}
+
+// resolve closes any open alert for the rule and server.
+func (ae *AlertEvaluator) resolve(rule *models.AlertRule, serverID uuid.UUID, serverName string) {
+	var open []models.Alert
+	ae.db.Where("rule_id = ? AND server_id = ? AND status IN ?", rule.ID, serverID, []string{"firing", "acknowledged"}).Find(&open)
+
+	now := time.Now()
+	for i := range open {
+		open[i].Status = "resolved"
+		open[i].ResolvedAt = &now
+		if err := ae.db.Save(&open[i]).Error; err != nil {
+			slog.Error("Failed to resolve alert", "alert", open[i].ID, "error", err)
+			continue
+		}
+		ae.events.Publish(EventAlert, open[i])
+		ae.notify(rule, open[i], serverName, NotifyResolved)
+		slog.Info("Alert resolved", "rule", rule.Name, "server", serverName)
+	}
+}
+
+// notify hands an alert transition to the rule's notification channel.
+func (ae *AlertEvaluator) notify(rule *models.AlertRule, alert models.Alert, serverName, event string) {
+	ae.notifier.Dispatch(rule, AlertNotification{
+		Event:    event,
+		AlertID:  alert.ID,
+		Rule:     rule.Name,
+		Severity: alert.Severity,
+		Server:   serverName,
+		Message:  alert.Message,
+		Details:  alert.Details,
+		Time:     time.Now(),
+	})
+}
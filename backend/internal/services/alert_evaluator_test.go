@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+)
+
+func TestCompareThreshold(t *testing.T) {
+	tests := []struct {
+		value float64
+		op    string
+		want  bool
+	}{
+		{91, ">", true},
+		{90, ">", false},
+		{91, "", true},
+		{89, "<", true},
+		{90, "<", false},
+		{90, ">=", true},
+		{89.99, ">=", false},
+		{90, "<=", true},
+		{90, "==", true},
+		{91, "!=", false},
+	}
+	for _, tt := range tests {
+		if got := CompareThreshold(tt.value, tt.op, 90); got != tt.want {
+			t.Errorf("CompareThreshold(%v, %q, 90) = %v, want %v", tt.value, tt.op, got, tt.want)
+		}
+	}
+}
+
+func TestStepAlertRuleSustainedDuration(t *testing.T) {
+	rule := &models.AlertRule{Metric: "cpu", Operator: ">=", Threshold: 90, DurationSeconds: 60}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		offset time.Duration
+		cpu    float64
+		want   AlertTransition
+	}{
+		{0, 95, AlertUnchanged},                 // breach starts
+		{30 * time.Second, 90, AlertUnchanged},  // held 30s of 60s
+		{60 * time.Second, 97, AlertFire},       // held for the full duration
+		{90 * time.Second, 99, AlertFire},       // keeps firing; open alerts debounce
+		{120 * time.Second, 40, AlertClear},     // recovered
+		{150 * time.Second, 95, AlertUnchanged}, // a new breach restarts the clock
+		{180 * time.Second, 95, AlertUnchanged},
+		{210 * time.Second, 95, AlertFire},
+	}
+
+	var since time.Time
+	for _, s := range steps {
+		m := &models.ServerMetrics{CPUPercent: s.cpu, CollectedAt: start.Add(s.offset)}
+		var got AlertTransition
+		since, _, got = StepAlertRule(rule, m, since)
+		if got != s.want {
+			t.Errorf("at +%v cpu %v: transition = %v, want %v", s.offset, s.cpu, got, s.want)
+		}
+	}
+}
+
+func TestStepAlertRuleImmediateAndBelow(t *testing.T) {
+	now := time.Now()
+	below := &models.AlertRule{Metric: "memory_percent", Operator: "<", Threshold: 10}
+
+	// No duration fires on the first breaching sample
+	m := &models.ServerMetrics{MemoryTotalMB: 1000, MemoryUsedMB: 50, CollectedAt: now}
+	since, value, got := StepAlertRule(below, m, time.Time{})
+	if got != AlertFire || value != 5 || !since.Equal(now) {
+		t.Errorf("StepAlertRule(< 10 at 5%%) = %v, %v, %v; want fire at 5 since now", since, value, got)
+	}
+
+	// A sample without the metric keeps the breach state
+	m = &models.ServerMetrics{CollectedAt: now.Add(time.Minute)}
+	if kept, _, got := StepAlertRule(below, m, since); got != AlertUnchanged || !kept.Equal(since) {
+		t.Errorf("StepAlertRule without memory totals = %v, %v; want unchanged since %v", kept, got, since)
+	}
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditQueueSize    = 1000
+	auditMaxAttempts  = 5
+	auditRetryBackoff = time.Second
+)
+
+// AuditForwarder ships audit and security events to an external sink
+// (syslog, HTTP or file) as JSON. Sends are buffered and retried in the
+// background so a slow or unreachable sink never blocks a request.
+type AuditForwarder struct {
+	kind   string
+	target string
+	token  string
+
+	client *http.Client
+	syslog *syslog.Writer
+	file   *os.File
+
+	queue chan []byte
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewAuditForwarder creates a forwarder for kind "syslog", "http" or "file".
+// For syslog, target is "udp://host:514", "tcp://host:514" or empty for the
+// local daemon. For http, token is sent as a Bearer token when set.
+func NewAuditForwarder(kind, target, token string) (*AuditForwarder, error) {
+	f := &AuditForwarder{
+		kind:   kind,
+		target: target,
+		token:  token,
+		queue:  make(chan []byte, auditQueueSize),
+		stop:   make(chan struct{}),
+	}
+
+	switch kind {
+	case "http":
+		if target == "" {
+			return nil, fmt.Errorf("audit forward target URL is required")
+		}
+		f.client = &http.Client{Timeout: 10 * time.Second}
+	case "file":
+		if target == "" {
+			return nil, fmt.Errorf("audit forward target path is required")
+		}
+		file, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit file: %w", err)
+		}
+		f.file = file
+	case "syslog":
+		network, addr := "", ""
+		if target != "" {
+			var ok bool
+			network, addr, ok = strings.Cut(target, "://")
+			if !ok {
+				network, addr = "udp", target
+			}
+		}
+		w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_AUTH, "bastion")
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		f.syslog = w
+	default:
+		return nil, fmt.Errorf("unknown audit forward type %q", kind)
+	}
+
+	return f, nil
+}
+
+func (f *AuditForwarder) Start() {
+	f.wg.Add(1)
+	go f.loop()
+	slog.Info("Audit forwarder started", "type", f.kind)
+}
+
+// Stop drains queued events and closes the sink.
+func (f *AuditForwarder) Stop() {
+	close(f.stop)
+	f.wg.Wait()
+	if f.syslog != nil {
+		f.syslog.Close()
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	slog.Info("Audit forwarder stopped")
+}
+
+// Forward queues an event for delivery. It never blocks; events are dropped
+// with a warning if the queue is full. Safe to call on a nil forwarder.
+func (f *AuditForwarder) Forward(event interface{}) {
+	if f == nil {
+		return
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to encode audit event", "error", err)
+		return
+	}
+
+	select {
+	case f.queue <- b:
+	default:
+		slog.Warn("Audit forward queue full, dropping event")
+	}
+}
+
+func (f *AuditForwarder) loop() {
+	defer f.wg.Done()
+	for {
+		select {
+		case b := <-f.queue:
+			f.deliver(b)
+		case <-f.stop:
+			for {
+				select {
+				case b := <-f.queue:
+					f.deliver(b)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver sends one event, retrying with exponential backoff.
+func (f *AuditForwarder) deliver(b []byte) {
+	backoff := auditRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := f.send(b)
+		if err == nil {
+			return
+		}
+		if attempt >= auditMaxAttempts {
+			slog.Error("Audit forward failed, giving up", "type", f.kind, "attempts", attempt, "error", err)
+			return
+		}
+		slog.Warn("Audit forward failed, retrying", "type", f.kind, "attempt", attempt, "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-f.stop:
+			// Shutting down: one last try without waiting
+			if err := f.send(b); err != nil {
+				slog.Error("Audit forward failed during shutdown", "type", f.kind, "error", err)
+			}
+			return
+		}
+		backoff *= 2
+	}
+}
+
+func (f *AuditForwarder) send(b []byte) error {
+	switch f.kind {
+	case "http":
+		req, err := http.NewRequest(http.MethodPost, f.target, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if f.token != "" {
+			req.Header.Set("Authorization", "Bearer "+f.token)
+		}
+		resp, err := f.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("sink returned %d", resp.StatusCode)
+		}
+		return nil
+	case "file":
+		_, err := f.file.Write(append(b, '\n'))
+		return err
+	case "syslog":
+		return f.syslog.Info(string(b))
+	}
+	return nil
+}
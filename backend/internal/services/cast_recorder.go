@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// CastContentType is the media type of asciicast v2 recordings.
+const CastContentType = "application/x-asciicast"
+
+// CastRecorder records terminal output as an asciicast v2 file: a JSON
+// header line, then one [seconds, "o", data] line per output chunk and
+// [seconds, "r", "COLSxROWS"] per resize. It buffers in memory so recording
+// never waits on I/O; Bytes returns the cast once the session ends. Once the
+// cast reaches maxBytes further events are dropped and Truncated reports it.
+// Safe for concurrent use.
+type CastRecorder struct {
+	mu        sync.Mutex
+	start     time.Time
+	buf       bytes.Buffer
+	maxBytes  int
+	events    int
+	truncated bool
+	pending   []byte // trailing bytes of a UTF-8 sequence split across chunks
+}
+
+// NewCastRecorder starts a recording of a cols x rows terminal.
+func NewCastRecorder(cols, rows int, term string, maxBytes int) *CastRecorder {
+	r := &CastRecorder{start: time.Now(), maxBytes: maxBytes}
+	header, _ := json.Marshal(struct {
+		Version   int               `json:"version"`
+		Width     int               `json:"width"`
+		Height    int               `json:"height"`
+		Timestamp int64             `json:"timestamp"`
+		Env       map[string]string `json:"env"`
+	}{2, cols, rows, r.start.Unix(), map[string]string{"TERM": term}})
+	r.buf.Write(header)
+	r.buf.WriteByte('\n')
+	return r
+}
+
+// Output records a chunk of terminal output. A multi-byte character split
+// across chunks is held back and recorded whole with the next chunk.
+func (r *CastRecorder) Output(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		data = append(r.pending, data...)
+		r.pending = nil
+	}
+	cut := len(data)
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				cut = len(data) - i
+			}
+			break
+		}
+	}
+	if cut < len(data) {
+		r.pending = append([]byte(nil), data[cut:]...)
+	}
+	if cut > 0 {
+		r.eventLocked("o", string(data[:cut]))
+	}
+}
+
+// Resize records a terminal size change.
+func (r *CastRecorder) Resize(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.eventLocked("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// eventLocked appends one event line. r.mu must be held.
+func (r *CastRecorder) eventLocked(kind, data string) {
+	if r.truncated {
+		return
+	}
+	elapsed := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	line, err := json.Marshal([]interface{}{elapsed, kind, data})
+	if err != nil {
+		return
+	}
+	if r.maxBytes > 0 && r.buf.Len()+len(line)+1 > r.maxBytes {
+		r.truncated = true
+		return
+	}
+	r.buf.Write(line)
+	r.buf.WriteByte('\n')
+	r.events++
+}
+
+// Bytes returns the cast so far, including any held-back partial character.
+func (r *CastRecorder) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		r.eventLocked("o", string(r.pending))
+		r.pending = nil
+	}
+	return append([]byte(nil), r.buf.Bytes()...)
+}
+
+// Events returns the number of events recorded.
+func (r *CastRecorder) Events() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events
+}
+
+// Truncated reports whether events were dropped at the size cap.
+func (r *CastRecorder) Truncated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.truncated
+}
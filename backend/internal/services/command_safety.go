@@ -1,6 +1,7 @@
 package services
 
 import (
+	"regexp"
 	"strings"
 )
 
@@ -204,6 +205,73 @@ func (c *CommandSafetyChecker) CheckSafety(input string) CommandSafety {
 	return CommandSafety{BaseCommand: baseCmd, IsSafe: false, Category: "unknown"}
 }
 
+// commandSeparators splits a command line into the commands it chains.
+var commandSeparators = regexp.MustCompile(`&&|\|\||[;|\n]`)
+
+// CheckEachCommand checks every command chained with ;, &&, || or | and
+// returns the first dangerous verdict, else the first unsafe one, else the
+// first command's verdict.
+func (c *CommandSafetyChecker) CheckEachCommand(input string) CommandSafety {
+	var first, unsafe *CommandSafety
+	for _, part := range commandSeparators.Split(input, -1) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		verdict := c.CheckSafety(part)
+		if verdict.Category == "dangerous" {
+			return verdict
+		}
+		if first == nil {
+			first = &verdict
+		}
+		if unsafe == nil && !verdict.IsSafe {
+			unsafe = &verdict
+		}
+	}
+	switch {
+	case unsafe != nil:
+		return *unsafe
+	case first != nil:
+		return *first
+	}
+	return c.CheckSafety(input)
+}
+
+var (
+	// harmlessRedirect matches redirections that write nowhere: to /dev/null
+	// or onto another descriptor, as in 2>&1.
+	harmlessRedirect = regexp.MustCompile(`[0-9]?>>?\s*/dev/null|[0-9]?>&[0-9]`)
+	// shellExpansion matches command and process substitution, output
+	// redirection and a lone & that backgrounds a job.
+	shellExpansion = regexp.MustCompile("`|\\$\\(|<\\(|>|(^|[^&])&([^&]|$)")
+)
+
+// HasShellExpansion reports whether a command line runs or writes more than
+// the commands CheckEachCommand sees: command substitution, process
+// substitution, output redirection to a file or a backgrounded job.
+func HasShellExpansion(input string) bool {
+	return shellExpansion.MatchString(harmlessRedirect.ReplaceAllString(input, ""))
+}
+
+// HasShellSyntax reports whether a command line is more than one simple
+// command: chained, piped, redirected, substituted or backgrounded.
+func HasShellSyntax(input string) bool {
+	return commandSeparators.MatchString(strings.TrimSpace(input)) || HasShellExpansion(input)
+}
+
+// CheckCommandLine is the verdict for a command line run on request:
+// CheckEachCommand's, made unsafe when the line also has shell expansion, so
+// `uptime && rm -rf /`, `cat x | sh` and `echo x > /etc/passwd` all need
+// confirmation.
+func (c *CommandSafetyChecker) CheckCommandLine(input string) CommandSafety {
+	verdict := c.CheckEachCommand(input)
+	if verdict.IsSafe && HasShellExpansion(input) {
+		verdict.IsSafe = false
+		verdict.Category = "dangerous"
+	}
+	return verdict
+}
+
 func (c *CommandSafetyChecker) categorizeCommand(cmd string) string {
 	fileCmds := map[string]bool{"ls": true, "cat": true, "head": true, "tail": true,
 		"grep": true, "find": true, "wc": true, "du": true, "stat": true, "file": true}
@@ -0,0 +1,43 @@
+package services
+
+import "testing"
+
+func TestCheckCommandLine(t *testing.T) {
+	checker := NewCommandSafetyChecker()
+	tests := []struct {
+		command string
+		safe    bool
+		base    string
+	}{
+		{"uptime", true, "uptime"},
+		{"ps aux | grep nginx", true, "ps"},
+		{"dmesg 2>&1 | tail -n 5", false, "dmesg"},
+		{"ls /nope 2>/dev/null", true, "ls"},
+		{"uptime && rm -rf /", false, "rm"},
+		{"cat x | sh", false, "sh"},
+		{"echo x > /etc/passwd", false, "echo"},
+		{"echo $(rm -rf /)", false, "echo"},
+		{"echo `id`", false, "echo"},
+		{"sleep 300 &", false, "sleep"},
+		{"sleep 1 && uptime", true, "sleep"},
+	}
+	for _, tt := range tests {
+		got := checker.CheckCommandLine(tt.command)
+		if got.IsSafe != tt.safe || got.BaseCommand != tt.base {
+			t.Errorf("CheckCommandLine(%q) = %+v, want safe=%v base=%q", tt.command, got, tt.safe, tt.base)
+		}
+	}
+}
+
+func TestHasShellSyntax(t *testing.T) {
+	for _, command := range []string{"uptime", "df -h /", "  ls -la  "} {
+		if HasShellSyntax(command) {
+			t.Errorf("HasShellSyntax(%q) = true, want false", command)
+		}
+	}
+	for _, command := range []string{"uptime; id", "ps | sh", "a && b", "a || b", "echo x > f", "echo $(id)", "sleep 1 &", "cat <(ls)"} {
+		if !HasShellSyntax(command) {
+			t.Errorf("HasShellSyntax(%q) = false, want true", command)
+		}
+	}
+}
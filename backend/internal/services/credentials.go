@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+)
+
+// ErrMissingCredential is returned when a server has no stored credential
+// for its auth type.
+var ErrMissingCredential = errors.New("no credential stored for auth type")
+
+// Decryptor decrypts stored server credentials.
+type Decryptor interface {
+	Decrypt(ciphertext string) (string, error)
+}
+
+// DecryptServerCredentials decrypts whatever credentials a server has stored
+// and checks that the one its AuthType needs is present: the private key for
+// "key", the password for "password". "keyfile" reads the key from the
+// Bastion host and "agent" needs nothing stored. Passphrase-protected keys
+// are returned unlocked.
+func DecryptServerCredentials(dec Decryptor, server *models.Server) (password, privateKey string, err error) {
+	switch server.AuthType {
+	case "agent":
+		return "", "", nil
+	case "keyfile":
+		if server.KeyFile == "" {
+			return "", "", fmt.Errorf("%w: keyfile", ErrMissingCredential)
+		}
+		if privateKey, err = ReadKeyFile(server.KeyFile); err != nil {
+			return "", "", err
+		}
+		privateKey, err = unlockServerKey(dec, server, privateKey)
+		return "", privateKey, err
+	}
+
+	if server.EncryptedPassword != "" {
+		password, err = dec.Decrypt(server.EncryptedPassword)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to decrypt password: %w", err)
+		}
+	}
+	if server.EncryptedPrivateKey != "" {
+		privateKey, err = dec.Decrypt(server.EncryptedPrivateKey)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+	}
+
+	switch server.AuthType {
+	case "key":
+		if privateKey == "" {
+			return "", "", fmt.Errorf("%w: key", ErrMissingCredential)
+		}
+		if privateKey, err = unlockServerKey(dec, server, privateKey); err != nil {
+			return "", "", err
+		}
+	default:
+		if password == "" {
+			return "", "", fmt.Errorf("%w: password", ErrMissingCredential)
+		}
+	}
+
+	return password, privateKey, nil
+}
+
+// unlockServerKey removes the stored passphrase, if any, from privateKey.
+func unlockServerKey(dec Decryptor, server *models.Server, privateKey string) (string, error) {
+	var passphrase string
+	if server.EncryptedPassphrase != "" {
+		var err error
+		passphrase, err = dec.Decrypt(server.EncryptedPassphrase)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt passphrase: %w", err)
+		}
+	}
+	return UnlockPrivateKey(privateKey, passphrase)
+}
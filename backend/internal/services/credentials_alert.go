@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+)
+
+// CredentialsRuleType is the alert rule type that rejected SSH credential
+// alerts are filed under. Like the SSL rule it is created on first use;
+// disabling it mutes the alerts and its notification_channel routes them.
+const CredentialsRuleType = "credentials"
+
+// SetNotifier routes credential alerts through n. Without a notifier the
+// alerts are dashboard-only.
+func (mc *MetricsCollector) SetNotifier(n *AlertNotifier) {
+	mc.notifier = n
+}
+
+// credentialsRule returns the built-in credentials rule, creating it on
+// first use.
+func (mc *MetricsCollector) credentialsRule() (*models.AlertRule, error) {
+	rule := models.AlertRule{
+		Name:     "SSH credentials rejected",
+		Type:     CredentialsRuleType,
+		Metric:   "status",
+		Operator: "==",
+		Severity: "critical",
+		Enabled:  true,
+	}
+	err := mc.db.Where("type = ?", CredentialsRuleType).Attrs(rule).FirstOrCreate(&rule).Error
+	return &rule, err
+}
+
+// openCredentialsAlert returns the server's firing or acknowledged
+// credentials alert, or nil.
+func (mc *MetricsCollector) openCredentialsAlert(rule *models.AlertRule, serverID uuid.UUID) *models.Alert {
+	var alert models.Alert
+	err := mc.db.Where("rule_id = ? AND server_id = ? AND status IN ?", rule.ID, serverID,
+		[]string{"firing", "acknowledged"}).First(&alert).Error
+	if err != nil {
+		return nil
+	}
+	return &alert
+}
+
+// credentialsRejected fires an alert for a server whose credentials stopped
+// working, once per outage.
+func (mc *MetricsCollector) credentialsRejected(server *models.Server, reason string) {
+	rule, err := mc.credentialsRule()
+	if err != nil {
+		slog.Error("Failed to load credentials alert rule", "error", err)
+		return
+	}
+	if !rule.Enabled || mc.openCredentialsAlert(rule, server.ID) != nil {
+		return
+	}
+
+	alert := models.Alert{
+		RuleID:   rule.ID,
+		ServerID: &server.ID,
+		Severity: rule.Severity,
+		Message:  fmt.Sprintf("SSH credentials for %s were rejected; update the server's credentials", server.Name),
+		Details:  reason,
+		Status:   "firing",
+	}
+	if err := mc.db.Create(&alert).Error; err != nil {
+		slog.Error("Failed to create credentials alert", "server", server.Name, "error", err)
+		return
+	}
+	mc.db.Model(rule).Update("last_triggered_at", time.Now())
+
+	mc.events.Publish(EventAlert, alert)
+	mc.notifyCredentials(rule, alert, server.Name, NotifyFiring)
+}
+
+// credentialsAccepted resolves the server's credentials alert once it
+// connects again.
+func (mc *MetricsCollector) credentialsAccepted(server *models.Server) {
+	rule, err := mc.credentialsRule()
+	if err != nil {
+		slog.Error("Failed to load credentials alert rule", "error", err)
+		return
+	}
+	alert := mc.openCredentialsAlert(rule, server.ID)
+	if alert == nil {
+		return
+	}
+
+	now := time.Now()
+	alert.Status = "resolved"
+	alert.ResolvedAt = &now
+	if err := mc.db.Save(alert).Error; err != nil {
+		slog.Error("Failed to resolve credentials alert", "alert", alert.ID, "error", err)
+		return
+	}
+
+	mc.events.Publish(EventAlert, *alert)
+	mc.notifyCredentials(rule, *alert, server.Name, NotifyResolved)
+}
+
+func (mc *MetricsCollector) notifyCredentials(rule *models.AlertRule, alert models.Alert, server, event string) {
+	mc.notifier.Dispatch(rule, AlertNotification{
+		Event:    event,
+		AlertID:  alert.ID,
+		Rule:     rule.Name,
+		Severity: alert.Severity,
+		Server:   server,
+		Message:  alert.Message,
+		Details:  alert.Details,
+		Time:     time.Now(),
+	})
+}
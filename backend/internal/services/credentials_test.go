@@ -0,0 +1,99 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// prefixDecryptor "decrypts" values stored as "enc:<plaintext>".
+type prefixDecryptor struct{}
+
+func (prefixDecryptor) Decrypt(ciphertext string) (string, error) {
+	plain, ok := strings.CutPrefix(ciphertext, "enc:")
+	if !ok {
+		return "", errors.New("cipher: message authentication failed")
+	}
+	return plain, nil
+}
+
+func testPrivateKey(t *testing.T, passphrase string) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(block))
+}
+
+func TestDecryptServerCredentials(t *testing.T) {
+	key := testPrivateKey(t, "")
+	lockedKey := testPrivateKey(t, "hunter2")
+
+	tests := []struct {
+		name         string
+		server       models.Server
+		wantPassword string
+		wantKey      bool
+		wantErr      error
+	}{
+		{"password", models.Server{AuthType: "password", EncryptedPassword: "enc:secret"}, "secret", false, nil},
+		{"empty auth type means password", models.Server{EncryptedPassword: "enc:secret"}, "secret", false, nil},
+		{"key", models.Server{AuthType: "key", EncryptedPrivateKey: "enc:" + key}, "", true, nil},
+		{"key with passphrase", models.Server{AuthType: "key", EncryptedPrivateKey: "enc:" + lockedKey,
+			EncryptedPassphrase: "enc:hunter2"}, "", true, nil},
+		{"key with sudo password", models.Server{AuthType: "key", EncryptedPrivateKey: "enc:" + key,
+			EncryptedPassword: "enc:sudo"}, "sudo", true, nil},
+		{"agent needs nothing", models.Server{AuthType: "agent"}, "", false, nil},
+		{"missing password", models.Server{AuthType: "password", EncryptedPrivateKey: "enc:" + key}, "", false, ErrMissingCredential},
+		{"missing key", models.Server{AuthType: "key", EncryptedPassword: "enc:secret"}, "", false, ErrMissingCredential},
+		{"missing keyfile", models.Server{AuthType: "keyfile"}, "", false, ErrMissingCredential},
+		{"missing passphrase", models.Server{AuthType: "key", EncryptedPrivateKey: "enc:" + lockedKey}, "", false, ErrPassphraseRequired},
+		{"wrong passphrase", models.Server{AuthType: "key", EncryptedPrivateKey: "enc:" + lockedKey,
+			EncryptedPassphrase: "enc:nope"}, "", false, ErrWrongPassphrase},
+	}
+	for _, tt := range tests {
+		password, privateKey, err := DecryptServerCredentials(prefixDecryptor{}, &tt.server)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: DecryptServerCredentials: %v", tt.name, err)
+			continue
+		}
+		if password != tt.wantPassword {
+			t.Errorf("%s: password = %q, want %q", tt.name, password, tt.wantPassword)
+		}
+		if (privateKey != "") != tt.wantKey {
+			t.Errorf("%s: private key returned = %v, want %v", tt.name, privateKey != "", tt.wantKey)
+		}
+		if privateKey != "" {
+			if _, err := ssh.ParsePrivateKey([]byte(privateKey)); err != nil {
+				t.Errorf("%s: returned key is not usable without a passphrase: %v", tt.name, err)
+			}
+		}
+	}
+
+	_, _, err := DecryptServerCredentials(prefixDecryptor{}, &models.Server{AuthType: "password", EncryptedPassword: "tampered"})
+	if err == nil || errors.Is(err, ErrMissingCredential) {
+		t.Errorf("tampered password error = %v, want a decrypt failure", err)
+	}
+}
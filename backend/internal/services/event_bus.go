@@ -0,0 +1,73 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published on the bus.
+const (
+	EventMetrics      = "metrics"
+	EventServerStatus = "server_status"
+	EventMonitorState = "monitor_state"
+	EventAlert        = "alert"
+)
+
+// Event is a typed update broadcast to subscribers.
+type Event struct {
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// EventBus is an in-process fan-out for live updates. Publishing never
+// blocks: slow subscribers miss events once their buffer is full.
+type EventBus struct {
+	mu     sync.RWMutex
+	subs   map[int]chan Event
+	nextID int
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[int]chan Event)}
+}
+
+// Subscribe returns a channel of events and a function that unsubscribes
+// and closes it.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an event to every subscriber. Safe to call on a nil bus.
+func (b *EventBus) Publish(eventType string, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	evt := Event{Type: eventType, Data: data, Timestamp: time.Now()}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KernelLogScript prints the last 5000 kernel log lines from the first
+// readable source, preceded by an "@source <name>" line. "@source none" means
+// every source was empty or denied (dmesg_restrict, user not in the adm or
+// systemd-journal group).
+const KernelLogScript = `if out=$(dmesg -T 2>/dev/null) && [ -n "$out" ]; then
+  echo "@source dmesg"; printf '%s\n' "$out" | tail -n 5000
+elif out=$(journalctl -k -q --no-pager -o short-iso -n 5000 2>/dev/null) && [ -n "$out" ]; then
+  echo "@source journalctl"; printf '%s\n' "$out"
+elif [ -r /var/log/kern.log ]; then
+  echo "@source kern.log"; tail -n 5000 /var/log/kern.log
+else
+  echo "@source none"
+fi`
+
+// Kernel event kinds.
+const (
+	KernelEventOOM      = "oom_kill"
+	KernelEventHardware = "hardware_error"
+)
+
+// KernelEvent is one OOM kill or hardware error parsed from the kernel log.
+// Time is the host's local clock reading, parsed as UTC, and is nil when the
+// line carried no wall-clock timestamp.
+type KernelEvent struct {
+	Kind       string     `json:"kind"`
+	Time       *time.Time `json:"time,omitempty"`
+	RawTime    string     `json:"raw_time,omitempty"`
+	Process    string     `json:"process,omitempty"`
+	PID        int        `json:"pid,omitempty"`
+	TotalVMKB  int64      `json:"total_vm_kb,omitempty"`
+	AnonRSSKB  int64      `json:"anon_rss_kb,omitempty"`
+	FileRSSKB  int64      `json:"file_rss_kb,omitempty"`
+	ShmemRSSKB int64      `json:"shmem_rss_kb,omitempty"`
+	Cgroup     string     `json:"cgroup,omitempty"` // memcg that hit its limit; empty for a host-wide OOM
+	Message    string     `json:"message"`
+}
+
+var (
+	dmesgTimeRe   = regexp.MustCompile(`^\[([A-Z][a-z]{2} [A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} \d{4})\]\s*`)
+	isoTimeRe     = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?)\s+\S+\s+kernel:\s*`)
+	syslogTimeRe  = regexp.MustCompile(`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2})\s+\S+\s+kernel:\s*`)
+	monotonicRe   = regexp.MustCompile(`^\[\s*\d+\.\d+\]\s*`)
+	oomKilledRe   = regexp.MustCompile(`Killed process (\d+) \(([^)]*)\)(.*)`)
+	oomMemcgRe    = regexp.MustCompile(`oom-kill:.*?oom_memcg=([^,\s]+)`)
+	oomSizeRe     = regexp.MustCompile(`(total-vm|anon-rss|file-rss|shmem-rss):(\d+)kB`)
+	hardwareErrRe = regexp.MustCompile(`(?i)(hardware error|machine check|\bmce:|\bedac\b|uncorrected|corrected error|i/o error|blk_update_request|critical medium error|ata\d+(\.\d+)?: .*(failed|error)|nvme\S*: .*(timeout|error|reset))`)
+)
+
+// ParseKernelLog extracts OOM kills and hardware errors from the output of
+// KernelLogScript, oldest first, and returns the source that was read.
+func ParseKernelLog(output string) (source string, events []KernelEvent) {
+	events = []KernelEvent{}
+	var memcg string // from the oom-kill: summary preceding a kill
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if s, ok := strings.CutPrefix(line, "@source "); ok {
+			source = strings.TrimSpace(s)
+			continue
+		}
+
+		msg, raw, ts := splitKernelTimestamp(line)
+		if msg == "" {
+			continue
+		}
+
+		if m := oomMemcgRe.FindStringSubmatch(msg); m != nil {
+			if m[1] != "/" && m[1] != "(null)" {
+				memcg = m[1]
+			}
+			continue
+		}
+
+		if m := oomKilledRe.FindStringSubmatch(msg); m != nil {
+			ev := KernelEvent{Kind: KernelEventOOM, Time: ts, RawTime: raw, Process: m[2], Message: msg}
+			ev.PID, _ = strconv.Atoi(m[1])
+			for _, s := range oomSizeRe.FindAllStringSubmatch(m[3], -1) {
+				kb, _ := strconv.ParseInt(s[2], 10, 64)
+				switch s[1] {
+				case "total-vm":
+					ev.TotalVMKB = kb
+				case "anon-rss":
+					ev.AnonRSSKB = kb
+				case "file-rss":
+					ev.FileRSSKB = kb
+				case "shmem-rss":
+					ev.ShmemRSSKB = kb
+				}
+			}
+			ev.Cgroup, memcg = memcg, ""
+			events = append(events, ev)
+			continue
+		}
+
+		if hardwareErrRe.MatchString(msg) {
+			events = append(events, KernelEvent{Kind: KernelEventHardware, Time: ts, RawTime: raw, Message: msg})
+		}
+	}
+	if source == "" {
+		source = "none"
+	}
+	return source, events
+}
+
+// splitKernelTimestamp strips the dmesg -T, journalctl short-iso or syslog
+// prefix from a kernel log line.
+func splitKernelTimestamp(line string) (msg, raw string, ts *time.Time) {
+	parse := func(layout, value string) *time.Time {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+		return nil
+	}
+
+	switch {
+	case dmesgTimeRe.MatchString(line):
+		m := dmesgTimeRe.FindStringSubmatch(line)
+		raw, msg = m[1], line[len(m[0]):]
+		ts = parse("Mon Jan _2 15:04:05 2006", raw)
+	case isoTimeRe.MatchString(line):
+		m := isoTimeRe.FindStringSubmatch(line)
+		raw, msg = m[1], line[len(m[0]):]
+		for _, layout := range []string{"2006-01-02T15:04:05Z0700", time.RFC3339Nano} {
+			if ts = parse(layout, raw); ts != nil {
+				break
+			}
+		}
+	case syslogTimeRe.MatchString(line):
+		// Syslog omits the year; assume the current one
+		m := syslogTimeRe.FindStringSubmatch(line)
+		raw, msg = m[1], line[len(m[0]):]
+		ts = parse("2006 Jan _2 15:04:05", strconv.Itoa(time.Now().Year())+" "+raw)
+	default:
+		msg = line
+	}
+	msg = strings.TrimSpace(monotonicRe.ReplaceAllString(msg, ""))
+	return msg, raw, ts
+}
+
+// recentOOM keeps the OOM kills seen on each server's latest kernel log read
+// so the AI prompt can mention them without an SSH round trip.
+var recentOOM = struct {
+	sync.Mutex
+	events map[uuid.UUID][]KernelEvent
+	seenAt map[uuid.UUID]time.Time
+}{events: map[uuid.UUID][]KernelEvent{}, seenAt: map[uuid.UUID]time.Time{}}
+
+// RecordKernelEvents remembers the OOM kills from a kernel log read.
+func RecordKernelEvents(serverID uuid.UUID, events []KernelEvent) {
+	var ooms []KernelEvent
+	for _, ev := range events {
+		if ev.Kind == KernelEventOOM {
+			ooms = append(ooms, ev)
+		}
+	}
+	recentOOM.Lock()
+	defer recentOOM.Unlock()
+	recentOOM.events[serverID] = ooms
+	recentOOM.seenAt[serverID] = time.Now()
+}
+
+// RecentOOMEvents returns up to limit of the newest recorded OOM kills for a
+// server that happened within maxAge. Events are aged by their own kernel
+// timestamp; one without a timestamp is aged by when the log was read. The
+// host's clock is parsed as UTC, so the cutoff can be off by its UTC offset.
+func RecentOOMEvents(serverID uuid.UUID, maxAge time.Duration, limit int) []KernelEvent {
+	recentOOM.Lock()
+	defer recentOOM.Unlock()
+	cutoff := time.Now().Add(-maxAge)
+	var ooms []KernelEvent
+	for _, ev := range recentOOM.events[serverID] {
+		at := recentOOM.seenAt[serverID]
+		if ev.Time != nil {
+			at = *ev.Time
+		}
+		if at.After(cutoff) {
+			ooms = append(ooms, ev)
+		}
+	}
+	return ooms[max(len(ooms)-limit, 0):]
+}
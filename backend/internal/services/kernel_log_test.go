@@ -0,0 +1,44 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRecentOOMEventsUsesKernelTimestamp(t *testing.T) {
+	now := time.Now().UTC()
+	line := func(at time.Time, pid int) string {
+		return fmt.Sprintf("%s host kernel: Out of memory: Killed process %d (java) total-vm:100kB, anon-rss:2048kB",
+			at.Format("2006-01-02T15:04:05Z0700"), pid)
+	}
+	output := "@source journalctl\n" +
+		line(now.Add(-72*time.Hour), 1) + "\n" +
+		line(now.Add(-2*time.Hour), 2) + "\n" +
+		"[12345.678] Out of memory: Killed process 3 (node) total-vm:100kB\n"
+	_, events := ParseKernelLog(output)
+	if len(events) != 3 {
+		t.Fatalf("parsed %d events, want 3", len(events))
+	}
+
+	serverID := uuid.New()
+	RecordKernelEvents(serverID, events)
+
+	// The 72h-old kill was read just now but is outside the window; the
+	// untimestamped one is aged by the read
+	got := RecentOOMEvents(serverID, 24*time.Hour, 5)
+	if len(got) != 2 || got[0].PID != 2 || got[1].PID != 3 {
+		t.Fatalf("RecentOOMEvents = %+v, want pids 2 and 3", got)
+	}
+	if got := RecentOOMEvents(serverID, 24*time.Hour, 1); len(got) != 1 || got[0].PID != 3 {
+		t.Errorf("RecentOOMEvents(limit 1) = %+v, want pid 3", got)
+	}
+	if got := RecentOOMEvents(serverID, time.Hour, 5); len(got) != 1 || got[0].PID != 3 {
+		t.Errorf("RecentOOMEvents(1h) = %+v, want pid 3", got)
+	}
+	if got := RecentOOMEvents(uuid.New(), 24*time.Hour, 5); len(got) != 0 {
+		t.Errorf("RecentOOMEvents(unknown server) = %+v, want none", got)
+	}
+}
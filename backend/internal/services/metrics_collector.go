@@ -2,31 +2,86 @@ package services
 
 import (
 	"log/slog"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/ahmetk3436/bastion/internal/crypto"
 	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/ssh"
 	"gorm.io/gorm"
 )
 
+// Connection retries within one collection. Total connect time, dials
+// included, is capped at collectRetryBudget or half the collection interval,
+// whichever is shorter.
+const (
+	collectRetryAttempts = 3
+	collectRetryBackoff  = 500 * time.Millisecond
+	collectRetryBudget   = 20 * time.Second
+)
+
+// Bounds for a per-server collection interval; 0 uses the global interval.
+const (
+	minCollectInterval = 10
+	maxCollectInterval = 86400
+)
+
+// ValidCollectInterval reports whether secs is usable as
+// Server.CollectIntervalSeconds.
+func ValidCollectInterval(secs int) bool {
+	return secs == 0 || (secs >= minCollectInterval && secs <= maxCollectInterval)
+}
+
+// CollectionDue reports whether a server whose last sample was taken at last
+// should be collected on a tick at now. Intervals shorter than the tick
+// collect on every tick. Half a tick of slack absorbs the time a collection
+// takes, so a 300s server on a 60s tick is collected every fifth tick.
+func CollectionDue(serverInterval, tick time.Duration, last, now time.Time) bool {
+	if serverInterval <= tick || last.IsZero() {
+		return true
+	}
+	return now.Sub(last) >= serverInterval-tick/2
+}
+
+// serverHealth counts consecutive collection results for one server.
+type serverHealth struct {
+	failures  int
+	successes int
+}
+
 type MetricsCollector struct {
-	db        *gorm.DB
-	sshPool   *SSHPool
-	encryptor *crypto.Encryptor
-	interval  time.Duration
-	stop      chan struct{}
+	db           *gorm.DB
+	sshPool      *SSHPool
+	encryptor    *crypto.Encryptor
+	interval     time.Duration
+	offlineAfter int
+	onlineAfter  int
+	events       *EventBus
+	notifier     *AlertNotifier // credentials alerts; nil is dashboard-only
+	sink         *MetricsSink   // optional time-series mirror; nil disables
+	stop         chan struct{}
+
+	mu     sync.Mutex
+	health map[uuid.UUID]*serverHealth
 }
 
-func NewMetricsCollector(db *gorm.DB, pool *SSHPool, encryptor *crypto.Encryptor, intervalSecs int) *MetricsCollector {
+// NewMetricsCollector creates a collector. A server is marked offline after
+// offlineAfter consecutive connection failures and back online after
+// onlineAfter consecutive successes; values below 1 are treated as 1. Samples
+// are also written to sink when it is non-nil.
+func NewMetricsCollector(db *gorm.DB, pool *SSHPool, encryptor *crypto.Encryptor, intervalSecs, offlineAfter, onlineAfter int, events *EventBus, sink *MetricsSink) *MetricsCollector {
 	return &MetricsCollector{
-		db:        db,
-		sshPool:   pool,
-		encryptor: encryptor,
-		interval:  time.Duration(intervalSecs) * time.Second,
-		stop:      make(chan struct{}),
+		db:           db,
+		sshPool:      pool,
+		encryptor:    encryptor,
+		interval:     time.Duration(intervalSecs) * time.Second,
+		offlineAfter: max(offlineAfter, 1),
+		onlineAfter:  max(onlineAfter, 1),
+		events:       events,
+		sink:         sink,
+		stop:         make(chan struct{}),
+		health:       make(map[uuid.UUID]*serverHealth),
 	}
 }
 
@@ -70,106 +125,249 @@ func (mc *MetricsCollector) CollectNow() {
 	mc.collectAll()
 }
 
+// collectionErrors is not labeled by server: names are internal topology,
+// and /metrics may be scraped without auth.
+var collectionErrors = DefaultTelemetry.Counter("bastion_metrics_collection_errors_total",
+	"Failed server metrics collections, by reason.", "reason")
+
 func (mc *MetricsCollector) collectServer(server models.Server) {
-	password, privateKey := "", ""
-	if server.EncryptedPassword != "" {
-		p, err := mc.encryptor.Decrypt(server.EncryptedPassword)
-		if err == nil {
-			password = p
+	if server.CollectIntervalSeconds > 0 {
+		var last models.ServerMetrics
+		mc.db.Select("collected_at").Where("server_id = ?", server.ID).Order("collected_at DESC").Limit(1).Find(&last)
+		if !CollectionDue(time.Duration(server.CollectIntervalSeconds)*time.Second, mc.interval, last.CollectedAt, time.Now()) {
+			return
 		}
 	}
-	if server.EncryptedPrivateKey != "" {
-		k, err := mc.encryptor.Decrypt(server.EncryptedPrivateKey)
-		if err == nil {
-			privateKey = k
+
+	password, privateKey, err := DecryptServerCredentials(mc.encryptor, &server)
+	if err != nil {
+		// Unusable credentials won't fix themselves; don't wait for the threshold
+		if server.Status != "auth_error" {
+			slog.Warn("Server credentials unusable", "server", server.Name, "error", err)
 		}
+		collectionErrors.Inc("credentials")
+		mc.setStatus(&server, "auth_error", err.Error())
+		return
 	}
 
-	client, err := mc.sshPool.GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := mc.connectWithRetry(&server, password, privateKey)
 	if err != nil {
-		mc.db.Model(&server).Update("status", "offline")
+		collectionErrors.Inc("connect")
+		mc.recordFailure(&server, err)
 		slog.Debug("Metrics collection failed", "server", server.Name, "error", err)
 		return
 	}
 
-	mc.db.Model(&server).Update("status", "online")
+	mc.recordSuccess(&server)
+
+	// The host is reachable from here on; command failures only affect the sample
+	succeeded := 0
+	run := func(cmd string) string {
+		out := runCommand(client, cmd)
+		if out != "" {
+			succeeded++
+		}
+		return out
+	}
 
 	metrics := models.ServerMetrics{
 		ServerID:    server.ID,
 		CollectedAt: time.Now(),
 	}
 
-	// CPU
-	if out := runCommand(client, `top -bn1 | head -3 | grep 'Cpu' | awk '{print $2}'`); out != "" {
-		metrics.CPUPercent, _ = strconv.ParseFloat(strings.TrimSpace(out), 64)
+	for _, p := range metricsProbes {
+		if out := run(p.cmd); out != "" {
+			// Fields that fail to parse are left at zero
+			p.parse(out, &metrics)
+		}
 	}
 
-	// Memory
-	if out := runCommand(client, `free -m | awk 'NR==2{print $2" "$3}'`); out != "" {
-		parts := strings.Fields(strings.TrimSpace(out))
-		if len(parts) >= 2 {
-			metrics.MemoryTotalMB, _ = strconv.ParseFloat(parts[0], 64)
-			metrics.MemoryUsedMB, _ = strconv.ParseFloat(parts[1], 64)
-		}
+	if succeeded == 0 {
+		collectionErrors.Inc("commands")
+		slog.Warn("Connected but every metrics command failed, skipping sample", "server", server.Name)
+		return
 	}
 
-	// Disk
-	if out := runCommand(client, `df -BG / | awk 'NR==2{gsub("G",""); print $2" "$3}'`); out != "" {
-		parts := strings.Fields(strings.TrimSpace(out))
-		if len(parts) >= 2 {
-			metrics.DiskTotalGB, _ = strconv.ParseFloat(parts[0], 64)
-			metrics.DiskUsedGB, _ = strconv.ParseFloat(parts[1], 64)
-		}
+	mc.db.Create(&metrics)
+	mc.saveInterfaces(&metrics)
+	mc.saveDisks(&metrics)
+	mc.events.Publish(EventMetrics, metrics)
+	mc.sink.Write(MetricsSample{Metrics: metrics, ServerName: server.Name, Host: server.Host})
+	slog.Debug("Metrics collected", "server", server.Name, "cpu", metrics.CPUPercent, "mem_used", metrics.MemoryUsedMB)
+}
+
+// saveInterfaces stores a sample's per-interface counters, with deltas and
+// rates against the server's previous sample.
+func (mc *MetricsCollector) saveInterfaces(m *models.ServerMetrics) {
+	if len(m.Interfaces) == 0 {
+		return
+	}
+	for i := range m.Interfaces {
+		m.Interfaces[i].ServerID = m.ServerID
+		m.Interfaces[i].MetricsID = m.ID
+		m.Interfaces[i].CollectedAt = m.CollectedAt
 	}
 
-	// Load average
-	if out := runCommand(client, `cat /proc/loadavg | awk '{print $1" "$2" "$3}'`); out != "" {
-		parts := strings.Fields(strings.TrimSpace(out))
-		if len(parts) >= 3 {
-			metrics.LoadAvg1m, _ = strconv.ParseFloat(parts[0], 64)
-			metrics.LoadAvg5m, _ = strconv.ParseFloat(parts[1], 64)
-			metrics.LoadAvg15m, _ = strconv.ParseFloat(parts[2], 64)
+	var prev []models.ServerNetworkMetrics
+	latest := mc.db.Model(&models.ServerNetworkMetrics{}).Select("metrics_id").
+		Where("server_id = ?", m.ServerID).Order("collected_at DESC").Limit(1)
+	mc.db.Where("metrics_id = (?)", latest).Find(&prev)
+	networkDeltas(m.Interfaces, prev)
+
+	if err := mc.db.Create(&m.Interfaces).Error; err != nil {
+		slog.Warn("Failed to store network interface metrics", "server_id", m.ServerID, "error", err)
+	}
+}
+
+// saveDisks stores a sample's per-mount disk usage.
+func (mc *MetricsCollector) saveDisks(m *models.ServerMetrics) {
+	if len(m.Disks) == 0 {
+		return
+	}
+	for i := range m.Disks {
+		m.Disks[i].ServerID = m.ServerID
+		m.Disks[i].MetricsID = m.ID
+		m.Disks[i].CollectedAt = m.CollectedAt
+	}
+	if err := mc.db.Create(&m.Disks).Error; err != nil {
+		slog.Warn("Failed to store disk metrics", "server_id", m.ServerID, "error", err)
+	}
+}
+
+// connectWithRetry gets a pooled connection, retrying transient failures with
+// exponential backoff so a single dropped connection doesn't count against
+// the server. Each dial is bounded by the budget left, so a stalled host
+// cannot stretch a collection past it. Rejected credentials are returned
+// immediately.
+func (mc *MetricsCollector) connectWithRetry(server *models.Server, password, privateKey string) (*ssh.Client, error) {
+	deadline := time.Now().Add(min(collectRetryBudget, mc.interval/2))
+	backoff := collectRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		timeout := min(sshDialTimeout, time.Until(deadline))
+		client, err := mc.sshPool.GetConnectionTimeout(server, password, privateKey, timeout)
+		if err == nil {
+			if attempt > 1 {
+				slog.Debug("Metrics connection recovered after retry", "server", server.Name, "attempts", attempt)
+			}
+			return client, nil
+		}
+		if ClassifySSHError(err) == SSHErrAuth || attempt >= collectRetryAttempts || time.Now().Add(backoff).After(deadline) {
+			return nil, err
+		}
+
+		slog.Debug("Metrics connection failed, retrying", "server", server.Name, "attempt", attempt, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-mc.stop:
+			return nil, err
+		}
+		backoff *= 2
+		if time.Until(deadline) <= 0 {
+			return nil, err
 		}
 	}
+}
+
+// recordFailure counts a failed connection and marks the server offline once
+// the failure threshold is reached. Rejected credentials are not transient,
+// so they flip to auth_error immediately.
+func (mc *MetricsCollector) recordFailure(server *models.Server, err error) {
+	mc.mu.Lock()
+	h := mc.healthFor(server.ID)
+	h.failures++
+	h.successes = 0
+	failures := h.failures
+	mc.mu.Unlock()
 
-	// Uptime
-	if out := runCommand(client, `cat /proc/uptime | awk '{print int($1)}'`); out != "" {
-		metrics.UptimeSeconds, _ = strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	status := StatusForSSHError(err)
+	if status == "auth_error" {
+		if server.Status != "auth_error" {
+			slog.Warn("SSH credentials rejected, update server credentials", "server", server.Name, "error", err)
+		}
+		mc.setStatus(server, status, err.Error())
+		return
 	}
 
-	// Docker containers
-	if out := runCommand(client, `docker ps -a --format '{{.Status}}' 2>/dev/null | wc -l`); out != "" {
-		count, _ := strconv.Atoi(strings.TrimSpace(out))
-		metrics.ContainerCount = count
+	if failures < mc.offlineAfter {
+		slog.Debug("Transient collection failure", "server", server.Name, "failures", failures, "threshold", mc.offlineAfter)
+		return
 	}
-	if out := runCommand(client, `docker ps --format '{{.Status}}' 2>/dev/null | wc -l`); out != "" {
-		count, _ := strconv.Atoi(strings.TrimSpace(out))
-		metrics.ContainerRunning = count
+	mc.setStatus(server, status, err.Error())
+}
+
+// recordSuccess counts a successful connection. A server that was offline
+// must succeed onlineAfter times in a row before it is marked online again.
+func (mc *MetricsCollector) recordSuccess(server *models.Server) {
+	mc.mu.Lock()
+	h := mc.healthFor(server.ID)
+	h.successes++
+	h.failures = 0
+	successes := h.successes
+	mc.mu.Unlock()
+
+	recovering := server.Status == "offline" || server.Status == "auth_error"
+	if recovering && successes < mc.onlineAfter {
+		return
 	}
+	mc.setStatus(server, "online", "")
+}
 
-	// Network (bytes since boot)
-	if out := runCommand(client, `cat /proc/net/dev | awk 'NR>2{rx+=$2; tx+=$10} END{print rx" "tx}'`); out != "" {
-		parts := strings.Fields(strings.TrimSpace(out))
-		if len(parts) >= 2 {
-			metrics.NetworkRxBytes, _ = strconv.ParseInt(parts[0], 10, 64)
-			metrics.NetworkTxBytes, _ = strconv.ParseInt(parts[1], 10, 64)
-		}
+// healthFor returns the counters for a server. Caller must hold mc.mu.
+func (mc *MetricsCollector) healthFor(id uuid.UUID) *serverHealth {
+	h, ok := mc.health[id]
+	if !ok {
+		h = &serverHealth{}
+		mc.health[id] = h
 	}
+	return h
+}
 
-	mc.db.Create(&metrics)
-	slog.Debug("Metrics collected", "server", server.Name, "cpu", metrics.CPUPercent, "mem_used", metrics.MemoryUsedMB)
+// setStatus persists a server's status and last error, and publishes a
+// transition event when the status differs from the previous value.
+// Rejected credentials fire a credentials alert even when a connection test
+// already set auth_error; coming back online resolves it.
+func (mc *MetricsCollector) setStatus(server *models.Server, status, lastError string) {
+	previous := server.Status
+	mc.db.Model(server).Updates(map[string]interface{}{
+		"status":     status,
+		"last_error": lastError,
+	})
+	if status == "auth_error" {
+		mc.credentialsRejected(server, lastError)
+	}
+	if previous == status {
+		return
+	}
+	if status == "online" {
+		mc.credentialsAccepted(server)
+	}
+	mc.events.Publish(EventServerStatus, map[string]interface{}{
+		"server_id": server.ID,
+		"name":      server.Name,
+		"from":      previous,
+		"to":        status,
+		"error":     lastError,
+	})
 }
 
 func runCommand(client *ssh.Client, cmd string) string {
-	session, err := client.NewSession()
+	out, err := runCommandOutput(client, cmd)
 	if err != nil {
 		return ""
 	}
-	defer session.Close()
+	return out
+}
 
-	out, err := session.CombinedOutput(cmd)
+// runCommandOutput runs cmd in a new session and returns its combined output
+// along with any session or exit error.
+func runCommandOutput(client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
 	if err != nil {
-		return ""
+		return "", err
 	}
-	return string(out)
+	defer session.Close()
+
+	out, err := session.CombinedOutput(cmd)
+	return string(out), err
 }
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestCollectionDueSkipsTicksWithinServerInterval(t *testing.T) {
+	const tick = 60 * time.Second
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// A 300s server on a 60s tick; each sample lands a few seconds after
+	// its tick, as collection takes time
+	var last time.Time
+	var collected []int
+	for i := 0; i < 20; i++ {
+		now := start.Add(time.Duration(i) * tick)
+		if CollectionDue(300*time.Second, tick, last, now) {
+			collected = append(collected, i)
+			last = now.Add(3 * time.Second)
+		}
+	}
+	want := []int{0, 5, 10, 15}
+	if len(collected) != len(want) {
+		t.Fatalf("collected on ticks %v, want %v", collected, want)
+	}
+	for i := range want {
+		if collected[i] != want[i] {
+			t.Fatalf("collected on ticks %v, want %v", collected, want)
+		}
+	}
+}
+
+func TestCollectionDue(t *testing.T) {
+	const tick = 60 * time.Second
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		interval time.Duration
+		last     time.Time
+		want     bool
+	}{
+		{"300s server one tick after its sample", 300 * time.Second, now.Add(-60 * time.Second), false},
+		{"300s server four ticks after its sample", 300 * time.Second, now.Add(-240 * time.Second), false},
+		{"300s server five ticks after its sample", 300 * time.Second, now.Add(-300 * time.Second), true},
+		{"never collected", 300 * time.Second, time.Time{}, true},
+		{"interval shorter than the tick", 30 * time.Second, now.Add(-time.Second), true},
+		{"interval equal to the tick", tick, now.Add(-time.Second), true},
+	}
+	for _, tt := range tests {
+		if got := CollectionDue(tt.interval, tick, tt.last, now); got != tt.want {
+			t.Errorf("%s: CollectionDue = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidCollectInterval(t *testing.T) {
+	for secs, want := range map[int]bool{0: true, 10: true, 300: true, 86400: true, 5: false, -1: false, 86401: false} {
+		if got := ValidCollectInterval(secs); got != want {
+			t.Errorf("ValidCollectInterval(%d) = %v, want %v", secs, got, want)
+		}
+	}
+}
+
+func TestConnectWithRetryBudgetIncludesDial(t *testing.T) {
+	// A host that accepts TCP connections and never starts the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	server := &models.Server{ID: uuid.New(), Name: "stalled", Host: "127.0.0.1", Port: addr.Port, Username: "root"}
+	mc := &MetricsCollector{
+		sshPool:  &SSHPool{conns: make(map[string][]*SSHConn)},
+		interval: 2 * time.Second, // a 1s budget
+		stop:     make(chan struct{}),
+	}
+
+	start := time.Now()
+	if _, err := mc.connectWithRetry(server, "secret", ""); err == nil {
+		t.Fatal("connectWithRetry succeeded against a stalled host")
+	}
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("connectWithRetry took %s, want it within the 1s budget", elapsed)
+	}
+}
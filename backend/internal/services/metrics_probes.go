@@ -0,0 +1,464 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// metricsProbe is one collection command and the parser that applies its
+// output to a sample. fields names the ServerMetrics JSON fields it sets.
+type metricsProbe struct {
+	name   string
+	cmd    string
+	fields []string
+	parse  func(out string, m *models.ServerMetrics) error
+}
+
+// metricsProbes is the command set run against every server per collection.
+var metricsProbes = []metricsProbe{
+	{
+		// Two snapshots of the aggregate cpu line, half a second apart
+		name:   "cpu",
+		cmd:    `grep '^cpu ' /proc/stat && { sleep 0.5 2>/dev/null || sleep 1; } && grep '^cpu ' /proc/stat`,
+		fields: []string{"cpu_percent"},
+		parse: func(out string, m *models.ServerMetrics) error {
+			pct, err := parseProcStatCPU(out)
+			m.CPUPercent = pct
+			return err
+		},
+	},
+	{
+		name:   "memory",
+		cmd:    `free -m`,
+		fields: []string{"memory_total_mb", "memory_used_mb", "mem_cached_mb", "swap_total_mb", "swap_used_mb"},
+		parse:  parseFree,
+	},
+	{
+		name:   "disk",
+		cmd:    `df -BG / | awk 'NR==2{gsub("G",""); print $2" "$3}'`,
+		fields: []string{"disk_total_gb", "disk_used_gb"},
+		parse: func(out string, m *models.ServerMetrics) error {
+			return parseFloats(out, &m.DiskTotalGB, &m.DiskUsedGB)
+		},
+	},
+	{
+		// Pseudo and image filesystems are left out: squashfs snaps are
+		// always full. Sizes are read in MB because -BG rounds up, which
+		// makes a small /boot look full. df still lists what it can read if
+		// some mount fails.
+		name:   "mounts",
+		cmd:    `df -BM --output=target,size,used,avail -x tmpfs -x devtmpfs -x overlay -x squashfs 2>/dev/null || true`,
+		fields: []string{"disks", "disk_max_percent", "disk_max_mount"},
+		parse:  parseDiskProbe,
+	},
+	{
+		name:   "load",
+		cmd:    `cat /proc/loadavg | awk '{print $1" "$2" "$3}'`,
+		fields: []string{"load_avg_1m", "load_avg_5m", "load_avg_15m"},
+		parse: func(out string, m *models.ServerMetrics) error {
+			return parseFloats(out, &m.LoadAvg1m, &m.LoadAvg5m, &m.LoadAvg15m)
+		},
+	},
+	{
+		name:   "uptime",
+		cmd:    `cat /proc/uptime | awk '{print int($1)}'`,
+		fields: []string{"uptime_seconds"},
+		parse: func(out string, m *models.ServerMetrics) error {
+			return parseInts(out, &m.UptimeSeconds)
+		},
+	},
+	{
+		name:   "containers",
+		cmd:    `docker ps -a --format '{{.Status}}' 2>/dev/null | wc -l`,
+		fields: []string{"container_count"},
+		parse: func(out string, m *models.ServerMetrics) error {
+			var n int64
+			err := parseInts(out, &n)
+			m.ContainerCount = int(n)
+			return err
+		},
+	},
+	{
+		name:   "containers_running",
+		cmd:    `docker ps --format '{{.Status}}' 2>/dev/null | wc -l`,
+		fields: []string{"container_running"},
+		parse: func(out string, m *models.ServerMetrics) error {
+			var n int64
+			err := parseInts(out, &n)
+			m.ContainerRunning = int(n)
+			return err
+		},
+	},
+	{
+		name:   "network",
+		cmd:    `cat /proc/net/dev`,
+		fields: []string{"network_rx_bytes", "network_tx_bytes", "interfaces"},
+		parse:  parseNetworkProbe,
+	},
+	{
+		// Prints nothing on servers without nvidia-smi
+		name:   "gpu",
+		cmd:    `command -v nvidia-smi >/dev/null 2>&1 && nvidia-smi --query-gpu=utilization.gpu,memory.used,memory.total --format=csv,noheader,nounits || true`,
+		fields: []string{"gpu_util_percent", "gpu_mem_used_mb", "gpu_mem_total_mb"},
+		parse:  parseNvidiaSmi,
+	},
+}
+
+// parseNvidiaSmi parses one "util, mem used, mem total" row per GPU from
+// nvidia-smi's CSV output into the GPU fields: mean utilization and summed
+// memory. Empty output (no nvidia-smi) leaves them nil. Rows that fail to
+// parse, such as a driver error message, are an error and are not stored.
+func parseNvidiaSmi(out string, m *models.ServerMetrics) error {
+	var util, used, total float64
+	gpus := 0
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var u, mu, mt float64
+		if err := parseFloats(strings.ReplaceAll(line, ",", " "), &u, &mu, &mt); err != nil {
+			return fmt.Errorf("gpu %d: %w", gpus, err)
+		}
+		util += u
+		used += mu
+		total += mt
+		gpus++
+	}
+	if gpus == 0 {
+		return nil
+	}
+
+	util /= float64(gpus)
+	m.GPUUtilPercent = &util
+	m.GPUMemUsedMB = &used
+	m.GPUMemTotalMB = &total
+	return nil
+}
+
+// parseFree parses `free -m`, finding columns by their header so it reads
+// both the buff/cache column of current procps and busybox and the separate
+// buffers and cached columns of older versions. A missing Mem: row is an
+// error; a missing Swap: row leaves swap at zero.
+func parseFree(out string, m *models.ServerMetrics) error {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	col := make(map[string]int)
+	for i, name := range strings.Fields(lines[0]) {
+		col[name] = i
+	}
+
+	var memFound bool
+	var firstErr error
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// Rows start with a label the header has no column for
+		values := fields[1:]
+		get := func(name string) (float64, bool) {
+			i, ok := col[name]
+			if !ok || i >= len(values) {
+				return 0, false
+			}
+			v, err := strconv.ParseFloat(values[i], 64)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s %s: %w", fields[0], name, err)
+				}
+				return 0, false
+			}
+			return v, true
+		}
+
+		switch fields[0] {
+		case "Mem:":
+			memFound = true
+			m.MemoryTotalMB, _ = get("total")
+			m.MemoryUsedMB, _ = get("used")
+			if cache, ok := get("buff/cache"); ok {
+				m.MemCachedMB = cache
+			} else {
+				buffers, _ := get("buffers")
+				cached, _ := get("cached")
+				m.MemCachedMB = buffers + cached
+			}
+		case "Swap:":
+			m.SwapTotalMB, _ = get("total")
+			m.SwapUsedMB, _ = get("used")
+		}
+	}
+	if !memFound {
+		return fmt.Errorf("no Mem: row in free output")
+	}
+	return firstErr
+}
+
+// parseProcStatCPU computes total CPU utilization from two snapshots of
+// /proc/stat's "cpu" line: the share of jiffies between them not spent idle
+// or waiting on I/O. guest time is already counted in user and nice, so
+// only the first eight counters make up the total.
+func parseProcStatCPU(out string) (float64, error) {
+	var snaps [][8]uint64
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var snap [8]uint64
+		for i := 0; i < len(snap) && i+1 < len(fields); i++ {
+			v, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("cpu field %d: %w", i+1, err)
+			}
+			snap[i] = v
+		}
+		snaps = append(snaps, snap)
+	}
+	if len(snaps) != 2 {
+		return 0, fmt.Errorf("expected 2 cpu lines, got %d", len(snaps))
+	}
+
+	var total, idle [2]uint64
+	for i, snap := range snaps {
+		for _, v := range snap {
+			total[i] += v
+		}
+		idle[i] = snap[3] + snap[4] // idle + iowait
+	}
+	if total[1] <= total[0] {
+		return 0, fmt.Errorf("no cpu time elapsed between snapshots")
+	}
+	dTotal := float64(total[1] - total[0])
+	// iowait can go backwards on some kernels
+	dIdle := float64(idle[1]) - float64(idle[0])
+	busy := (dTotal - dIdle) / dTotal * 100
+	return math.Round(math.Min(math.Max(busy, 0), 100)*100) / 100, nil
+}
+
+// parseDiskProbe stores every mount's usage and picks out the fullest.
+func parseDiskProbe(out string, m *models.ServerMetrics) error {
+	disks, err := parseDfMounts(out)
+	m.Disks = disks
+	m.DiskMaxPercent, m.DiskMaxMount = 0, ""
+	for _, d := range disks {
+		if m.DiskMaxMount == "" || d.UsedPercent > m.DiskMaxPercent {
+			m.DiskMaxPercent, m.DiskMaxMount = d.UsedPercent, d.Mount
+		}
+	}
+	return err
+}
+
+// parseDfMounts parses `df -BM --output=target,size,used,avail` into sizes
+// in GB. Size, used and avail are the last three columns, so mount points
+// containing spaces survive. Usage is used/(used+avail) as df reports it:
+// blocks reserved for root count as neither. Lines that fail to parse are
+// skipped and reported.
+func parseDfMounts(out string) ([]models.ServerDiskMetrics, error) {
+	var disks []models.ServerDiskMetrics
+	var firstErr error
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 4 {
+			continue // header
+		}
+		n := len(fields)
+		mount := strings.Join(fields[:n-3], " ")
+		var size, used, avail float64
+		sizes := strings.ReplaceAll(strings.Join(fields[n-3:], " "), "M", "")
+		if err := parseFloats(sizes, &size, &used, &avail); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("mount %s: %w", mount, err)
+			}
+			continue
+		}
+		// Bind mounts of one filesystem are listed once per target
+		if seen[mount] {
+			continue
+		}
+		seen[mount] = true
+
+		d := models.ServerDiskMetrics{
+			Mount:  mount,
+			SizeGB: math.Round(size/1024*100) / 100,
+			UsedGB: math.Round(used/1024*100) / 100,
+		}
+		if used+avail > 0 {
+			d.UsedPercent = math.Round(used/(used+avail)*10000) / 100
+		}
+		disks = append(disks, d)
+	}
+	return disks, firstErr
+}
+
+// parseNetworkProbe stores /proc/net/dev's per-interface counters and their
+// sums, loopback excluded.
+func parseNetworkProbe(out string, m *models.ServerMetrics) error {
+	ifaces, err := parseNetDev(out)
+	m.Interfaces = ifaces
+	m.NetworkRxBytes, m.NetworkTxBytes = 0, 0
+	for _, iface := range ifaces {
+		m.NetworkRxBytes += iface.RxBytes
+		m.NetworkTxBytes += iface.TxBytes
+	}
+	return err
+}
+
+// parseNetDev parses /proc/net/dev into one entry per interface other than
+// lo. A line whose counters fail to parse is skipped and reported.
+func parseNetDev(out string) ([]models.ServerNetworkMetrics, error) {
+	var ifaces []models.ServerNetworkMetrics
+	var firstErr error
+	for _, line := range strings.Split(out, "\n") {
+		// The two header lines have no colon
+		name, counters, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || name == "lo" {
+			continue
+		}
+
+		// Receive: bytes packets errs drop fifo frame compressed multicast,
+		// then transmit: bytes packets errs drop ...
+		var v [12]int64
+		dst := make([]*int64, len(v))
+		for i := range v {
+			dst[i] = &v[i]
+		}
+		if err := parseInts(counters, dst...); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("interface %s: %w", name, err)
+			}
+			continue
+		}
+		ifaces = append(ifaces, models.ServerNetworkMetrics{
+			Interface: name,
+			RxBytes:   v[0],
+			RxPackets: v[1],
+			RxErrors:  v[2],
+			RxDropped: v[3],
+			TxBytes:   v[8],
+			TxPackets: v[9],
+			TxErrors:  v[10],
+			TxDropped: v[11],
+		})
+	}
+	return ifaces, firstErr
+}
+
+// networkDeltas sets each interface's deltas and rates against the matching
+// interface in prev. A counter lower than before (a reboot or a recreated
+// interface) gets no delta.
+func networkDeltas(cur, prev []models.ServerNetworkMetrics) {
+	last := make(map[string]models.ServerNetworkMetrics, len(prev))
+	for _, p := range prev {
+		last[p.Interface] = p
+	}
+	for i := range cur {
+		p, ok := last[cur[i].Interface]
+		if !ok {
+			continue
+		}
+		secs := cur[i].CollectedAt.Sub(p.CollectedAt).Seconds()
+		if secs <= 0 {
+			continue
+		}
+		cur[i].RxDelta, cur[i].RxRate = counterDelta(cur[i].RxBytes, p.RxBytes, secs)
+		cur[i].TxDelta, cur[i].TxRate = counterDelta(cur[i].TxBytes, p.TxBytes, secs)
+	}
+}
+
+func counterDelta(cur, prev int64, secs float64) (*int64, *float64) {
+	if cur < prev {
+		return nil, nil
+	}
+	delta := cur - prev
+	rate := float64(delta) / secs
+	return &delta, &rate
+}
+
+// parseFloats parses the whitespace-separated fields of out into dst in
+// order. Fields that fail to parse are left at zero.
+func parseFloats(out string, dst ...*float64) error {
+	parts := strings.Fields(out)
+	if len(parts) < len(dst) {
+		return fmt.Errorf("expected %d fields, got %d", len(dst), len(parts))
+	}
+	var firstErr error
+	for i, d := range dst {
+		v, err := strconv.ParseFloat(parts[i], 64)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("field %d: %w", i+1, err)
+		}
+		*d = v
+	}
+	return firstErr
+}
+
+// parseInts is parseFloats for integer fields.
+func parseInts(out string, dst ...*int64) error {
+	parts := strings.Fields(out)
+	if len(parts) < len(dst) {
+		return fmt.Errorf("expected %d fields, got %d", len(dst), len(parts))
+	}
+	var firstErr error
+	for i, d := range dst {
+		v, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("field %d: %w", i+1, err)
+		}
+		*d = v
+	}
+	return firstErr
+}
+
+// ProbeResult is the outcome of one metrics command in a diagnostic run.
+type ProbeResult struct {
+	Name       string                 `json:"name"`
+	Command    string                 `json:"command"`
+	Output     string                 `json:"output"`
+	CommandErr string                 `json:"command_error,omitempty"`
+	ParseErr   string                 `json:"parse_error,omitempty"`
+	Parsed     map[string]interface{} `json:"parsed"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+// DiagnoseMetrics runs every metrics command once on client and reports
+// each command's raw output, error and parsed values. Nothing is stored.
+func DiagnoseMetrics(client *ssh.Client) []ProbeResult {
+	results := make([]ProbeResult, 0, len(metricsProbes))
+	for _, p := range metricsProbes {
+		start := time.Now()
+		out, err := runCommandOutput(client, p.cmd)
+		result := ProbeResult{
+			Name:       p.name,
+			Command:    p.cmd,
+			Output:     out,
+			Parsed:     map[string]interface{}{},
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			result.CommandErr = err.Error()
+		}
+
+		var sample models.ServerMetrics
+		if perr := p.parse(out, &sample); perr != nil {
+			result.ParseErr = perr.Error()
+		}
+		var all map[string]interface{}
+		raw, _ := json.Marshal(sample)
+		json.Unmarshal(raw, &all)
+		for _, f := range p.fields {
+			result.Parsed[f] = all[f]
+		}
+
+		results = append(results, result)
+	}
+	return results
+}
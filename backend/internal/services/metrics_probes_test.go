@@ -0,0 +1,153 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+)
+
+const procNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 9876543     1234    0    0    0     0          0         0  9876543     1234    0    0    0     0       0          0
+  eth0:123456789   98765    1    2    0     0          0        10 87654321   56789    3    4    0     0       0          0
+docker0:     500       5    0    0    0     0          0         0     1500      15    0    0    0     0       0          0
+ wlan0: garbage
+`
+
+func TestParseNetDev(t *testing.T) {
+	ifaces, err := parseNetDev(procNetDev)
+	if err == nil {
+		t.Error("parseNetDev ignored the unparseable wlan0 line")
+	}
+	want := []models.ServerNetworkMetrics{
+		{Interface: "eth0", RxBytes: 123456789, RxPackets: 98765, RxErrors: 1, RxDropped: 2,
+			TxBytes: 87654321, TxPackets: 56789, TxErrors: 3, TxDropped: 4},
+		{Interface: "docker0", RxBytes: 500, RxPackets: 5, TxBytes: 1500, TxPackets: 15},
+	}
+	if len(ifaces) != len(want) {
+		t.Fatalf("parseNetDev = %+v, want %d interfaces without lo", ifaces, len(want))
+	}
+	for i := range want {
+		if ifaces[i] != want[i] {
+			t.Errorf("interface %d = %+v, want %+v", i, ifaces[i], want[i])
+		}
+	}
+
+	var m models.ServerMetrics
+	parseNetworkProbe(procNetDev, &m)
+	if m.NetworkRxBytes != 123457289 || m.NetworkTxBytes != 87655821 {
+		t.Errorf("totals = %d/%d, want 123457289/87655821", m.NetworkRxBytes, m.NetworkTxBytes)
+	}
+}
+
+func TestParseProcStatCPU(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want float64
+	}{
+		// 1000 jiffies elapse: 150 idle and 50 iowait, so 80% busy
+		{"busy", "cpu  1000 0 500 8000 100 0 0 0 0 0\ncpu  1600 0 700 8150 150 0 0 0 0 0\n", 80},
+		// guest (field 9) is already counted in user and is not added again
+		{"guest", "cpu  100 0 0 900 0 0 0 0 50 0\ncpu  200 0 0 1000 0 0 0 0 150 0\n", 50},
+		// iowait going backwards clamps at fully busy
+		{"iowait backwards", "cpu  0 0 0 100 50 0 0 0\ncpu  100 0 0 100 0 0 0 0\n", 100},
+		// kernels before 2.6.33 print fewer counters
+		{"short line", "cpu  10 0 10 80\ncpu  20 0 20 160\n", 20},
+	}
+	for _, tt := range tests {
+		got, err := parseProcStatCPU(tt.out)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: parseProcStatCPU = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	for _, out := range []string{
+		"cpu  1 2 3 4 5 6 7 8\n",
+		"cpu  1 2 3 4 5 6 7 8\ncpu  1 2 3 4 5 6 7 8\n",
+		"cpu  1 2 3 x 5\ncpu  1 2 3 4 5\n",
+	} {
+		if _, err := parseProcStatCPU(out); err == nil {
+			t.Errorf("parseProcStatCPU(%q) succeeded, want an error", out)
+		}
+	}
+}
+
+func TestParseFree(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want models.ServerMetrics
+	}{
+		{"procps 3.3", `               total        used        free      shared  buff/cache   available
+Mem:           15895        4210        6123         512        5561       10842
+Swap:           2047         128        1919
+`, models.ServerMetrics{MemoryTotalMB: 15895, MemoryUsedMB: 4210, MemCachedMB: 5561, SwapTotalMB: 2047, SwapUsedMB: 128}},
+		{"procps 3.2 buffers and cached", `             total       used       free     shared    buffers     cached
+Mem:          7984       7712        272          0        321       5120
+-/+ buffers/cache:       2271       5713
+Swap:         4095          0       4095
+`, models.ServerMetrics{MemoryTotalMB: 7984, MemoryUsedMB: 7712, MemCachedMB: 5441, SwapTotalMB: 4095}},
+		{"busybox without swap", `              total        used        free      shared  buff/cache   available
+Mem:            983         201         412           1         369         641
+`, models.ServerMetrics{MemoryTotalMB: 983, MemoryUsedMB: 201, MemCachedMB: 369}},
+	}
+	for _, tt := range tests {
+		var m models.ServerMetrics
+		if err := parseFree(tt.out, &m); err != nil {
+			t.Errorf("%s: parseFree: %v", tt.name, err)
+		}
+		if m.MemoryTotalMB != tt.want.MemoryTotalMB || m.MemoryUsedMB != tt.want.MemoryUsedMB ||
+			m.MemCachedMB != tt.want.MemCachedMB || m.SwapTotalMB != tt.want.SwapTotalMB || m.SwapUsedMB != tt.want.SwapUsedMB {
+			t.Errorf("%s: total/used/cache/swap = %v/%v/%v/%v/%v, want %v/%v/%v/%v/%v", tt.name,
+				m.MemoryTotalMB, m.MemoryUsedMB, m.MemCachedMB, m.SwapTotalMB, m.SwapUsedMB,
+				tt.want.MemoryTotalMB, tt.want.MemoryUsedMB, tt.want.MemCachedMB, tt.want.SwapTotalMB, tt.want.SwapUsedMB)
+		}
+	}
+
+	var m models.ServerMetrics
+	if err := parseFree("              total        used\nSwap:          100          10\n", &m); err == nil {
+		t.Error("parseFree without a Mem: row succeeded, want an error")
+	}
+	if err := parseFree("              total        used\nMem:          100          x\n", &m); err == nil {
+		t.Error("parseFree with a bad used column succeeded, want an error")
+	}
+}
+
+func TestParseDfMounts(t *testing.T) {
+	out := `Mounted on                1M-blocks   Used  Avail
+/                            50000M 45000M  2500M
+/boot                          973M   200M   706M
+/mnt/My Backups             100000M 25000M 75000M
+/srv/data                   100000M 25000M 75000M
+/srv/data                   100000M 25000M 75000M
+/media/broken                    -      -      -
+/var/lib/empty                  0M     0M     0M
+`
+	disks, err := parseDfMounts(out)
+	if err == nil {
+		t.Error("parseDfMounts ignored the unparseable /media/broken line")
+	}
+	want := []models.ServerDiskMetrics{
+		// 5% of / is reserved for root: 45000 of the 47500 usable MB
+		{Mount: "/", SizeGB: 48.83, UsedGB: 43.95, UsedPercent: 94.74},
+		{Mount: "/boot", SizeGB: 0.95, UsedGB: 0.2, UsedPercent: 22.08},
+		{Mount: "/mnt/My Backups", SizeGB: 97.66, UsedGB: 24.41, UsedPercent: 25},
+		{Mount: "/srv/data", SizeGB: 97.66, UsedGB: 24.41, UsedPercent: 25},
+		{Mount: "/var/lib/empty"},
+	}
+	if len(disks) != len(want) {
+		t.Fatalf("parseDfMounts = %+v, want %d mounts with the bind duplicate dropped", disks, len(want))
+	}
+	for i := range want {
+		if disks[i] != want[i] {
+			t.Errorf("mount %d = %+v, want %+v", i, disks[i], want[i])
+		}
+	}
+
+	var m models.ServerMetrics
+	parseDiskProbe(out, &m)
+	if m.DiskMaxMount != "/" || m.DiskMaxPercent != 94.74 {
+		t.Errorf("fullest = %s %v, want / 94.74", m.DiskMaxMount, m.DiskMaxPercent)
+	}
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/klauspost/compress/snappy"
+)
+
+const (
+	metricsSinkQueueSize = 1000
+	metricsSinkBatchSize = 100
+)
+
+// MetricsSample is one collected sample with the labels identifying its server.
+type MetricsSample struct {
+	Metrics    models.ServerMetrics
+	ServerName string
+	Host       string
+}
+
+// MetricsSink mirrors collected samples to a time-series backend using
+// InfluxDB line protocol or Prometheus remote-write. Writes are queued and
+// sent in batches in the background; failures are logged and dropped so
+// Postgres collection is never affected.
+type MetricsSink struct {
+	kind  string
+	url   string
+	token string
+
+	client *http.Client
+	queue  chan MetricsSample
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewMetricsSink creates a sink for kind "influxdb" or "prometheus". url is
+// the full write endpoint, e.g.
+// "http://influx:8086/api/v2/write?org=ops&bucket=bastion" or
+// "http://prometheus:9090/api/v1/write".
+func NewMetricsSink(kind, url, token string) (*MetricsSink, error) {
+	if kind != "influxdb" && kind != "prometheus" {
+		return nil, fmt.Errorf("unknown metrics sink type %q", kind)
+	}
+	if url == "" {
+		return nil, fmt.Errorf("metrics sink URL is required")
+	}
+
+	return &MetricsSink{
+		kind:   kind,
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan MetricsSample, metricsSinkQueueSize),
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+func (s *MetricsSink) Start() {
+	s.wg.Add(1)
+	go s.loop()
+	slog.Info("Metrics sink started", "type", s.kind)
+}
+
+// Stop flushes queued samples and waits for the sender to exit.
+func (s *MetricsSink) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+	slog.Info("Metrics sink stopped")
+}
+
+// Write queues a sample. It never blocks; samples are dropped with a warning
+// if the queue is full. Safe to call on a nil sink.
+func (s *MetricsSink) Write(sample MetricsSample) {
+	if s == nil {
+		return
+	}
+
+	select {
+	case s.queue <- sample:
+	default:
+		slog.Warn("Metrics sink queue full, dropping sample", "server", sample.ServerName)
+	}
+}
+
+func (s *MetricsSink) loop() {
+	defer s.wg.Done()
+	for {
+		select {
+		case first := <-s.queue:
+			s.flush(s.drain(first))
+		case <-s.stop:
+			for {
+				select {
+				case first := <-s.queue:
+					s.flush(s.drain(first))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// drain collects up to metricsSinkBatchSize queued samples without waiting.
+func (s *MetricsSink) drain(first MetricsSample) []MetricsSample {
+	batch := []MetricsSample{first}
+	for len(batch) < metricsSinkBatchSize {
+		select {
+		case sample := <-s.queue:
+			batch = append(batch, sample)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (s *MetricsSink) flush(batch []MetricsSample) {
+	var (
+		body    []byte
+		headers = map[string]string{}
+	)
+
+	switch s.kind {
+	case "influxdb":
+		body = encodeInfluxLines(batch)
+		headers["Content-Type"] = "text/plain; charset=utf-8"
+		if s.token != "" {
+			headers["Authorization"] = "Token " + s.token
+		}
+	case "prometheus":
+		body = snappy.Encode(nil, encodeRemoteWrite(batch))
+		headers["Content-Type"] = "application/x-protobuf"
+		headers["Content-Encoding"] = "snappy"
+		headers["X-Prometheus-Remote-Write-Version"] = "0.1.0"
+		if s.token != "" {
+			headers["Authorization"] = "Bearer " + s.token
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Metrics sink request failed", "type", s.kind, "error", err)
+		return
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		slog.Warn("Metrics sink write failed", "type", s.kind, "samples", len(batch), "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Warn("Metrics sink write rejected", "type", s.kind, "samples", len(batch), "status", resp.StatusCode)
+	}
+}
+
+// sampleValues flattens a sample into metric name → value. GPU metrics are
+// only present on servers that report them.
+func sampleValues(m models.ServerMetrics) map[string]float64 {
+	values := map[string]float64{
+		"cpu_percent":       m.CPUPercent,
+		"memory_used_mb":    m.MemoryUsedMB,
+		"memory_total_mb":   m.MemoryTotalMB,
+		"mem_cached_mb":     m.MemCachedMB,
+		"swap_used_mb":      m.SwapUsedMB,
+		"swap_total_mb":     m.SwapTotalMB,
+		"disk_used_gb":      m.DiskUsedGB,
+		"disk_total_gb":     m.DiskTotalGB,
+		"disk_max_percent":  m.DiskMaxPercent,
+		"network_rx_bytes":  float64(m.NetworkRxBytes),
+		"network_tx_bytes":  float64(m.NetworkTxBytes),
+		"container_count":   float64(m.ContainerCount),
+		"container_running": float64(m.ContainerRunning),
+		"load_avg_1m":       m.LoadAvg1m,
+		"load_avg_5m":       m.LoadAvg5m,
+		"load_avg_15m":      m.LoadAvg15m,
+		"uptime_seconds":    float64(m.UptimeSeconds),
+	}
+	if m.GPUUtilPercent != nil {
+		values["gpu_util_percent"] = *m.GPUUtilPercent
+		values["gpu_mem_used_mb"] = *m.GPUMemUsedMB
+		values["gpu_mem_total_mb"] = *m.GPUMemTotalMB
+	}
+	return values
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ─── InfluxDB line protocol ─────────────────────────────────────────────────
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// encodeInfluxLines renders one "bastion_server" point per sample with
+// nanosecond timestamps.
+func encodeInfluxLines(batch []MetricsSample) []byte {
+	var buf bytes.Buffer
+	for _, sample := range batch {
+		fmt.Fprintf(&buf, "bastion_server,server_id=%s,server=%s,host=%s ",
+			sample.Metrics.ServerID,
+			influxTagEscaper.Replace(sample.ServerName),
+			influxTagEscaper.Replace(sample.Host))
+
+		values := sampleValues(sample.Metrics)
+		for i, name := range sortedKeys(values) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(name)
+			buf.WriteByte('=')
+			buf.WriteString(strconv.FormatFloat(values[name], 'f', -1, 64))
+		}
+		fmt.Fprintf(&buf, " %d\n", sample.Metrics.CollectedAt.UnixNano())
+	}
+	return buf.Bytes()
+}
+
+// ─── Prometheus remote-write ────────────────────────────────────────────────
+
+// encodeRemoteWrite builds a prometheus.WriteRequest protobuf with one
+// "bastion_<metric>" series per value. The message is small enough to
+// encode by hand rather than pull in generated protobuf code.
+func encodeRemoteWrite(batch []MetricsSample) []byte {
+	var req []byte
+	for _, sample := range batch {
+		labels := [][2]string{
+			{"host", sample.Host},
+			{"server", sample.ServerName},
+			{"server_id", sample.Metrics.ServerID.String()},
+		}
+		ts := sample.Metrics.CollectedAt.UnixMilli()
+
+		values := sampleValues(sample.Metrics)
+		for _, name := range sortedKeys(values) {
+			var series []byte
+			// Labels must be sorted by name; __name__ sorts first
+			series = pbMessage(series, 1, pbLabel("__name__", "bastion_"+name))
+			for _, l := range labels {
+				series = pbMessage(series, 1, pbLabel(l[0], l[1]))
+			}
+
+			var s []byte
+			s = binary.AppendUvarint(s, 1<<3|1) // value: double
+			s = binary.LittleEndian.AppendUint64(s, math.Float64bits(values[name]))
+			s = binary.AppendUvarint(s, 2<<3|0) // timestamp: int64
+			s = binary.AppendUvarint(s, uint64(ts))
+			series = pbMessage(series, 2, s)
+
+			req = pbMessage(req, 1, series)
+		}
+	}
+	return req
+}
+
+func pbLabel(name, value string) []byte {
+	var b []byte
+	b = pbMessage(b, 1, []byte(name))
+	b = pbMessage(b, 2, []byte(value))
+	return b
+}
+
+// pbMessage appends a length-delimited field (strings and sub-messages).
+func pbMessage(b []byte, field int, payload []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
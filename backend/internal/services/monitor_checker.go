@@ -4,21 +4,27 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/ahmetk3436/bastion/internal/models"
 	"gorm.io/gorm"
 )
 
+// ValidMonitorTypes lists the monitor types the checker can probe.
+var ValidMonitorTypes = map[string]bool{"http": true, "tcp": true, "ping": true, "dns": true}
+
 type MonitorChecker struct {
-	db   *gorm.DB
-	stop chan struct{}
+	db     *gorm.DB
+	events *EventBus
+	stop   chan struct{}
 }
 
-func NewMonitorChecker(db *gorm.DB) *MonitorChecker {
+func NewMonitorChecker(db *gorm.DB, events *EventBus) *MonitorChecker {
 	return &MonitorChecker{
-		db:   db,
-		stop: make(chan struct{}),
+		db:     db,
+		events: events,
+		stop:   make(chan struct{}),
 	}
 }
 
@@ -62,20 +68,51 @@ func (mc *MonitorChecker) checkAll() {
 }
 
 func (mc *MonitorChecker) checkOne(m models.Monitor) {
-	start := time.Now()
-	client := &http.Client{Timeout: time.Duration(m.TimeoutMs) * time.Millisecond}
+	mc.savePing(m, mc.probe(m))
+}
+
+// CheckNow checks a monitor immediately, outside its schedule, records the
+// ping and updates the monitor's stats like a scheduled check.
+func (mc *MonitorChecker) CheckNow(m models.Monitor) models.MonitorPing {
+	ping := mc.probe(m)
+	mc.savePing(m, ping)
+	return ping
+}
 
+// probe performs one check of the monitor's type without recording it.
+func (mc *MonitorChecker) probe(m models.Monitor) models.MonitorPing {
 	ping := models.MonitorPing{
 		MonitorID: m.ID,
 		CheckedAt: time.Now(),
 	}
 
+	// Expected statuses only apply to HTTP monitors
+	switch m.Type {
+	case "http", "":
+		probeHTTP(m, &ping)
+	case "tcp":
+		probeTCP(m, &ping)
+	case "ping":
+		probePing(m, &ping)
+	case "dns":
+		probeDNS(m, &ping)
+	default:
+		ping.Status = "down"
+		ping.Error = fmt.Sprintf("unsupported monitor type %q", m.Type)
+	}
+	return ping
+}
+
+// probeHTTP requests the monitor URL and checks the status code.
+func probeHTTP(m models.Monitor, ping *models.MonitorPing) {
+	start := time.Now()
+	client := &http.Client{Timeout: time.Duration(m.TimeoutMs) * time.Millisecond}
+
 	req, err := http.NewRequest(m.Method, m.URL, nil)
 	if err != nil {
 		ping.Status = "down"
 		ping.Error = fmt.Sprintf("invalid request: %s", err.Error())
 		ping.ResponseMs = int(time.Since(start).Milliseconds())
-		mc.savePing(m, ping)
 		return
 	}
 
@@ -89,18 +126,33 @@ func (mc *MonitorChecker) checkOne(m models.Monitor) {
 	} else {
 		defer resp.Body.Close()
 		ping.StatusCode = resp.StatusCode
-		if resp.StatusCode == m.ExpectedStatus {
+		expected := AcceptedStatuses(m)
+		if slices.Contains(expected, resp.StatusCode) {
 			ping.Status = "up"
 		} else {
 			ping.Status = "down"
-			ping.Error = fmt.Sprintf("expected %d, got %d", m.ExpectedStatus, resp.StatusCode)
+			ping.Error = fmt.Sprintf("expected %v, got %d", expected, resp.StatusCode)
 		}
 	}
+}
 
-	mc.savePing(m, ping)
+// AcceptedStatuses returns the status codes that count as up for a monitor.
+// Monitors created before ExpectedStatuses existed use ExpectedStatus.
+func AcceptedStatuses(m models.Monitor) []int {
+	if len(m.ExpectedStatuses) > 0 {
+		return m.ExpectedStatuses
+	}
+	if m.ExpectedStatus > 0 {
+		return []int{m.ExpectedStatus}
+	}
+	return []int{200}
 }
 
+var monitorChecks = DefaultTelemetry.Counter("bastion_monitor_checks_total",
+	"Monitor checks performed, by result.", "status")
+
 func (mc *MonitorChecker) savePing(m models.Monitor, ping models.MonitorPing) {
+	monitorChecks.Inc(ping.Status)
 	if err := mc.db.Create(&ping).Error; err != nil {
 		slog.Error("Failed to save monitor ping", "monitor", m.Name, "error", err)
 		return
@@ -129,4 +181,45 @@ func (mc *MonitorChecker) savePing(m models.Monitor, ping models.MonitorPing) {
 	}
 
 	mc.db.Model(&models.Monitor{}).Where("id = ?", m.ID).Updates(updates)
+	mc.trackIncident(m, ping)
+
+	if m.LastStatus != ping.Status {
+		mc.events.Publish(EventMonitorState, map[string]interface{}{
+			"monitor_id":  m.ID,
+			"name":        m.Name,
+			"from":        m.LastStatus,
+			"to":          ping.Status,
+			"response_ms": ping.ResponseMs,
+			"error":       ping.Error,
+		})
+	}
+}
+
+// trackIncident opens an incident when a monitor goes down, updates it while
+// it stays down, and resolves it when the monitor recovers.
+func (mc *MonitorChecker) trackIncident(m models.Monitor, ping models.MonitorPing) {
+	var open models.MonitorIncident
+	hasOpen := mc.db.Where("monitor_id = ? AND resolved_at IS NULL", m.ID).
+		Order("started_at DESC").
+		First(&open).Error == nil
+
+	switch {
+	case ping.Status == "down" && !hasOpen:
+		mc.db.Create(&models.MonitorIncident{
+			MonitorID: m.ID,
+			StartedAt: ping.CheckedAt,
+			FailCount: 1,
+			LastError: ping.Error,
+		})
+	case ping.Status == "down":
+		mc.db.Model(&open).Updates(map[string]interface{}{
+			"fail_count": gorm.Expr("fail_count + 1"),
+			"last_error": ping.Error,
+		})
+	case hasOpen:
+		mc.db.Model(&open).Updates(map[string]interface{}{
+			"resolved_at":      ping.CheckedAt,
+			"duration_seconds": int64(ping.CheckedAt.Sub(open.StartedAt).Seconds()),
+		})
+	}
 }
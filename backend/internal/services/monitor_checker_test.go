@@ -0,0 +1,19 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+)
+
+func TestProbeRejectsUnsupportedType(t *testing.T) {
+	mc := &MonitorChecker{}
+	ping := mc.probe(models.Monitor{Type: "smtp", URL: "smtp://mail.example.com", TimeoutMs: 100})
+	if ping.Status != "down" || !strings.Contains(ping.Error, "unsupported monitor type") {
+		t.Errorf("probe(smtp) = %q %q, want down with unsupported type", ping.Status, ping.Error)
+	}
+	if ValidMonitorTypes["smtp"] {
+		t.Error("ValidMonitorTypes accepts smtp, which probe cannot check")
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxIncidentResults caps how many down monitors and past incidents are returned.
+const maxIncidentResults = 20
+
+// DownMonitor describes a monitor that is currently failing.
+type DownMonitor struct {
+	ID               uuid.UUID  `json:"id"`
+	Name             string     `json:"name"`
+	URL              string     `json:"url"`
+	ConsecutiveFails int        `json:"consecutive_fails"`
+	DownSince        *time.Time `json:"down_since"`
+	DownForSeconds   int64      `json:"down_for_seconds"`
+	LastError        string     `json:"last_error"`
+}
+
+// IncidentSummary is the current monitor outage picture.
+type IncidentSummary struct {
+	Down   []DownMonitor            `json:"down"`
+	Recent []models.MonitorIncident `json:"recent"`
+
+	names map[uuid.UUID]string
+}
+
+// GetMonitorIncidents returns currently-down monitors and the most recent
+// incidents, each capped at limit (or maxIncidentResults when limit <= 0).
+func GetMonitorIncidents(db *gorm.DB, limit int) (*IncidentSummary, error) {
+	if limit <= 0 || limit > maxIncidentResults {
+		limit = maxIncidentResults
+	}
+
+	var monitors []models.Monitor
+	if err := db.Where("enabled = ? AND last_status = ?", true, "down").
+		Order("consecutive_fails DESC").
+		Limit(limit).
+		Find(&monitors).Error; err != nil {
+		return nil, err
+	}
+
+	summary := &IncidentSummary{
+		Down:   make([]DownMonitor, 0, len(monitors)),
+		Recent: make([]models.MonitorIncident, 0),
+	}
+
+	now := time.Now()
+	for _, m := range monitors {
+		d := DownMonitor{
+			ID:               m.ID,
+			Name:             m.Name,
+			URL:              m.URL,
+			ConsecutiveFails: m.ConsecutiveFails,
+		}
+
+		var open models.MonitorIncident
+		if err := db.Where("monitor_id = ? AND resolved_at IS NULL", m.ID).
+			Order("started_at DESC").
+			First(&open).Error; err == nil {
+			since := open.StartedAt
+			d.DownSince = &since
+			d.DownForSeconds = int64(now.Sub(since).Seconds())
+			d.LastError = open.LastError
+		} else {
+			var ping models.MonitorPing
+			if err := db.Where("monitor_id = ?", m.ID).Order("checked_at DESC").First(&ping).Error; err == nil {
+				d.LastError = ping.Error
+			}
+		}
+
+		summary.Down = append(summary.Down, d)
+	}
+
+	if err := db.Order("started_at DESC").Limit(limit).Find(&summary.Recent).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(summary.Recent))
+	for _, inc := range summary.Recent {
+		ids = append(ids, inc.MonitorID)
+	}
+	summary.names = make(map[uuid.UUID]string)
+	if len(ids) > 0 {
+		var named []models.Monitor
+		db.Unscoped().Select("id", "name").Where("id IN ?", ids).Find(&named)
+		for _, m := range named {
+			summary.names[m.ID] = m.Name
+		}
+	}
+
+	return summary, nil
+}
+
+// Format renders the summary as concise text for the AI.
+func (s *IncidentSummary) Format() string {
+	var sb strings.Builder
+
+	if len(s.Down) == 0 {
+		sb.WriteString("All monitors are up.\n")
+	}
+	for _, d := range s.Down {
+		sb.WriteString(fmt.Sprintf("- DOWN %s (%s): %d consecutive fails", d.Name, d.URL, d.ConsecutiveFails))
+		if d.DownSince != nil {
+			sb.WriteString(fmt.Sprintf(", down for %s", (time.Duration(d.DownForSeconds) * time.Second).String()))
+		}
+		if d.LastError != "" {
+			sb.WriteString(fmt.Sprintf(", last error: %s", d.LastError))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(s.Recent) > 0 {
+		sb.WriteString("Recent incidents:\n")
+		for _, inc := range s.Recent {
+			state := "ongoing"
+			if inc.ResolvedAt != nil {
+				state = fmt.Sprintf("resolved after %s", (time.Duration(inc.DurationSeconds) * time.Second).String())
+			}
+			name := s.names[inc.MonitorID]
+			if name == "" {
+				name = inc.MonitorID.String()
+			}
+			sb.WriteString(fmt.Sprintf("- %s started %s, %s\n", name, inc.StartedAt.Format(time.RFC3339), state))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// pingFallbackPorts are dialled when ICMP sockets are unavailable. A refused
+// connection still proves the host answered.
+var pingFallbackPorts = []string{"80", "443", "22"}
+
+// monitorHost strips the type scheme from a monitor URL.
+func monitorHost(m models.Monitor) string {
+	raw := strings.TrimSpace(m.URL)
+	if i := strings.Index(raw, "://"); i >= 0 {
+		raw = raw[i+3:]
+	}
+	return strings.TrimSuffix(raw, "/")
+}
+
+// tcpTarget returns the host:port a tcp monitor connects to.
+func tcpTarget(m models.Monitor) (string, error) {
+	target := monitorHost(m)
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", fmt.Errorf("tcp monitor URL %q needs host:port", m.URL)
+	}
+	if host == "" || port == "" {
+		return "", fmt.Errorf("tcp monitor URL %q needs host:port", m.URL)
+	}
+	return target, nil
+}
+
+func monitorTimeout(m models.Monitor) time.Duration {
+	if m.TimeoutMs <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(m.TimeoutMs) * time.Millisecond
+}
+
+// probeTCP records how long a TCP connect to the monitor's host:port takes.
+func probeTCP(m models.Monitor, ping *models.MonitorPing) {
+	target, err := tcpTarget(m)
+	if err != nil {
+		ping.Status = "down"
+		ping.Error = err.Error()
+		return
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", target, monitorTimeout(m))
+	ping.ResponseMs = int(time.Since(start).Milliseconds())
+	if err != nil {
+		ping.Status = "down"
+		ping.Error = err.Error()
+		return
+	}
+	conn.Close()
+	ping.Status = "up"
+}
+
+// probePing sends one ICMP echo and records the round trip. Without ICMP
+// socket permission it falls back to a TCP connect on common ports.
+func probePing(m models.Monitor, ping *models.MonitorPing) {
+	host := monitorHost(m)
+	timeout := monitorTimeout(m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(addrs) == 0 {
+		ping.Status = "down"
+		ping.Error = fmt.Sprintf("resolve %s: %v", host, err)
+		return
+	}
+
+	rtt, err := icmpEcho(addrs[0], timeout)
+	if errors.Is(err, os.ErrPermission) {
+		rtt, err = tcpReach(addrs[0].String(), timeout)
+	}
+	ping.ResponseMs = int(rtt.Milliseconds())
+	if err != nil {
+		ping.Status = "down"
+		ping.Error = err.Error()
+		return
+	}
+	ping.Status = "up"
+}
+
+// icmpEcho sends an echo request over an unprivileged datagram socket, or a
+// raw socket when running privileged. Socket permission errors wrap
+// os.ErrPermission.
+func icmpEcho(ip net.IP, timeout time.Duration) (time.Duration, error) {
+	network, dst := "udp4", net.Addr(&net.UDPAddr{IP: ip})
+	conn, err := icmp.ListenPacket(network, "0.0.0.0")
+	if err != nil {
+		network, dst = "ip4:icmp", &net.IPAddr{IP: ip}
+		conn, err = icmp.ListenPacket(network, "0.0.0.0")
+	}
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			return 0, fmt.Errorf("icmp: %w", os.ErrPermission)
+		}
+		return 0, err
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: 1, Data: []byte("bastion")},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(timeout))
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return time.Since(start), fmt.Errorf("no echo reply from %s: %w", ip, err)
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil {
+			continue
+		}
+		if reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		// Datagram sockets rewrite the ID, so only raw replies are matched on it
+		if echo, ok := reply.Body.(*icmp.Echo); ok && (network == "udp4" || echo.ID == id) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// tcpReach treats any TCP answer, including a refused connection, as the
+// host being up.
+func tcpReach(host string, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	var lastErr error
+	for _, port := range pingFallbackPorts {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), timeout)
+		if err == nil {
+			conn.Close()
+			return time.Since(start), nil
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return time.Since(start), nil
+		}
+		lastErr = err
+	}
+	return time.Since(start), fmt.Errorf("host unreachable (tcp fallback): %w", lastErr)
+}
+
+// probeDNS records how long resolving the monitor's hostname takes.
+func probeDNS(m models.Monitor, ping *models.MonitorPing) {
+	host := monitorHost(m)
+	ctx, cancel := context.WithTimeout(context.Background(), monitorTimeout(m))
+	defer cancel()
+
+	start := time.Now()
+	_, err := net.DefaultResolver.LookupHost(ctx, host)
+	ping.ResponseMs = int(time.Since(start).Milliseconds())
+	if err != nil {
+		ping.Status = "down"
+		ping.Error = err.Error()
+		return
+	}
+	ping.Status = "up"
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+)
+
+// notifyTimeout bounds one delivery attempt so a hung SMTP server or webhook
+// never piles up goroutines.
+const notifyTimeout = 30 * time.Second
+
+// Alert notification events.
+const (
+	NotifyFiring   = "firing"
+	NotifyResolved = "resolved"
+)
+
+// AlertNotification is what a Notifier delivers when an alert fires or
+// resolves.
+type AlertNotification struct {
+	Event    string    `json:"event"` // firing, resolved
+	AlertID  uuid.UUID `json:"alert_id"`
+	Rule     string    `json:"rule"`
+	Severity string    `json:"severity"`
+	Server   string    `json:"server"`
+	Message  string    `json:"message"`
+	Details  string    `json:"details,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Subject is a one-line summary used as the email subject and webhook text.
+func (n AlertNotification) Subject() string {
+	prefix := "[" + strings.ToUpper(n.Severity) + "] "
+	if n.Event == NotifyResolved {
+		prefix = "[RESOLVED] "
+	}
+	return prefix + n.Rule + " on " + n.Server
+}
+
+// Notifier delivers alert notifications to one external channel.
+type Notifier interface {
+	Notify(ctx context.Context, n AlertNotification) error
+}
+
+// AlertNotifier routes notifications to the notifier registered for a rule's
+// notification_channel. Channels without a notifier ("dashboard", or one not
+// configured) are dashboard-only.
+// ValidNotificationChannels lists the channels an alert rule may notify.
+// "dashboard" only records the alert; the others are registered at startup
+// when configured.
+var ValidNotificationChannels = map[string]bool{"dashboard": true, "email": true, "webhook": true}
+
+type AlertNotifier struct {
+	channels map[string]Notifier
+}
+
+func NewAlertNotifier() *AlertNotifier {
+	return &AlertNotifier{channels: make(map[string]Notifier)}
+}
+
+// Register sets the notifier for a channel name.
+func (an *AlertNotifier) Register(channel string, n Notifier) {
+	an.channels[channel] = n
+	slog.Info("Alert notifications enabled", "channel", channel)
+}
+
+// Dispatch delivers n to the rule's channel in the background. Failures are
+// logged and never block the caller. Safe to call on a nil notifier.
+func (an *AlertNotifier) Dispatch(rule *models.AlertRule, n AlertNotification) {
+	if an == nil {
+		return
+	}
+	notifier, ok := an.channels[rule.NotificationChannel]
+	if !ok {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := notifier.Notify(ctx, n); err != nil {
+			slog.Error("Alert notification failed", "channel", rule.NotificationChannel,
+				"rule", n.Rule, "event", n.Event, "error", err)
+		}
+	}()
+}
+
+// WebhookNotifier POSTs notifications as JSON. Format "json" sends the
+// AlertNotification as is; "slack" sends a Slack incoming-webhook payload,
+// which Mattermost and Discord's /slack endpoint also accept.
+type WebhookNotifier struct {
+	url    string
+	format string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url, format string) (*WebhookNotifier, error) {
+	if url == "" {
+		return nil, fmt.Errorf("alert webhook URL is required")
+	}
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "slack" {
+		return nil, fmt.Errorf("unknown alert webhook format %q", format)
+	}
+	return &WebhookNotifier{
+		url:    url,
+		format: format,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n AlertNotification) error {
+	var payload interface{} = n
+	if w.format == "slack" {
+		payload = slackPayload(n)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// slackColors maps severity to the attachment side bar colour.
+var slackColors = map[string]string{
+	"critical": "#d62728",
+	"warning":  "#ff7f0e",
+	"info":     "#1f77b4",
+}
+
+func slackPayload(n AlertNotification) map[string]interface{} {
+	color := slackColors[n.Severity]
+	if n.Event == NotifyResolved {
+		color = "#2ca02c"
+	}
+	fields := []map[string]interface{}{
+		{"title": "Server", "value": n.Server, "short": true},
+		{"title": "Severity", "value": n.Severity, "short": true},
+	}
+	if n.Details != "" {
+		fields = append(fields, map[string]interface{}{"title": "Details", "value": "```" + n.Details + "```", "short": false})
+	}
+	return map[string]interface{}{
+		"text": n.Subject(),
+		"attachments": []map[string]interface{}{{
+			"color":  color,
+			"text":   n.Message,
+			"fields": fields,
+			"ts":     n.Time.Unix(),
+		}},
+	}
+}
+
+// SMTPSettings configures EmailNotifier. Port 465 uses implicit TLS; other
+// ports upgrade with STARTTLS when the server offers it.
+type SMTPSettings struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// EmailNotifier sends notifications as plain-text email.
+type EmailNotifier struct {
+	smtp SMTPSettings
+	to   []string
+}
+
+func NewEmailNotifier(settings SMTPSettings, to []string) (*EmailNotifier, error) {
+	if settings.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	if settings.From == "" {
+		return nil, fmt.Errorf("SMTP from address is required")
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("at least one alert email recipient is required")
+	}
+	if settings.Port == 0 {
+		settings.Port = 587
+	}
+	return &EmailNotifier{smtp: settings, to: to}, nil
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, n AlertNotification) error {
+	addr := net.JoinHostPort(e.smtp.Host, fmt.Sprint(e.smtp.Port))
+	tlsConfig := &tls.Config{ServerName: e.smtp.Host}
+
+	var conn net.Conn
+	var err error
+	if e.smtp.Port == 465 {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, e.smtp.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && e.smtp.Port != 465 {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if e.smtp.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.smtp.Username, e.smtp.Password, e.smtp.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.smtp.From); err != nil {
+		return err
+	}
+	for _, rcpt := range e.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message renders the RFC 5322 message. Header values are stripped of line
+// breaks so rule names and server names cannot inject headers.
+func (e *EmailNotifier) message(n AlertNotification) []byte {
+	header := strings.NewReplacer("\r", " ", "\n", " ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header.Replace(e.smtp.From))
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(strings.Join(e.to, ", ")))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header.Replace(n.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+
+	fmt.Fprintf(&b, "Alert:    %s\r\n", n.Rule)
+	fmt.Fprintf(&b, "Status:   %s\r\n", n.Event)
+	fmt.Fprintf(&b, "Severity: %s\r\n", n.Severity)
+	fmt.Fprintf(&b, "Server:   %s\r\n", n.Server)
+	fmt.Fprintf(&b, "Time:     %s\r\n\r\n", n.Time.Format(time.RFC3339))
+	b.WriteString(n.Message + "\r\n")
+	if n.Details != "" {
+		b.WriteString("\r\n" + n.Details + "\r\n")
+	}
+	return []byte(strings.ReplaceAll(strings.ReplaceAll(b.String(), "\r\n", "\n"), "\n", "\r\n"))
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+)
+
+// captureWebhook records the body of every request it receives.
+func captureWebhook(t *testing.T, status int) (*httptest.Server, chan []byte) {
+	t.Helper()
+	bodies := make(chan []byte, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook request = %s %s, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, bodies
+}
+
+func testNotification(event string) AlertNotification {
+	return AlertNotification{
+		Event:    event,
+		AlertID:  uuid.New(),
+		Rule:     "High CPU",
+		Severity: "critical",
+		Server:   "web-1",
+		Message:  "cpu on web-1 is 97.00",
+		Details:  "top: java",
+		Time:     time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookNotifierJSON(t *testing.T) {
+	srv, bodies := captureWebhook(t, http.StatusOK)
+	w, err := NewWebhookNotifier(srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := testNotification(NotifyFiring)
+	if err := w.Notify(context.Background(), sent); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var got AlertNotification
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != sent {
+		t.Errorf("webhook payload = %+v, want %+v", got, sent)
+	}
+}
+
+func TestWebhookNotifierSlack(t *testing.T) {
+	srv, bodies := captureWebhook(t, http.StatusOK)
+	w, err := NewWebhookNotifier(srv.URL, "slack")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ event, text, color string }{
+		{NotifyFiring, "[CRITICAL] High CPU on web-1", "#d62728"},
+		{NotifyResolved, "[RESOLVED] High CPU on web-1", "#2ca02c"},
+	} {
+		if err := w.Notify(context.Background(), testNotification(tt.event)); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+		var payload struct {
+			Text        string `json:"text"`
+			Attachments []struct {
+				Color  string `json:"color"`
+				Text   string `json:"text"`
+				Fields []struct {
+					Title string `json:"title"`
+					Value string `json:"value"`
+				} `json:"fields"`
+			} `json:"attachments"`
+		}
+		if err := json.Unmarshal(<-bodies, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Text != tt.text || len(payload.Attachments) != 1 {
+			t.Fatalf("%s: slack payload = %+v, want text %q and one attachment", tt.event, payload, tt.text)
+		}
+		a := payload.Attachments[0]
+		if a.Color != tt.color || a.Text != "cpu on web-1 is 97.00" || len(a.Fields) != 3 || a.Fields[2].Value != "```top: java```" {
+			t.Errorf("%s: attachment = %+v", tt.event, a)
+		}
+	}
+}
+
+func TestWebhookNotifierErrors(t *testing.T) {
+	srv, bodies := captureWebhook(t, http.StatusInternalServerError)
+	w, _ := NewWebhookNotifier(srv.URL, "json")
+	if err := w.Notify(context.Background(), testNotification(NotifyFiring)); err == nil {
+		t.Error("Notify succeeded on a 500 response")
+	}
+	<-bodies
+
+	if _, err := NewWebhookNotifier("", "json"); err == nil {
+		t.Error("NewWebhookNotifier without a URL succeeded")
+	}
+	if _, err := NewWebhookNotifier(srv.URL, "teams"); err == nil {
+		t.Error("NewWebhookNotifier with an unknown format succeeded")
+	}
+}
+
+func TestAlertNotifierDispatchesByChannel(t *testing.T) {
+	srv, bodies := captureWebhook(t, http.StatusOK)
+	webhook, _ := NewWebhookNotifier(srv.URL, "json")
+	an := NewAlertNotifier()
+	an.Register("webhook", webhook)
+
+	an.Dispatch(&models.AlertRule{NotificationChannel: "dashboard"}, testNotification(NotifyFiring))
+	an.Dispatch(&models.AlertRule{NotificationChannel: "webhook"}, testNotification(NotifyResolved))
+
+	select {
+	case body := <-bodies:
+		if !strings.Contains(string(body), `"event":"resolved"`) {
+			t.Errorf("delivered %s, want only the webhook rule's notification", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook rule's notification was not delivered")
+	}
+	select {
+	case body := <-bodies:
+		t.Errorf("dashboard rule's notification was delivered: %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	var nilNotifier *AlertNotifier
+	nilNotifier.Dispatch(&models.AlertRule{NotificationChannel: "webhook"}, testNotification(NotifyFiring))
+}
+
+func TestEmailMessageStripsHeaderInjection(t *testing.T) {
+	e, err := NewEmailNotifier(SMTPSettings{Host: "smtp.example", From: "bastion@example"}, []string{"ops@example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := testNotification(NotifyFiring)
+	n.Rule = "High CPU\r\nBcc: attacker@example"
+
+	msg := string(e.message(n))
+	header, _, _ := strings.Cut(msg, "\r\n\r\n")
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Errorf("rule name injected a header:\n%s", header)
+	}
+	if !strings.Contains(header, "Subject: [CRITICAL] High CPU  Bcc: attacker@example on web-1") {
+		t.Errorf("subject not kept on one line:\n%s", header)
+	}
+}
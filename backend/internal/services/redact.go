@@ -0,0 +1,26 @@
+package services
+
+import "regexp"
+
+const redacted = "[REDACTED]"
+
+// secretPatterns match credentials that commonly leak into logs, errors and
+// command output. Each keeps its non-secret prefix via ${1}.
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`), redacted},
+	{regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[:=]\s*["']?)[^\s"',;&]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{8,}`), "${1}" + redacted},
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^@\s/]+@`), "${1}" + redacted + "@"},
+	{regexp.MustCompile(`\b(AKIA)[0-9A-Z]{16}\b`), "${1}" + redacted},
+}
+
+// RedactSecrets masks likely credentials in text before it leaves Bastion.
+func RedactSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"gorm.io/gorm"
+)
+
+// Retention runs hourly and deletes in batches so a large backlog never
+// holds one long lock on the table.
+const (
+	retentionInterval  = time.Hour
+	retentionBatchSize = 10000
+)
+
+// RetentionService periodically deletes metrics samples and monitor pings
+// older than their configured retention. A retention of 0 days keeps that
+// table forever.
+type RetentionService struct {
+	db          *gorm.DB
+	metricsDays int
+	pingDays    int
+	stop        chan struct{}
+}
+
+func NewRetentionService(db *gorm.DB, metricsDays, pingDays int) *RetentionService {
+	return &RetentionService{
+		db:          db,
+		metricsDays: metricsDays,
+		pingDays:    pingDays,
+		stop:        make(chan struct{}),
+	}
+}
+
+func (rs *RetentionService) Start() {
+	go rs.loop()
+	slog.Info("Retention service started", "metrics_days", rs.metricsDays, "ping_days", rs.pingDays)
+}
+
+func (rs *RetentionService) Stop() {
+	close(rs.stop)
+	slog.Info("Retention service stopped")
+}
+
+func (rs *RetentionService) loop() {
+	rs.Prune(time.Now())
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rs.Prune(time.Now())
+		case <-rs.stop:
+			return
+		}
+	}
+}
+
+// Prune deletes rows older than the retention windows as of now and returns
+// how many metrics samples and monitor pings were removed.
+func (rs *RetentionService) Prune(now time.Time) (metrics, pings int64) {
+	if rs.metricsDays > 0 {
+		cutoff := now.AddDate(0, 0, -rs.metricsDays)
+		metrics = rs.deleteBefore(&models.ServerMetrics{}, "collected_at", cutoff)
+		if metrics > 0 {
+			slog.Info("Pruned old server metrics", "deleted", metrics, "older_than", cutoff)
+		}
+		if n := rs.deleteBefore(&models.ServerNetworkMetrics{}, "collected_at", cutoff); n > 0 {
+			slog.Info("Pruned old network interface metrics", "deleted", n, "older_than", cutoff)
+		}
+		if n := rs.deleteBefore(&models.ServerDiskMetrics{}, "collected_at", cutoff); n > 0 {
+			slog.Info("Pruned old disk metrics", "deleted", n, "older_than", cutoff)
+		}
+	}
+	if rs.pingDays > 0 {
+		cutoff := now.AddDate(0, 0, -rs.pingDays)
+		pings = rs.deleteBefore(&models.MonitorPing{}, "checked_at", cutoff)
+		if pings > 0 {
+			slog.Info("Pruned old monitor pings", "deleted", pings, "older_than", cutoff)
+		}
+	}
+	return metrics, pings
+}
+
+// deleteBefore removes rows of model whose column is before cutoff, one
+// batch at a time.
+func (rs *RetentionService) deleteBefore(model interface{}, column string, cutoff time.Time) int64 {
+	var total int64
+	for {
+		batch := rs.db.Model(model).Select("id").Where(column+" < ?", cutoff).Limit(retentionBatchSize)
+		res := rs.db.Where("id IN (?)", batch).Delete(model)
+		if res.Error != nil {
+			slog.Error("Retention delete failed", "column", column, "error", res.Error)
+			return total
+		}
+		total += res.RowsAffected
+		if res.RowsAffected < retentionBatchSize {
+			return total
+		}
+		select {
+		case <-rs.stop:
+			return total
+		default:
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB connects to the Postgres database in BASTION_TEST_DSN, skipping the
+// test when it is unset.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("BASTION_TEST_DSN")
+	if dsn == "" {
+		t.Skip("BASTION_TEST_DSN not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	return db
+}
+
+func TestRetentionPrunesOnlyOldRows(t *testing.T) {
+	db := testDB(t)
+	if err := db.AutoMigrate(&models.Server{}, &models.ServerMetrics{}, &models.ServerNetworkMetrics{},
+		&models.ServerDiskMetrics{}, &models.MonitorPing{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	server := models.Server{Name: "retention-test", Host: "127.0.0.1", Port: 22, Username: "test"}
+	if err := db.Create(&server).Error; err != nil {
+		t.Fatal(err)
+	}
+	monitorID := uuid.New()
+	t.Cleanup(func() {
+		db.Where("server_id = ?", server.ID).Delete(&models.ServerDiskMetrics{})
+		db.Where("server_id = ?", server.ID).Delete(&models.ServerNetworkMetrics{})
+		db.Where("server_id = ?", server.ID).Delete(&models.ServerMetrics{})
+		db.Where("monitor_id = ?", monitorID).Delete(&models.MonitorPing{})
+		db.Delete(&server)
+	})
+
+	now := time.Now()
+	old, recent := now.AddDate(0, 0, -31), now.AddDate(0, 0, -29)
+	oldPing, recentPing := now.AddDate(0, 0, -8), now.AddDate(0, 0, -6)
+	for _, at := range []time.Time{old, old, recent} {
+		m := models.ServerMetrics{ServerID: server.ID, CollectedAt: at}
+		if err := db.Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+		db.Create(&models.ServerNetworkMetrics{ServerID: server.ID, MetricsID: m.ID, Interface: "eth0", CollectedAt: at})
+		db.Create(&models.ServerDiskMetrics{ServerID: server.ID, MetricsID: m.ID, Mount: "/", CollectedAt: at})
+	}
+	for _, at := range []time.Time{oldPing, recentPing, recentPing} {
+		if err := db.Create(&models.MonitorPing{MonitorID: monitorID, Status: "up", CheckedAt: at}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs := NewRetentionService(db, 30, 7)
+	metrics, pings := rs.Prune(now)
+	if metrics < 2 || pings < 1 {
+		t.Errorf("Prune deleted %d metrics and %d pings, want at least the 2 and 1 seeded old rows", metrics, pings)
+	}
+
+	remaining := func(model interface{}, where string, id uuid.UUID) int64 {
+		var n int64
+		db.Model(model).Where(where, id).Count(&n)
+		return n
+	}
+	if n := remaining(&models.ServerMetrics{}, "server_id = ?", server.ID); n != 1 {
+		t.Errorf("server metrics left = %d, want only the recent sample", n)
+	}
+	if n := remaining(&models.ServerNetworkMetrics{}, "server_id = ?", server.ID); n != 1 {
+		t.Errorf("network metrics left = %d, want only the recent sample", n)
+	}
+	if n := remaining(&models.ServerDiskMetrics{}, "server_id = ?", server.ID); n != 1 {
+		t.Errorf("disk metrics left = %d, want only the recent sample", n)
+	}
+	if n := remaining(&models.MonitorPing{}, "monitor_id = ?", monitorID); n != 2 {
+		t.Errorf("monitor pings left = %d, want the 2 recent pings", n)
+	}
+
+	// A retention of 0 days keeps everything
+	if metrics, pings := NewRetentionService(db, 0, 0).Prune(now.AddDate(1, 0, 0)); metrics != 0 || pings != 0 {
+		t.Errorf("Prune with retention disabled deleted %d metrics and %d pings", metrics, pings)
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ScriptInterpreters maps the interpreters a script may request to the
+// command that reads the script from stdin.
+var ScriptInterpreters = map[string]string{
+	"bash":   "bash -s",
+	"sh":     "sh -s",
+	"python": "python3 -",
+}
+
+// ScriptRisk is a script line the safety checker considers dangerous.
+// Command is the dangerous shell command, or the Python call for python
+// scripts.
+type ScriptRisk struct {
+	Line    int    `json:"line"`
+	Text    string `json:"text"`
+	Command string `json:"command"`
+}
+
+var scriptSeparatorRe = regexp.MustCompile(`\s*(?:;|&&|\|\||\|)\s*`)
+
+var (
+	// pythonShellCallRe matches a call that hands its first string literal
+	// to a shell or exec, including subprocess's list form
+	pythonShellCallRe = regexp.MustCompile(`\b(?:os\.(?:system|popen|exec\w*|spawn\w*)|subprocess\.\w+|pty\.spawn)\s*\(\s*\[?\s*[rbuf]?(?:'([^']*)'|"([^"]*)")`)
+	// pythonDangerousCallRe matches library calls that delete files or
+	// signal processes without going through a shell
+	pythonDangerousCallRe = regexp.MustCompile(`\b(shutil\.rmtree|os\.(?:remove|unlink|rmdir|removedirs|kill|killpg|truncate))\s*\(`)
+)
+
+// ScriptRisks returns the dangerous lines of a script for interpreter.
+// Blank lines and comments are skipped.
+func ScriptRisks(script, interpreter string) []ScriptRisk {
+	check := shellLineRisk
+	if interpreter == "python" {
+		check = pythonLineRisk
+	}
+
+	risks := []ScriptRisk{}
+	for i, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if command, risky := check(trimmed); risky {
+			risks = append(risks, ScriptRisk{Line: i + 1, Text: trimmed, Command: command})
+		}
+	}
+	return risks
+}
+
+// shellLineRisk runs every command of a shell line through the safety
+// checker, splitting it on ;, &&, || and pipes.
+func shellLineRisk(line string) (string, bool) {
+	for _, part := range scriptSeparatorRe.Split(line, -1) {
+		if part == "" {
+			continue
+		}
+		safety := DefaultSafetyChecker.CheckSafety(part)
+		if !safety.IsSafe && safety.Category == "dangerous" {
+			return safety.BaseCommand, true
+		}
+	}
+	return "", false
+}
+
+// pythonLineRisk flags destructive library calls, and shell commands passed
+// as string literals to os.system, subprocess and friends that the safety
+// checker considers dangerous. Commands built at run time are not seen.
+func pythonLineRisk(line string) (string, bool) {
+	if m := pythonDangerousCallRe.FindStringSubmatch(line); m != nil {
+		return m[1], true
+	}
+	for _, m := range pythonShellCallRe.FindAllStringSubmatch(line, -1) {
+		safety := DefaultSafetyChecker.CheckCommandLine(m[1] + m[2])
+		if !safety.IsSafe && safety.Category == "dangerous" {
+			return safety.BaseCommand, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,39 @@
+package services
+
+import "testing"
+
+func TestScriptRisks(t *testing.T) {
+	tests := []struct {
+		name        string
+		interpreter string
+		script      string
+		want        []ScriptRisk
+	}{
+		{"shell", "bash", "# rm -rf / in a comment\nuptime\ncd /tmp && rm -rf build\n",
+			[]ScriptRisk{{Line: 3, Text: "cd /tmp && rm -rf build", Command: "rm"}}},
+		{"python shell calls", "python", "import os, subprocess\nos.system('df -h')\nsubprocess.run(['rm', '-rf', '/var/tmp/x'])\nos.system(\"uptime; reboot\")\n",
+			[]ScriptRisk{
+				{Line: 3, Text: "subprocess.run(['rm', '-rf', '/var/tmp/x'])", Command: "rm"},
+				{Line: 4, Text: `os.system("uptime; reboot")`, Command: "reboot"},
+			}},
+		{"python library calls", "python", "import shutil\nshutil.rmtree('/srv/app')\nos.kill(1, 9)\n",
+			[]ScriptRisk{
+				{Line: 2, Text: "shutil.rmtree('/srv/app')", Command: "shutil.rmtree"},
+				{Line: 3, Text: "os.kill(1, 9)", Command: "os.kill"},
+			}},
+		// Python keywords that are shell commands are not shell risks
+		{"python not shell", "python", "import sys\nkill = [p for p in procs if p.stale]\nprint('rm -rf /')\n", []ScriptRisk{}},
+	}
+	for _, tt := range tests {
+		got := ScriptRisks(tt.script, tt.interpreter)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: ScriptRisks = %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: risk %d = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
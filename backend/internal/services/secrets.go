@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var envKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+// ValidEnvKey reports whether k can be used as an environment variable name.
+func ValidEnvKey(k string) bool {
+	return envKeyRe.MatchString(k)
+}
+
+// ResolveServerSecrets decrypts the named secrets of a server. Every key must
+// exist; a missing key is an error rather than an empty variable.
+func ResolveServerSecrets(db *gorm.DB, dec Decryptor, serverID uuid.UUID, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var secrets []models.ServerSecret
+	if err := db.Where("server_id = ? AND key IN ?", serverID, keys).Find(&secrets).Error; err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	env := make(map[string]string, len(secrets))
+	for _, s := range secrets {
+		value, err := dec.Decrypt(s.EncryptedValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %s: %w", s.Key, err)
+		}
+		env[s.Key] = value
+	}
+	for _, k := range keys {
+		if _, ok := env[k]; !ok {
+			return nil, fmt.Errorf("secret %s not found", k)
+		}
+	}
+	return env, nil
+}
+
+// envPreamble exports the variables InjectEnv sends on stdin: one
+// KEY=base64(value) line each, up to an empty line. Values only pass through
+// printf, a shell builtin, and base64's stdin, so they are never in a
+// process's arguments. The trailing "." keeps newlines command substitution
+// would strip.
+const envPreamble = `while IFS= read -r __e && [ -n "$__e" ]; do ` +
+	`__v=$(printf %s "${__e#*=}" | base64 -d; echo .); export "${__e%%=*}=${__v%.}"; ` +
+	`done; unset __e __v; `
+
+// InjectEnv makes env available to cmd without putting the values on a
+// command line, where ps, shell history and /proc/*/cmdline on the server
+// would show them: cmd is prefixed with envPreamble and the values are sent
+// first on stdin, followed by stdin itself. With no env, cmd and stdin are
+// returned unchanged.
+func InjectEnv(env map[string]string, cmd string, stdin io.Reader) (string, io.Reader) {
+	if len(env) == 0 {
+		return cmd, stdin
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		buf.WriteString(k + "=" + base64.StdEncoding.EncodeToString([]byte(env[k])) + "\n")
+	}
+	buf.WriteString("\n")
+
+	if stdin == nil {
+		return envPreamble + cmd, &buf
+	}
+	return envPreamble + cmd, io.MultiReader(&buf, stdin)
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestInjectEnv(t *testing.T) {
+	env := map[string]string{
+		"API_TOKEN": "s3cr3t 'quoted' $HOME `id`",
+		"MULTILINE": "line one\nline two\n",
+	}
+	cmd, stdin := InjectEnv(env, `printf '%s|%s|' "$API_TOKEN" "$MULTILINE"; cat`, strings.NewReader("piped input"))
+	if strings.Contains(cmd, "s3cr3t") || strings.Contains(cmd, "line one") {
+		t.Fatalf("secret value on the command line: %s", cmd)
+	}
+
+	var out bytes.Buffer
+	sh := exec.Command("sh", "-c", cmd)
+	sh.Stdin = stdin
+	sh.Stdout = &out
+	if err := sh.Run(); err != nil {
+		t.Fatalf("sh: %v", err)
+	}
+	want := env["API_TOKEN"] + "|" + env["MULTILINE"] + "|piped input"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+
+	if cmd, stdin := InjectEnv(nil, "uptime", nil); cmd != "uptime" || stdin != nil {
+		t.Errorf("InjectEnv(nil) = %q, %v; want the command unchanged and no stdin", cmd, stdin)
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrNoServerResolved is returned when no source names a target server.
+var ErrNoServerResolved = errors.New("no target server: pass server_id, set the conversation server, configure AI_DEFAULT_SERVER or mark a server as default")
+
+// ServerSelector lists the candidate sources for an AI target server in
+// priority order. Empty fields are skipped.
+type ServerSelector struct {
+	Conversation string // server bound to the conversation
+	Request      string // server_id on the request or tool call
+	Config       string // AI_DEFAULT_SERVER, an ID or server name
+}
+
+// ResolveServer walks conversation → request → config default → is_default
+// and returns the first server found along with the source that chose it.
+// A source that names a missing server is an error rather than a fallthrough,
+// and there is deliberately no "any server" fallback.
+func ResolveServer(db *gorm.DB, sel ServerSelector) (*models.Server, string, error) {
+	candidates := []struct{ source, ref string }{
+		{"conversation", sel.Conversation},
+		{"request", sel.Request},
+		{"config", sel.Config},
+	}
+	for _, cand := range candidates {
+		if cand.ref == "" {
+			continue
+		}
+		server, err := findServerRef(db, cand.ref, cand.source == "config")
+		if err != nil {
+			return nil, cand.source, fmt.Errorf("%s server %q: %w", cand.source, cand.ref, err)
+		}
+		slog.Debug("Resolved AI target server", "source", cand.source, "server", server.Name)
+		return server, cand.source, nil
+	}
+
+	var server models.Server
+	if err := db.First(&server, "is_default = ?", true).Error; err == nil {
+		slog.Debug("Resolved AI target server", "source", "is_default", "server", server.Name)
+		return &server, "is_default", nil
+	}
+
+	slog.Warn("No AI target server could be resolved")
+	return nil, "", ErrNoServerResolved
+}
+
+// findServerRef loads a server by ID, or by name when byName is set.
+func findServerRef(db *gorm.DB, ref string, byName bool) (*models.Server, error) {
+	var server models.Server
+	if id, err := uuid.Parse(ref); err == nil {
+		if err := db.First(&server, "id = ?", id).Error; err != nil {
+			return nil, fmt.Errorf("server not found")
+		}
+		return &server, nil
+	}
+	if !byName {
+		return nil, fmt.Errorf("invalid server ID")
+	}
+	if err := db.First(&server, "name = ?", ref).Error; err != nil {
+		return nil, fmt.Errorf("server not found")
+	}
+	return &server, nil
+}
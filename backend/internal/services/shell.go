@@ -0,0 +1,35 @@
+package services
+
+import "strings"
+
+// defaultWrapShell runs the user command when only a prefix is configured,
+// so pipes and redirections stay inside the wrapper.
+const defaultWrapShell = "sh -c"
+
+// ShellQuote quotes s as a single POSIX shell word.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// WrapCommand applies a server's command prefix and shell to cmd. With
+// neither set the command runs as-is; otherwise it becomes
+// "<prefix> <shell> '<cmd>'", e.g. "toolbox run bash -lc 'uptime'".
+func WrapCommand(prefix, shell, cmd string) string {
+	prefix = strings.TrimSpace(prefix)
+	shell = strings.TrimSpace(shell)
+	if prefix == "" && shell == "" {
+		return cmd
+	}
+	if shell == "" {
+		shell = defaultWrapShell
+	}
+
+	wrapped := shell + " " + ShellQuote(cmd)
+	if prefix != "" {
+		wrapped = prefix + " " + wrapped
+	}
+	return wrapped
+}
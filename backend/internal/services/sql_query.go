@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// externalQueryTimeout bounds every statement run against an external database.
+const externalQueryTimeout = 15 * time.Second
+
+var (
+	sqlLineComment  = regexp.MustCompile(`--[^\n]*`)
+	sqlBlockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+	// readOnlyStatements are the statements a read-only query may start with.
+	readOnlyStatements = []string{"SELECT", "WITH", "EXPLAIN", "SHOW", "VALUES", "TABLE"}
+
+	// explainableStatements are the read-only statements EXPLAIN can plan.
+	explainableStatements = []string{"SELECT", "WITH", "VALUES", "TABLE"}
+
+	// disallowedSQL matches mutation keywords and server-side functions that
+	// reach outside the transaction, as whole words.
+	disallowedSQL = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE|DROP|ALTER|CREATE|TRUNCATE|GRANT|REVOKE|COPY|CALL|DO|LOCK|VACUUM|REINDEX|CLUSTER|REFRESH|LISTEN|NOTIFY|SET|RESET|PG_TERMINATE_BACKEND|PG_CANCEL_BACKEND|PG_READ_FILE|PG_READ_BINARY_FILE|PG_LS_DIR|LO_IMPORT|LO_EXPORT|DBLINK\w*|SET_CONFIG)\b`)
+)
+
+// CheckReadOnlyQuery rejects anything other than a single read-only
+// statement. It is a first line of defence; queries must still be run in a
+// read-only transaction.
+func CheckReadOnlyQuery(query string) error {
+	q := sqlBlockComment.ReplaceAllString(query, " ")
+	q = sqlLineComment.ReplaceAllString(q, " ")
+	q = strings.TrimSpace(q)
+	q = strings.TrimSpace(strings.TrimSuffix(q, ";"))
+	if q == "" {
+		return fmt.Errorf("query is empty")
+	}
+	if strings.Contains(q, ";") {
+		return fmt.Errorf("only a single statement is allowed")
+	}
+
+	first := strings.ToUpper(strings.Fields(q)[0])
+	allowed := false
+	for _, kw := range readOnlyStatements {
+		if first == kw || strings.HasPrefix(first, kw+"(") {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("mutation queries are not allowed (found %s)", first)
+	}
+
+	if kw := disallowedSQL.FindString(q); kw != "" {
+		return fmt.Errorf("disallowed keyword %s", strings.ToUpper(kw))
+	}
+	return nil
+}
+
+// CheckExplainableQuery accepts a query CheckReadOnlyQuery accepts that is
+// also a statement EXPLAIN can plan, so not SHOW or EXPLAIN itself.
+func CheckExplainableQuery(query string) error {
+	if err := CheckReadOnlyQuery(query); err != nil {
+		return err
+	}
+	q := strings.TrimSpace(sqlLineComment.ReplaceAllString(sqlBlockComment.ReplaceAllString(query, " "), " "))
+	first := strings.ToUpper(strings.Fields(q)[0])
+	for _, kw := range explainableStatements {
+		if first == kw || strings.HasPrefix(first, kw+"(") {
+			return nil
+		}
+	}
+	return fmt.Errorf("only SELECT queries can be explained (found %s)", first)
+}
+
+// DSNHost returns "host/dbname" for a Postgres DSN in URL or key=value form,
+// for display without credentials.
+func DSNHost(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		return u.Host + u.Path
+	}
+	var host, dbname string
+	for _, field := range strings.Fields(dsn) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "host":
+			host = v
+		case "dbname":
+			dbname = v
+		}
+	}
+	if dbname != "" {
+		return host + "/" + dbname
+	}
+	return host
+}
+
+// PingDatabase checks that an external Postgres DSN is reachable.
+func PingDatabase(ctx context.Context, dsn string) error {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, externalQueryTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// QueryResult is a bounded result set from an external database.
+type QueryResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	RowCount  int             `json:"row_count"`
+	Truncated bool            `json:"truncated"`
+}
+
+// QueryExternalDatabase runs a query that passed CheckReadOnlyQuery in a
+// read-only transaction with a statement timeout, returning at most limit
+// rows.
+func QueryExternalDatabase(ctx context.Context, dsn, query string, limit int) (*QueryResult, error) {
+	if err := CheckReadOnlyQuery(query); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, externalQueryTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", externalQueryTimeout.Milliseconds())); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		if len(result.Rows) >= limit {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result.RowCount = len(result.Rows)
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// maxKeyFileSize bounds key files read from the Bastion host.
+const maxKeyFileSize = 64 << 10
+
+// Private key errors, distinguishable with errors.Is.
+var (
+	ErrPassphraseRequired = errors.New("private key is passphrase-protected; a passphrase is required")
+	ErrWrongPassphrase    = errors.New("wrong passphrase for private key")
+	ErrMalformedKey       = errors.New("malformed private key")
+)
+
+// keyFileDir is the only directory key files may be read from. While it is
+// unset the "keyfile" auth type is refused.
+var keyFileDir string
+
+// SetKeyFileDir allows "keyfile" servers to use keys under dir.
+func SetKeyFileDir(dir string) {
+	if dir != "" {
+		dir = filepath.Clean(dir)
+	}
+	keyFileDir = dir
+}
+
+// ValidAuthType reports whether t is a supported server auth type.
+func ValidAuthType(t string) bool {
+	switch t {
+	case "password", "key", "keyfile", "agent":
+		return true
+	}
+	return false
+}
+
+// ReadKeyFile reads a private key from the Bastion host's disk. The path must
+// be absolute and inside the key directory once symlinks are resolved;
+// without a key directory nothing is read.
+func ReadKeyFile(path string) (string, error) {
+	if keyFileDir == "" {
+		return "", fmt.Errorf("keyfile auth is disabled; set SSH_KEY_DIR to enable it")
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("key file path must be absolute")
+	}
+	path = filepath.Clean(path)
+	if !strings.HasPrefix(path, keyFileDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("key file must be inside %s", keyFileDir)
+	}
+	// A symlink in the key directory must not lead out of it
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		dir, err := filepath.EvalSymlinks(keyFileDir)
+		if err != nil || !strings.HasPrefix(real, dir+string(filepath.Separator)) {
+			return "", fmt.Errorf("key file must be inside %s", keyFileDir)
+		}
+		path = real
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open key file: %w", err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, maxKeyFileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(b) > maxKeyFileSize {
+		return "", fmt.Errorf("key file is too large")
+	}
+	return string(b), nil
+}
+
+// UnlockPrivateKey returns privateKey with its passphrase removed, re-encoded
+// as an OpenSSH PEM block, so the rest of the SSH code only ever handles
+// plain keys. Keys that are not protected are returned unchanged and the
+// passphrase is ignored.
+func UnlockPrivateKey(privateKey, passphrase string) (string, error) {
+	_, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case err == nil:
+		return privateKey, nil
+	case !errors.As(err, &missing):
+		return "", fmt.Errorf("%w: %v", ErrMalformedKey, err)
+	case passphrase == "":
+		return "", ErrPassphraseRequired
+	}
+
+	key, err := ssh.ParseRawPrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return "", ErrWrongPassphrase
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformedKey, err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformedKey, err)
+	}
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// sshAuthMethods builds the auth methods for a connection. privateKey holds
+// key material for both "key" and "keyfile", already unlocked (see
+// UnlockPrivateKey). For "agent" the returned close
+// function releases the agent socket and must be called after the handshake.
+func sshAuthMethods(password, privateKey, authType string) ([]ssh.AuthMethod, func(), error) {
+	noop := func() {}
+
+	switch authType {
+	case "key", "keyfile":
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, noop, ErrPassphraseRequired
+		}
+		if err != nil {
+			return nil, noop, fmt.Errorf("%w: %v", ErrMalformedKey, err)
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, noop, nil
+	case "agent":
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, noop, fmt.Errorf("SSH agent unavailable: SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, noop, fmt.Errorf("SSH agent unavailable: %w", err)
+		}
+		client := agent.NewClient(conn)
+		keys, err := client.List()
+		if err != nil {
+			conn.Close()
+			return nil, noop, fmt.Errorf("SSH agent unavailable: %w", err)
+		}
+		if len(keys) == 0 {
+			conn.Close()
+			return nil, noop, fmt.Errorf("SSH agent has no keys loaded")
+		}
+		return []ssh.AuthMethod{ssh.PublicKeysCallback(client.Signers)}, func() { conn.Close() }, nil
+	default: // password
+		return []ssh.AuthMethod{ssh.Password(password)}, noop, nil
+	}
+}
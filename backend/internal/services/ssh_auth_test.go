@@ -0,0 +1,44 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadKeyFile(t *testing.T) {
+	defer SetKeyFileDir("")
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	SetKeyFileDir("")
+	if _, err := ReadKeyFile(keyPath); err == nil {
+		t.Error("ReadKeyFile without SSH_KEY_DIR succeeded, want an error")
+	}
+
+	SetKeyFileDir(dir)
+	if key, err := ReadKeyFile(keyPath); err != nil || key != "key" {
+		t.Errorf("ReadKeyFile(%q) = %q, %v; want the key", keyPath, key, err)
+	}
+	for _, path := range []string{
+		"id_ed25519",
+		outside,
+		filepath.Join(dir, "..", filepath.Base(filepath.Dir(outside)), "secret"),
+		filepath.Join(dir, "escape"),
+	} {
+		if _, err := ReadKeyFile(path); err == nil {
+			t.Errorf("ReadKeyFile(%q) succeeded, want an error", path)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// SSH error classes returned by ClassifySSHError.
+const (
+	SSHErrAuth    = "auth"
+	SSHErrHostKey = "host_key"
+	SSHErrTimeout = "timeout"
+	SSHErrNetwork = "network"
+	SSHErrUnknown = "unknown"
+)
+
+// ClassifySSHError groups a dial/handshake error so callers can tell
+// rejected credentials apart from an unreachable host.
+func ClassifySSHError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, ErrHostKeyMismatch) {
+		return SSHErrHostKey
+	}
+
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "unable to authenticate") ||
+		strings.Contains(msg, "no supported methods remain") ||
+		strings.Contains(msg, "failed to parse private key") ||
+		strings.Contains(msg, "ssh agent") ||
+		strings.Contains(msg, "permission denied") {
+		return SSHErrAuth
+	}
+
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return SSHErrTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return SSHErrTimeout
+	}
+	if strings.Contains(msg, "i/o timeout") {
+		return SSHErrTimeout
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) ||
+		strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "no route to host") ||
+		strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "eof") {
+		return SSHErrNetwork
+	}
+
+	return SSHErrUnknown
+}
+
+// StatusForSSHError maps a connection error to a server status:
+// auth_error for rejected credentials, offline otherwise.
+func StatusForSSHError(err error) string {
+	if ClassifySSHError(err) == SSHErrAuth {
+		return "auth_error"
+	}
+	return "offline"
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+// Host key policies for Server.HostKeyPolicy. Strict rejects a changed host
+// key; warn logs the change and connects anyway.
+const (
+	HostKeyPolicyStrict = "strict"
+	HostKeyPolicyWarn   = "warn"
+)
+
+// ErrHostKeyMismatch is returned when a server presents a host key other
+// than the one on record under the strict policy.
+var ErrHostKeyMismatch = errors.New("host key mismatch")
+
+// ValidHostKeyPolicy reports whether p is a supported host key policy.
+func ValidHostKeyPolicy(p string) bool {
+	return p == HostKeyPolicyStrict || p == HostKeyPolicyWarn
+}
+
+// hostKeyCallback compares the presented key against the expected SHA256
+// fingerprint. An empty expected fingerprint accepts any key (trust on first
+// use); the presented fingerprint is always stored in seen.
+func hostKeyCallback(expected, policy string, seen *string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+		*seen = fingerprint
+		if expected == "" || fingerprint == expected {
+			return nil
+		}
+		if policy == HostKeyPolicyWarn {
+			slog.Warn("SSH host key changed, connecting anyway", "host", hostname, "expected", expected, "got", fingerprint)
+			return nil
+		}
+		return fmt.Errorf("%w for %s: expected %s, got %s", ErrHostKeyMismatch, hostname, expected, fingerprint)
+	}
+}
+
+// HostKeyStore supplies the expected host key of a server to the SSH pool
+// and records keys seen on first connect.
+type HostKeyStore interface {
+	HostKey(serverID uuid.UUID) (fingerprint, policy string)
+	RecordHostKey(serverID uuid.UUID, fingerprint string)
+}
+
+// dbHostKeyStore reads and records fingerprints on the servers table.
+type dbHostKeyStore struct {
+	db *gorm.DB
+}
+
+// NewHostKeyStore returns a HostKeyStore backed by the servers table.
+func NewHostKeyStore(db *gorm.DB) HostKeyStore {
+	return &dbHostKeyStore{db: db}
+}
+
+func (s *dbHostKeyStore) HostKey(serverID uuid.UUID) (string, string) {
+	var server models.Server
+	if err := s.db.Select("fingerprint", "host_key_policy").First(&server, "id = ?", serverID).Error; err != nil {
+		return "", HostKeyPolicyStrict
+	}
+	return server.Fingerprint, server.HostKeyPolicy
+}
+
+func (s *dbHostKeyStore) RecordHostKey(serverID uuid.UUID, fingerprint string) {
+	err := s.db.Model(&models.Server{}).
+		Where("id = ? AND (fingerprint = '' OR fingerprint IS NULL)", serverID).
+		Update("fingerprint", fingerprint).Error
+	if err != nil {
+		slog.Error("Failed to record SSH host key", "server", serverID, "error", err)
+		return
+	}
+	slog.Info("Recorded SSH host key on first connect", "server", serverID, "fingerprint", fingerprint)
+}
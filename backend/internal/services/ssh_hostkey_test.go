@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+)
+
+// policyHostKeys is a HostKeyStore with a fixed policy that, like the
+// servers table, only records a fingerprint when none is stored.
+type policyHostKeys struct {
+	policy string
+	keys   map[uuid.UUID]string
+}
+
+func (s *policyHostKeys) HostKey(serverID uuid.UUID) (string, string) {
+	return s.keys[serverID], s.policy
+}
+
+func (s *policyHostKeys) RecordHostKey(serverID uuid.UUID, fingerprint string) {
+	if s.keys[serverID] == "" {
+		s.keys[serverID] = fingerprint
+	}
+}
+
+func TestSSHPoolRejectsChangedHostKey(t *testing.T) {
+	var forwards int32
+	for _, policy := range []string{HostKeyPolicyStrict, HostKeyPolicyWarn} {
+		host, port := startTestSSHServer(t, &forwards)
+		server := &models.Server{ID: uuid.New(), Host: host, Port: port, Username: "ops", AuthType: "password"}
+		store := &policyHostKeys{policy: policy, keys: map[uuid.UUID]string{}}
+		pool := &SSHPool{conns: make(map[string][]*SSHConn)}
+		pool.SetHostKeyStore(store)
+
+		// First connect trusts and records the key
+		if _, err := pool.GetConnection(server, "secret", ""); err != nil {
+			t.Fatalf("%s: first GetConnection: %v", policy, err)
+		}
+		recorded := store.keys[server.ID]
+		if recorded == "" {
+			t.Fatalf("%s: host key not recorded on first connect", policy)
+		}
+
+		// The server is reinstalled: same record, new host key
+		server.Host, server.Port = startTestSSHServer(t, &forwards)
+		_, err := pool.GetConnection(server, "secret", "")
+		switch policy {
+		case HostKeyPolicyStrict:
+			if !errors.Is(err, ErrHostKeyMismatch) {
+				t.Errorf("strict: GetConnection error = %v, want a host key mismatch", err)
+			}
+		case HostKeyPolicyWarn:
+			if err != nil {
+				t.Errorf("warn: GetConnection: %v, want the changed key accepted", err)
+			}
+		}
+		if store.keys[server.ID] != recorded {
+			t.Errorf("%s: stored fingerprint replaced with %s", policy, store.keys[server.ID])
+		}
+		pool.CloseAll()
+	}
+}
+
+func TestSSHConnectionVerifiesHostKey(t *testing.T) {
+	var forwards int32
+	host, port := startTestSSHServer(t, &forwards)
+
+	fingerprint, err := TestSSHConnection(host, port, "ops", "secret", "", "password", "", HostKeyPolicyStrict, nil)
+	if err != nil || fingerprint == "" {
+		t.Fatalf("TestSSHConnection without a stored key = %q, %v; want the presented fingerprint", fingerprint, err)
+	}
+	if _, err := TestSSHConnection(host, port, "ops", "secret", "", "password", fingerprint, HostKeyPolicyStrict, nil); err != nil {
+		t.Errorf("TestSSHConnection with the matching key: %v", err)
+	}
+
+	got, err := TestSSHConnection(host, port, "ops", "secret", "", "password", "SHA256:stale", HostKeyPolicyStrict, nil)
+	if !errors.Is(err, ErrHostKeyMismatch) {
+		t.Errorf("TestSSHConnection with a changed key error = %v, want a host key mismatch", err)
+	}
+	if got != fingerprint {
+		t.Errorf("TestSSHConnection fingerprint = %q, want the presented %q even on mismatch", got, fingerprint)
+	}
+	if _, err := TestSSHConnection(host, port, "ops", "secret", "", "password", "SHA256:stale", HostKeyPolicyWarn, nil); err != nil {
+		t.Errorf("TestSSHConnection under the warn policy: %v", err)
+	}
+}
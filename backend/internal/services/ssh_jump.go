@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+// ErrJumpHostChain is returned when a server's jump host itself needs a jump
+// host. Only a single hop is supported.
+var ErrJumpHostChain = errors.New("jump host must be directly reachable")
+
+// JumpHost is the gateway (ProxyJump) a server is reached through, with its
+// credentials already decrypted.
+type JumpHost struct {
+	ServerID      uuid.UUID // the jump server's own record, for recording its host key
+	Host          string
+	Port          int
+	Username      string
+	Password      string
+	PrivateKey    string
+	AuthType      string
+	Fingerprint   string
+	HostKeyPolicy string
+}
+
+func (j *JumpHost) addr() string {
+	return fmt.Sprintf("%s:%d", j.Host, j.Port)
+}
+
+// JumpHostResolver supplies the jump host, if any, that the SSH pool must go
+// through to reach a server. A nil JumpHost means a direct connection.
+type JumpHostResolver interface {
+	JumpHost(serverID uuid.UUID) (*JumpHost, error)
+}
+
+// dbJumpHostResolver looks jump hosts up through servers.jump_server_id.
+type dbJumpHostResolver struct {
+	db  *gorm.DB
+	dec Decryptor
+}
+
+// NewJumpHostResolver returns a JumpHostResolver backed by the servers table.
+func NewJumpHostResolver(db *gorm.DB, dec Decryptor) JumpHostResolver {
+	return &dbJumpHostResolver{db: db, dec: dec}
+}
+
+func (r *dbJumpHostResolver) JumpHost(serverID uuid.UUID) (*JumpHost, error) {
+	var server models.Server
+	if err := r.db.Select("jump_server_id").First(&server, "id = ?", serverID).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up jump host of server %s: %w", serverID, err)
+	}
+	return LoadJumpHost(r.db, r.dec, server.JumpServerID)
+}
+
+// LoadJumpHost loads and decrypts the jump server with the given ID. A nil ID
+// returns a nil JumpHost.
+func LoadJumpHost(db *gorm.DB, dec Decryptor, jumpServerID *uuid.UUID) (*JumpHost, error) {
+	if jumpServerID == nil {
+		return nil, nil
+	}
+
+	var jump models.Server
+	if err := db.First(&jump, "id = ?", *jumpServerID).Error; err != nil {
+		return nil, fmt.Errorf("jump server %s not found", *jumpServerID)
+	}
+	if jump.JumpServerID != nil {
+		return nil, fmt.Errorf("%w: %s has its own jump host", ErrJumpHostChain, jump.Name)
+	}
+
+	password, privateKey, err := DecryptServerCredentials(dec, &jump)
+	if err != nil {
+		return nil, fmt.Errorf("jump server %s: %w", jump.Name, err)
+	}
+	return &JumpHost{
+		ServerID:      jump.ID,
+		Host:          jump.Host,
+		Port:          jump.Port,
+		Username:      jump.Username,
+		Password:      password,
+		PrivateKey:    privateKey,
+		AuthType:      jump.AuthType,
+		Fingerprint:   jump.Fingerprint,
+		HostKeyPolicy: jump.HostKeyPolicy,
+	}, nil
+}
+
+// dialSSH opens an SSH client to addr, directly or through jump. A proxied
+// client owns its jump connection, which is closed when the client closes.
+// jumpKey is the fingerprint a jump host presented once its own handshake
+// succeeded, for recording on first use; it is empty for direct connections.
+func dialSSH(addr string, config *ssh.ClientConfig, jump *JumpHost) (client *ssh.Client, jumpKey string, err error) {
+	if jump == nil {
+		client, err = dialDirect(addr, config)
+		return client, "", err
+	}
+
+	authMethods, closeAuth, err := sshAuthMethods(jump.Password, jump.PrivateKey, jump.AuthType)
+	if err != nil {
+		return nil, "", fmt.Errorf("jump host %s: %w", jump.addr(), err)
+	}
+	defer closeAuth()
+
+	start := time.Now()
+	jumpConfig := &ssh.ClientConfig{
+		User:            jump.Username,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback(jump.Fingerprint, jump.HostKeyPolicy, &jumpKey),
+		Timeout:         config.Timeout,
+	}
+	applySSHTuning(jumpConfig)
+
+	jumpClient, err := dialDirect(jump.addr(), jumpConfig)
+	if err != nil {
+		return nil, "", fmt.Errorf("jump host %s: %w", jump.addr(), err)
+	}
+
+	// Tunnelled channels have no deadlines; bound the rest of the dial by
+	// closing the jump connection once the timeout is spent
+	if config.Timeout > 0 {
+		timer := time.AfterFunc(config.Timeout-time.Since(start), func() { jumpClient.Close() })
+		defer timer.Stop()
+	}
+
+	conn, err := jumpClient.Dial("tcp", addr)
+	if err != nil {
+		jumpClient.Close()
+		return nil, jumpKey, fmt.Errorf("jump host %s could not reach %s: %w", jump.addr(), addr, err)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		jumpClient.Close()
+		return nil, jumpKey, fmt.Errorf("via jump host %s: %w", jump.addr(), err)
+	}
+
+	client = ssh.NewClient(c, chans, reqs)
+	go func() {
+		client.Wait()
+		jumpClient.Close()
+	}()
+	return client, jumpKey, nil
+}
+
+// dialDirect is ssh.Dial with config.Timeout covering the handshake as well
+// as the TCP connect, so a host that accepts and then stalls cannot hold the
+// caller past its timeout.
+func dialDirect(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var deadline time.Time
+	if config.Timeout > 0 {
+		deadline = time.Now().Add(config.Timeout)
+	}
+	conn, err := (&net.Dialer{Deadline: deadline}).Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(deadline)
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// poolKey identifies pooled connections for one server: its ID and user
+// come first, so servers sharing an address never reuse each other's client
+// and each keeps its own host key check. Keys end in "@host:port", and
+// proxied connections are prefixed with the jump path so they never mix with
+// direct ones.
+func poolKey(server *models.Server, jump *JumpHost) string {
+	key := fmt.Sprintf("%s/%s@%s:%d", server.ID, server.Username, server.Host, server.Port)
+	if jump != nil {
+		key = fmt.Sprintf("%s@%s>%s", jump.Username, jump.addr(), key)
+	}
+	return key
+}
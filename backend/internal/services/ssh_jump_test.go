@@ -0,0 +1,300 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// startTestSSHServer runs an SSH server on 127.0.0.1 that accepts the
+// password "secret", answers every exec with "ok" and forwards direct-tcpip
+// channels, counting them in forwards.
+func startTestSSHServer(t *testing.T, forwards *int32) (string, int) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, errors.New("denied")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, config, forwards)
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func serveTestSSHConn(conn net.Conn, config *ssh.ServerConfig, forwards *int32) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		switch newCh.ChannelType() {
+		case "session":
+			ch, reqs, err := newCh.Accept()
+			if err != nil {
+				continue
+			}
+			go func() {
+				for req := range reqs {
+					if req.Type != "exec" {
+						req.Reply(false, nil)
+						continue
+					}
+					req.Reply(true, nil)
+					ch.Write([]byte("ok"))
+					ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					ch.Close()
+				}
+			}()
+		case "direct-tcpip":
+			var target struct {
+				Host     string
+				Port     uint32
+				OrigHost string
+				OrigPort uint32
+			}
+			if err := ssh.Unmarshal(newCh.ExtraData(), &target); err != nil {
+				newCh.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+			if err != nil {
+				newCh.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			ch, reqs, err := newCh.Accept()
+			if err != nil {
+				upstream.Close()
+				continue
+			}
+			atomic.AddInt32(forwards, 1)
+			go ssh.DiscardRequests(reqs)
+			go func() {
+				io.Copy(ch, upstream)
+				ch.Close()
+			}()
+			go func() {
+				io.Copy(upstream, ch)
+				upstream.Close()
+			}()
+		default:
+			newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+type stubJumpResolver struct {
+	jumps map[uuid.UUID]*JumpHost
+	err   error
+}
+
+func (r stubJumpResolver) JumpHost(serverID uuid.UUID) (*JumpHost, error) {
+	return r.jumps[serverID], r.err
+}
+
+type memoryHostKeys map[uuid.UUID]string
+
+func (m memoryHostKeys) HostKey(serverID uuid.UUID) (string, string) {
+	return m[serverID], HostKeyPolicyStrict
+}
+
+func (m memoryHostKeys) RecordHostKey(serverID uuid.UUID, fingerprint string) {
+	m[serverID] = fingerprint
+}
+
+func runTestCommand(t *testing.T, client *ssh.Client) string {
+	t.Helper()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	out, err := session.Output("uptime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestSSHPoolResolvesJumpHostByServerID(t *testing.T) {
+	var gatewayForwards, targetForwards int32
+	gatewayHost, gatewayPort := startTestSSHServer(t, &gatewayForwards)
+	targetHost, targetPort := startTestSSHServer(t, &targetForwards)
+
+	// Two servers share the target's address; only one sits behind the gateway
+	proxied := &models.Server{ID: uuid.New(), Host: targetHost, Port: targetPort, Username: "ops", AuthType: "password"}
+	direct := &models.Server{ID: uuid.New(), Host: targetHost, Port: targetPort, Username: "ops", AuthType: "password"}
+
+	pool := &SSHPool{conns: make(map[string][]*SSHConn)}
+	defer pool.CloseAll()
+	hostKeys := memoryHostKeys{}
+	pool.SetHostKeyStore(hostKeys)
+	pool.SetJumpHostResolver(stubJumpResolver{jumps: map[uuid.UUID]*JumpHost{
+		proxied.ID: {Host: gatewayHost, Port: gatewayPort, Username: "jump", Password: "secret", AuthType: "password"},
+	}})
+
+	client, err := pool.GetConnection(direct, "secret", "")
+	if err != nil {
+		t.Fatalf("direct GetConnection: %v", err)
+	}
+	if out := runTestCommand(t, client); out != "ok" {
+		t.Errorf("direct output = %q, want ok", out)
+	}
+	if n := atomic.LoadInt32(&gatewayForwards); n != 0 {
+		t.Errorf("direct server went through the gateway %d times", n)
+	}
+
+	client, err = pool.GetConnection(proxied, "secret", "")
+	if err != nil {
+		t.Fatalf("proxied GetConnection: %v", err)
+	}
+	if out := runTestCommand(t, client); out != "ok" {
+		t.Errorf("proxied output = %q, want ok", out)
+	}
+	if n := atomic.LoadInt32(&gatewayForwards); n != 1 {
+		t.Errorf("gateway forwards = %d, want 1", n)
+	}
+	if len(pool.conns) != 2 {
+		t.Errorf("pool keys = %d, want direct and proxied connections kept apart", len(pool.conns))
+	}
+	if hostKeys[proxied.ID] == "" || hostKeys[direct.ID] == "" {
+		t.Errorf("host keys not recorded per server: %v", hostKeys)
+	}
+}
+
+func TestSSHPoolKeepsSameAddressServersApart(t *testing.T) {
+	var forwards int32
+	host, port := startTestSSHServer(t, &forwards)
+
+	first := &models.Server{ID: uuid.New(), Host: host, Port: port, Username: "ops", AuthType: "password"}
+	second := &models.Server{ID: uuid.New(), Host: host, Port: port, Username: "deploy", AuthType: "password"}
+
+	pool := &SSHPool{conns: make(map[string][]*SSHConn)}
+	defer pool.CloseAll()
+	pool.SetHostKeyStore(memoryHostKeys{})
+
+	firstClient, err := pool.GetConnection(first, "secret", "")
+	if err != nil {
+		t.Fatalf("first GetConnection: %v", err)
+	}
+	secondClient, err := pool.GetConnection(second, "secret", "")
+	if err != nil {
+		t.Fatalf("second GetConnection: %v", err)
+	}
+	if firstClient == secondClient {
+		t.Fatal("second server reused the first server's client")
+	}
+	if len(pool.conns) != 2 {
+		t.Fatalf("pool keys = %d, want one per server", len(pool.conns))
+	}
+	if n := len(pool.Stats(host, port)); n != 2 {
+		t.Errorf("Stats = %d connections, want 2", n)
+	}
+	if n := pool.Evict(host, port); n != 2 {
+		t.Errorf("Evict dropped %d connections, want 2", n)
+	}
+}
+
+func TestSSHPoolReturnsJumpHostLookupError(t *testing.T) {
+	lookupErr := errors.New("connection refused")
+	pool := &SSHPool{conns: make(map[string][]*SSHConn)}
+	pool.SetJumpHostResolver(stubJumpResolver{err: lookupErr})
+
+	_, err := pool.GetConnection(&models.Server{ID: uuid.New(), Host: "127.0.0.1", Port: 1}, "secret", "")
+	if !errors.Is(err, lookupErr) {
+		t.Fatalf("GetConnection error = %v, want the lookup error", err)
+	}
+}
+
+func TestSSHPoolRecordsJumpHostKeyOnFirstUse(t *testing.T) {
+	var gatewayForwards, targetForwards int32
+	gatewayHost, gatewayPort := startTestSSHServer(t, &gatewayForwards)
+	targetHost, targetPort := startTestSSHServer(t, &targetForwards)
+
+	jumpID := uuid.New()
+	server := &models.Server{ID: uuid.New(), Host: targetHost, Port: targetPort, Username: "ops", AuthType: "password"}
+	pool := &SSHPool{conns: make(map[string][]*SSHConn)}
+	defer pool.CloseAll()
+	hostKeys := memoryHostKeys{}
+	pool.SetHostKeyStore(hostKeys)
+	pool.SetJumpHostResolver(stubJumpResolver{jumps: map[uuid.UUID]*JumpHost{
+		server.ID: {ServerID: jumpID, Host: gatewayHost, Port: gatewayPort, Username: "jump", Password: "secret", AuthType: "password"},
+	}})
+
+	if _, err := pool.GetConnection(server, "secret", ""); err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+	if hostKeys[jumpID] == "" {
+		t.Errorf("jump host key not recorded: %v", hostKeys)
+	}
+	if hostKeys[jumpID] == hostKeys[server.ID] {
+		t.Errorf("jump and target recorded the same key %q", hostKeys[jumpID])
+	}
+}
+
+func TestDialSSHStalledJumpHostTimesOut(t *testing.T) {
+	// A gateway that accepts TCP connections and never starts the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	jump := &JumpHost{ServerID: uuid.New(), Host: "127.0.0.1", Port: port, Username: "jump", Password: "secret", AuthType: "password"}
+	config := &ssh.ClientConfig{User: "ops", HostKeyCallback: ssh.InsecureIgnoreHostKey(), Timeout: 300 * time.Millisecond}
+
+	start := time.Now()
+	if _, _, err := dialSSH("127.0.0.1:22", config, jump); err == nil {
+		t.Fatal("dialSSH succeeded through a stalled jump host")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dialSSH took %s, want it bounded by the 300ms timeout", elapsed)
+	}
+}
@@ -3,10 +3,12 @@ package services
 import (
 	"fmt"
 	"log/slog"
-	"net"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ahmetk3436/bastion/internal/models"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -14,6 +16,7 @@ const (
 	maxConnsPerServer = 5
 	idleTimeout       = 10 * time.Minute
 	keepAliveInterval = 30 * time.Second
+	sshDialTimeout    = 10 * time.Second
 )
 
 type SSHConn struct {
@@ -23,20 +26,54 @@ type SSHConn struct {
 }
 
 type SSHPool struct {
-	mu    sync.Mutex
-	conns map[string][]*SSHConn // key: "host:port"
+	mu       sync.Mutex
+	conns    map[string][]*SSHConn // key: "host:port", or "user@jump:port>host:port" when proxied
+	hostKeys HostKeyStore
+	jumps    JumpHostResolver
 }
 
+var sshDials = DefaultTelemetry.Counter("bastion_ssh_dials_total",
+	"New SSH connections dialed by the pool, by result.", "result")
+
 func NewSSHPool() *SSHPool {
 	pool := &SSHPool{
 		conns: make(map[string][]*SSHConn),
 	}
+	DefaultTelemetry.GaugeFunc("bastion_ssh_pool_connections",
+		"Pooled SSH connections, direct or through a jump host.", []string{"route"}, pool.telemetrySamples)
 	go pool.cleanupLoop()
 	return pool
 }
 
-func (p *SSHPool) GetConnection(host string, port int, username, password, privateKey, authType string) (*ssh.Client, error) {
-	key := fmt.Sprintf("%s:%d", host, port)
+// SetHostKeyStore enables host key verification for pooled connections.
+// Without a store any host key is accepted.
+func (p *SSHPool) SetHostKeyStore(store HostKeyStore) {
+	p.hostKeys = store
+}
+
+// SetJumpHostResolver enables jump hosts for servers that have one.
+func (p *SSHPool) SetJumpHostResolver(resolver JumpHostResolver) {
+	p.jumps = resolver
+}
+
+// GetConnection returns a pooled connection to server, dialing one through
+// the server's jump host if needed. Jump hosts and host keys are looked up
+// by server ID: servers behind different gateways can share an address.
+func (p *SSHPool) GetConnection(server *models.Server, password, privateKey string) (*ssh.Client, error) {
+	return p.GetConnectionTimeout(server, password, privateKey, sshDialTimeout)
+}
+
+// GetConnectionTimeout is GetConnection with a bound on dialing a new
+// connection, handshake included.
+func (p *SSHPool) GetConnectionTimeout(server *models.Server, password, privateKey string, timeout time.Duration) (*ssh.Client, error) {
+	var jump *JumpHost
+	if p.jumps != nil {
+		var err error
+		if jump, err = p.jumps.JumpHost(server.ID); err != nil {
+			return nil, err
+		}
+	}
+	key := poolKey(server, jump)
 
 	p.mu.Lock()
 	// Try to find an idle connection
@@ -61,10 +98,12 @@ func (p *SSHPool) GetConnection(host string, port int, username, password, priva
 	p.mu.Unlock()
 
 	// Create new connection
-	client, err := p.dial(host, port, username, password, privateKey, authType)
+	client, err := p.dial(server, password, privateKey, jump, timeout)
 	if err != nil {
+		sshDials.Inc("error")
 		return nil, err
 	}
+	sshDials.Inc("success")
 
 	p.mu.Lock()
 	p.conns[key] = append(p.conns[key], &SSHConn{
@@ -80,34 +119,45 @@ func (p *SSHPool) GetConnection(host string, port int, username, password, priva
 	return client, nil
 }
 
-func (p *SSHPool) dial(host string, port int, username, password, privateKey, authType string) (*ssh.Client, error) {
-	var authMethods []ssh.AuthMethod
+func (p *SSHPool) dial(server *models.Server, password, privateKey string, jump *JumpHost, timeout time.Duration) (*ssh.Client, error) {
+	authMethods, closeAuth, err := sshAuthMethods(password, privateKey, server.AuthType)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAuth()
 
-	switch authType {
-	case "key":
-		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse private key: %w", err)
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	default: // password
-		authMethods = append(authMethods, ssh.Password(password))
+	expected, policy := "", HostKeyPolicyWarn
+	if p.hostKeys != nil {
+		expected, policy = p.hostKeys.HostKey(server.ID)
 	}
 
+	var seen string
 	config := &ssh.ClientConfig{
-		User:            username,
+		User:            server.Username,
 		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
+		HostKeyCallback: hostKeyCallback(expected, policy, &seen),
+		Timeout:         timeout,
 	}
+	applySSHTuning(config)
 
-	addr := fmt.Sprintf("%s:%d", host, port)
-	client, err := ssh.Dial("tcp", addr, config)
+	addr := fmt.Sprintf("%s:%d", server.Host, server.Port)
+	client, jumpKey, err := dialSSH(addr, config, jump)
+	if jump != nil && jump.Fingerprint == "" && jumpKey != "" && p.hostKeys != nil {
+		p.hostKeys.RecordHostKey(jump.ServerID, jumpKey)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
 	}
 
-	slog.Info("SSH connection established", "host", addr, "user", username)
+	if expected == "" && seen != "" && p.hostKeys != nil {
+		p.hostKeys.RecordHostKey(server.ID, seen)
+	}
+
+	if jump != nil {
+		slog.Info("SSH connection established", "host", addr, "user", server.Username, "via", jump.addr())
+	} else {
+		slog.Info("SSH connection established", "host", addr, "user", server.Username)
+	}
 	return client, nil
 }
 
@@ -150,6 +200,83 @@ func (p *SSHPool) cleanupLoop() {
 	}
 }
 
+// PoolConnStats describes one pooled connection.
+type PoolConnStats struct {
+	Key      string    `json:"key"` // pool key: host:port, or user@jump:port>host:port when proxied
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Stats returns the pooled connections to host:port, direct or proxied,
+// most recently used first.
+func (p *SSHPool) Stats(host string, port int) []PoolConnStats {
+	key := fmt.Sprintf("%s:%d", host, port)
+
+	p.mu.Lock()
+	stats := []PoolConnStats{}
+	for k, conns := range p.conns {
+		if !poolKeyMatches(k, key) {
+			continue
+		}
+		for _, conn := range conns {
+			stats = append(stats, PoolConnStats{Key: k, LastUsed: conn.LastUsed})
+		}
+	}
+	p.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].LastUsed.After(stats[j].LastUsed) })
+	return stats
+}
+
+// Evict closes and drops every pooled connection to host:port, direct or
+// proxied, so the next request dials fresh. It returns how many connections
+// were dropped.
+func (p *SSHPool) Evict(host string, port int) int {
+	key := fmt.Sprintf("%s:%d", host, port)
+
+	p.mu.Lock()
+	var conns []*SSHConn
+	for k, c := range p.conns {
+		if poolKeyMatches(k, key) {
+			conns = append(conns, c...)
+			delete(p.conns, k)
+		}
+	}
+	p.mu.Unlock()
+
+	// Close outside the lock: closing waits on the network
+	for _, conn := range conns {
+		conn.Client.Close()
+	}
+	slog.Info("SSH pool evicted", "host", key, "dropped", len(conns))
+	return len(conns)
+}
+
+// poolKeyMatches reports whether pool key k connects to hostPort, for any
+// server and user, directly or through a jump host.
+func poolKeyMatches(k, hostPort string) bool {
+	return strings.HasSuffix(k, "@"+hostPort)
+}
+
+// telemetrySamples reports the pool size for bastion_ssh_pool_connections.
+// Pool keys name users and internal hosts, and /metrics may be scraped
+// without auth, so connections are only split by route.
+func (p *SSHPool) telemetrySamples() []TelemetrySample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var direct, jump int
+	for key, conns := range p.conns {
+		if strings.Contains(key, ">") {
+			jump += len(conns)
+		} else {
+			direct += len(conns)
+		}
+	}
+	return []TelemetrySample{
+		{Labels: []string{"direct"}, Value: float64(direct)},
+		{Labels: []string{"jump"}, Value: float64(jump)},
+	}
+}
+
 func (p *SSHPool) CloseAll() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -163,36 +290,30 @@ func (p *SSHPool) CloseAll() {
 	slog.Info("All SSH connections closed")
 }
 
-// TestConnection tests an SSH connection without pooling
-func TestSSHConnection(host string, port int, username, password, privateKey, authType string) (string, error) {
-	var authMethods []ssh.AuthMethod
-
-	switch authType {
-	case "key":
-		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
-		if err != nil {
-			return "", fmt.Errorf("failed to parse private key: %w", err)
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	default:
-		authMethods = append(authMethods, ssh.Password(password))
+// TestSSHConnection tests an SSH connection without pooling, through jump
+// when it is not nil. The host key is verified against expectedFingerprint
+// like pooled connections; the presented fingerprint is returned even when it
+// does not match.
+func TestSSHConnection(host string, port int, username, password, privateKey, authType, expectedFingerprint, hostKeyPolicy string, jump *JumpHost) (string, error) {
+	authMethods, closeAuth, err := sshAuthMethods(password, privateKey, authType)
+	if err != nil {
+		return "", err
 	}
+	defer closeAuth()
 
 	var fingerprint string
 	config := &ssh.ClientConfig{
-		User: username,
-		Auth: authMethods,
-		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-			fingerprint = ssh.FingerprintSHA256(key)
-			return nil
-		},
-		Timeout: 10 * time.Second,
+		User:            username,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback(expectedFingerprint, hostKeyPolicy, &fingerprint),
+		Timeout:         10 * time.Second,
 	}
+	applySSHTuning(config)
 
 	addr := fmt.Sprintf("%s:%d", host, port)
-	client, err := ssh.Dial("tcp", addr, config)
+	client, _, err := dialSSH(addr, config, jump)
 	if err != nil {
-		return "", fmt.Errorf("connection failed: %w", err)
+		return fingerprint, fmt.Errorf("connection failed: %w", err)
 	}
 	defer client.Close()
 
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// commandKillGrace is how long a timed-out command gets to exit after
+// SIGTERM before its session is closed under it.
+const commandKillGrace = 2 * time.Second
+
+// ErrCommandTimeout is returned by RunSession for a command stopped at its
+// timeout.
+var ErrCommandTimeout = errors.New("command timed out")
+
+// RunSession runs cmd like session.Run, but stops it once it has run for
+// timeout (0 never stops it): the remote process gets SIGTERM and, if it
+// has not exited after commandKillGrace, the session is closed. Output the
+// command wrote before then stays in the session's Stdout and Stderr.
+// exitCode is -1 when the command timed out or reported no exit status.
+func RunSession(session *ssh.Session, cmd string, timeout time.Duration) (exitCode int, err error) {
+	done := make(chan error, 1)
+	go func() { done <- session.Run(cmd) }()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case err = <-done:
+	case <-expired:
+		session.Signal(ssh.SIGTERM)
+		select {
+		case <-done:
+		case <-time.After(commandKillGrace):
+			// Servers that ignore signal requests get the channel closed,
+			// which unblocks Run
+			session.Close()
+			<-done
+		}
+		return -1, fmt.Errorf("%w after %s", ErrCommandTimeout, timeout)
+	}
+
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), err
+	}
+	return -1, err
+}
+
+// CombinedOutputTimeout is session.CombinedOutput with RunSession's timeout.
+// A timed-out command's partial output is returned with ErrCommandTimeout.
+func CombinedOutputTimeout(session *ssh.Session, cmd string, timeout time.Duration) ([]byte, error) {
+	var out lockedBuffer
+	session.Stdout = &out
+	session.Stderr = &out
+	_, err := RunSession(session, cmd, timeout)
+	return out.Bytes(), err
+}
+
+// lockedBuffer is a bytes.Buffer shared by a session's stdout and stderr
+// copiers.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
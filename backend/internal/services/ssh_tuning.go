@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Algorithms golang.org/x/crypto/ssh implements on the client side. Requested
+// algorithms are checked against these so a typo fails at startup instead of
+// on every handshake.
+var (
+	supportedSSHCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour",
+	}
+	supportedSSHKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+	supportedSSHMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
+	}
+)
+
+// SSHTuning holds optional algorithm preferences for outgoing SSH
+// connections. Empty lists keep the library defaults.
+type SSHTuning struct {
+	Ciphers      []string
+	KeyExchanges []string
+	MACs         []string
+	Compression  bool
+}
+
+// sshTuning is applied to every client config built by the pool and by
+// TestSSHConnection.
+var sshTuning SSHTuning
+
+// SetSSHTuning validates and installs SSH algorithm preferences.
+func SetSSHTuning(t SSHTuning) error {
+	if t.Compression {
+		// x/crypto/ssh only negotiates "none"
+		return fmt.Errorf("SSH compression is not supported by the SSH client")
+	}
+	if err := checkAlgorithms("cipher", t.Ciphers, supportedSSHCiphers); err != nil {
+		return err
+	}
+	if err := checkAlgorithms("key exchange", t.KeyExchanges, supportedSSHKeyExchanges); err != nil {
+		return err
+	}
+	if err := checkAlgorithms("MAC", t.MACs, supportedSSHMACs); err != nil {
+		return err
+	}
+	sshTuning = t
+	return nil
+}
+
+// ParseAlgorithmList splits a comma-separated algorithm list, dropping blanks.
+func ParseAlgorithmList(s string) []string {
+	var algos []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			algos = append(algos, a)
+		}
+	}
+	return algos
+}
+
+func checkAlgorithms(kind string, requested, supported []string) error {
+	for _, a := range requested {
+		found := false
+		for _, s := range supported {
+			if a == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unsupported SSH %s %q (supported: %s)", kind, a, strings.Join(supported, ", "))
+		}
+	}
+	return nil
+}
+
+// applySSHTuning sets the configured algorithm preferences on config.
+func applySSHTuning(config *ssh.ClientConfig) {
+	config.Ciphers = sshTuning.Ciphers
+	config.KeyExchanges = sshTuning.KeyExchanges
+	config.MACs = sshTuning.MACs
+}
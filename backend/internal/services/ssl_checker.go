@@ -0,0 +1,384 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmetk3436/bastion/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SSLRuleType is the alert rule type that certificate expiry alerts are
+// filed under. The rule is created on first use; disabling it mutes expiry
+// alerts and its notification_channel routes them.
+const SSLRuleType = "ssl"
+
+const sslDialTimeout = 10 * time.Second
+
+// sslCheckConcurrency bounds how many certificates CheckAll fetches at once.
+const sslCheckConcurrency = 8
+
+// SSLChecker re-checks every tracked certificate on an interval, keeps
+// DaysRemaining current and opens one alert per domain when the certificate
+// gets close to expiry: warning under warnDays, critical under criticalDays.
+type SSLChecker struct {
+	db           *gorm.DB
+	events       *EventBus
+	notifier     *AlertNotifier
+	interval     time.Duration
+	warnDays     int
+	criticalDays int
+	stop         chan struct{}
+
+	mu sync.Mutex // serializes alert updates, which share the SSL rule
+}
+
+func NewSSLChecker(db *gorm.DB, events *EventBus, notifier *AlertNotifier, intervalSec, warnDays, criticalDays int) *SSLChecker {
+	if intervalSec <= 0 {
+		intervalSec = 6 * 3600
+	}
+	return &SSLChecker{
+		db:           db,
+		events:       events,
+		notifier:     notifier,
+		interval:     time.Duration(intervalSec) * time.Second,
+		warnDays:     warnDays,
+		criticalDays: criticalDays,
+		stop:         make(chan struct{}),
+	}
+}
+
+func (sc *SSLChecker) Start() {
+	go sc.loop()
+	slog.Info("SSL checker started", "interval", sc.interval, "warn_days", sc.warnDays, "critical_days", sc.criticalDays)
+}
+
+func (sc *SSLChecker) Stop() {
+	close(sc.stop)
+	slog.Info("SSL checker stopped")
+}
+
+func (sc *SSLChecker) loop() {
+	ticker := time.NewTicker(sc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sc.checkAll()
+		case <-sc.stop:
+			return
+		}
+	}
+}
+
+func (sc *SSLChecker) checkAll() {
+	results, err := sc.CheckAll(context.Background(), sslDialTimeout)
+	if err != nil {
+		slog.Error("Failed to load SSL certificates", "error", err)
+		return
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			slog.Warn("SSL check failed", "domain", r.Domain, "error", r.Error)
+		}
+	}
+}
+
+// SSLCheckResult is one certificate's outcome in a CheckAll run. When Error
+// is set the check failed and the other fields are from the last successful
+// check.
+type SSLCheckResult struct {
+	ID            uuid.UUID  `json:"id"`
+	Domain        string     `json:"domain"`
+	DaysRemaining int        `json:"days_remaining"`
+	ValidTo       time.Time  `json:"valid_to"`
+	VerifyError   string     `json:"verify_error,omitempty"`
+	AlertID       *uuid.UUID `json:"alert_id"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// CheckAll re-checks every tracked certificate, sslCheckConcurrency at a
+// time, giving each domain timeout to connect and complete the handshake.
+// Results are sorted by soonest expiry, then domain.
+func (sc *SSLChecker) CheckAll(ctx context.Context, timeout time.Duration) ([]SSLCheckResult, error) {
+	var certs []models.SSLCert
+	if err := sc.db.Find(&certs).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]SSLCheckResult, len(certs))
+	sem := make(chan struct{}, sslCheckConcurrency)
+	var wg sync.WaitGroup
+	for i, cert := range certs {
+		wg.Add(1)
+		go func(i int, cert models.SSLCert) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			domainCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			record, _, err := sc.CheckContext(domainCtx, cert.Domain)
+			if err != nil {
+				record = &cert
+			}
+			results[i] = SSLCheckResult{
+				ID:            record.ID,
+				Domain:        record.Domain,
+				DaysRemaining: record.DaysRemaining,
+				ValidTo:       record.ValidTo,
+				VerifyError:   record.VerifyError,
+				AlertID:       record.AlertID,
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, cert)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].DaysRemaining != results[j].DaysRemaining {
+			return results[i].DaysRemaining < results[j].DaysRemaining
+		}
+		return results[i].Domain < results[j].Domain
+	})
+	return results, nil
+}
+
+// NormalizeSSLDomain strips a scheme and path from domain. An explicit port
+// other than 443 is kept, so certificates on other ports can be tracked.
+func NormalizeSSLDomain(domain string) string {
+	domain = strings.TrimSpace(domain)
+	domain = strings.TrimPrefix(domain, "https://")
+	domain = strings.TrimPrefix(domain, "http://")
+	if idx := strings.IndexAny(domain, "/?#"); idx != -1 {
+		domain = domain[:idx]
+	}
+	return strings.TrimSuffix(strings.ToLower(domain), ":443")
+}
+
+// FetchCertificate returns the leaf certificate served for domain ("host" or
+// "host:port"). Untrusted or expired certificates are still returned so
+// their expiry can be tracked; verifyErr says why the chain did not verify.
+func FetchCertificate(domain string) (leaf *x509.Certificate, verifyErr, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sslDialTimeout)
+	defer cancel()
+	return FetchCertificateContext(ctx, domain)
+}
+
+// FetchCertificateContext is FetchCertificate bounded by ctx instead of
+// sslDialTimeout; the deadline covers both the dial and the handshake.
+func FetchCertificateContext(ctx context.Context, domain string) (leaf *x509.Certificate, verifyErr, err error) {
+	host, addr := domain, domain+":443"
+	if h, _, splitErr := net.SplitHostPort(domain); splitErr == nil {
+		host, addr = h, domain
+	}
+
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: host, InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("no certificates presented")
+	}
+
+	opts := x509.VerifyOptions{DNSName: host, Intermediates: x509.NewCertPool()}
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, verifyErr = certs[0].Verify(opts)
+	return certs[0], verifyErr, nil
+}
+
+// Check fetches domain's certificate, saves it to the SSLCert table and
+// raises or clears the expiry alert.
+func (sc *SSLChecker) Check(domain string) (*models.SSLCert, *x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sslDialTimeout)
+	defer cancel()
+	return sc.CheckContext(ctx, domain)
+}
+
+// CheckContext is Check with the certificate fetch bounded by ctx.
+func (sc *SSLChecker) CheckContext(ctx context.Context, domain string) (*models.SSLCert, *x509.Certificate, error) {
+	domain = NormalizeSSLDomain(domain)
+	leaf, verifyErr, err := FetchCertificateContext(ctx, domain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	record := models.SSLCert{Domain: domain}
+	sc.db.Where("domain = ?", domain).FirstOrInit(&record)
+	record.Issuer = leaf.Issuer.CommonName
+	record.ValidFrom = leaf.NotBefore
+	record.ValidTo = leaf.NotAfter
+	record.DaysRemaining = DaysUntil(leaf.NotAfter, now)
+	record.LastCheckedAt = &now
+	record.VerifyError = ""
+	if verifyErr != nil {
+		record.VerifyError = verifyErr.Error()
+	}
+	if err := sc.db.Save(&record).Error; err != nil {
+		return nil, nil, err
+	}
+
+	sc.mu.Lock()
+	sc.evaluate(&record)
+	sc.mu.Unlock()
+	return &record, leaf, nil
+}
+
+// DaysUntil returns whole days from now until t, negative once t has passed.
+func DaysUntil(t, now time.Time) int {
+	d := t.Sub(now)
+	days := int(d / (24 * time.Hour))
+	if d < 0 && d%(24*time.Hour) != 0 {
+		days--
+	}
+	return days
+}
+
+// ExpirySeverity returns the alert severity for a certificate with
+// daysRemaining left, or "" when it is not close to expiry.
+func (sc *SSLChecker) ExpirySeverity(daysRemaining int) string {
+	switch {
+	case daysRemaining < sc.criticalDays:
+		return "critical"
+	case daysRemaining < sc.warnDays:
+		return "warning"
+	}
+	return ""
+}
+
+// evaluate keeps at most one open alert per certificate. A warning that
+// turns critical is resolved and replaced so the escalation notifies again;
+// a renewed certificate resolves its alert.
+func (sc *SSLChecker) evaluate(cert *models.SSLCert) {
+	severity := sc.ExpirySeverity(cert.DaysRemaining)
+
+	if open := sc.openAlert(cert); open != nil {
+		if severity == open.Severity || (severity == "warning" && open.Severity == "critical") {
+			return
+		}
+		sc.resolve(cert, open)
+	}
+	if severity == "" {
+		return
+	}
+
+	rule, err := sc.rule()
+	if err != nil {
+		slog.Error("Failed to load SSL alert rule", "error", err)
+		return
+	}
+	if !rule.Enabled {
+		return
+	}
+
+	message := fmt.Sprintf("SSL certificate for %s expires in %d days (%s)",
+		cert.Domain, cert.DaysRemaining, cert.ValidTo.Format("2006-01-02"))
+	if cert.DaysRemaining < 0 {
+		message = fmt.Sprintf("SSL certificate for %s expired %d days ago (%s)",
+			cert.Domain, -cert.DaysRemaining, cert.ValidTo.Format("2006-01-02"))
+	}
+	details := "Issuer: " + cert.Issuer
+	if cert.VerifyError != "" {
+		details += "\nVerification: " + cert.VerifyError
+	}
+
+	alert := models.Alert{
+		RuleID:   rule.ID,
+		Severity: severity,
+		Message:  message,
+		Details:  details,
+		Status:   "firing",
+	}
+	if err := sc.db.Create(&alert).Error; err != nil {
+		slog.Error("Failed to create SSL alert", "domain", cert.Domain, "error", err)
+		return
+	}
+	sc.db.Model(cert).Update("alert_id", alert.ID)
+	cert.AlertID = &alert.ID
+	sc.db.Model(rule).Update("last_triggered_at", time.Now())
+
+	sc.events.Publish(EventAlert, alert)
+	sc.notify(rule, alert, cert.Domain, NotifyFiring)
+	slog.Warn("SSL certificate expiring", "domain", cert.Domain, "days_remaining", cert.DaysRemaining, "severity", severity)
+}
+
+// openAlert returns the certificate's firing or acknowledged alert. A
+// reference to an alert that was since resolved is cleared.
+func (sc *SSLChecker) openAlert(cert *models.SSLCert) *models.Alert {
+	if cert.AlertID == nil {
+		return nil
+	}
+	var alert models.Alert
+	err := sc.db.Where("id = ? AND status IN ?", *cert.AlertID, []string{"firing", "acknowledged"}).First(&alert).Error
+	if err != nil {
+		sc.db.Model(cert).Update("alert_id", nil)
+		cert.AlertID = nil
+		return nil
+	}
+	return &alert
+}
+
+func (sc *SSLChecker) resolve(cert *models.SSLCert, alert *models.Alert) {
+	now := time.Now()
+	alert.Status = "resolved"
+	alert.ResolvedAt = &now
+	if err := sc.db.Save(alert).Error; err != nil {
+		slog.Error("Failed to resolve SSL alert", "alert", alert.ID, "error", err)
+		return
+	}
+	sc.db.Model(cert).Update("alert_id", nil)
+	cert.AlertID = nil
+
+	sc.events.Publish(EventAlert, *alert)
+	if rule, err := sc.rule(); err == nil {
+		sc.notify(rule, *alert, cert.Domain, NotifyResolved)
+	}
+	slog.Info("SSL alert resolved", "domain", cert.Domain)
+}
+
+// rule returns the built-in SSL expiry rule, creating it on first use.
+func (sc *SSLChecker) rule() (*models.AlertRule, error) {
+	rule := models.AlertRule{
+		Name:      "SSL certificate expiry",
+		Type:      SSLRuleType,
+		Metric:    "days_remaining",
+		Operator:  "<",
+		Threshold: float64(sc.warnDays),
+		Severity:  "warning",
+		Enabled:   true,
+	}
+	err := sc.db.Where("type = ?", SSLRuleType).Attrs(rule).FirstOrCreate(&rule).Error
+	return &rule, err
+}
+
+func (sc *SSLChecker) notify(rule *models.AlertRule, alert models.Alert, domain, event string) {
+	sc.notifier.Dispatch(rule, AlertNotification{
+		Event:    event,
+		AlertID:  alert.ID,
+		Rule:     rule.Name,
+		Severity: alert.Severity,
+		Server:   domain,
+		Message:  alert.Message,
+		Details:  alert.Details,
+		Time:     time.Now(),
+	})
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TelemetryContentType is the media type of the Prometheus text exposition
+// format Telemetry.Write renders.
+const TelemetryContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultTelemetry holds Bastion's own metrics, served on /metrics.
+var DefaultTelemetry = NewTelemetry()
+
+// Telemetry is a minimal registry of counters and scrape-time gauges that
+// renders them in the Prometheus text exposition format. Safe for
+// concurrent use.
+type Telemetry struct {
+	mu      sync.Mutex
+	metrics []telemetryMetric
+}
+
+type telemetryMetric struct {
+	name, help, kind string
+	labels           []string
+	collect          func() []TelemetrySample
+}
+
+// TelemetrySample is one value of a metric; Labels are in the order the
+// metric's label names were registered.
+type TelemetrySample struct {
+	Labels []string
+	Value  float64
+}
+
+func NewTelemetry() *Telemetry {
+	return &Telemetry{}
+}
+
+// Counter registers a counter with the given label names.
+func (t *Telemetry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{labels: len(labels), values: make(map[string]*counterValue)}
+	t.register(telemetryMetric{name: name, help: help, kind: "counter", labels: labels, collect: c.samples})
+	return c
+}
+
+// GaugeFunc registers a gauge whose samples are read by collect at scrape
+// time, for values that already live elsewhere (the database, the SSH pool).
+func (t *Telemetry) GaugeFunc(name, help string, labels []string, collect func() []TelemetrySample) {
+	t.register(telemetryMetric{name: name, help: help, kind: "gauge", labels: labels, collect: collect})
+}
+
+func (t *Telemetry) register(m telemetryMetric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, existing := range t.metrics {
+		if existing.name == m.name {
+			t.metrics[i] = m
+			return
+		}
+	}
+	t.metrics = append(t.metrics, m)
+	sort.Slice(t.metrics, func(i, j int) bool { return t.metrics[i].name < t.metrics[j].name })
+}
+
+// Write renders every metric in the text exposition format, metrics sorted
+// by name and samples by label values.
+func (t *Telemetry) Write(w io.Writer) error {
+	t.mu.Lock()
+	metrics := append([]telemetryMetric(nil), t.metrics...)
+	t.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.kind)
+
+		samples := m.collect()
+		sort.Slice(samples, func(i, j int) bool {
+			return strings.Join(samples[i].Labels, "\xff") < strings.Join(samples[j].Labels, "\xff")
+		})
+		for _, s := range samples {
+			bw.WriteString(m.name)
+			if len(m.labels) > 0 {
+				bw.WriteByte('{')
+				for i, name := range m.labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					value := ""
+					if i < len(s.Labels) {
+						value = s.Labels[i]
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", name, escapeLabelValue(value))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatSampleValue(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	mu     sync.Mutex
+	labels int
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// Inc adds one to the counter for the given label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the counter for the given
+// label values.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 || len(labelValues) != c.labels {
+		return
+	}
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	v, ok := c.values[key]
+	if !ok {
+		v = &counterValue{labels: append([]string(nil), labelValues...)}
+		c.values[key] = v
+	}
+	v.value += delta
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) samples() []TelemetrySample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	samples := make([]TelemetrySample, 0, len(c.values))
+	for _, v := range c.values {
+		samples = append(samples, TelemetrySample{Labels: v.labels, Value: v.value})
+	}
+	return samples
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelEscaper.Replace(s) }
+
+func formatSampleValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
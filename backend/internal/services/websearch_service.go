@@ -22,6 +22,8 @@ type SearchResult struct {
 type WebSearchService struct {
 	tavilyAPIKey string
 	serperAPIKey string
+	tavilyURL    string
+	serperURL    string
 	client       *http.Client
 }
 
@@ -30,12 +32,30 @@ func NewWebSearchService(tavilyKey, serperKey string) *WebSearchService {
 	return &WebSearchService{
 		tavilyAPIKey: tavilyKey,
 		serperAPIKey: serperKey,
+		tavilyURL:    "https://api.tavily.com/search",
+		serperURL:    "https://google.serper.dev/search",
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 	}
 }
 
+// SetEndpoints overrides the Tavily and Serper API URLs, e.g. to point at a
+// mock server. Empty values keep the current URL.
+func (s *WebSearchService) SetEndpoints(tavilyURL, serperURL string) {
+	if tavilyURL != "" {
+		s.tavilyURL = tavilyURL
+	}
+	if serperURL != "" {
+		s.serperURL = serperURL
+	}
+}
+
+// Configured reports whether a search provider API key is set
+func (s *WebSearchService) Configured() bool {
+	return s.tavilyAPIKey != "" || s.serperAPIKey != ""
+}
+
 // Search performs a web search with the given query
 // It tries Tavily first, then falls back to Serper if Tavily fails
 func (s *WebSearchService) Search(query string, maxResults int) ([]SearchResult, error) {
@@ -82,7 +102,7 @@ func (s *WebSearchService) searchTavily(query string, maxResults int) ([]SearchR
 	}
 
 	body, _ := json.Marshal(reqBody)
-	req, err := http.NewRequest("POST", "https://api.tavily.com/search", bytes.NewReader(body))
+	req, err := http.NewRequest("POST", s.tavilyURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -139,7 +159,7 @@ func (s *WebSearchService) searchSerper(query string, maxResults int) ([]SearchR
 	}
 
 	body, _ := json.Marshal(reqBody)
-	req, err := http.NewRequest("POST", "https://google.serper.dev/search", bytes.NewReader(body))
+	req, err := http.NewRequest("POST", s.serperURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// searchMock serves canned Tavily and Serper responses and records the
+// decoded request bodies.
+type searchMock struct {
+	tavilyStatus, serperStatus int
+	tavilyReq, serperReq       map[string]interface{}
+	serperKey                  string
+}
+
+func (m *searchMock) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/tavily":
+			m.tavilyReq = body
+			w.WriteHeader(m.tavilyStatus)
+			w.Write([]byte(`{"results":[{"title":"Exit code 137","url":"https://docs.example/137","content":"` +
+				strings.Repeat("x", 400) + `","score":0.9}]}`))
+		case "/serper":
+			m.serperReq = body
+			m.serperKey = r.Header.Get("X-API-KEY")
+			w.WriteHeader(m.serperStatus)
+			w.Write([]byte(`{"organic":[{"title":"OOM killer","link":"https://kb.example/oom","snippet":"SIGKILL"},` +
+				`{"title":"cgroups","link":"https://kb.example/cg","snippet":"memory.max"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSearchServiceTavily(t *testing.T) {
+	mock := &searchMock{tavilyStatus: http.StatusOK, serperStatus: http.StatusOK}
+	srv := mock.start(t)
+	s := NewWebSearchService("tvly-key", "serper-key")
+	s.SetEndpoints(srv.URL+"/tavily", srv.URL+"/serper")
+
+	results, err := s.Search("exit code 137", 3)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 || results[0].Source != "tavily" || results[0].URL != "https://docs.example/137" {
+		t.Fatalf("results = %+v, want the Tavily result", results)
+	}
+	if len(results[0].Snippet) != 303 {
+		t.Errorf("snippet length = %d, want content truncated to 300 plus ellipsis", len(results[0].Snippet))
+	}
+	if mock.tavilyReq["api_key"] != "tvly-key" || mock.tavilyReq["query"] != "exit code 137" || mock.tavilyReq["max_results"] != float64(3) {
+		t.Errorf("Tavily request = %v", mock.tavilyReq)
+	}
+	if mock.serperReq != nil {
+		t.Error("Serper was queried although Tavily answered")
+	}
+}
+
+func TestWebSearchServiceFallsBackToSerper(t *testing.T) {
+	mock := &searchMock{tavilyStatus: http.StatusUnauthorized, serperStatus: http.StatusOK}
+	srv := mock.start(t)
+	s := NewWebSearchService("tvly-key", "serper-key")
+	s.SetEndpoints(srv.URL+"/tavily", srv.URL+"/serper")
+
+	results, err := s.Search("oom killer", 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 || results[0].Source != "serper" || results[1].Title != "cgroups" {
+		t.Fatalf("results = %+v, want the Serper results", results)
+	}
+	if mock.serperKey != "serper-key" || mock.serperReq["q"] != "oom killer" || mock.serperReq["num"] != float64(10) {
+		t.Errorf("Serper request = %v with key %q, want the default of 10 results", mock.serperReq, mock.serperKey)
+	}
+
+	formatted := s.FormatResults(results)
+	if !strings.Contains(formatted, "1. **OOM killer**") || !strings.Contains(formatted, "URL: https://kb.example/cg") {
+		t.Errorf("FormatResults = %q", formatted)
+	}
+}
+
+func TestWebSearchServiceBothFail(t *testing.T) {
+	mock := &searchMock{tavilyStatus: http.StatusInternalServerError, serperStatus: http.StatusTooManyRequests}
+	srv := mock.start(t)
+	s := NewWebSearchService("tvly-key", "serper-key")
+	s.SetEndpoints(srv.URL+"/tavily", srv.URL+"/serper")
+
+	if _, err := s.Search("anything", 5); err == nil {
+		t.Error("Search succeeded with both providers failing")
+	}
+	if mock.tavilyReq == nil || mock.serperReq == nil {
+		t.Error("Search did not try both providers")
+	}
+}
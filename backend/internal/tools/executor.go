@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// toolQueueWait is how long a queued tool call waits for a free slot before
+// giving up as busy.
+const toolQueueWait = 10 * time.Second
+
+// ErrToolBusy is returned by ExecuteTool when every execution slot is taken
+// and the queue is full or the wait for a slot timed out.
+var ErrToolBusy = errors.New("tool executor busy")
+
+// toolBusyResult is the tool result handed back to the model when saturated.
+const toolBusyResult = "Tool executor is busy: too many tool calls are running. Retry this call shortly."
+
+// toolExecutor bounds how many tool calls run at once and how many may wait
+// for a slot.
+type toolExecutor struct {
+	slots    chan struct{}
+	queueMax int32
+	waiting  atomic.Int32
+}
+
+func newToolExecutor(concurrency, queue int) *toolExecutor {
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	if queue < 0 {
+		queue = 0
+	}
+	return &toolExecutor{
+		slots:    make(chan struct{}, concurrency),
+		queueMax: int32(queue),
+	}
+}
+
+// acquire takes an execution slot, queueing for up to toolQueueWait when
+// none is free. The returned func releases the slot.
+func (e *toolExecutor) acquire() (func(), error) {
+	release := func() { <-e.slots }
+
+	select {
+	case e.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if e.waiting.Add(1) > e.queueMax {
+		e.waiting.Add(-1)
+		return nil, ErrToolBusy
+	}
+	defer e.waiting.Add(-1)
+
+	timer := time.NewTimer(toolQueueWait)
+	defer timer.Stop()
+	select {
+	case e.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrToolBusy
+	}
+}
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestToolExecutorBoundsSimultaneousCalls(t *testing.T) {
+	const concurrency, queue, calls = 2, 3, 20
+	e := newToolExecutor(concurrency, queue)
+
+	var running, peak, done, busy atomic.Int32
+	hold := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := e.acquire()
+			if errors.Is(err, ErrToolBusy) {
+				busy.Add(1)
+				return
+			}
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			<-hold
+			running.Add(-1)
+			done.Add(1)
+			release()
+		}()
+	}
+
+	// Every call beyond the running and queued ones is turned away at once
+	deadline := time.Now().Add(5 * time.Second)
+	for busy.Load() < calls-concurrency-queue && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := busy.Load(); n != calls-concurrency-queue {
+		t.Fatalf("busy calls = %d, want %d rejected while saturated", n, calls-concurrency-queue)
+	}
+
+	close(hold)
+	wg.Wait()
+	if p := peak.Load(); p > concurrency {
+		t.Errorf("peak concurrent calls = %d, want at most %d", p, concurrency)
+	}
+	if n := done.Load(); n != concurrency+queue {
+		t.Errorf("completed calls = %d, want the %d running and queued calls to finish", n, concurrency+queue)
+	}
+}
+
+func TestExecuteToolReturnsBusyResult(t *testing.T) {
+	r := &ToolRegistry{executor: newToolExecutor(1, 0)}
+	release, err := r.executor.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := r.ExecuteTool("get_server_list", nil)
+	if !errors.Is(err, ErrToolBusy) || result != toolBusyResult {
+		t.Errorf("saturated ExecuteTool = %q, %v; want the busy result and ErrToolBusy", result, err)
+	}
+
+	release()
+	if _, err := r.ExecuteTool("no_such_tool", nil); errors.Is(err, ErrToolBusy) {
+		t.Error("ExecuteTool still busy after the slot was released")
+	}
+}
@@ -2,7 +2,9 @@ package tools
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,7 +13,7 @@ import (
 
 	"github.com/ahmetk3436/bastion/internal/config"
 	"github.com/ahmetk3436/bastion/internal/models"
-	"github.com/google/uuid"
+	"github.com/ahmetk3436/bastion/internal/services"
 	"golang.org/x/crypto/ssh"
 	"gorm.io/gorm"
 )
@@ -31,7 +33,7 @@ type ToolCallFunction struct {
 
 // SSHPoolInterface defines the interface for SSH pool operations
 type SSHPoolInterface interface {
-	GetConnection(host string, port int, username, password, privateKey, authType string) (*ssh.Client, error)
+	GetConnection(server *models.Server, password, privateKey string) (*ssh.Client, error)
 }
 
 // CredentialDecryptor defines the interface for decrypting credentials
@@ -46,10 +48,12 @@ type ToolRegistry struct {
 	sshPool    SSHPoolInterface
 	decryptor  CredentialDecryptor
 	httpClient *http.Client
+	executor   *toolExecutor
+	webSearch  *services.WebSearchService
 }
 
 // NewToolRegistry creates a new tool registry
-func NewToolRegistry(cfg *config.Config, db *gorm.DB, sshPool SSHPoolInterface, decryptor CredentialDecryptor) *ToolRegistry {
+func NewToolRegistry(cfg *config.Config, db *gorm.DB, sshPool SSHPoolInterface, decryptor CredentialDecryptor, webSearch *services.WebSearchService) *ToolRegistry {
 	return &ToolRegistry{
 		cfg:       cfg,
 		db:        db,
@@ -58,6 +62,8 @@ func NewToolRegistry(cfg *config.Config, db *gorm.DB, sshPool SSHPoolInterface,
 		httpClient: &http.Client{
 			Timeout: 60 * time.Second,
 		},
+		executor:  newToolExecutor(cfg.AIToolConcurrency, cfg.AIToolQueue),
+		webSearch: webSearch,
 	}
 }
 
@@ -67,9 +73,11 @@ func (r *ToolRegistry) GetToolDefinitions() []map[string]interface{} {
 		r.executeCommandTool(),
 		r.getServerListTool(),
 		r.getMonitorStatusTool(),
+		r.getMonitorIncidentsTool(),
 		r.getLogsTool(),
 		r.restartAppTool(),
 		r.searchWebTool(),
+		r.queryDatabaseTool(),
 	}
 }
 
@@ -181,6 +189,27 @@ func (r *ToolRegistry) restartAppTool() map[string]interface{} {
 	}
 }
 
+// getMonitorIncidentsTool defines the get_monitor_incidents tool
+func (r *ToolRegistry) getMonitorIncidentsTool() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "get_monitor_incidents",
+			"description": "Get uptime monitors that are currently down (consecutive fails, downtime, last error) and recent monitor incidents. Use this when a site or endpoint is reported down.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum number of monitors and incidents to return (default and max 20)",
+					},
+				},
+				"required": []string{},
+			},
+		},
+	}
+}
+
 // searchWebTool defines the search_web tool
 func (r *ToolRegistry) searchWebTool() map[string]interface{} {
 	return map[string]interface{}{
@@ -195,6 +224,10 @@ func (r *ToolRegistry) searchWebTool() map[string]interface{} {
 						"type":        "string",
 						"description": "The search query (e.g., 'docker container exited with code 137', 'nginx 502 bad error troubleshooting')",
 					},
+					"max_results": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Number of results to return (default: %d, max: %d).", defaultSearchResults, maxSearchResults),
+					},
 				},
 				"required": []string{"query"},
 			},
@@ -202,8 +235,42 @@ func (r *ToolRegistry) searchWebTool() map[string]interface{} {
 	}
 }
 
-// ExecuteTool executes a tool by name and returns the result
+// queryDatabaseTool defines the query_database tool
+func (r *ToolRegistry) queryDatabaseTool() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "query_database",
+			"description": "Run a read-only SQL query against an external application database. Only connections marked AI-queryable can be used, and results are capped.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"connection_id": map[string]interface{}{
+						"type":        "string",
+						"description": "The database connection ID",
+					},
+					"sql": map[string]interface{}{
+						"type":        "string",
+						"description": "A single read-only statement (SELECT, WITH, EXPLAIN or SHOW)",
+					},
+				},
+				"required": []string{"connection_id", "sql"},
+			},
+		},
+	}
+}
+
+// ExecuteTool executes a tool by name and returns the result. At most
+// AI_TOOL_CONCURRENCY calls run at once; when the queue is full it returns a
+// busy result with ErrToolBusy instead of piling up.
 func (r *ToolRegistry) ExecuteTool(toolName string, arguments map[string]interface{}) (string, error) {
+	release, err := r.executor.acquire()
+	if err != nil {
+		slog.Warn("AI tool call rejected, executor saturated", "tool", toolName)
+		return toolBusyResult, err
+	}
+	defer release()
+
 	switch toolName {
 	case "execute_command":
 		return r.executeCommand(arguments)
@@ -211,12 +278,16 @@ func (r *ToolRegistry) ExecuteTool(toolName string, arguments map[string]interfa
 		return r.getServerList(arguments)
 	case "get_monitor_status":
 		return r.getMonitorStatus(arguments)
+	case "get_monitor_incidents":
+		return r.getMonitorIncidents(arguments)
 	case "get_logs":
 		return r.getLogs(arguments)
 	case "restart_app":
 		return r.restartApp(arguments)
 	case "search_web":
 		return r.searchWeb(arguments)
+	case "query_database":
+		return r.queryDatabase(arguments)
 	default:
 		return "", fmt.Errorf("unknown tool: %s", toolName)
 	}
@@ -229,26 +300,9 @@ func (r *ToolRegistry) executeCommand(args map[string]interface{}) (string, erro
 		return "", fmt.Errorf("command is required")
 	}
 
-	// Get server_id or use default
-	var server *models.Server
-	serverIDStr, hasServerID := args["server_id"].(string)
-
-	if hasServerID && serverIDStr != "" {
-		serverID, err := uuid.Parse(serverIDStr)
-		if err != nil {
-			return "", fmt.Errorf("invalid server_id: %w", err)
-		}
-		if err := r.db.First(&server, "id = ?", serverID).Error; err != nil {
-			return "", fmt.Errorf("server not found: %w", err)
-		}
-	} else {
-		// Use default server
-		if err := r.db.First(&server, "is_default = ?", true).Error; err != nil {
-			// Try any server
-			if err := r.db.First(&server).Error; err != nil {
-				return "", fmt.Errorf("no server configured")
-			}
-		}
+	server, err := r.ResolveServer(args)
+	if err != nil {
+		return "", err
 	}
 
 	password, privateKey, err := r.decryptCredentials(server)
@@ -256,7 +310,7 @@ func (r *ToolRegistry) executeCommand(args map[string]interface{}) (string, erro
 		return "", fmt.Errorf("failed to decrypt credentials: %w", err)
 	}
 
-	client, err := r.sshPool.GetConnection(server.Host, server.Port, server.Username, password, privateKey, server.AuthType)
+	client, err := r.sshPool.GetConnection(server, password, privateKey)
 	if err != nil {
 		return "", fmt.Errorf("SSH connection failed: %w", err)
 	}
@@ -271,7 +325,7 @@ func (r *ToolRegistry) executeCommand(args map[string]interface{}) (string, erro
 	session.Stdout = &stdout
 	session.Stderr = &stderr
 
-	if err := session.Run(command); err != nil {
+	if _, err := services.RunSession(session, services.WrapCommand(server.CommandPrefix, server.Shell, command), r.cfg.ExecTimeout); err != nil {
 		// Command failed but return output anyway
 		output := stdout.String()
 		errOutput := stderr.String()
@@ -281,6 +335,9 @@ func (r *ToolRegistry) executeCommand(args map[string]interface{}) (string, erro
 			}
 			output += errOutput
 		}
+		if errors.Is(err, services.ErrCommandTimeout) {
+			return output + fmt.Sprintf("\n[Killed after %s timeout]", r.cfg.ExecTimeout), nil
+		}
 		return output + fmt.Sprintf("\n[Exit status: %v]", err), nil
 	}
 
@@ -295,22 +352,23 @@ func (r *ToolRegistry) executeCommand(args map[string]interface{}) (string, erro
 	return output, nil
 }
 
-// decryptCredentials decrypts the password or private key for a server
+// ResolveServer picks the server a tool call runs on: the
+// conversation_server_id the caller injects, the call's server_id,
+// AI_DEFAULT_SERVER and the is_default server, in that order.
+func (r *ToolRegistry) ResolveServer(args map[string]interface{}) (*models.Server, error) {
+	conversation, _ := args["conversation_server_id"].(string)
+	request, _ := args["server_id"].(string)
+	server, _, err := services.ResolveServer(r.db, services.ServerSelector{
+		Conversation: conversation,
+		Request:      request,
+		Config:       r.cfg.AIDefaultServer,
+	})
+	return server, err
+}
+
+// decryptCredentials decrypts the credentials for a server
 func (r *ToolRegistry) decryptCredentials(server *models.Server) (password, privateKey string, err error) {
-	if server.AuthType == "key" && server.EncryptedPrivateKey != "" {
-		decrypted, err := r.decryptor.Decrypt(server.EncryptedPrivateKey)
-		if err != nil {
-			return "", "", err
-		}
-		privateKey = decrypted
-	} else if server.EncryptedPassword != "" {
-		decrypted, err := r.decryptor.Decrypt(server.EncryptedPassword)
-		if err != nil {
-			return "", "", err
-		}
-		password = decrypted
-	}
-	return password, privateKey, nil
+	return services.DecryptServerCredentials(r.decryptor, server)
 }
 
 // getServerList implementation
@@ -343,24 +401,9 @@ func (r *ToolRegistry) getServerList(args map[string]interface{}) (string, error
 
 // getMonitorStatus implementation
 func (r *ToolRegistry) getMonitorStatus(args map[string]interface{}) (string, error) {
-	var server *models.Server
-	serverIDStr, hasServerID := args["server_id"].(string)
-
-	if hasServerID && serverIDStr != "" {
-		serverID, err := uuid.Parse(serverIDStr)
-		if err != nil {
-			return "", fmt.Errorf("invalid server_id: %w", err)
-		}
-		if err := r.db.First(&server, "id = ?", serverID).Error; err != nil {
-			return "", fmt.Errorf("server not found: %w", err)
-		}
-	} else {
-		// Use default server
-		if err := r.db.First(&server, "is_default = ?", true).Error; err != nil {
-			if err := r.db.First(&server).Error; err != nil {
-				return "", fmt.Errorf("no server configured")
-			}
-		}
+	server, err := r.ResolveServer(args)
+	if err != nil {
+		return "", err
 	}
 
 	var metrics models.ServerMetrics
@@ -374,6 +417,14 @@ func (r *ToolRegistry) getMonitorStatus(args map[string]interface{}) (string, er
 	result += fmt.Sprintf("Memory:      %.0f MB / %.0f MB (%.1f%%)\n",
 		metrics.MemoryUsedMB, metrics.MemoryTotalMB,
 		safePercent(metrics.MemoryUsedMB, metrics.MemoryTotalMB))
+	result += fmt.Sprintf("Buff/Cache:  %.0f MB\n", metrics.MemCachedMB)
+	if metrics.SwapTotalMB > 0 {
+		result += fmt.Sprintf("Swap:        %.0f MB / %.0f MB (%.1f%%)\n",
+			metrics.SwapUsedMB, metrics.SwapTotalMB,
+			safePercent(metrics.SwapUsedMB, metrics.SwapTotalMB))
+	} else {
+		result += "Swap:        none\n"
+	}
 	result += fmt.Sprintf("Disk:        %.1f GB / %.1f GB (%.1f%%)\n",
 		metrics.DiskUsedGB, metrics.DiskTotalGB,
 		safePercent(metrics.DiskUsedGB, metrics.DiskTotalGB))
@@ -398,6 +449,20 @@ func (r *ToolRegistry) getMonitorStatus(args map[string]interface{}) (string, er
 	return result, nil
 }
 
+// getMonitorIncidents implementation
+func (r *ToolRegistry) getMonitorIncidents(args map[string]interface{}) (string, error) {
+	limit := 0
+	if l, ok := args["limit"].(float64); ok {
+		limit = int(l)
+	}
+
+	summary, err := services.GetMonitorIncidents(r.db, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to load monitor incidents: %w", err)
+	}
+	return summary.Format(), nil
+}
+
 // getLogs implementation
 func (r *ToolRegistry) getLogs(args map[string]interface{}) (string, error) {
 	appUUID, _ := args["app_uuid"].(string)
@@ -472,18 +537,68 @@ func (r *ToolRegistry) restartApp(args map[string]interface{}) (string, error) {
 	return fmt.Sprintf("App %s restart initiated successfully", appUUID), nil
 }
 
-// searchWeb implementation - placeholder for now
+// Web search result limits for the search_web tool
+const (
+	defaultSearchResults = 5
+	maxSearchResults     = 10
+)
+
+// searchWeb implementation
 func (r *ToolRegistry) searchWeb(args map[string]interface{}) (string, error) {
 	query, _ := args["query"].(string)
 	if query == "" {
 		return "", fmt.Errorf("query is required")
 	}
 
-	slog.Info("Web search requested", "query", query)
+	if r.webSearch == nil || !r.webSearch.Configured() {
+		return fmt.Sprintf("Web search for '%s' was requested. To enable actual web search, configure Tavily or Serper API keys.", query), nil
+	}
+
+	maxResults := defaultSearchResults
+	if n, ok := args["max_results"].(float64); ok && n > 0 {
+		maxResults = min(int(n), maxSearchResults)
+	}
+
+	slog.Info("Web search requested", "query", query, "max_results", maxResults)
+
+	results, err := r.webSearch.Search(query, maxResults)
+	if err != nil {
+		return "", fmt.Errorf("web search failed: %w", err)
+	}
+	return r.webSearch.FormatResults(results), nil
+}
+
+// queryDatabase implementation
+func (r *ToolRegistry) queryDatabase(args map[string]interface{}) (string, error) {
+	connID, _ := args["connection_id"].(string)
+	query, _ := args["sql"].(string)
+	if connID == "" || query == "" {
+		return "", fmt.Errorf("connection_id and sql are required")
+	}
+
+	var conn models.DatabaseConnection
+	if err := r.db.First(&conn, "id = ?", connID).Error; err != nil {
+		return "", fmt.Errorf("connection not found: %s", connID)
+	}
+	if !conn.AIQueryable {
+		return "", fmt.Errorf("connection %s is not AI-queryable", conn.Name)
+	}
+	if err := services.CheckReadOnlyQuery(query); err != nil {
+		return "", err
+	}
+
+	dsn, err := r.decryptor.Decrypt(conn.EncryptedDSN)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt connection: %w", err)
+	}
+
+	result, err := services.QueryExternalDatabase(context.Background(), dsn, query, 200)
+	if err != nil {
+		return "", err
+	}
 
-	// For now, return a message indicating web search capability
-	// TODO: Integrate with Tavily/Serper API
-	return fmt.Sprintf("Web search for '%s' was requested. To enable actual web search, configure Tavily or Serper API keys.", query), nil
+	out, _ := json.Marshal(result)
+	return string(out), nil
 }
 
 // Helper functions
@@ -0,0 +1,47 @@
+package tools
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmetk3436/bastion/internal/services"
+)
+
+func TestSearchWebUsesWebSearchService(t *testing.T) {
+	var requested int
+	var num float64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested++
+		var body struct {
+			Num float64 `json:"num"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		num = body.Num
+		w.Write([]byte(`{"organic":[{"title":"nginx 502","link":"https://kb.example/502","snippet":"upstream down"}]}`))
+	}))
+	defer srv.Close()
+
+	search := services.NewWebSearchService("", "serper-key")
+	search.SetEndpoints("", srv.URL)
+	r := &ToolRegistry{executor: newToolExecutor(1, 0), webSearch: search}
+
+	result, err := r.ExecuteTool("search_web", map[string]interface{}{"query": "nginx 502", "max_results": float64(50)})
+	if err != nil {
+		t.Fatalf("search_web: %v", err)
+	}
+	if requested != 1 || !strings.Contains(result, "**nginx 502**") || !strings.Contains(result, "https://kb.example/502") {
+		t.Errorf("search_web = %q after %d requests, want the formatted Serper result", result, requested)
+	}
+	if num != maxSearchResults {
+		t.Errorf("requested %v results, want max_results capped at %d", num, maxSearchResults)
+	}
+
+	unconfigured := &ToolRegistry{executor: newToolExecutor(1, 0), webSearch: services.NewWebSearchService("", "")}
+	result, err = unconfigured.ExecuteTool("search_web", map[string]interface{}{"query": "nginx 502"})
+	if err != nil || !strings.Contains(result, "configure Tavily or Serper API keys") {
+		t.Errorf("unconfigured search_web = %q, %v; want the configuration hint", result, err)
+	}
+}
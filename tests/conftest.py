@@ -2,6 +2,8 @@
 Bastion Backend — Shared test configuration and fixtures.
 """
 import os
+import uuid
+
 import requests
 
 BASE_URL = os.getenv("BASTION_URL", "http://89.47.113.196:8097/api")
@@ -31,6 +33,26 @@ def auth_headers():
     return {"Authorization": f"Bearer {token}"}
 
 
+def role_headers(role):
+    """Create a throwaway user with role; return its Authorization header and
+    user ID. Callers disable the user when done."""
+    username = f"test-{role}-{uuid.uuid4().hex[:8]}"
+    password = uuid.uuid4().hex
+    resp = requests.post(f"{BASE_URL}/users", headers=auth_headers(), json={
+        "username": username,
+        "password": password,
+        "role": role,
+    }, timeout=10)
+    resp.raise_for_status()
+    user_id = resp.json()["id"]
+    resp = requests.post(f"{BASE_URL}/auth/login", json={
+        "username": username,
+        "password": password,
+    }, timeout=10)
+    resp.raise_for_status()
+    return {"Authorization": f"Bearer {resp.json()['access_token']}"}, user_id
+
+
 def api_get(path, params=None):
     return requests.get(f"{BASE_URL}{path}", headers=auth_headers(), params=params, timeout=15)
 
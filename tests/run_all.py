@@ -15,6 +15,7 @@ TEST_FILES = [
     "test_dashboard.py",
     "test_servers.py",
     "test_commands.py",
+    "test_secrets.py",
     "test_crons.py",
     "test_docker.py",
     "test_monitors.py",
@@ -16,7 +16,7 @@ def test_create_alert_rule():
         "operator": ">",
         "threshold": 95.0,
         "duration_seconds": 60,
-        "notification_channel": "telegram",
+        "notification_channel": "webhook",
     })
     assert resp.status_code in [200, 201], f"Create rule failed: {resp.status_code} {resp.text}"
     data = resp.json()
@@ -25,6 +25,54 @@ def test_create_alert_rule():
     print(f"  PASS: Alert rule created — id={RULE_ID}")
 
 
+def test_alert_rule_severity():
+    """POST /api/alerts/rules — severity defaults to warning and is validated."""
+    base = {"name": "Severity check", "type": "cpu", "metric": "cpu_percent", "threshold": 99.0}
+    resp = api_post("/alerts/rules", json={**base, "severity": "catastrophic"})
+    assert resp.status_code == 400, f"Expected 400 for bad severity, got {resp.status_code}"
+    resp = api_post("/alerts/rules", json={**base, "severity": "critical"})
+    assert resp.status_code == 201, f"Create failed: {resp.status_code} {resp.text}"
+    rule = resp.json()
+    assert rule["severity"] == "critical", f"Severity not stored: {rule}"
+    api_delete(f"/alerts/rules/{rule['id']}")
+    print("  PASS: Alert rule severity validated")
+
+
+def test_alert_rule_notification_channel():
+    """POST /api/alerts/rules — unknown notification channels are rejected."""
+    resp = api_post("/alerts/rules", json={
+        "name": "Channel check", "type": "cpu", "metric": "cpu_percent", "threshold": 99.0,
+        "notification_channel": "telegram",
+    })
+    assert resp.status_code == 400, f"Expected 400 for bad channel, got {resp.status_code}"
+    print("  PASS: Alert rule notification channel validated")
+
+
+def test_command_alert_rule():
+    """POST /api/alerts/rules — command rules need a server and command."""
+    resp = api_post("/alerts/rules", json={"name": "Health script", "type": "command", "command": "/opt/health.sh"})
+    assert resp.status_code == 400, f"Expected 400 without server_id, got {resp.status_code}"
+    resp = api_post("/alerts/rules", json={
+        "name": "Health script", "type": "command", "command": "/opt/health.sh",
+        "server_id": "00000000-0000-0000-0000-000000000000",
+    })
+    assert resp.status_code == 404, f"Expected 404 for unknown server, got {resp.status_code}"
+
+    servers = api_get("/servers").json().get("servers", [])
+    if not servers:
+        print("  SKIP: No server for command rule")
+        return
+    resp = api_post("/alerts/rules", json={
+        "name": "Health script", "type": "command", "command": "/opt/health.sh",
+        "server_id": servers[0]["id"], "failure_threshold": 2, "window_seconds": 600,
+    })
+    assert resp.status_code == 201, f"Create failed: {resp.status_code} {resp.text}"
+    rule = resp.json()
+    assert rule["metric"] == "exit_code" and rule["failure_threshold"] == 2, f"Unexpected rule: {rule}"
+    api_delete(f"/alerts/rules/{rule['id']}")
+    print("  PASS: Command alert rules validated")
+
+
 def test_list_alert_rules():
     """GET /api/alerts/rules — list all rules."""
     resp = api_get("/alerts/rules")
@@ -35,6 +83,27 @@ def test_list_alert_rules():
     print(f"  PASS: Listed {len(rules)} alert rules")
 
 
+def test_simulate_alert_rule():
+    """POST /api/alerts/rules/simulate — backtest a rule against history."""
+    resp = api_post("/alerts/rules/simulate", json={
+        "type": "cpu",
+        "metric": "cpu_percent",
+        "operator": ">",
+        "threshold": 90.0,
+        "duration_seconds": 60,
+    })
+    assert resp.status_code == 200, f"Simulate failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert "trigger_count" in data and "triggers" in data, f"Unexpected response: {data}"
+    resp = api_post("/alerts/rules/simulate", json={"metric": "cpu_percent", "operator": "!="})
+    assert resp.status_code == 400, f"Expected 400 for bad operator, got {resp.status_code}"
+    resp = api_post("/alerts/rules/simulate", json={
+        "metric": "cpu_percent", "from": "2025-01-01T00:00:00Z", "to": "2025-03-01T00:00:00Z",
+    })
+    assert resp.status_code == 400, f"Expected 400 for a 59-day window, got {resp.status_code}"
+    print(f"  PASS: Rule would have fired {data['trigger_count']} times")
+
+
 def test_list_alerts():
     """GET /api/alerts — list all alerts."""
     resp = api_get("/alerts")
@@ -52,6 +121,27 @@ def test_list_alerts_filtered():
     print("  PASS: Filtered alerts retrieved")
 
 
+def test_bulk_alerts():
+    """POST /api/alerts/bulk — acknowledge/resolve many alerts with per-ID results."""
+    missing = "00000000-0000-0000-0000-000000000000"
+    resp = api_post("/alerts/bulk", json={"action": "acknowledge", "ids": [missing, "bogus"]})
+    assert resp.status_code == 200, f"Bulk failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["updated"] == 0
+    errors = [r["error"] for r in data["results"]]
+    assert "alert not found" in errors and any("invalid alert ID" in e for e in errors), f"Unexpected results: {data}"
+
+    resp = api_post("/alerts/bulk", json={"action": "acknowledge", "all_firing": True, "severity": "info"})
+    assert resp.status_code == 200, f"Acknowledge all failed: {resp.status_code} {resp.text}"
+    assert all(r["ok"] for r in resp.json()["results"])
+
+    resp = api_post("/alerts/bulk", json={"action": "delete", "ids": [missing]})
+    assert resp.status_code == 400, f"Expected 400 for bad action, got {resp.status_code}"
+    resp = api_post("/alerts/bulk", json={"action": "resolve"})
+    assert resp.status_code == 400, f"Expected 400 without selection, got {resp.status_code}"
+    print("  PASS: Bulk alert actions")
+
+
 def test_delete_alert_rule():
     """DELETE /api/alerts/rules/:id — delete rule."""
     if not RULE_ID:
@@ -64,8 +154,13 @@ def test_delete_alert_rule():
 
 if __name__ == "__main__":
     test_create_alert_rule()
+    test_alert_rule_severity()
+    test_alert_rule_notification_channel()
+    test_command_alert_rule()
     test_list_alert_rules()
+    test_simulate_alert_rule()
     test_list_alerts()
     test_list_alerts_filtered()
+    test_bulk_alerts()
     test_delete_alert_rule()
     print("\nALL ALERT TESTS PASSED")
@@ -1,7 +1,9 @@
 """
 Test: Audit log endpoints.
 """
-from conftest import api_get
+from datetime import datetime, timedelta
+
+from conftest import api_get, api_post, api_put, api_delete, ADMIN_USERNAME, SSH_HOST, SSH_USER, SSH_PASS
 
 
 def test_list_audit_logs():
@@ -30,8 +32,157 @@ def test_audit_filter_action():
     print("  PASS: Filtered audit by action")
 
 
+def test_model_hooks_audit():
+    """Creating, updating and deleting a monitor is audited automatically."""
+    resp = api_post("/monitors", json={"name": "Audit Hook Monitor", "url": "http://example.com"})
+    assert resp.status_code in [200, 201], f"Create monitor failed: {resp.status_code} {resp.text}"
+    monitor_id = resp.json()["id"]
+    api_put(f"/monitors/{monitor_id}", json={"interval_seconds": 120})
+    api_delete(f"/monitors/{monitor_id}")
+
+    for action in ("monitor.create", "monitor.update", "monitor.delete"):
+        resp = api_get("/audit", params={"action": action, "actor": ADMIN_USERNAME})
+        assert resp.status_code == 200
+        logs = resp.json()["logs"]
+        matched = [l for l in logs if l["target"] == monitor_id or monitor_id in str(l.get("details"))]
+        assert matched, f"No {action} audit entry for monitor {monitor_id}"
+    print("  PASS: Model hooks audited create/update/delete")
+
+
+
+def test_audit_target_and_date_filters():
+    """GET /api/audit?target=&from=&to=&order= — target substring and date range."""
+    resp = api_post("/monitors", json={"name": "Audit Filter Monitor", "url": "http://example.com"})
+    assert resp.status_code in [200, 201], f"Create monitor failed: {resp.status_code} {resp.text}"
+    monitor_id = resp.json()["id"]
+    api_put(f"/monitors/{monitor_id}", json={"interval_seconds": 120})
+    api_delete(f"/monitors/{monitor_id}")
+
+    # Target substring, case-insensitive
+    resp = api_get("/audit", params={"target": monitor_id[:13].upper()})
+    assert resp.status_code == 200, f"Target filter failed: {resp.status_code} {resp.text}"
+    logs = resp.json()["logs"]
+    assert logs and all(monitor_id[:13] in l["target"] for l in logs), logs
+    entry = next(l for l in logs if l["action"] == "monitor.create")
+
+    # LIKE wildcards in the filter are matched literally
+    resp = api_get("/audit", params={"target": monitor_id[:8] + "%"})
+    assert resp.status_code == 200 and resp.json()["total"] == 0, f"% acted as a wildcard: {resp.text}"
+
+    # Date range around the entry includes it; a range before it does not
+    created = datetime.fromisoformat(entry["created_at"].replace("Z", "+00:00"))
+    window = {
+        "target": monitor_id,
+        "from": (created - timedelta(seconds=1)).isoformat(),
+        "to": (created + timedelta(seconds=1)).isoformat(),
+    }
+    resp = api_get("/audit", params=window)
+    assert resp.status_code == 200, f"Date filter failed: {resp.status_code} {resp.text}"
+    assert entry["id"] in [l["id"] for l in resp.json()["logs"]]
+
+    resp = api_get("/audit", params={"target": monitor_id, "to": (created - timedelta(minutes=1)).isoformat()})
+    assert resp.status_code == 200
+    assert resp.json()["total"] == 0, resp.json()
+
+    # Ascending order puts the create before the update
+    resp = api_get("/audit", params={"target": monitor_id, "order": "asc"})
+    actions = [l["action"] for l in resp.json()["logs"]]
+    assert actions.index("monitor.create") < actions.index("monitor.update"), actions
+
+    for bad in ({"from": "yesterday"}, {"to": "2026-13-01"}, {"order": "sideways"},
+                {"from": "2026-02-01T00:00:00Z", "to": "2026-01-01T00:00:00Z"}):
+        resp = api_get("/audit", params=bad)
+        assert resp.status_code == 400, f"Expected 400 for {bad}: {resp.status_code}"
+    print("  PASS: Audit target, date range and order filters")
+
+
+def _audit_entries(action, target):
+    resp = api_get("/audit", params={"action": action, "actor": ADMIN_USERNAME})
+    assert resp.status_code == 200, f"Audit query failed: {resp.status_code} {resp.text}"
+    return [l for l in resp.json()["logs"] if l["target"] == target]
+
+
+def test_exec_and_kill_audited():
+    """Running a command and killing a process each write an audit entry."""
+    resp = api_post("/servers", json={
+        "name": "Audit Action Server",
+        "host": SSH_HOST, "port": 22,
+        "username": SSH_USER, "password": SSH_PASS,
+        "auth_type": "password",
+    })
+    assert resp.status_code in [200, 201], f"Create server failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    server_id = data.get("server", data)["id"]
+    try:
+        resp = api_post(f"/servers/{server_id}/exec", json={
+            "command": "nohup sleep 300 >/dev/null 2>&1 & echo $!",
+            "confirm": True,
+        })
+        assert resp.status_code == 200, f"Exec failed: {resp.status_code} {resp.text}"
+        pid = resp.json()["output"].strip().splitlines()[-1]
+        history_id = resp.json()["id"]
+
+        execs = [l for l in _audit_entries("command.exec", server_id)
+                 if l["details"].get("history_id") == history_id]
+        assert execs, f"No command.exec audit entry for history {history_id}"
+        assert execs[0]["actor"] == ADMIN_USERNAME
+        assert "sleep 300" in execs[0]["details"]["command"]
+
+        resp = api_post(f"/servers/{server_id}/processes/{pid}/kill", json={"signal": "9"})
+        assert resp.status_code == 200, f"Kill failed: {resp.status_code} {resp.text}"
+
+        kills = [l for l in _audit_entries("process.kill", server_id)
+                 if l["details"].get("pid") == pid]
+        assert kills, f"No process.kill audit entry for pid {pid}"
+        assert kills[0]["actor"] == ADMIN_USERNAME
+        assert kills[0]["details"]["signal"] == "9"
+        assert kills[0]["details"]["result"] == "ok"
+    finally:
+        api_delete(f"/servers/{server_id}")
+    print("  PASS: Command exec and process kill audited")
+
+
+def test_ai_actions_audited():
+    """POST /api/ai/execute — AI commands and Coolify restarts write audit entries."""
+    resp = api_post("/servers", json={
+        "name": "Audit AI Server",
+        "host": SSH_HOST, "port": 22,
+        "username": SSH_USER, "password": SSH_PASS,
+        "auth_type": "password",
+    })
+    assert resp.status_code in [200, 201], f"Create server failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    server_id = data.get("server", data)["id"]
+    try:
+        resp = api_post("/ai/execute", json={
+            "action": "execute_command", "server_id": server_id, "command": "echo audit-ai-marker",
+        })
+        assert resp.status_code == 200, f"AI execute failed: {resp.status_code} {resp.text}"
+
+        cmds = [l for l in _audit_entries("ai.command", server_id)
+                if "audit-ai-marker" in l["details"].get("command", "")]
+        assert cmds, "No ai.command audit entry"
+        assert cmds[0]["details"]["exit_code"] == 0
+        assert cmds[0]["details"]["history_id"], cmds[0]
+        assert cmds[0]["details"]["server_source"], cmds[0]
+    finally:
+        api_delete(f"/servers/{server_id}")
+
+    # The restart is audited whether or not Coolify accepts it
+    app_uuid = "audit-ai-restart-app"
+    api_post("/ai/execute", json={"action": "restart_app", "app_uuid": app_uuid})
+    restarts = _audit_entries("coolify.restart", app_uuid)
+    assert restarts, "No coolify.restart audit entry"
+    assert "status" in restarts[0]["details"], restarts[0]
+    print("  PASS: AI command and Coolify restart audited")
+
+
 if __name__ == "__main__":
     test_list_audit_logs()
     test_audit_pagination()
     test_audit_filter_action()
+    test_model_hooks_audit()
+    test_audit_target_and_date_filters()
+    test_exec_and_kill_audited()
+    test_ai_actions_audited()
     print("\nALL AUDIT TESTS PASSED")
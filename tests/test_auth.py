@@ -1,8 +1,12 @@
 """
 Test: Authentication endpoints — login, refresh, me, password change.
 """
+import base64
+import json
+import uuid
+
 import requests
-from conftest import BASE_URL, ADMIN_USERNAME, ADMIN_PASSWORD, get_tokens, auth_headers, api_get, api_put
+from conftest import BASE_URL, ADMIN_USERNAME, ADMIN_PASSWORD, get_tokens, auth_headers, api_get, api_post, api_put
 
 
 def test_login_success():
@@ -75,6 +79,80 @@ def test_refresh_token():
     print("  PASS: Token refresh works")
 
 
+def _jwt_part(token, index):
+    part = token.split(".")[index]
+    return json.loads(base64.urlsafe_b64decode(part + "=" * (-len(part) % 4)))
+
+
+def test_token_lifetimes():
+    """POST /api/auth/login — token lifetimes and algorithm follow config bounds."""
+    access, refresh = get_tokens()
+    header = _jwt_part(access, 0)
+    assert header["alg"] in ["HS256", "HS384", "HS512"], f"Unexpected alg: {header}"
+    access_ttl = _jwt_part(access, 1)["exp"] - _jwt_part(access, 1)["iat"]
+    refresh_ttl = _jwt_part(refresh, 1)["exp"] - _jwt_part(refresh, 1)["iat"]
+    assert 60 <= access_ttl <= 86400, f"Access lifetime out of bounds: {access_ttl}s"
+    assert access_ttl <= refresh_ttl <= 90 * 86400, f"Refresh lifetime out of bounds: {refresh_ttl}s"
+
+    # A token re-labelled with another algorithm must be rejected
+    forged_header = base64.urlsafe_b64encode(json.dumps({"alg": "none", "typ": "JWT"}).encode()).rstrip(b"=").decode()
+    forged = ".".join([forged_header] + access.split(".")[1:2]) + "."
+    resp = requests.get(f"{BASE_URL}/auth/me", headers={"Authorization": f"Bearer {forged}"}, timeout=10)
+    assert resp.status_code == 401, f"Expected 401 for alg=none token, got {resp.status_code}"
+    print(f"  PASS: Access {access_ttl}s, refresh {refresh_ttl}s, alg {header['alg']}")
+
+
+def test_refresh_rotation_reuse():
+    """POST /api/auth/refresh — rotated tokens are single use; reuse revokes the family."""
+    access, first = get_tokens()
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": access}, timeout=10)
+    assert resp.status_code == 401, f"Access token accepted as refresh token: {resp.status_code}"
+
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": first}, timeout=10)
+    assert resp.status_code == 200, f"Refresh failed: {resp.status_code} {resp.text}"
+    second = resp.json()["refresh_token"]
+    assert second != first, "Refresh token was not rotated"
+
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": first}, timeout=10)
+    assert resp.status_code == 401, f"Consumed refresh token accepted: {resp.status_code}"
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": second}, timeout=10)
+    assert resp.status_code == 401, f"Family not revoked after reuse: {resp.status_code}"
+    print("  PASS: Refresh rotation and reuse detection")
+
+
+def test_refresh_reuse_audited():
+    """POST /api/auth/refresh — reusing a rotated token is written to the audit log."""
+    _, first = get_tokens()
+    jti = _jwt_part(first, 1)["jti"]
+    assert requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": first}, timeout=10).status_code == 200
+    assert requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": first}, timeout=10).status_code == 401
+
+    logs = api_get("/audit", params={"action": "auth.refresh_reuse", "actor": ADMIN_USERNAME}).json()["logs"]
+    assert any((log.get("details") or {}).get("jti") == jti for log in logs), "Reuse not audited"
+    print("  PASS: Refresh token reuse is audited")
+
+
+def test_logout():
+    """POST /api/auth/logout — revokes the refresh token and its rotations."""
+    _, first = get_tokens()
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": first}, timeout=10)
+    assert resp.status_code == 200, f"Refresh failed: {resp.status_code} {resp.text}"
+    current = resp.json()["refresh_token"]
+
+    resp = requests.post(f"{BASE_URL}/auth/logout", json={"refresh_token": current}, timeout=10)
+    assert resp.status_code == 200, f"Logout failed: {resp.status_code} {resp.text}"
+
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": current}, timeout=10)
+    assert resp.status_code == 401, f"Refresh after logout: expected 401, got {resp.status_code}"
+
+    resp = requests.post(f"{BASE_URL}/auth/logout", json={"refresh_token": "invalid.token.here"}, timeout=10)
+    assert resp.status_code == 401, f"Logout with a bad token: expected 401, got {resp.status_code}"
+
+    logs = api_get("/audit", params={"action": "auth.logout", "actor": ADMIN_USERNAME}).json()["logs"]
+    assert logs, "Logout not audited"
+    print("  PASS: Logout revokes the session")
+
+
 def test_refresh_invalid_token():
     """POST /api/auth/refresh — invalid token should fail."""
     resp = requests.post(f"{BASE_URL}/auth/refresh", json={
@@ -121,6 +199,150 @@ def test_password_change_too_short():
     print("  PASS: Short new password returns 400")
 
 
+def _create_user(role, password):
+    """Create a uniquely named user as admin and return it."""
+    username = f"test-{role}-{uuid.uuid4().hex[:8]}"
+    resp = api_post("/users", json={
+        "username": username,
+        "password": password,
+        "display_name": f"Test {role.title()}",
+        "role": role,
+    })
+    assert resp.status_code == 201, f"Create user failed: {resp.status_code} {resp.text}"
+    user = resp.json()
+    assert user["username"] == username
+    assert user["role"] == role
+    assert "password_hash" not in user, "Password hash must not be returned"
+    return user
+
+
+def _login(username, password):
+    return requests.post(f"{BASE_URL}/auth/login", json={
+        "username": username,
+        "password": password,
+    }, timeout=10)
+
+
+def test_login_db_user():
+    """POST /api/users then /api/auth/login — a created user can log in."""
+    user = _create_user("operator", "Operator-Pass-1")
+
+    resp = _login(user["username"], "Operator-Pass-1")
+    assert resp.status_code == 200, f"Login failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["user"]["username"] == user["username"]
+    assert data["user"]["role"] == "operator"
+    assert data["user"]["display_name"] == "Test Operator"
+
+    headers = {"Authorization": f"Bearer {data['access_token']}"}
+    me = requests.get(f"{BASE_URL}/auth/me", headers=headers, timeout=10).json()
+    assert me["username"] == user["username"]
+    assert me["last_login_at"], "last_login_at not recorded"
+
+    listed = api_get("/users").json()["users"]
+    assert any(u["username"] == user["username"] for u in listed)
+
+    dup = api_post("/users", json={"username": user["username"], "password": "Another-Pass-1"})
+    assert dup.status_code == 409, f"Expected 409 for duplicate, got {dup.status_code}"
+    print(f"  PASS: DB user {user['username']} logs in as operator")
+
+
+def test_password_change_persists():
+    """PUT /api/auth/password — the new hash is stored, not kept in memory."""
+    user = _create_user("viewer", "Viewer-Pass-1")
+    token = _login(user["username"], "Viewer-Pass-1").json()["access_token"]
+    other = _login(user["username"], "Viewer-Pass-1").json()["refresh_token"]
+
+    resp = requests.put(f"{BASE_URL}/auth/password", headers={"Authorization": f"Bearer {token}"}, json={
+        "old_password": "Viewer-Pass-1",
+        "new_password": "Viewer-Pass-2",
+    }, timeout=10)
+    assert resp.status_code == 200, f"Password change failed: {resp.status_code} {resp.text}"
+    refresh = resp.json()["refresh_token"]
+
+    # Sessions opened with the old password are revoked; the returned pair works
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": other}, timeout=10)
+    assert resp.status_code == 401, f"Old session still refreshes: {resp.status_code}"
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": refresh}, timeout=10)
+    assert resp.status_code == 200, f"New session refresh failed: {resp.status_code} {resp.text}"
+
+    # Logins read the hash from the database, so these hold across restarts.
+    assert _login(user["username"], "Viewer-Pass-1").status_code == 401
+    assert _login(user["username"], "Viewer-Pass-2").status_code == 200
+    print("  PASS: Changed password is persisted")
+
+
+def test_user_role_enforcement():
+    """/api/users is admin only; role changes and disabling apply to live tokens."""
+    user = _create_user("viewer", "Viewer-Pass-1")
+    login = _login(user["username"], "Viewer-Pass-1").json()
+    headers = {"Authorization": f"Bearer {login['access_token']}"}
+
+    resp = requests.get(f"{BASE_URL}/users", headers=headers, timeout=10)
+    assert resp.status_code == 403, f"Viewer listed users: {resp.status_code}"
+    resp = requests.post(f"{BASE_URL}/users", headers=headers, json={
+        "username": f"test-escalate-{uuid.uuid4().hex[:8]}",
+        "password": "Escalate-Pass-1",
+        "role": "admin",
+    }, timeout=10)
+    assert resp.status_code == 403, f"Viewer created a user: {resp.status_code}"
+
+    # A role change applies to tokens already issued
+    resp = api_put(f"/users/{user['id']}", json={"role": "admin"})
+    assert resp.status_code == 200, f"Promote failed: {resp.status_code} {resp.text}"
+    resp = requests.get(f"{BASE_URL}/users", headers=headers, timeout=10)
+    assert resp.status_code == 200, f"Promoted user still refused: {resp.status_code}"
+    api_put(f"/users/{user['id']}", json={"role": "viewer"})
+    resp = requests.get(f"{BASE_URL}/users", headers=headers, timeout=10)
+    assert resp.status_code == 403, f"Demoted user kept admin access: {resp.status_code}"
+
+    resp = api_put(f"/users/{user['id']}", json={"disabled": True})
+    assert resp.status_code == 200, f"Disable failed: {resp.status_code} {resp.text}"
+    assert resp.json()["disabled"] is True
+
+    resp = requests.get(f"{BASE_URL}/auth/me", headers=headers, timeout=10)
+    assert resp.status_code == 401, f"Disabled user's access token still works: {resp.status_code}"
+    assert _login(user["username"], "Viewer-Pass-1").status_code == 401
+    resp = requests.post(f"{BASE_URL}/auth/refresh", json={"refresh_token": login["refresh_token"]}, timeout=10)
+    assert resp.status_code == 401, f"Disabled user refreshed: {resp.status_code}"
+
+    me = api_get("/auth/me").json()
+    admin = next(u for u in api_get("/users").json()["users"] if u["username"] == me["username"])
+    resp = api_put(f"/users/{admin['id']}", json={"disabled": True})
+    assert resp.status_code == 400, f"Admin disabled themselves: {resp.status_code}"
+    print("  PASS: Non-admins get 403 on /users; demoted and disabled users lose access at once")
+
+
+def test_login_lockout():
+    """POST /api/auth/login — the sixth attempt after five failures gets 429."""
+    user = _create_user("viewer", "Lockout-Pass-1")
+    for i in range(5):
+        resp = _login(user["username"], f"wrong-{i}")
+        assert resp.status_code == 401, f"Attempt {i + 1}: expected 401, got {resp.status_code}"
+
+    # Locked out even with the right password
+    resp = _login(user["username"], "Lockout-Pass-1")
+    assert resp.status_code == 429, f"Expected 429, got {resp.status_code} {resp.text}"
+    retry_after = int(resp.headers.get("Retry-After", "0"))
+    assert 0 < retry_after <= 15 * 60, f"Bad Retry-After: {retry_after}"
+    print(f"  PASS: Sixth attempt locked out, Retry-After={retry_after}s")
+
+
+def test_login_success_resets_failures():
+    """POST /api/auth/login — a successful login clears earlier failures."""
+    user = _create_user("viewer", "Reset-Pass-1")
+    for i in range(4):
+        assert _login(user["username"], f"wrong-{i}").status_code == 401
+
+    resp = _login(user["username"], "Reset-Pass-1")
+    assert resp.status_code == 200, f"Login before lockout failed: {resp.status_code} {resp.text}"
+
+    for i in range(5):
+        resp = _login(user["username"], f"wrong-again-{i}")
+        assert resp.status_code == 401, f"Attempt {i + 1} after reset: expected 401, got {resp.status_code}"
+    print("  PASS: Successful login resets the failure count")
+
+
 if __name__ == "__main__":
     test_login_success()
     test_login_wrong_password()
@@ -128,9 +350,18 @@ if __name__ == "__main__":
     test_login_empty_body()
     test_login_no_content_type()
     test_refresh_token()
+    test_token_lifetimes()
+    test_refresh_rotation_reuse()
+    test_refresh_reuse_audited()
+    test_logout()
     test_refresh_invalid_token()
     test_me_endpoint()
     test_me_no_auth()
     test_password_change_wrong_old()
     test_password_change_too_short()
+    test_login_db_user()
+    test_password_change_persists()
+    test_user_role_enforcement()
+    test_login_lockout()
+    test_login_success_resets_failures()
     print("\nALL AUTH TESTS PASSED")
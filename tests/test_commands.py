@@ -1,7 +1,10 @@
 """
 Test: Command execution and history endpoints.
 """
-from conftest import api_get, api_post, api_delete, SSH_HOST, SSH_USER, SSH_PASS
+import time
+import uuid
+
+from conftest import api_get, api_post, api_put, api_delete, SSH_HOST, SSH_USER, SSH_PASS
 
 SERVER_ID = None
 
@@ -40,6 +43,34 @@ def test_exec_command():
     print(f"  PASS: Command exec — output='{data['output'].strip()}'")
 
 
+def test_exec_safety_gate():
+    """POST /api/servers/:id/exec — unsafe commands need confirm, verdict is returned."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={"command": "uptime"})
+    assert resp.status_code == 200, f"Safe exec failed: {resp.status_code} {resp.text}"
+    assert resp.json()["safety"] == {"safe": True, "category": "system", "base_command": "uptime"}, resp.text
+
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={"command": "rm -f /tmp/bastion_safety_gate"})
+    assert resp.status_code == 412, f"Expected 412 without confirm, got {resp.status_code}"
+    data = resp.json()
+    assert data["requires_confirmation"] and data["safety"]["category"] == "dangerous", f"Unexpected: {data}"
+
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={"command": "rm -f /tmp/bastion_safety_gate", "confirm": True})
+    assert resp.status_code == 200, f"Confirmed exec failed: {resp.status_code} {resp.text}"
+    assert resp.json()["safety"]["base_command"] == "rm", resp.text
+
+    # Every chained command is checked, and substitution or redirection to a file is never safe
+    for cmd in ["uptime && rm -f /tmp/bastion_safety_gate", "cat /etc/hostname | sh",
+                "echo $(id) > /tmp/bastion_safety_gate"]:
+        resp = api_post(f"/servers/{SERVER_ID}/exec", json={"command": cmd})
+        assert resp.status_code == 412, f"{cmd}: expected 412 without confirm, got {resp.status_code}"
+        resp = api_post("/commands/bulk-exec", json={"command": cmd, "server_ids": [SERVER_ID]})
+        assert resp.status_code == 412, f"bulk {cmd}: expected 412 without confirm, got {resp.status_code}"
+    print("  PASS: Exec safety gate enforced")
+
+
 def test_exec_command_with_error():
     """POST /api/servers/:id/exec — command that fails."""
     if not SERVER_ID:
@@ -55,6 +86,125 @@ def test_exec_command_with_error():
     print(f"  PASS: Failed command returns exit_code={data.get('exit_code')}")
 
 
+def test_exec_timeout():
+    """POST /api/servers/:id/exec, /api/ai/execute — timeout_seconds stops a hanging command with a 504."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    for path, body in [
+        (f"/servers/{SERVER_ID}/exec", {}),
+        (f"/servers/{SERVER_ID}/exec/diff", {}),
+        ("/ai/execute", {"action": "execute_command", "server_id": SERVER_ID}),
+    ]:
+        start = time.time()
+        resp = api_post(path, json={**body, "command": "echo started; sleep 10", "timeout_seconds": 1})
+        elapsed = time.time() - start
+        assert resp.status_code == 504, f"{path}: expected 504, got {resp.status_code} {resp.text}"
+        data = resp.json()
+        assert data["timed_out"] is True and data["exit_code"] == -1, f"{path}: unexpected result: {data}"
+        assert "started" in data["output"], f"{path}: partial output missing: {data['output']!r}"
+        assert elapsed < 9, f"{path}: command was not stopped, took {elapsed:.1f}s"
+
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={"command": "true", "timeout_seconds": 1})
+    assert resp.status_code == 200 and resp.json()["timed_out"] is False, f"Fast command: {resp.text}"
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={"command": "true", "timeout_seconds": -1})
+    assert resp.status_code == 400, f"Expected 400 for negative timeout, got {resp.status_code}"
+    print("  PASS: Hanging commands time out with partial output")
+
+
+def test_exec_diff():
+    """POST /api/servers/:id/exec/diff — diff output against previous run."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    cmd = "cat /etc/hostname"
+    resp = api_post(f"/servers/{SERVER_ID}/exec/diff", json={"command": cmd})
+    assert resp.status_code == 200, f"Diff exec failed: {resp.status_code} {resp.text}"
+    resp = api_post(f"/servers/{SERVER_ID}/exec/diff", json={"command": cmd})
+    assert resp.status_code == 200, f"Diff exec failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data.get("previous_id"), f"Expected a previous run: {data}"
+    assert data.get("changed") is False, f"Expected unchanged output: {data}"
+    assert data.get("output_hash"), "Missing output hash"
+    resp = api_get("/audit", params={"action": "command.diff"})
+    assert resp.status_code == 200, f"Audit query failed: {resp.status_code} {resp.text}"
+    entry = next((l for l in resp.json()["logs"] if l["details"].get("history_id") == data["id"]), None)
+    assert entry, f"No command.diff audit entry for history {data['id']}"
+    print("  PASS: Repeated command reports no drift")
+
+
+def test_exec_command_wrapper():
+    """PUT /api/servers/:id command_prefix/shell — commands run through the wrapper."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_put(f"/servers/{SERVER_ID}", json={"command_prefix": "env BASTION_WRAP=yes", "shell": "bash -c"})
+    assert resp.status_code == 200, f"Update failed: {resp.status_code} {resp.text}"
+    try:
+        resp = api_post(f"/servers/{SERVER_ID}/exec", json={
+            "command": "echo \"wrap=$BASTION_WRAP\" | tr a-z A-Z; echo 'it''s quoted'",
+            "confirm": True,
+        })
+        assert resp.status_code == 200, f"Exec failed: {resp.status_code} {resp.text}"
+        output = resp.json()["output"]
+        assert "WRAP=YES" in output, f"Wrapper not applied: {output}"
+        assert "its quoted" in output, f"Quoting broken: {output}"
+    finally:
+        api_put(f"/servers/{SERVER_ID}", json={"command_prefix": "", "shell": ""})
+    print("  PASS: Command prefix and shell wrap exec")
+
+
+def test_exec_script():
+    """POST /api/servers/:id/script — multi-line scripts run via stdin, risky ones need confirm."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_post(f"/servers/{SERVER_ID}/script", json={
+        "script": "set -e\nX='it''s'\necho \"line1 $X\"\necho line2\nexit 3\n",
+        "interpreter": "bash",
+    })
+    assert resp.status_code == 200, f"Script failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert "line1 its" in data["output"] and "line2" in data["output"], f"Unexpected output: {data}"
+    assert data["exit_code"] == 3, f"Expected exit 3: {data}"
+
+    resp = api_post(f"/servers/{SERVER_ID}/script", json={"script": "echo ok\nrm -f /tmp/bastion_script_probe\n"})
+    assert resp.status_code == 409, f"Expected 409 without confirm, got {resp.status_code}"
+    assert resp.json()["risks"][0]["line"] == 2
+    resp = api_post(f"/servers/{SERVER_ID}/script", json={
+        "script": "echo ok\nrm -f /tmp/bastion_script_probe\n",
+        "confirm": True,
+    })
+    assert resp.status_code == 200, f"Confirmed script failed: {resp.status_code} {resp.text}"
+    history_id = resp.json()["id"]
+    resp = api_get("/audit", params={"action": "command.script"})
+    assert resp.status_code == 200, f"Audit query failed: {resp.status_code} {resp.text}"
+    entry = next((l for l in resp.json()["logs"] if l["details"].get("history_id") == history_id), None)
+    assert entry, f"No command.script audit entry for history {history_id}"
+    assert entry["details"]["confirmed_risks"][0]["command"] == "rm", entry
+
+    # Python scripts are checked as Python: shell words in strings are not risks,
+    # shell commands handed to os.system and destructive library calls are
+    resp = api_post(f"/servers/{SERVER_ID}/script", json={
+        "script": "kill = []\nprint('rm -rf /')\n",
+        "interpreter": "python",
+    })
+    assert resp.status_code == 200, f"Harmless python script blocked: {resp.status_code} {resp.text}"
+    assert resp.json()["risks"] == [], resp.json()
+    for script, command in [("import os\nos.system('rm -f /tmp/bastion_script_probe')\n", "rm"),
+                            ("import shutil\nshutil.rmtree('/tmp/bastion_script_probe_dir')\n", "shutil.rmtree")]:
+        resp = api_post(f"/servers/{SERVER_ID}/script", json={"script": script, "interpreter": "python"})
+        assert resp.status_code == 409, f"Expected 409 for {command}, got {resp.status_code}"
+        assert resp.json()["risks"][0]["command"] == command, resp.json()
+
+    resp = api_post(f"/servers/{SERVER_ID}/script", json={"script": "sleep 5", "timeout_seconds": 1})
+    assert resp.status_code == 200 and resp.json()["exit_code"] == -1, f"Expected timeout: {resp.text}"
+
+    resp = api_post(f"/servers/{SERVER_ID}/script", json={"script": "echo", "interpreter": "perl"})
+    assert resp.status_code == 400, f"Expected 400 for interpreter, got {resp.status_code}"
+    print("  PASS: Script execution, confirmation and timeout")
+
+
 def test_command_history():
     """GET /api/servers/:id/history — command history."""
     if not SERVER_ID:
@@ -76,6 +226,55 @@ def test_favorites():
     print("  PASS: Favorites list retrieved")
 
 
+def test_bulk_exec():
+    """POST /api/commands/bulk-exec — one command on several servers, concurrently."""
+    tag = f"bulk-{uuid.uuid4().hex[:6]}"
+    ids = []
+    try:
+        for name in ("Bulk A", "Bulk B"):
+            resp = api_post("/servers", json={
+                "name": name, "host": SSH_HOST, "port": 22, "username": SSH_USER,
+                "password": SSH_PASS, "auth_type": "password", "tags": [tag],
+            })
+            assert resp.status_code in [200, 201], f"Setup failed: {resp.status_code} {resp.text}"
+            ids.append(resp.json().get("server", resp.json())["id"])
+
+        resp = api_post("/commands/bulk-exec", json={"command": "uptime"})
+        assert resp.status_code == 400, f"Expected 400 without a target, got {resp.status_code}"
+        resp = api_post("/commands/bulk-exec", json={"command": "uptime", "server_ids": ids, "tag": tag})
+        assert resp.status_code == 400, f"Expected 400 with both targets, got {resp.status_code}"
+        resp = api_post("/commands/bulk-exec", json={"command": "uptime", "server_ids": [str(uuid.uuid4())]})
+        assert resp.status_code == 404, f"Expected 404 for unknown server, got {resp.status_code}"
+        resp = api_post("/commands/bulk-exec", json={"command": "rm -f /tmp/bastion_bulk_gate", "tag": tag})
+        assert resp.status_code == 412 and resp.json()["requires_confirmation"], f"Unsafe batch ran: {resp.text}"
+
+        # Each run sleeps 2s; together they must take well under 4s
+        resp = api_post("/commands/bulk-exec", json={"command": "sleep 2; echo bulk-ok", "server_ids": ids})
+        assert resp.status_code == 200, f"Bulk exec failed: {resp.status_code} {resp.text}"
+        data = resp.json()
+        assert data["total"] == 2 and data["succeeded"] == 2 and data["failed"] == 0, f"Unexpected: {data}"
+        assert sorted(r["server_id"] for r in data["results"]) == sorted(ids)
+        for r in data["results"]:
+            assert r["exit_code"] == 0 and "bulk-ok" in r["output"], f"Bad result: {r}"
+            assert r["duration_ms"] >= 2000 and r["history_id"], f"Bad result: {r}"
+        assert data["duration_ms"] < 3800, f"Servers ran one after another: {data['duration_ms']}ms"
+
+        resp = api_post("/commands/bulk-exec", json={"command": "sh -c 'exit 3'", "tag": tag, "confirm": True})
+        assert resp.status_code == 200, f"Tag bulk exec failed: {resp.status_code} {resp.text}"
+        data = resp.json()
+        assert data["total"] == 2 and data["failed"] == 2, f"Unexpected: {data}"
+        assert all(r["exit_code"] == 3 for r in data["results"]), data
+
+        for sid in ids:
+            history = api_get(f"/servers/{sid}/history").json().get("history", [])
+            commands = [h["command"] for h in history]
+            assert "sleep 2; echo bulk-ok" in commands and "sh -c 'exit 3'" in commands, f"Not in history: {commands}"
+        print(f"  PASS: Bulk exec ran concurrently on {len(ids)} servers and recorded history")
+    finally:
+        for sid in ids:
+            api_delete(f"/servers/{sid}")
+
+
 def cleanup_server():
     """Delete the temporary server."""
     if SERVER_ID:
@@ -86,8 +285,14 @@ def cleanup_server():
 if __name__ == "__main__":
     setup_server()
     test_exec_command()
+    test_exec_safety_gate()
     test_exec_command_with_error()
+    test_exec_timeout()
+    test_exec_diff()
+    test_exec_command_wrapper()
+    test_exec_script()
     test_command_history()
     test_favorites()
+    test_bulk_exec()
     cleanup_server()
     print("\nALL COMMAND TESTS PASSED")
@@ -1,7 +1,9 @@
 """
 Test: Coolify proxy endpoints.
 """
-from conftest import api_get, api_post
+import requests
+
+from conftest import BASE_URL, api_get, api_post, api_put, api_delete, role_headers
 
 
 def test_list_apps():
@@ -14,6 +16,19 @@ def test_list_apps():
     print(f"  PASS: Coolify apps listed — {count} entries")
 
 
+def test_list_apps_cached():
+    """GET /api/coolify/apps — a second call within the TTL is served from cache."""
+    first = api_get("/coolify/apps", params={"refresh": "true"})
+    assert first.status_code == 200, f"List apps failed: {first.status_code} {first.text}"
+    assert first.headers.get("X-Cache") == "MISS", f"refresh=true served from cache: {first.headers}"
+
+    second = api_get("/coolify/apps")
+    assert second.status_code == 200
+    assert second.headers.get("X-Cache") == "HIT", f"Second call hit Coolify: {second.headers}"
+    assert second.json() == first.json(), "Cached apps differ from fetched apps"
+    print("  PASS: Coolify app list cached between calls")
+
+
 def test_get_app():
     """GET /api/coolify/apps/:uuid — get single app (Bastion itself)."""
     resp = api_get("/coolify/apps/dosgc4go4skko4kc0s4oksg8")
@@ -28,6 +43,18 @@ def test_get_app_envs():
     print("  PASS: Got app environment variables")
 
 
+def test_diff_app_envs():
+    """POST /api/coolify/apps/:uuid/envs/diff — compare envs, values masked."""
+    desired = {"BASTION_DIFF_PROBE": "plain-text-probe-value"}
+    resp = api_post("/coolify/apps/dosgc4go4skko4kc0s4oksg8/envs/diff", json={"desired": desired})
+    assert resp.status_code == 200, f"Diff failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert [a["key"] for a in data["added"]] == ["BASTION_DIFF_PROBE"], f"Unexpected added: {data['added']}"
+    assert "plain-text-probe-value" not in resp.text, "Desired value leaked in clear"
+    assert all(r["current"] in ["********", "(empty)"] for r in data["removed"]), "Current values not masked"
+    print(f"  PASS: Env diff — {len(data['added'])} added, {len(data['removed'])} removed, {len(data['changed'])} changed")
+
+
 def test_list_databases():
     """GET /api/coolify/databases — list databases."""
     resp = api_get("/coolify/databases")
@@ -49,11 +76,55 @@ def test_list_deployments():
     print("  PASS: Coolify deployments listed")
 
 
+def test_proxy_allowed_get():
+    """GET /api/coolify/proxy/applications/:uuid — forwarded with status and content type kept."""
+    resp = api_get("/coolify/proxy/applications/dosgc4go4skko4kc0s4oksg8")
+    assert resp.status_code == 200, f"Proxy GET failed: {resp.status_code} {resp.text}"
+    assert resp.headers["Content-Type"].startswith("application/json")
+    assert resp.json() == api_get("/coolify/apps/dosgc4go4skko4kc0s4oksg8").json(), "Proxy and fixed endpoint disagree"
+
+    resp = api_get("/coolify/proxy/applications/no-such-app-uuid")
+    assert resp.status_code == 404, f"Upstream 404 not preserved: {resp.status_code}"
+    print("  PASS: Coolify proxy forwards allowed GETs")
+
+
+def test_proxy_blocked():
+    """ANY /api/coolify/proxy/* — paths and methods outside the allowlist are refused."""
+    resp = api_get("/coolify/proxy/security/keys")
+    assert resp.status_code == 403, f"Expected 403 for blocked path, got {resp.status_code}"
+    assert resp.json()["error"] is True
+
+    resp = api_get("/coolify/proxy/applications/..%2Fteams")
+    assert resp.status_code == 400, f"Expected 400 for traversal, got {resp.status_code}"
+
+    resp = api_delete("/coolify/proxy/applications/dosgc4go4skko4kc0s4oksg8")
+    assert resp.status_code == 405, f"Expected 405 for DELETE, got {resp.status_code}"
+    assert "GET" in resp.headers.get("Allow", ""), f"Missing Allow header: {resp.headers}"
+
+    # Coolify serves deploy, start, stop and restart over GET; the proxy only forwards them as POST
+    for path in ["deploy", "applications/dosgc4go4skko4kc0s4oksg8/restart", "services/abc/stop"]:
+        resp = api_get(f"/coolify/proxy/{path}")
+        assert resp.status_code == 405, f"GET {path}: expected 405, got {resp.status_code}"
+        assert resp.headers.get("Allow") == "POST", f"GET {path}: unexpected Allow: {resp.headers}"
+
+    viewer, viewer_id = role_headers("viewer")
+    try:
+        resp = requests.get(f"{BASE_URL}/coolify/proxy/version", headers=viewer, timeout=15)
+        assert resp.status_code == 403, f"Viewer used the proxy: {resp.status_code}"
+    finally:
+        api_put(f"/users/{viewer_id}", json={"disabled": True})
+    print("  PASS: Coolify proxy blocks disallowed paths and methods")
+
+
 if __name__ == "__main__":
     test_list_apps()
+    test_list_apps_cached()
     test_get_app()
     test_get_app_envs()
+    test_diff_app_envs()
     test_list_databases()
     test_list_services()
     test_list_deployments()
+    test_proxy_allowed_get()
+    test_proxy_blocked()
     print("\nALL COOLIFY TESTS PASSED")
@@ -1,6 +1,8 @@
 """
 Test: Cron job CRUD and execution endpoints.
 """
+import threading
+import time
 from conftest import api_get, api_post, api_put, api_delete, SSH_HOST, SSH_USER, SSH_PASS
 
 SERVER_ID = None
@@ -88,6 +90,40 @@ def test_run_cron():
     print(f"  PASS: Cron executed — output={data.get('output', '').strip()}")
 
 
+def test_cancel_cron_run():
+    """POST /api/crons/runs/:runId/cancel — abort an in-flight run."""
+    if not CRON_ID:
+        print("  SKIP: No cron")
+        return
+    resp = api_get(f"/crons/{CRON_ID}/runs")
+    assert resp.status_code == 200, f"List runs failed: {resp.status_code} {resp.text}"
+    finished = [r for r in resp.json()["runs"] if r["status"] != "running"]
+    if finished:
+        resp = api_post(f"/crons/runs/{finished[0]['id']}/cancel")
+        assert resp.status_code == 409, f"Expected 409 for finished run, got {resp.status_code}"
+
+    api_put(f"/crons/{CRON_ID}", json={"command": "sleep 25"})
+    result = {}
+    runner = threading.Thread(target=lambda: result.update(resp=api_post(f"/crons/{CRON_ID}/run")))
+    runner.start()
+
+    run_id = None
+    for _ in range(20):
+        time.sleep(0.5)
+        runs = api_get(f"/crons/{CRON_ID}/runs").json()["runs"]
+        running = [r for r in runs if r["status"] == "running"]
+        if running:
+            run_id = running[0]["id"]
+            break
+    assert run_id, "Run never showed as running"
+
+    resp = api_post(f"/crons/runs/{run_id}/cancel")
+    assert resp.status_code == 200, f"Cancel failed: {resp.status_code} {resp.text}"
+    runner.join(timeout=20)
+    assert result["resp"].json()["status"] == "cancelled", f"Run not cancelled: {result['resp'].text}"
+    print(f"  PASS: Cron run {run_id} cancelled")
+
+
 def test_cron_logs():
     """GET /api/crons/:id/logs — get cron logs."""
     if not CRON_ID:
@@ -98,6 +134,34 @@ def test_cron_logs():
     print("  PASS: Cron logs retrieved")
 
 
+def test_dangerous_cron_requires_ack():
+    """POST /api/servers/:id/crons — dangerous commands need allow_dangerous; server must exist."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    body = {"name": "Dangerous Cron", "schedule": "0 3 * * *", "command": "cd /tmp && rm -rf bastion_cron_scratch"}
+    resp = api_post(f"/servers/{SERVER_ID}/crons", json=body)
+    assert resp.status_code == 412, f"Expected 412 without ack, got {resp.status_code} {resp.text}"
+    assert resp.json().get("requires_confirmation") is True
+
+    resp = api_post(f"/servers/{SERVER_ID}/crons", json={**body, "allow_dangerous": True})
+    assert resp.status_code == 201, f"Create with ack failed: {resp.status_code} {resp.text}"
+    cron = resp.json()
+    assert cron.get("dangerous_ack_by"), f"Acknowledgment not recorded: {cron}"
+
+    # Switching to a safe command clears the acknowledgment
+    resp = api_put(f"/crons/{cron['id']}", json={"command": "echo safe"})
+    assert resp.status_code == 200 and resp.json().get("dangerous_ack_by") == ""
+    resp = api_put(f"/crons/{cron['id']}", json={"command": "rm -rf /tmp/bastion_cron_scratch"})
+    assert resp.status_code == 412, f"Expected 412 on dangerous update, got {resp.status_code}"
+    api_delete(f"/crons/{cron['id']}")
+
+    resp = api_post("/servers/00000000-0000-0000-0000-000000000000/crons",
+                    json={"name": "Orphan", "schedule": "* * * * *", "command": "echo hi"})
+    assert resp.status_code == 404, f"Expected 404 for unknown server, got {resp.status_code}"
+    print("  PASS: Dangerous cron gated and unknown server rejected")
+
+
 def test_delete_cron():
     """DELETE /api/crons/:id — delete cron job."""
     if not CRON_ID:
@@ -121,7 +185,9 @@ if __name__ == "__main__":
     test_update_cron()
     test_toggle_cron()
     test_run_cron()
+    test_cancel_cron_run()
     test_cron_logs()
+    test_dangerous_cron_requires_ack()
     test_delete_cron()
     cleanup()
     print("\nALL CRON TESTS PASSED")
@@ -1,7 +1,7 @@
 """
 Test: Dashboard and System endpoints.
 """
-from conftest import api_get
+from conftest import api_get, api_post, api_delete
 import requests
 from conftest import BASE_URL
 
@@ -23,6 +23,13 @@ def test_dashboard_no_auth():
     print("  PASS: Dashboard without auth returns 401")
 
 
+def test_dashboard_stream_requires_upgrade():
+    """GET /api/ws/dashboard — plain HTTP is rejected with 426."""
+    resp = api_get("/ws/dashboard")
+    assert resp.status_code == 426, f"Expected 426, got {resp.status_code}"
+    print("  PASS: Dashboard stream requires WebSocket upgrade")
+
+
 def test_system_info():
     """GET /api/system/info — system information."""
     resp = api_get("/system/info")
@@ -41,9 +48,32 @@ def test_status_page():
     print(f"  PASS: Status page — status={data.get('status')}")
 
 
+
+def test_status_page_cache_invalidation():
+    """GET /api/status — cached payload is refreshed when monitors change."""
+    api_get("/status")
+    resp = api_post("/monitors", json={
+        "name": "Status Cache Probe",
+        "url": "http://127.0.0.1:9/",
+        "interval_seconds": 3600,
+    })
+    assert resp.status_code == 201, f"Create monitor failed: {resp.status_code} {resp.text}"
+    monitor_id = resp.json().get("id")
+    try:
+        names = [m["name"] for m in api_get("/status").json().get("monitors") or []]
+        assert "Status Cache Probe" in names, f"New monitor missing from cached status page: {names}"
+    finally:
+        api_delete(f"/monitors/{monitor_id}")
+    names = [m["name"] for m in api_get("/status").json().get("monitors") or []]
+    assert "Status Cache Probe" not in names, "Deleted monitor still on status page"
+    print("  PASS: Status page cache invalidated on monitor changes")
+
+
 if __name__ == "__main__":
     test_dashboard_overview()
     test_dashboard_no_auth()
+    test_dashboard_stream_requires_upgrade()
     test_system_info()
     test_status_page()
+    test_status_page_cache_invalidation()
     print("\nALL DASHBOARD TESTS PASSED")
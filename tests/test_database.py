@@ -1,7 +1,12 @@
 """
 Test: Database management endpoints.
 """
-from conftest import api_get, api_post
+import csv
+import io
+import json
+import uuid
+
+from conftest import api_get, api_post, api_put, api_delete
 
 
 def test_list_tables():
@@ -41,6 +46,179 @@ def test_read_only_query():
     print(f"  PASS: Read-only query — result: {data.get('rows')}")
 
 
+def test_export_table_ndjson():
+    """GET /api/database/tables/:name/export — streams bounded NDJSON rows."""
+    resp = api_get("/database/tables/servers/export", params={"limit": 3})
+    assert resp.status_code == 200, f"Export failed: {resp.status_code} {resp.text}"
+    assert "ndjson" in resp.headers.get("Content-Type", ""), f"Unexpected type: {resp.headers.get('Content-Type')}"
+    lines = [l for l in resp.text.splitlines() if l]
+    assert len(lines) <= 3, f"Limit not applied: {len(lines)} rows"
+    for line in lines:
+        assert "id" in json.loads(line), f"Row missing id: {line}"
+    print(f"  PASS: Exported {len(lines)} rows as NDJSON")
+
+
+def test_query_ndjson():
+    """POST /api/database/query?format=ndjson — streams query rows."""
+    resp = api_post("/database/query?format=ndjson", json={
+        "query": "SELECT generate_series(1, 5) AS n",
+    })
+    assert resp.status_code == 200, f"Query failed: {resp.status_code} {resp.text}"
+    rows = [json.loads(l) for l in resp.text.splitlines() if l]
+    assert [r["n"] for r in rows] == [1, 2, 3, 4, 5], f"Unexpected rows: {rows}"
+    resp = api_post("/database/query?format=ndjson", json={"query": "SELECT * FROM no_such_table"})
+    assert resp.status_code == 400, f"Expected 400 for bad query, got {resp.status_code}"
+    print("  PASS: Query streamed as NDJSON")
+
+
+def test_query_csv_export():
+    """POST /api/database/query?format=csv — quoting and NULL vs empty string."""
+    resp = api_post("/database/query?format=csv", json={
+        "query": "SELECT 1 AS id, 'a,b' AS note, '' AS empty, NULL::text AS missing, "
+                 "E'two\\nlines' AS multi, 'say \"hi\"' AS quoted",
+    })
+    assert resp.status_code == 200, f"CSV query failed: {resp.status_code} {resp.text}"
+    assert resp.headers.get("Content-Type", "").startswith("text/csv"), resp.headers.get("Content-Type")
+    assert 'filename="query.csv"' in resp.headers.get("Content-Disposition", ""), resp.headers
+    expected = 'id,note,empty,missing,multi,quoted\r\n1,"a,b","",,"two\nlines","say ""hi"""\r\n'
+    assert resp.text == expected, f"Unexpected CSV: {resp.text!r}"
+
+    resp = api_post("/database/query?format=json", json={"query": "SELECT generate_series(1, 3) AS n"})
+    assert resp.status_code == 200, f"JSON query failed: {resp.status_code} {resp.text}"
+    assert 'filename="query.json"' in resp.headers.get("Content-Disposition", "")
+    assert [r["n"] for r in json.loads(resp.text)] == [1, 2, 3], resp.text
+
+    resp = api_post("/database/query?format=xml", json={"query": "SELECT 1"})
+    assert resp.status_code == 400, f"Expected 400 for unknown format, got {resp.status_code}"
+    resp = api_post("/database/query?format=csv", json={"query": "DELETE FROM servers"})
+    assert resp.status_code == 403, f"Mutation allowed through CSV export: {resp.status_code}"
+    print("  PASS: Query exported as CSV and JSON")
+
+
+def test_table_rows_export():
+    """GET /api/database/tables/:name/rows?format= — CSV and JSON downloads."""
+    resp = api_get("/database/tables/servers/rows", params={"format": "csv", "limit": 2})
+    assert resp.status_code == 200, f"CSV export failed: {resp.status_code} {resp.text}"
+    assert resp.headers.get("Content-Type", "").startswith("text/csv")
+    assert 'filename="servers.csv"' in resp.headers.get("Content-Disposition", ""), resp.headers
+    records = list(csv.reader(io.StringIO(resp.text, newline="")))
+    assert "id" in records[0] and "name" in records[0], f"Unexpected header: {records[0]}"
+    assert len(records) <= 3 and all(len(r) == len(records[0]) for r in records), records
+
+    resp = api_get("/database/tables/servers/rows", params={"format": "json", "limit": 2})
+    assert resp.status_code == 200, f"JSON export failed: {resp.status_code} {resp.text}"
+    rows = json.loads(resp.text)
+    assert isinstance(rows, list) and len(rows) <= 2 and all("id" in r for r in rows), rows
+
+    resp = api_get("/database/tables/no_such_table/rows", params={"format": "csv"})
+    assert resp.status_code == 404, f"Expected 404 for unknown table, got {resp.status_code}"
+    resp = api_get("/database/tables/servers/rows", params={"format": "xlsx"})
+    assert resp.status_code == 400, f"Expected 400 for unknown format, got {resp.status_code}"
+    print(f"  PASS: Table rows exported as CSV ({len(records) - 1} rows) and JSON")
+
+
+def test_query_timeout():
+    """POST /api/database/query — a slow query is cancelled by the statement timeout."""
+    resp = api_post("/database/query", json={"query": "SELECT pg_sleep(10)", "timeout_seconds": 1})
+    assert resp.status_code == 504, f"Expected 504 for slow query, got {resp.status_code} {resp.text}"
+    assert "timed out" in resp.json()["message"], resp.text
+
+    resp = api_post("/database/query", json={"query": "SELECT pg_sleep(0.1) AS slept", "timeout_seconds": 5})
+    assert resp.status_code == 200, f"Quick query failed: {resp.status_code} {resp.text}"
+    assert resp.json()["duration_ms"] >= 100, resp.text
+    print("  PASS: Slow query timed out, fast query reported its duration")
+
+
+def test_query_row_cap():
+    """POST /api/database/query — oversized results are truncated at max_rows."""
+    resp = api_post("/database/query", json={"query": "SELECT generate_series(1, 500) AS n", "max_rows": 100})
+    assert resp.status_code == 200, f"Query failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["row_count"] == 100 and len(data["rows"]) == 100, f"Not capped: {data['row_count']}"
+    assert data["truncated"] is True and data["max_rows"] == 100, f"Missing truncated flag: {data}"
+    assert [r["n"] for r in data["rows"][:3]] == [1, 2, 3]
+
+    resp = api_post("/database/query", json={"query": "SELECT generate_series(1, 100) AS n", "max_rows": 100})
+    data = resp.json()
+    assert data["row_count"] == 100 and data["truncated"] is False, f"Exact fit marked truncated: {data}"
+    print("  PASS: Oversized result truncated with flag")
+
+
+def test_saved_queries():
+    """/api/database/saved-queries — save, list, update, re-run and delete."""
+    name = f"servers-count-{uuid.uuid4().hex[:6]}"
+    resp = api_post("/database/saved-queries", json={"name": name, "sql": "SELECT COUNT(*) AS cnt FROM servers"})
+    assert resp.status_code == 201, f"Save failed: {resp.status_code} {resp.text}"
+    saved = resp.json()
+    qid = saved["id"]
+    try:
+        resp = api_post("/database/saved-queries", json={"name": name, "sql": "SELECT 1"})
+        assert resp.status_code == 409, f"Expected 409 for duplicate name, got {resp.status_code}"
+        resp = api_post("/database/saved-queries", json={"name": "bad", "sql": "DELETE FROM servers"})
+        assert resp.status_code == 403, f"Mutation saved: {resp.status_code}"
+
+        queries = api_get("/database/saved-queries").json()["queries"]
+        assert any(q["id"] == qid and q["sql"] == saved["sql"] for q in queries), f"Not listed: {queries}"
+
+        resp = api_put(f"/database/saved-queries/{qid}", json={"sql": "DROP TABLE servers"})
+        assert resp.status_code == 403, f"Mutation accepted on update: {resp.status_code}"
+        resp = api_put(f"/database/saved-queries/{qid}", json={"sql": "SELECT generate_series(1, 3) AS n"})
+        assert resp.status_code == 200, f"Update failed: {resp.status_code} {resp.text}"
+
+        resp = api_post(f"/database/saved-queries/{qid}/run")
+        assert resp.status_code == 200, f"Run failed: {resp.status_code} {resp.text}"
+        data = resp.json()
+        assert [r["n"] for r in data["rows"]] == [1, 2, 3], f"Unexpected rows: {data['rows']}"
+        resp = api_post(f"/database/saved-queries/{qid}/run", json={"max_rows": 2})
+        assert resp.json()["truncated"] is True, resp.text
+
+        resp = api_get("/database/history", params={"saved_query_id": qid, "per_page": 10})
+        assert resp.status_code == 200, f"History failed: {resp.status_code} {resp.text}"
+        history = resp.json()
+        assert history["total"] == 2, f"Expected 2 runs, got {history['total']}"
+        latest = history["history"][0]
+        assert latest["success"] and latest["row_count"] == 2 and latest["truncated"], f"Unexpected: {latest}"
+        assert latest["sql"] == "SELECT generate_series(1, 3) AS n" and "duration_ms" in latest
+
+        assert api_post("/database/saved-queries/not-a-uuid/run").status_code == 400
+        assert api_post(f"/database/saved-queries/{uuid.uuid4()}/run").status_code == 404
+        print("  PASS: Saved query stored, guarded, re-run and recorded in history")
+    finally:
+        api_delete(f"/database/saved-queries/{qid}")
+
+
+def test_query_history():
+    """GET /api/database/history — ad hoc runs are recorded, failures included."""
+    marker = f"history_{uuid.uuid4().hex[:8]}"
+    api_post("/database/query", json={"query": f"SELECT 1 AS {marker}"})
+    api_post("/database/query", json={"query": f"SELECT * FROM {marker}"})
+    history = api_get("/database/history", params={"per_page": 20}).json()["history"]
+    runs = [h for h in history if marker in h["sql"]]
+    assert len(runs) == 2, f"Runs not recorded: {runs}"
+    failed, ok = runs
+    assert ok["success"] and ok["row_count"] == 1 and ok["saved_query_id"] is None, ok
+    assert not failed["success"] and failed["error"], failed
+    assert api_get("/database/history", params={"saved_query_id": "x"}).status_code == 400
+    print("  PASS: Ad hoc queries recorded in history")
+
+
+def test_explain_query():
+    """POST /api/database/explain — plan tree for SELECTs, everything else rejected."""
+    resp = api_post("/database/explain", json={"query": "SELECT id, name FROM servers WHERE name = 'x'"})
+    assert resp.status_code == 200, f"Explain failed: {resp.status_code} {resp.text}"
+    plan = resp.json()["plan"]
+    assert plan.get("Node Type") and "Total Cost" in plan, f"Not a plan node: {plan}"
+    assert "Actual Rows" not in plan, f"Query was analyzed: {plan}"
+
+    resp = api_post("/database/explain", json={"query": "DELETE FROM servers"})
+    assert resp.status_code == 403, f"Expected 403 for DELETE, got {resp.status_code}"
+    resp = api_post("/database/explain", json={"query": "SHOW work_mem"})
+    assert resp.status_code == 403, f"Expected 403 for SHOW, got {resp.status_code}"
+    resp = api_post("/database/explain", json={"query": "SELECT * FROM no_such_table"})
+    assert resp.status_code == 400, f"Expected 400 for unknown table, got {resp.status_code}"
+    print(f"  PASS: Explain returned a {plan['Node Type']} plan, DELETE rejected")
+
+
 def test_mutation_blocked():
     """POST /api/database/query — mutation should be blocked."""
     resp = api_post("/database/query", json={
@@ -59,6 +237,19 @@ def test_drop_blocked():
     print(f"  PASS: DROP blocked with {resp.status_code}")
 
 
+def test_read_only_guard():
+    """POST /api/database/query — the guard matches whole words and single statements."""
+    resp = api_post("/database/query", json={"query": "SELECT created_at FROM servers LIMIT 1"})
+    assert resp.status_code == 200, f"Column names must not trip the guard: {resp.status_code} {resp.text}"
+    resp = api_post("/database/query", json={"query": "SELECT 1; DROP TABLE servers"})
+    assert resp.status_code == 403, f"Expected 403 for stacked statements, got {resp.status_code}"
+    resp = api_get("/database/connections")
+    assert resp.status_code == 200, f"List connections failed: {resp.status_code}"
+    resp = api_post("/database/connections", json={"name": "bad", "dsn": "postgres://nobody@127.0.0.1:1/none"})
+    assert resp.status_code == 400, f"Expected 400 for unreachable dsn, got {resp.status_code}"
+    print("  PASS: Read-only guard and connection checks")
+
+
 def test_database_stats():
     """GET /api/database/stats — database statistics."""
     resp = api_get("/database/stats")
@@ -72,7 +263,17 @@ if __name__ == "__main__":
     test_list_tables()
     test_get_table_rows()
     test_read_only_query()
+    test_export_table_ndjson()
+    test_query_ndjson()
+    test_query_csv_export()
+    test_table_rows_export()
+    test_query_timeout()
+    test_query_row_cap()
+    test_saved_queries()
+    test_query_history()
+    test_explain_query()
     test_mutation_blocked()
     test_drop_blocked()
+    test_read_only_guard()
     test_database_stats()
     print("\nALL DATABASE TESTS PASSED")
@@ -34,6 +34,72 @@ def test_list_containers():
     return containers
 
 
+def test_container_parsed_status():
+    """GET /api/servers/:id/docker/containers — Status is parsed alongside the raw value."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/docker/containers")
+    assert resp.status_code == 200, f"List containers failed: {resp.status_code} {resp.text}"
+    containers = resp.json().get("containers") or []
+    for ct in containers:
+        assert "Status" in ct, "Raw Status should be kept"
+        parsed = ct.get("parsed_status")
+        assert parsed, f"Missing parsed_status: {ct}"
+        raw = ct["Status"]
+        if raw.startswith("Up "):
+            assert parsed["state"] in ("running", "paused"), f"{raw} -> {parsed}"
+        elif raw.startswith("Exited ("):
+            assert parsed["state"] == "exited", f"{raw} -> {parsed}"
+            code = int(raw.split("(")[1].split(")")[0])
+            assert parsed["exit_code"] == code, f"{raw} -> {parsed}"
+            if code == 137:
+                assert parsed["exit_reason"] == "oom_or_killed"
+        elif raw == "Created":
+            assert parsed["state"] == "created"
+        if "(healthy)" in raw:
+            assert parsed.get("health") == "healthy"
+    print(f"  PASS: Parsed status for {len(containers)} containers")
+
+
+def test_container_exec():
+    """POST /api/servers/:id/docker/containers/:cid/exec — runs a command in a container."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/docker/containers")
+    running = [ct for ct in resp.json().get("containers") or []
+               if (ct.get("parsed_status") or {}).get("state") == "running"]
+    if not running:
+        print("  SKIP: No running containers")
+        return
+    cid = (running[0].get("ID") or running[0].get("id"))[:12]
+    resp = api_post(f"/servers/{SERVER_ID}/docker/containers/{cid}/exec",
+                    json={"command": "echo \"in $0\"; echo oops >&2; exit 3", "confirm": True})
+    assert resp.status_code == 200, f"Exec failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["stdout"].strip() == "in sh", f"Unexpected stdout: {data}"
+    assert data["stderr"].strip() == "oops", f"Unexpected stderr: {data}"
+    assert data["exit_code"] == 3, f"Unexpected exit code: {data}"
+
+    resp = api_get(f"/servers/{SERVER_ID}/history")
+    entry = next((h for h in resp.json().get("history", []) if h["id"] == data["id"]), None)
+    assert entry and entry["container"] == cid, f"Exec not recorded as container exec: {entry}"
+    print("  PASS: Container exec returns stdout, stderr and exit code")
+
+
+def test_container_exec_invalid_id():
+    """POST /api/servers/:id/docker/containers/:cid/exec — container ID is validated."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_post(f"/servers/{SERVER_ID}/docker/containers/bad%3Bid/exec", json={"command": "id"})
+    assert resp.status_code == 400, f"Expected 400 for bad container ID, got {resp.status_code}"
+    resp = api_post(f"/servers/{SERVER_ID}/docker/containers/abc123/exec", json={})
+    assert resp.status_code == 400, f"Expected 400 without command, got {resp.status_code}"
+    print("  PASS: Container exec rejects invalid container IDs")
+
+
 def test_container_stats():
     """GET /api/servers/:id/docker/containers/:cid/stats — container stats."""
     if not SERVER_ID:
@@ -71,6 +137,106 @@ def test_container_logs():
     print(f"  PASS: Container logs returned {resp.status_code}")
 
 
+def test_search_container_logs():
+    """GET /api/servers/:id/docker/containers/:cid/logs/search — grep container logs."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    base = f"/servers/{SERVER_ID}/docker/containers/abc123/logs/search"
+    resp = api_get(base, params={"pattern": "x", "context": "50"})
+    assert resp.status_code == 400, f"Expected 400 for large context, got {resp.status_code}"
+
+    resp = api_get(f"/servers/{SERVER_ID}/docker/containers")
+    containers = resp.json().get("containers", [])
+    cid = (containers[0].get("id") or containers[0].get("ID") or "") if containers else ""
+    if not cid:
+        print("  PASS: Invalid context rejected (no containers to search)")
+        return
+
+    # The remote grep validates the pattern before docker runs, and a
+    # missing container is an error rather than "no matches"
+    resp = api_get(base, params={"pattern": "a(b"})
+    assert resp.status_code == 400, f"Expected 400 for invalid pattern, got {resp.status_code}"
+    resp = api_get(base, params={"pattern": "x"})
+    assert resp.status_code == 502, f"Expected 502 for missing container, got {resp.status_code}"
+    resp = api_get(f"/servers/{SERVER_ID}/docker/containers/{cid[:12]}/logs",
+                   params={"grep": "e'; echo x", "tail": "50", "context": "1"})
+    assert resp.status_code in [200, 502], f"Search failed: {resp.status_code} {resp.text}"
+    if resp.status_code == 200:
+        data = resp.json()
+        assert isinstance(data.get("lines"), list), f"Missing lines: {data}"
+    print(f"  PASS: Container log search returned {resp.status_code}")
+
+
+def test_stream_container_logs_validation():
+    """GET /api/servers/:id/docker/containers/:cid/logs/stream — checked before upgrade."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/docker/containers/bad%3Bid/logs/stream")
+    assert resp.status_code == 400, f"Expected 400 for bad container ID, got {resp.status_code}"
+    resp = api_get("/servers/not-a-uuid/docker/containers/abc123/logs/stream")
+    assert resp.status_code == 400, f"Expected 400 for bad server ID, got {resp.status_code}"
+    resp = api_get(f"/servers/{SERVER_ID}/docker/containers/abc123/logs/stream")
+    assert resp.status_code == 426, f"Expected 426 without WebSocket upgrade, got {resp.status_code}"
+    print("  PASS: Log stream validates IDs and requires a WebSocket")
+
+
+def test_container_top():
+    """GET /api/servers/:id/docker/containers/:cid/top — processes inside container."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/docker/containers")
+    containers = resp.json().get("containers", [])
+    if not containers:
+        print("  SKIP: No containers")
+        return
+    cid = containers[0].get("id") or containers[0].get("ID") or containers[0].get("container_id", "")
+    if not cid:
+        print("  SKIP: No container ID")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/docker/containers/{cid[:12]}/top")
+    assert resp.status_code in [200, 502], f"Top failed: {resp.status_code}"
+    if resp.status_code == 200:
+        data = resp.json()
+        assert "header" in data and "parsed" in data, f"Unexpected response: {data}"
+    print(f"  PASS: Container top returned {resp.status_code}")
+
+
+def test_list_compose_projects():
+    """GET /api/servers/:id/docker/compose — parsed `docker compose ls` output."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/docker/compose")
+    if resp.status_code == 502:
+        print(f"  SKIP: docker compose unavailable: {resp.json().get('message')}")
+        return
+    assert resp.status_code == 200, f"List compose failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["total"] == len(data["projects"]), f"Unexpected response: {data}"
+    for p in data["projects"]:
+        assert p["name"] and isinstance(p["config_files"], list), f"Unparsed project: {p}"
+        if p["config_files"]:
+            assert p["config_files"][0].startswith(p["path"]), f"Path not derived: {p}"
+    print(f"  PASS: Listed {data['total']} compose projects")
+
+
+def test_compose_action_validation():
+    """POST /api/servers/:id/docker/compose/action — path and action are validated."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    url = f"/servers/{SERVER_ID}/docker/compose/action"
+    for bad in ["/srv/app; rm -rf /", "/srv/$(id)", "/srv/app`id`", "/srv/a|b", ""]:
+        resp = api_post(url, json={"path": bad, "action": "up"})
+        assert resp.status_code == 400, f"Expected 400 for path {bad!r}, got {resp.status_code}"
+    resp = api_post(url, json={"path": "/srv/app", "action": "rm"})
+    assert resp.status_code == 400, f"Expected 400 for unknown action, got {resp.status_code}"
+    print("  PASS: Compose actions reject shell metacharacters and unknown actions")
+
+
 def test_list_images():
     """GET /api/servers/:id/docker/images — list Docker images."""
     if not SERVER_ID:
@@ -93,8 +259,16 @@ def cleanup():
 if __name__ == "__main__":
     setup_server()
     test_list_containers()
+    test_container_parsed_status()
+    test_container_exec()
+    test_container_exec_invalid_id()
     test_container_stats()
     test_container_logs()
+    test_search_container_logs()
+    test_stream_container_logs_validation()
+    test_container_top()
+    test_list_compose_projects()
+    test_compose_action_validation()
     test_list_images()
     cleanup()
     print("\nALL DOCKER TESTS PASSED")
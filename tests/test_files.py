@@ -1,7 +1,10 @@
 """
-Test: File management endpoints (list, read, write).
+Test: File management endpoints (list, read, write, search, delete, rename, mkdir, chmod).
 """
-from conftest import api_get, api_put, api_post, api_delete, SSH_HOST, SSH_USER, SSH_PASS
+import uuid
+
+import requests
+from conftest import api_get, api_put, api_post, api_delete, auth_headers, BASE_URL, SSH_HOST, SSH_USER, SSH_PASS
 
 SERVER_ID = None
 
@@ -42,6 +45,29 @@ def test_list_root():
     print("  PASS: Listed root directory")
 
 
+def test_list_files_bounded():
+    """GET /api/servers/:id/files?limit=&glob=&after= — bounded, paginated listing."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/files", params={"path": "/etc", "limit": 5})
+    assert resp.status_code == 200, f"List failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert len(data["files"]) <= 5
+    assert "truncated" in data
+    if data["truncated"]:
+        resp = api_get(f"/servers/{SERVER_ID}/files", params={"path": "/etc", "limit": 5, "after": data["next_after"]})
+        assert resp.status_code == 200
+        names = [f["name"] for f in resp.json()["files"]]
+        assert data["next_after"] not in names, "Next page repeated the cursor entry"
+    resp = api_get(f"/servers/{SERVER_ID}/files", params={"path": "/etc", "glob": "*.conf"})
+    assert resp.status_code == 200
+    assert all(f["name"].endswith(".conf") for f in resp.json()["files"]), "Glob filter not applied"
+    resp = api_get(f"/servers/{SERVER_ID}/files", params={"path": "/etc", "glob": "$(id)"})
+    assert resp.status_code == 400, f"Expected 400 for unsafe glob, got {resp.status_code}"
+    print("  PASS: Bounded listing with pagination and glob filter")
+
+
 def test_read_file():
     """GET /api/servers/:id/files/content — read a file."""
     if not SERVER_ID:
@@ -74,6 +100,209 @@ def test_write_and_read_file():
     print("  PASS: Write + read back verified")
 
 
+def test_download_file_range():
+    """GET /api/servers/:id/files/download — full download and byte ranges."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    api_put(f"/servers/{SERVER_ID}/files/content", json={
+        "path": "/tmp/bastion_download.txt",
+        "content": "0123456789",
+    })
+    url = f"{BASE_URL}/servers/{SERVER_ID}/files/download"
+    params = {"path": "/tmp/bastion_download.txt"}
+
+    resp = requests.get(url, headers=auth_headers(), params=params, timeout=15)
+    assert resp.status_code == 200, f"Download failed: {resp.status_code} {resp.text}"
+    assert resp.content == b"0123456789"
+    assert resp.headers.get("Accept-Ranges") == "bytes"
+
+    headers = {**auth_headers(), "Range": "bytes=2-5"}
+    resp = requests.get(url, headers=headers, params=params, timeout=15)
+    assert resp.status_code == 206, f"Expected 206, got {resp.status_code}"
+    assert resp.content == b"2345"
+    assert resp.headers.get("Content-Range") == "bytes 2-5/10"
+
+    headers = {**auth_headers(), "Range": "bytes=50-60"}
+    resp = requests.get(url, headers=headers, params=params, timeout=15)
+    assert resp.status_code == 416, f"Expected 416, got {resp.status_code}"
+    assert resp.headers.get("Content-Range") == "bytes */10"
+
+    resp = api_get(f"/servers/{SERVER_ID}/files/download", params={"path": "/tmp"})
+    assert resp.status_code == 400, f"Expected 400 for directory, got {resp.status_code}"
+    print("  PASS: Download with Range support")
+
+
+def test_upload_file_binary():
+    """POST /api/servers/:id/files/upload — binary bytes survive an upload/download round trip."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    payload = bytes(range(256)) * 64 + b"\x00\r\n\xff"
+    resp = requests.post(
+        f"{BASE_URL}/servers/{SERVER_ID}/files/upload",
+        headers=auth_headers(),
+        data={"path": "/tmp/"},
+        files={"file": ("bastion_upload.bin", payload, "application/octet-stream")},
+        timeout=30,
+    )
+    assert resp.status_code == 201, f"Upload failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data.get("path") == "/tmp/bastion_upload.bin", f"Unexpected path: {data}"
+    assert data.get("size") == len(payload), f"Size mismatch: {data}"
+
+    resp = requests.get(f"{BASE_URL}/servers/{SERVER_ID}/files/download", headers=auth_headers(),
+                        params={"path": "/tmp/bastion_upload.bin"}, timeout=15)
+    assert resp.status_code == 200, f"Download failed: {resp.status_code}"
+    assert resp.content == payload, "Binary content changed in transit"
+    assert resp.headers.get("Content-Length") == str(len(payload))
+    assert "bastion_upload.bin" in resp.headers.get("Content-Disposition", "")
+
+    resp = requests.post(f"{BASE_URL}/servers/{SERVER_ID}/files/upload", headers=auth_headers(),
+                         data={"path": "/tmp/x"}, timeout=15)
+    assert resp.status_code == 400, f"Expected 400 without file, got {resp.status_code}"
+    print("  PASS: Binary upload round trip")
+
+
+def _delete_file(path, recursive=False):
+    params = {"path": path}
+    if recursive:
+        params["recursive"] = "true"
+    return requests.delete(f"{BASE_URL}/servers/{SERVER_ID}/files", headers=auth_headers(), params=params, timeout=15)
+
+
+def test_file_operations():
+    """POST .../files/mkdir, rename, chmod, DELETE .../files — manage files, audited."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    base = f"/tmp/bastion-fileops-{uuid.uuid4().hex[:8]}"
+
+    resp = api_post(f"/servers/{SERVER_ID}/files/mkdir", json={"path": f"{base}/a/b"})
+    assert resp.status_code == 201, f"mkdir failed: {resp.status_code} {resp.text}"
+    resp = api_post(f"/servers/{SERVER_ID}/files/mkdir", json={"path": f"{base}/a/b"})
+    assert resp.status_code == 201, f"mkdir -p should accept an existing directory: {resp.status_code}"
+    resp = api_put(f"/servers/{SERVER_ID}/files/content", json={"path": f"{base}/a/file.txt", "content": "x"})
+    assert resp.status_code == 200, f"Write failed: {resp.text}"
+
+    resp = api_post(f"/servers/{SERVER_ID}/files/chmod", json={"path": f"{base}/a/file.txt", "mode": "0640"})
+    assert resp.status_code == 200, f"chmod failed: {resp.status_code} {resp.text}"
+    files = api_get(f"/servers/{SERVER_ID}/files", params={"path": f"{base}/a"}).json()["files"]
+    perms = {f["name"]: f["permissions"] for f in files}
+    assert perms.get("file.txt") == "-rw-r-----", f"Mode not applied: {perms}"
+    for mode in ["rwx", "999", "07777", "-1"]:
+        resp = api_post(f"/servers/{SERVER_ID}/files/chmod", json={"path": f"{base}/a/file.txt", "mode": mode})
+        assert resp.status_code == 400, f"Expected 400 for mode {mode!r}, got {resp.status_code}"
+
+    resp = api_post(f"/servers/{SERVER_ID}/files/rename", json={"from": f"{base}/a/file.txt", "to": f"{base}/a/moved.txt"})
+    assert resp.status_code == 200, f"Rename failed: {resp.status_code} {resp.text}"
+    resp = api_get(f"/servers/{SERVER_ID}/files/content", params={"path": f"{base}/a/moved.txt"})
+    assert resp.json()["content"] == "x", f"Renamed file unreadable: {resp.text}"
+    resp = api_post(f"/servers/{SERVER_ID}/files/rename", json={"from": f"{base}/a/moved.txt", "to": f"{base}/a/b"})
+    assert resp.status_code == 409, f"Expected 409 renaming onto an existing path, got {resp.status_code}"
+    resp = api_post(f"/servers/{SERVER_ID}/files/rename", json={"from": f"{base}/missing", "to": f"{base}/other"})
+    assert resp.status_code == 404, f"Expected 404 renaming a missing file, got {resp.status_code}"
+
+    resp = _delete_file(f"{base}/a")
+    assert resp.status_code == 409, f"Expected 409 deleting a non-empty directory, got {resp.status_code}"
+    resp = _delete_file(f"{base}/a/moved.txt")
+    assert resp.status_code == 200 and resp.json()["is_dir"] is False, f"Delete file failed: {resp.text}"
+    resp = _delete_file(f"{base}/a/moved.txt")
+    assert resp.status_code == 404, f"Expected 404 deleting a missing file, got {resp.status_code}"
+    resp = _delete_file(base, recursive=True)
+    assert resp.status_code == 200 and resp.json()["is_dir"] is True, f"Recursive delete failed: {resp.text}"
+    resp = api_get(f"/servers/{SERVER_ID}/files", params={"path": base})
+    assert resp.status_code != 200 or not resp.json().get("files"), f"Directory still present: {resp.text}"
+
+    for action in ["file.mkdir", "file.chmod", "file.rename", "file.delete"]:
+        logs = api_get("/audit", params={"action": action}).json()["logs"]
+        assert any(base in str(log.get("details")) for log in logs), f"{action} not audited for {base}"
+    print("  PASS: mkdir, chmod, rename and delete work and are audited")
+
+
+def test_file_operations_dangerous_paths():
+    """File operations refuse protected paths and shell metacharacters."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    for path in ["/", "/etc", "/usr/", "//var/./", "/tmp/../.."]:
+        resp = _delete_file(path, recursive=True)
+        assert resp.status_code == 403, f"Delete {path!r}: expected 403, got {resp.status_code}"
+        resp = api_post(f"/servers/{SERVER_ID}/files/chmod", json={"path": path, "mode": "0777"})
+        assert resp.status_code == 403, f"chmod {path!r}: expected 403, got {resp.status_code}"
+    resp = api_post(f"/servers/{SERVER_ID}/files/rename", json={"from": "/etc", "to": "/tmp/etc"})
+    assert resp.status_code == 403, f"Rename /etc: expected 403, got {resp.status_code}"
+    # Relative paths resolve against the login directory, so ../.. could be /
+    for path in ["/tmp/x; rm -rf /", "/tmp/$(id)", "", ".", "../..", "tmp/x"]:
+        resp = _delete_file(path, recursive=True)
+        assert resp.status_code == 400, f"Delete {path!r}: expected 400, got {resp.status_code}"
+        resp = api_post(f"/servers/{SERVER_ID}/files/mkdir", json={"path": path})
+        assert resp.status_code == 400, f"mkdir {path!r}: expected 400, got {resp.status_code}"
+    resp = api_get(f"/servers/{SERVER_ID}/files/search", params={"path": "../..", "name": "*"})
+    assert resp.status_code == 400, f"Search a relative path: expected 400, got {resp.status_code}"
+
+    # A symlinked directory does not reach a protected path either
+    base = f"/tmp/bastion-link-{uuid.uuid4().hex[:8]}"
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={"command": f"mkdir -p {base} && ln -s / {base}/root", "confirm": True})
+    assert resp.status_code == 200, f"Creating the symlink failed: {resp.status_code} {resp.text}"
+    try:
+        resp = _delete_file(f"{base}/root/etc", recursive=True)
+        assert resp.status_code == 403, f"Delete through a symlink: expected 403, got {resp.status_code}"
+        resp = api_post(f"/servers/{SERVER_ID}/files/chmod", json={"path": f"{base}/root", "mode": "0777"})
+        assert resp.status_code == 403, f"chmod a symlink to /: expected 403, got {resp.status_code}"
+        resp = _delete_file(f"{base}/root")
+        assert resp.status_code == 200 and resp.json()["is_dir"] is False, f"Deleting the symlink itself failed: {resp.text}"
+    finally:
+        _delete_file(base, recursive=True)
+    print("  PASS: Protected, relative and unsafe paths rejected")
+
+
+def test_search_files():
+    """GET /api/servers/:id/files/search — find files by name with size and mtime."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    base = f"/tmp/bastion-search-{uuid.uuid4().hex[:8]}"
+    api_post(f"/servers/{SERVER_ID}/files/mkdir", json={"path": f"{base}/sub/deeper"})
+    for rel, content in [("one.log", "a"), ("sub/two.log", "bb"), ("sub/deeper/three.log", "ccc"), ("sub/skip.txt", "x")]:
+        resp = api_put(f"/servers/{SERVER_ID}/files/content", json={"path": f"{base}/{rel}", "content": content})
+        assert resp.status_code == 200, f"Write {rel} failed: {resp.text}"
+    try:
+        resp = api_get(f"/servers/{SERVER_ID}/files/search", params={"path": base, "name": "*.log"})
+        assert resp.status_code == 200, f"Search failed: {resp.status_code} {resp.text}"
+        data = resp.json()
+        found = {f["path"]: f for f in data["files"]}
+        assert set(found) == {f"{base}/one.log", f"{base}/sub/two.log", f"{base}/sub/deeper/three.log"}, f"Unexpected results: {sorted(found)}"
+        entry = found[f"{base}/sub/deeper/three.log"]
+        assert entry["name"] == "three.log" and entry["size"] == 3, f"Bad entry: {entry}"
+        assert entry["modified"].startswith("20"), f"Bad mtime: {entry}"
+        assert data["truncated"] is False
+
+        resp = api_get(f"/servers/{SERVER_ID}/files/search", params={"path": base, "name": "*.log", "max": 2})
+        data = resp.json()
+        assert data["count"] == 2 and data["truncated"] is True, f"Expected 2 truncated results: {data}"
+
+        resp = api_get(f"/servers/{SERVER_ID}/files/search", params={"path": f"{base}/missing", "name": "*"})
+        assert resp.status_code == 404, f"Expected 404 for missing directory, got {resp.status_code}"
+    finally:
+        _delete_file(base, recursive=True)
+    print("  PASS: File search returns sized, timestamped matches")
+
+
+def test_search_files_rejects_malicious_input():
+    """GET /api/servers/:id/files/search — unsafe patterns and unbounded paths are refused."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    for name in ["-exec", "-delete", "*.log -exec rm {} ;", "$(id)", "`id`", "a;b", "a|b", ""]:
+        resp = api_get(f"/servers/{SERVER_ID}/files/search", params={"path": "/tmp", "name": name})
+        assert resp.status_code == 400, f"Name {name!r}: expected 400, got {resp.status_code}"
+    for path in ["", "/", "//", "-exec", "/tmp;id"]:
+        resp = api_get(f"/servers/{SERVER_ID}/files/search", params={"path": path, "name": "*.log"})
+        assert resp.status_code == 400, f"Path {path!r}: expected 400, got {resp.status_code}"
+    print("  PASS: Malicious search patterns rejected")
+
+
 def test_disk_usage():
     """GET /api/servers/:id/disk — disk usage info."""
     if not SERVER_ID:
@@ -89,7 +318,7 @@ def test_disk_usage():
 def cleanup():
     if SERVER_ID:
         # Clean up test file
-        api_post(f"/servers/{SERVER_ID}/exec", json={"command": "rm -f /tmp/bastion_test_file.txt"})
+        api_post(f"/servers/{SERVER_ID}/exec", json={"command": "rm -f /tmp/bastion_test_file.txt /tmp/bastion_upload.bin", "confirm": True})
         api_delete(f"/servers/{SERVER_ID}")
         print("  Cleanup: Server deleted")
 
@@ -98,8 +327,15 @@ if __name__ == "__main__":
     setup_server()
     test_list_files()
     test_list_root()
+    test_list_files_bounded()
     test_read_file()
     test_write_and_read_file()
+    test_download_file_range()
+    test_upload_file_binary()
+    test_file_operations()
+    test_file_operations_dangerous_paths()
+    test_search_files()
+    test_search_files_rejects_malicious_input()
     test_disk_usage()
     cleanup()
     print("\nALL FILE TESTS PASSED")
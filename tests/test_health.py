@@ -1,9 +1,18 @@
 """
-Test: Health endpoint (public, no auth required).
+Test: Health and /metrics endpoints (public, no auth required).
 """
+import os
+import re
+
 import requests
 from conftest import BASE_URL
 
+# Prometheus text exposition: a sample is name{labels} value
+METRIC_LINE = re.compile(
+    r'^[a-zA-Z_:][a-zA-Z0-9_:]*(\{([a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*",?)*\})? '
+    r'([-+]?[0-9.eE+-]+|[-+]Inf|NaN)$'
+)
+
 
 def test_health():
     """GET /api/health — should return status ok with DB check."""
@@ -19,6 +28,65 @@ def test_health():
     print(f"  PASS: Health OK — version={data['version']}, uptime={data['uptime']}")
 
 
+def test_metrics():
+    """GET /metrics — Prometheus exposition format with Bastion's own metrics."""
+    requests.get(f"{BASE_URL}/health", timeout=10)  # ensure an HTTP request is counted
+
+    headers = {}
+    if os.environ.get("METRICS_TOKEN"):
+        headers["Authorization"] = f"Bearer {os.environ['METRICS_TOKEN']}"
+    root = BASE_URL.rsplit("/api", 1)[0]
+    resp = requests.get(f"{root}/metrics", headers=headers, timeout=10)
+    assert resp.status_code == 200, f"Expected 200, got {resp.status_code}: {resp.text}"
+    assert resp.headers.get("Content-Type", "").startswith("text/plain; version=0.0.4"), \
+        f"Unexpected content type: {resp.headers.get('Content-Type')}"
+
+    types = {}
+    for line in resp.text.splitlines():
+        if line.startswith("# TYPE "):
+            _, _, name, kind = line.split(" ", 3)
+            assert kind in ("counter", "gauge"), f"Unexpected metric type: {line}"
+            types[name] = kind
+        elif line.startswith("# HELP ") or not line:
+            continue
+        else:
+            assert METRIC_LINE.match(line), f"Invalid sample line: {line!r}"
+            name = re.match(r"[a-zA-Z_:][a-zA-Z0-9_:]*", line).group(0)
+            assert name in types, f"Sample before its # TYPE line: {line!r}"
+
+    expected = {
+        "bastion_http_requests_total": "counter",
+        "bastion_ssh_pool_connections": "gauge",
+        "bastion_ssh_dials_total": "counter",
+        "bastion_monitors": "gauge",
+        "bastion_monitor_checks_total": "counter",
+        "bastion_alerts_firing": "gauge",
+        "bastion_metrics_collection_errors_total": "counter",
+    }
+    for name, kind in expected.items():
+        assert types.get(name) == kind, f"Missing {kind} {name}: {sorted(types)}"
+    assert re.search(r'^bastion_http_requests_total\{method="GET",path="/api/health",status="200"\} \d+',
+                     resp.text, re.M), "Health request not counted"
+    # Labels never carry SSH users, hosts or server names
+    assert re.search(r'^bastion_ssh_pool_connections\{route="direct"\} \d+', resp.text, re.M), "Pool gauge not split by route"
+    assert not re.search(r'\{[^}]*(host|server)="', resp.text), "Host or server label exposed"
+    assert "@" not in resp.text, "SSH user exposed in a label"
+    print(f"  PASS: /metrics renders {len(types)} metrics")
+
+
+def test_metrics_token():
+    """GET /metrics with a wrong bearer token is refused when METRICS_TOKEN is set."""
+    if not os.environ.get("METRICS_TOKEN"):
+        print("  SKIP: METRICS_TOKEN not set")
+        return
+    root = BASE_URL.rsplit("/api", 1)[0]
+    resp = requests.get(f"{root}/metrics", headers={"Authorization": "Bearer wrong"}, timeout=10)
+    assert resp.status_code == 401, f"Expected 401, got {resp.status_code}"
+    print("  PASS: wrong metrics token refused")
+
+
 if __name__ == "__main__":
     test_health()
+    test_metrics()
+    test_metrics_token()
     print("ALL HEALTH TESTS PASSED")
@@ -1,7 +1,17 @@
 """
 Test: Monitor (uptime + SSL) endpoints.
 """
-from conftest import api_get, api_post, api_delete
+import os
+import shutil
+import socket
+import ssl
+import subprocess
+import tempfile
+import threading
+import time
+from urllib.parse import urlparse
+
+from conftest import api_get, api_post, api_put, api_delete, BASE_URL
 
 MONITOR_ID = None
 
@@ -45,6 +55,73 @@ def test_get_monitor():
     print("  PASS: Monitor details retrieved")
 
 
+def test_update_expected_statuses():
+    """PUT /api/monitors/:id — accept a list of expected status codes."""
+    if not MONITOR_ID:
+        print("  SKIP: No monitor")
+        return
+    resp = api_put(f"/monitors/{MONITOR_ID}", json={"expected_statuses": [200, 204, 401]})
+    assert resp.status_code == 200, f"Update failed: {resp.status_code} {resp.text}"
+    assert resp.json()["expected_statuses"] == [200, 204, 401]
+
+    resp = api_put(f"/monitors/{MONITOR_ID}", json={"expected_statuses": [200, 700]})
+    assert resp.status_code == 400, f"Expected 400 for invalid code, got {resp.status_code}"
+
+    resp = api_post("/monitors", json={"name": "Bad Codes", "url": "http://example.com", "expected_statuses": [42]})
+    assert resp.status_code == 400, f"Expected 400 on create, got {resp.status_code}"
+    print("  PASS: Expected status list updated and validated")
+
+
+def test_monitor_url_validation():
+    """POST/PUT /api/monitors — URLs are validated and normalized per type."""
+    cases = [
+        ({"url": "tcp://db.internal"}, "host:port"),
+        ({"url": "http://example.com:70000/"}, "port"),
+        ({"url": "example.com", "type": "http"}, "http"),
+        ({"url": "no-such-host.invalid", "type": "ping"}, "resolve"),
+        ({"url": "http://example.com", "type": "smtp"}, "type"),
+    ]
+    for body, hint in cases:
+        resp = api_post("/monitors", json={"name": "Bad URL", **body})
+        assert resp.status_code == 400, f"Expected 400 for {body}, got {resp.status_code}"
+        assert hint in resp.json()["message"], f"Unhelpful message for {body}: {resp.text}"
+
+    resp = api_post("/monitors", json={"name": "Normalized TCP", "url": "tcp://LocalHost:5432"})
+    assert resp.status_code == 201, f"Create failed: {resp.status_code} {resp.text}"
+    created = resp.json()
+    try:
+        assert created["type"] == "tcp" and created["url"] == "tcp://localhost:5432", f"Not normalized: {created}"
+        resp = api_put(f"/monitors/{created['id']}", json={"url": "tcp://localhost"})
+        assert resp.status_code == 400, f"Expected 400 on update, got {resp.status_code}"
+        resp = api_put(f"/monitors/{created['id']}", json={"type": "smtp"})
+        assert resp.status_code == 400, f"Expected 400 for unsupported type, got {resp.status_code}"
+    finally:
+        api_delete(f"/monitors/{created['id']}")
+    print("  PASS: Monitor URLs validated per type")
+
+
+def test_tcp_and_ping_monitor_checks():
+    """POST /api/monitors/:id/check — tcp and ping monitors probe without HTTP."""
+    cases = [
+        ({"url": "tcp://89.47.113.196:8097"}, "up"),
+        ({"url": "tcp://127.0.0.1:1"}, "down"),
+        ({"url": "ping://127.0.0.1", "type": "ping"}, "up"),
+    ]
+    for body, want in cases:
+        resp = api_post("/monitors", json={"name": "Probe check", "timeout_ms": 3000, **body})
+        assert resp.status_code == 201, f"Create failed: {resp.status_code} {resp.text}"
+        monitor_id = resp.json()["id"]
+        try:
+            resp = api_post(f"/monitors/{monitor_id}/check")
+            assert resp.status_code == 200, f"Check failed: {resp.status_code} {resp.text}"
+            ping = resp.json()["ping"]
+            assert ping["status"] == want, f"{body['url']}: expected {want}, got {ping}"
+            assert not ping.get("status_code"), f"Non-HTTP check reported a status code: {ping}"
+        finally:
+            api_delete(f"/monitors/{monitor_id}")
+    print("  PASS: TCP and ping monitors probe their targets")
+
+
 def test_toggle_monitor():
     """POST /api/monitors/:id/toggle — enable/disable."""
     if not MONITOR_ID:
@@ -55,6 +132,21 @@ def test_toggle_monitor():
     print("  PASS: Monitor toggled")
 
 
+def test_check_monitor_now():
+    """POST /api/monitors/:id/check — runs a check immediately, rate limited."""
+    if not MONITOR_ID:
+        print("  SKIP: No monitor created")
+        return
+    resp = api_post(f"/monitors/{MONITOR_ID}/check")
+    assert resp.status_code == 200, f"Check failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["ping"]["status"] in ["up", "down"], f"Unexpected ping: {data}"
+    assert data["monitor"]["last_checked_at"], f"Stats not updated: {data}"
+    resp = api_post(f"/monitors/{MONITOR_ID}/check")
+    assert resp.status_code == 429, f"Expected 429 on rapid re-check, got {resp.status_code}"
+    print(f"  PASS: Check now returned {data['ping']['status']} in {data['ping'].get('response_ms')}ms")
+
+
 def test_monitor_pings():
     """GET /api/monitors/:id/pings — get ping history."""
     if not MONITOR_ID:
@@ -65,6 +157,16 @@ def test_monitor_pings():
     print("  PASS: Monitor pings retrieved")
 
 
+def test_monitor_incidents():
+    """GET /api/monitors/incidents — down monitors and recent incidents."""
+    resp = api_get("/monitors/incidents", params={"limit": 5})
+    assert resp.status_code == 200, f"Incidents failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert isinstance(data.get("down"), list) and isinstance(data.get("recent"), list), f"Unexpected: {data}"
+    assert len(data["recent"]) <= 5
+    print(f"  PASS: {len(data['down'])} monitors down, {len(data['recent'])} recent incidents")
+
+
 def test_ssl_list():
     """GET /api/monitors/ssl — list SSL certificates."""
     resp = api_get("/monitors/ssl")
@@ -83,6 +185,161 @@ def test_ssl_check():
     print(f"  PASS: SSL check — github.com days_remaining={data['days_remaining']}")
 
 
+def _start_tls_server(days, workdir):
+    """Serve a self-signed certificate valid for `days` on 127.0.0.1; returns (server socket, port)."""
+    cert, key = os.path.join(workdir, f"{days}.crt"), os.path.join(workdir, f"{days}.key")
+    subprocess.run(["openssl", "req", "-x509", "-newkey", "rsa:2048", "-nodes", "-days", str(days),
+                    "-subj", "/CN=127.0.0.1", "-keyout", key, "-out", cert],
+                   check=True, capture_output=True)
+    return _serve_tls(cert, key)
+
+
+def _start_expired_tls_server(workdir):
+    """Serve a self-signed certificate that expired in 2020 on 127.0.0.1; returns (server socket, port)."""
+    # `openssl req` only takes a positive -days, so sign with `openssl ca`, which accepts explicit dates
+    cert, key, csr = (os.path.join(workdir, f"expired.{ext}") for ext in ("crt", "key", "csr"))
+    config = os.path.join(workdir, "ca.cnf")
+    with open(config, "w") as f:
+        f.write("[ca]\ndefault_ca = ca_default\n[ca_default]\n"
+                f"database = {workdir}/index.txt\nnew_certs_dir = {workdir}\nserial = {workdir}/serial\n"
+                "default_md = sha256\npolicy = policy_any\n[policy_any]\ncommonName = supplied\n")
+    open(os.path.join(workdir, "index.txt"), "w").close()
+    with open(os.path.join(workdir, "serial"), "w") as f:
+        f.write("01\n")
+    subprocess.run(["openssl", "req", "-new", "-newkey", "rsa:2048", "-nodes", "-subj", "/CN=127.0.0.1",
+                    "-keyout", key, "-out", csr], check=True, capture_output=True)
+    subprocess.run(["openssl", "ca", "-batch", "-config", config, "-selfsign", "-keyfile", key, "-in", csr,
+                    "-out", cert, "-startdate", "20200101000000Z", "-enddate", "20200201000000Z", "-notext"],
+                   check=True, capture_output=True)
+    return _serve_tls(cert, key)
+
+
+def _serve_tls(cert, key):
+    """Complete TLS handshakes with cert on 127.0.0.1 until the socket is closed; returns (server socket, port)."""
+    ctx = ssl.SSLContext(ssl.PROTOCOL_TLS_SERVER)
+    ctx.load_cert_chain(cert, key)
+    sock = socket.socket()
+    sock.bind(("127.0.0.1", 0))
+    sock.listen()
+
+    def serve():
+        while True:
+            try:
+                conn, _ = sock.accept()
+            except OSError:
+                return
+            try:
+                ctx.wrap_socket(conn, server_side=True).close()
+            except (OSError, ssl.SSLError):
+                conn.close()
+
+    threading.Thread(target=serve, daemon=True).start()
+    return sock, sock.getsockname()[1]
+
+
+def _check_all_ssl():
+    """POST check-all, waiting out the minimum interval between runs."""
+    resp = api_post("/monitors/ssl/check-all")
+    if resp.status_code == 429:
+        time.sleep(int(resp.headers["Retry-After"]))
+        resp = api_post("/monitors/ssl/check-all")
+    assert resp.status_code == 200, f"Check-all failed: {resp.status_code} {resp.text}"
+    return resp.json()
+
+
+def test_ssl_check_all():
+    """POST /api/monitors/ssl/check-all — every tracked cert, soonest expiry first."""
+    if urlparse(BASE_URL).hostname not in ("localhost", "127.0.0.1") or not shutil.which("openssl"):
+        # The TLS servers below are only reachable from a local backend
+        data = _check_all_ssl()
+        print(f"  PASS: Checked {data['total']} certificates (local TLS servers skipped)")
+        return
+
+    cert_ids = []
+    try:
+        with tempfile.TemporaryDirectory() as workdir:
+            soon, soon_port = _start_tls_server(3, workdir)
+            later, later_port = _start_tls_server(365, workdir)
+            domains = {f"127.0.0.1:{soon_port}": 2, f"127.0.0.1:{later_port}": 364}
+            for domain in domains:
+                resp = api_post("/monitors/ssl/check", json={"domain": domain})
+                assert resp.status_code == 200, f"Tracking {domain} failed: {resp.status_code} {resp.text}"
+                cert_ids.append(resp.json()["id"])
+
+            data = _check_all_ssl()
+            results = data["results"]
+            days = [r["days_remaining"] for r in results]
+            assert days == sorted(days), f"Not sorted by expiry: {days}"
+            ours = {r["domain"]: r for r in results if r["domain"] in domains}
+            for domain, expected in domains.items():
+                assert ours[domain]["days_remaining"] == expected, ours[domain]
+                assert not ours[domain].get("error"), ours[domain]
+            order = [r["domain"] for r in results]
+            assert order.index(f"127.0.0.1:{soon_port}") < order.index(f"127.0.0.1:{later_port}")
+
+            # Back-to-back runs are refused
+            resp = api_post("/monitors/ssl/check-all")
+            assert resp.status_code == 429, f"Expected 429 for an immediate rerun, got {resp.status_code}"
+            assert int(resp.headers["Retry-After"]) > 0
+
+            # Once the hosts are gone their dial errors are reported with the last known expiry
+            soon.close()
+            later.close()
+            data = _check_all_ssl()
+            ours = {r["domain"]: r for r in data["results"] if r["domain"] in domains}
+            for domain, expected in domains.items():
+                assert ours[domain].get("error"), f"Expected a dial error for {domain}: {ours[domain]}"
+                assert ours[domain]["days_remaining"] == expected
+            assert data["failed"] >= 2
+    finally:
+        for cert_id in cert_ids:
+            resp = api_delete(f"/monitors/ssl/{cert_id}")
+            assert resp.status_code == 200, f"Delete cert failed: {resp.status_code} {resp.text}"
+
+    resp = api_get("/monitors/ssl")
+    remaining = [c["domain"] for c in resp.json()["ssl_certs"]]
+    assert not any(d in remaining for d in domains), f"Test certificates left behind: {remaining}"
+    print(f"  PASS: {data['total']} certificates checked, soonest expiry first, dial errors reported")
+
+
+def test_ssl_expired_alert():
+    """An expired (and self-signed-chain) certificate opens one critical alert."""
+    if urlparse(BASE_URL).hostname not in ("localhost", "127.0.0.1") or not shutil.which("openssl"):
+        # The expired TLS server below is only reachable from a local backend
+        print("  SKIP: Expired certificate alert needs a local backend and openssl")
+        return
+
+    with tempfile.TemporaryDirectory() as workdir:
+        server, port = _start_expired_tls_server(workdir)
+        domain = f"127.0.0.1:{port}"
+        cert_id = None
+        try:
+            resp = api_post("/monitors/ssl/check", json={"domain": f"https://{domain}/"})
+            assert resp.status_code == 200, f"SSL check failed: {resp.status_code} {resp.text}"
+            data = resp.json()
+            cert_id = data["id"]
+            assert data["domain"] == domain, data
+            assert data["days_remaining"] < 0, f"Expected expired cert: {data}"
+            assert data["is_valid"] is False and data["verify_error"], data
+            alert_id = data["alert_id"]
+            assert alert_id, f"No expiry alert opened: {data}"
+
+            # Re-checking on demand keeps the same open alert
+            resp = api_post(f"/monitors/ssl/{cert_id}/check")
+            assert resp.status_code == 200, f"Recheck failed: {resp.status_code} {resp.text}"
+            assert resp.json()["alert_id"] == alert_id, "Recheck opened a duplicate alert"
+
+            alerts = api_get("/alerts", params={"status": "firing"}).json()["alerts"]
+            matched = [a for a in alerts if a["id"] == alert_id]
+            assert matched and matched[0]["severity"] == "critical", f"Alert not firing as critical: {matched}"
+            assert sum(domain in a["message"] for a in alerts) == 1
+        finally:
+            server.close()
+            if cert_id:
+                api_delete(f"/monitors/ssl/{cert_id}")
+    print("  PASS: Expired certificate raised a single critical alert")
+
+
 def test_delete_monitor():
     """DELETE /api/monitors/:id — delete monitor."""
     if not MONITOR_ID:
@@ -97,9 +354,16 @@ if __name__ == "__main__":
     test_create_monitor()
     test_list_monitors()
     test_get_monitor()
+    test_update_expected_statuses()
+    test_monitor_url_validation()
+    test_tcp_and_ping_monitor_checks()
     test_toggle_monitor()
+    test_check_monitor_now()
     test_monitor_pings()
+    test_monitor_incidents()
     test_ssl_list()
     test_ssl_check()
+    test_ssl_check_all()
+    test_ssl_expired_alert()
     test_delete_monitor()
     print("\nALL MONITOR TESTS PASSED")
@@ -12,6 +12,18 @@ def test_ops_overview():
     print(f"  PASS: Ops overview — keys: {list(data.keys())}")
 
 
+def test_ops_overview_cached():
+    """GET /api/ops/overview — a second call within the TTL is served from cache."""
+    first = api_get("/ops/overview", params={"refresh": "true"})
+    assert first.status_code == 200, f"Ops overview failed: {first.status_code} {first.text}"
+    assert first.headers.get("X-Cache") == "MISS", f"refresh=true served from cache: {first.headers}"
+
+    second = api_get("/ops/overview")
+    assert second.headers.get("X-Cache") == "HIT", f"Second call hit the ops backend: {second.headers}"
+    assert second.json() == first.json(), "Cached overview differs from fetched overview"
+    print("  PASS: Ops overview cached between calls")
+
+
 def test_sre_events():
     """GET /api/ops/sre/events — SRE events."""
     resp = api_get("/ops/sre/events")
@@ -35,6 +47,7 @@ def test_reviews():
 
 if __name__ == "__main__":
     test_ops_overview()
+    test_ops_overview_cached()
     test_sre_events()
     test_support_tickets()
     test_reviews()
@@ -1,7 +1,10 @@
 """
 Test: Process and service management endpoints.
 """
-from conftest import api_get, api_post, api_delete, SSH_HOST, SSH_USER, SSH_PASS
+import json
+
+import requests
+from conftest import api_get, api_post, api_put, api_delete, get_tokens, role_headers, BASE_URL, SSH_HOST, SSH_USER, SSH_PASS
 
 SERVER_ID = None
 
@@ -33,8 +36,100 @@ def test_list_processes():
     print(f"  PASS: Listed {len(procs)} processes")
 
 
+def test_process_tree():
+    """GET /api/servers/:id/processes?format=tree — processes nested by PPID."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/processes", params={"format": "tree"})
+    assert resp.status_code == 200, f"Process tree failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["format"] == "tree"
+    roots = data["processes"]
+    assert isinstance(roots, list) and roots, "Tree has no roots"
+
+    seen = set()
+
+    def walk(node, parent):
+        assert node["pid"] not in seen, f"PID {node['pid']} appears twice"
+        seen.add(node["pid"])
+        if parent is not None:
+            assert node["ppid"] == parent["pid"], f"PID {node['pid']} nested under the wrong parent"
+        for child in node["children"]:
+            walk(child, node)
+
+    for root in roots:
+        walk(root, None)
+    assert len(seen) == data["count"], f"Tree holds {len(seen)} processes, count says {data['count']}"
+
+    # Every root's parent is absent from the listing (init, kthreadd, orphans)
+    for root in roots:
+        assert root["ppid"] not in seen, f"Root {root['pid']} has parent {root['ppid']} in the list"
+
+    resp = api_get(f"/servers/{SERVER_ID}/processes")
+    assert resp.status_code == 200 and "format" not in resp.json(), "Flat list should stay the default"
+    resp = api_get(f"/servers/{SERVER_ID}/processes", params={"format": "bogus"})
+    assert resp.status_code == 400
+    print(f"  PASS: Process tree with {data['count']} processes under {len(roots)} roots")
+
+
+def test_kill_signal_names():
+    """POST /api/servers/:id/processes/:pid/kill — signal names map to numbers."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    for signal, number in [("TERM", 15), ("sigkill", 9), ("HUP", 1), ("INT", 2), ("0", 0)]:
+        resp = api_post(f"/servers/{SERVER_ID}/processes/999999/kill", json={"signal": signal})
+        # No such PID, so kill itself fails; the signal was still accepted
+        assert resp.status_code != 400, f"Signal {signal} rejected: {resp.text}"
+        assert f"Signal {number} " in resp.text or "Failed to kill" in resp.text, resp.text
+
+    for signal in ["FOO", "-9", "65", "15; reboot"]:
+        resp = api_post(f"/servers/{SERVER_ID}/processes/1/kill", json={"signal": signal})
+        assert resp.status_code == 400, f"Signal {signal!r} should be rejected: {resp.status_code}"
+    resp = api_post(f"/servers/{SERVER_ID}/processes/1;reboot/kill", json={"signal": "TERM"})
+    assert resp.status_code == 400, f"Non-numeric PID should be rejected: {resp.status_code}"
+    print("  PASS: Signal names mapped and invalid signals rejected")
+
+
+def test_kill_by_name():
+    """POST /api/servers/:id/processes/kill-by-name — pgrep -x resolution."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    # A copy of sleep under a unique name, so nothing else on the host matches
+    name = "bastionslp"
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={
+        "command": f"cp \"$(command -v sleep)\" /tmp/{name} && for i in 1 2; do (setsid /tmp/{name} 300 >/dev/null 2>&1 &); done; sleep 1",
+        "confirm": True,
+    })
+    assert resp.status_code == 200, f"Starting processes failed: {resp.status_code} {resp.text}"
+
+    # -x matches whole names only
+    resp = api_post(f"/servers/{SERVER_ID}/processes/kill-by-name", json={"name": name[:-1]})
+    assert resp.status_code == 404, f"Prefix should not match: {resp.status_code} {resp.text}"
+
+    resp = api_post(f"/servers/{SERVER_ID}/processes/kill-by-name", json={"name": name, "signal": "KILL"})
+    assert resp.status_code == 200, f"Kill by name failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["signal"] == 9
+    assert len(data["pids"]) == 2 and all(isinstance(p, int) for p in data["pids"]), data
+
+    resp = api_post(f"/servers/{SERVER_ID}/processes/kill-by-name", json={"name": name})
+    assert resp.status_code == 404, f"Killed processes still found: {resp.status_code} {resp.text}"
+
+    for bad in ["", "a;reboot", "-f", "$(id)", "x" * 16]:
+        resp = api_post(f"/servers/{SERVER_ID}/processes/kill-by-name", json={"name": bad})
+        assert resp.status_code == 400, f"Name {bad!r} should be rejected: {resp.status_code}"
+    resp = api_post(f"/servers/{SERVER_ID}/processes/kill-by-name", json={"name": name, "signal": "FOO"})
+    assert resp.status_code == 400
+
+    api_post(f"/servers/{SERVER_ID}/exec", json={"command": f"rm -f /tmp/{name}", "confirm": True})
+    print(f"  PASS: Killed PIDs {data['pids']} by name")
+
+
 def test_list_services():
-    """GET /api/servers/:id/services — list systemd services."""
+    """GET /api/servers/:id/services — list services (systemd/OpenRC/runit)."""
     if not SERVER_ID:
         print("  SKIP: No server")
         return
@@ -43,7 +138,114 @@ def test_list_services():
     data = resp.json()
     services = data.get("services", data)
     assert isinstance(services, list)
-    print(f"  PASS: Listed {len(services)} services")
+    assert data.get("init_system") in ["systemd", "openrc", "runit"], f"Unexpected init system: {data.get('init_system')}"
+    print(f"  PASS: Listed {len(services)} {data['init_system']} services")
+
+
+def test_service_status():
+    """GET /api/servers/:id/services/:name/status — systemctl show detail."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/services/bastion-no-such-unit/status")
+    if resp.status_code == 501:
+        print(f"  SKIP: {resp.json()['message']}")
+        return
+    assert resp.status_code == 404, f"Missing unit should 404: {resp.status_code} {resp.text}"
+
+    for bad in ["-H", "a;reboot", "$(id)"]:
+        resp = api_get(f"/servers/{SERVER_ID}/services/{bad}/status")
+        assert resp.status_code == 400, f"Name {bad!r} should be rejected: {resp.status_code}"
+
+    services = api_get(f"/servers/{SERVER_ID}/services").json().get("services", [])
+    running = [s for s in services if s.get("sub") == "running"]
+    if not running:
+        print("  SKIP: No running services")
+        return
+    name = running[0]["name"]
+    resp = api_get(f"/servers/{SERVER_ID}/services/{name}/status")
+    assert resp.status_code == 200, f"Service status failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert data["load_state"] == "loaded" and data["active_state"] == "active", data
+    assert data["sub_state"] == "running"
+    assert data["properties"]["Id"].startswith(name), data["properties"].get("Id")
+    assert data["main_pid"] is None or data["main_pid"] > 0
+    assert data["restarts"] is None or data["restarts"] >= 0
+    assert isinstance(data["logs"], list)
+    assert any(k.startswith("Exec") for k in data["properties"]), "Admin should see Exec* properties"
+
+    # Environment and command lines can carry credentials, so viewers do not get them
+    viewer, viewer_id = role_headers("viewer")
+    try:
+        resp = requests.get(f"{BASE_URL}/servers/{SERVER_ID}/services/{name}/status", headers=viewer, timeout=15)
+        assert resp.status_code == 200, f"Viewer service status failed: {resp.status_code} {resp.text}"
+        hidden = [k for k in resp.json()["properties"] if k.startswith("Exec") or k.startswith("Environment")]
+        assert not hidden, f"Viewer sees sensitive properties: {hidden}"
+    finally:
+        api_put(f"/users/{viewer_id}", json={"disabled": True})
+    print(f"  PASS: {name} is {data['sub_state']}, PID {data['main_pid']}, {data['restarts']} restarts")
+
+
+def test_service_logs():
+    """GET /api/servers/:id/services/:name/logs — journalctl for one unit."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    base = f"/servers/{SERVER_ID}/services"
+    for params in [{"lines": "0"}, {"lines": "abc"}, {"lines": "10001"}, {"lines": "5;id"},
+                   {"since": "yesterday"}, {"since": "-1h"}, {"since": "1h; id"}, {"since": "2026-13-01"}]:
+        resp = api_get(f"{base}/ssh/logs", params=params)
+        assert resp.status_code == 400, f"{params} should be rejected: {resp.status_code} {resp.text}"
+    resp = api_get(f"{base}/-f/logs")
+    assert resp.status_code == 400, f"Option-like name should be rejected: {resp.status_code}"
+    resp = api_get(f"{base}/ssh/logs", params={"follow": "true"})
+    assert resp.status_code == 426, f"follow without a WebSocket should 426: {resp.status_code}"
+
+    resp = api_get(f"{base}/ssh/logs", params={"lines": "20", "since": "7d"})
+    if resp.status_code == 501:
+        print(f"  SKIP: {resp.json()['message']}")
+        return
+    assert resp.status_code == 200, f"Service logs failed: {resp.status_code} {resp.text}"
+    data = resp.json()
+    assert isinstance(data["logs"], str) and isinstance(data["entries"], list)
+    assert data["count"] == len(data["entries"])
+    for entry in data["entries"]:
+        assert "message" in entry
+        if "timestamp" in entry:
+            assert entry["identifier"], entry
+    print(f"  PASS: Read {data['count']} journal entries; bad lines/since rejected")
+
+
+def test_service_logs_follow():
+    """GET /api/servers/:id/services/:name/logs?follow=true — WebSocket journal stream."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    if api_get(f"/servers/{SERVER_ID}/services/ssh/logs", params={"lines": "1"}).status_code == 501:
+        print("  SKIP: No systemd journal")
+        return
+    try:
+        import websocket
+    except ImportError:
+        print("  SKIP: websocket-client is not installed")
+        return
+
+    token, _ = get_tokens()
+    ws_url = BASE_URL.replace("http", "ws", 1) + f"/servers/{SERVER_ID}/services/ssh/logs?follow=true&lines=5&token={token}"
+    ws = websocket.create_connection(ws_url, timeout=15)
+    try:
+        ws.send(json.dumps({"action": "stop"}))
+        frames = []
+        while True:
+            frame = json.loads(ws.recv())
+            frames.append(frame)
+            if frame["type"] in ("end", "error"):
+                break
+        assert frames[-1] == {"type": "end", "data": "cancelled"}, f"Unexpected last frame: {frames[-1]}"
+        assert all(f["type"] == "line" for f in frames[:-1]), frames
+    finally:
+        ws.close()
+    print(f"  PASS: Followed journal, {len(frames) - 1} lines before stop")
 
 
 def test_network_connections():
@@ -68,7 +270,13 @@ def cleanup():
 if __name__ == "__main__":
     setup_server()
     test_list_processes()
+    test_process_tree()
+    test_kill_signal_names()
+    test_kill_by_name()
     test_list_services()
+    test_service_status()
+    test_service_logs()
+    test_service_logs_follow()
     test_network_connections()
     cleanup()
     print("\nALL PROCESS TESTS PASSED")
@@ -0,0 +1,111 @@
+"""
+Test: Per-server secret store and injection into commands.
+"""
+from conftest import api_get, api_post, api_put, api_delete, SSH_HOST, SSH_USER, SSH_PASS
+
+SERVER_ID = None
+SECRET_VALUE = "s3cr3t value with 'quotes'"
+
+
+def setup_server():
+    global SERVER_ID
+    resp = api_post("/servers", json={
+        "name": "Secrets Test Server",
+        "host": SSH_HOST, "port": 22,
+        "username": SSH_USER, "password": SSH_PASS,
+        "auth_type": "password",
+    })
+    data = resp.json()
+    server = data.get("server", data)
+    SERVER_ID = server.get("id") or server.get("ID")
+    print(f"  Setup: Server id={SERVER_ID}")
+
+
+def test_create_secret():
+    """POST /api/servers/:id/secrets — value is never echoed back."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_post(f"/servers/{SERVER_ID}/secrets", json={"key": "BASTION_TEST_SECRET", "value": SECRET_VALUE})
+    assert resp.status_code == 201, f"Create secret failed: {resp.status_code} {resp.text}"
+    assert SECRET_VALUE not in resp.text, "Secret value returned in plaintext"
+
+    resp = api_post(f"/servers/{SERVER_ID}/secrets", json={"key": "BASTION_TEST_SECRET", "value": "x"})
+    assert resp.status_code == 409, f"Expected 409 for duplicate, got {resp.status_code}"
+    resp = api_post(f"/servers/{SERVER_ID}/secrets", json={"key": "bad-key;rm", "value": "x"})
+    assert resp.status_code == 400, f"Expected 400 for invalid key, got {resp.status_code}"
+    print("  PASS: Secret created")
+
+
+def test_list_secrets():
+    """GET /api/servers/:id/secrets — keys only."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_get(f"/servers/{SERVER_ID}/secrets")
+    assert resp.status_code == 200, f"List secrets failed: {resp.status_code} {resp.text}"
+    keys = [s["key"] for s in resp.json()["secrets"]]
+    assert "BASTION_TEST_SECRET" in keys
+    assert SECRET_VALUE not in resp.text, "Secret value returned in plaintext"
+    print(f"  PASS: Listed {len(keys)} secrets")
+
+
+def test_exec_with_secret():
+    """POST /api/servers/:id/exec with env — secret injected and access audited."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={
+        "command": "printf '%s' \"$BASTION_TEST_SECRET\"",
+        "env": ["BASTION_TEST_SECRET"],
+    })
+    assert resp.status_code == 200, f"Exec failed: {resp.status_code} {resp.text}"
+    assert resp.json()["output"] == SECRET_VALUE, f"Secret not injected: {resp.json()['output']!r}"
+
+    # The value reaches the environment but not the shell's command line
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={
+        "command": "tr '\\0' ' ' < /proc/$$/cmdline",
+        "env": ["BASTION_TEST_SECRET"],
+        "confirm": True,
+    })
+    assert resp.status_code == 200, f"Exec failed: {resp.status_code} {resp.text}"
+    assert SECRET_VALUE not in resp.json()["output"], f"Secret on the command line: {resp.json()['output']!r}"
+
+    resp = api_post(f"/servers/{SERVER_ID}/exec", json={"command": "true", "env": ["MISSING_SECRET"]})
+    assert resp.status_code == 400, f"Expected 400 for missing secret, got {resp.status_code}"
+
+    resp = api_get("/audit", params={"action": "secret.inject"})
+    assert any(l["target"] == SERVER_ID for l in resp.json()["logs"]), "Secret access not audited"
+    print("  PASS: Secret injected into command")
+
+
+def test_update_and_delete_secret():
+    """PUT/DELETE /api/servers/:id/secrets/:key."""
+    if not SERVER_ID:
+        print("  SKIP: No server")
+        return
+    resp = api_put(f"/servers/{SERVER_ID}/secrets/BASTION_TEST_SECRET", json={"value": "rotated"})
+    assert resp.status_code == 200, f"Update failed: {resp.status_code} {resp.text}"
+    assert "rotated" not in resp.text
+
+    resp = api_delete(f"/servers/{SERVER_ID}/secrets/BASTION_TEST_SECRET")
+    assert resp.status_code == 200, f"Delete failed: {resp.status_code} {resp.text}"
+    resp = api_delete(f"/servers/{SERVER_ID}/secrets/BASTION_TEST_SECRET")
+    assert resp.status_code == 404
+    print("  PASS: Secret rotated and deleted")
+
+
+def cleanup():
+    if SERVER_ID:
+        api_delete(f"/servers/{SERVER_ID}")
+        print("  Cleanup: Server deleted")
+
+
+if __name__ == "__main__":
+    setup_server()
+    test_create_secret()
+    test_list_secrets()
+    test_exec_with_secret()
+    test_update_and_delete_secret()
+    cleanup()
+    print("\nALL SECRET TESTS PASSED")